@@ -0,0 +1,423 @@
+// Package bot is a headless gocraft client for scripts: companions, server
+// stress tests and CI scenarios. A Bot logs in like a player, keeps a
+// world.World in sync with the server and sends its position ten times a
+// second.
+//
+//	b, err := bot.Dial("localhost:8421", bot.Options{Name: "bob"})
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	defer b.Close()
+//	b.MoveTo(mgl32.Vec3{0, 40, 0})
+//	b.Place(world.Vec3{X: 0, Y: 39, Z: 0}, world.Brick)
+package bot
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/rpc"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-gl/mathgl/mgl32"
+	gocraft "github.com/icexin/gocraft-server/client"
+	"github.com/icexin/gocraft-server/proto"
+	"github.com/icexin/gocraft/internal/protocol"
+	"github.com/icexin/gocraft/world"
+)
+
+const (
+	defaultPort    = ":8421"
+	dialTimeout    = 5 * time.Second
+	updateInterval = time.Second / 10
+	// chunks kept by the bot world
+	worldCacheSize = 256
+)
+
+var (
+	// ErrUnsupported is returned when the server doesn't implement a call.
+	ErrUnsupported = errors.New("not supported by the server")
+	// ErrClosed is returned after Close or a kick.
+	ErrClosed = errors.New("bot closed")
+)
+
+// Options are the login options of a bot.
+type Options struct {
+	Name  string
+	Token string
+	// TLS connects with tls when not nil
+	TLS *tls.Config
+}
+
+// Bot is a connected player without a window, its methods are safe for
+// concurrent use.
+type Bot struct {
+	client *gocraft.Client
+	conn   net.Conn
+	world  *world.World
+	caps   map[string]bool // nil for servers without handshake
+
+	mutex   sync.Mutex
+	state   proto.PlayerState
+	players map[int32]proto.PlayerState
+	closed  bool
+	kicked  string
+
+	done chan struct{}
+}
+
+// Dial connects a bot to the server at addr, host[:port].
+func Dial(addr string, opt Options) (*Bot, error) {
+	if !strings.Contains(addr, ":") {
+		addr += defaultPort
+	}
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	var (
+		conn net.Conn
+		err  error
+	)
+	if opt.TLS != nil {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, opt.TLS)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	b := &Bot{
+		conn:    conn,
+		players: make(map[int32]proto.PlayerState),
+		done:    make(chan struct{}),
+	}
+	b.world = world.New(worldCacheSize, source{b}, nil)
+	b.client = gocraft.NewClient()
+	b.client.RegisterService("Block", &blockService{b})
+	b.client.RegisterService("Player", &playerService{b})
+	b.client.Start(conn)
+	if err := b.hello(); err != nil {
+		b.Close()
+		return nil, err
+	}
+	if err := b.login(opt); err != nil {
+		b.Close()
+		return nil, err
+	}
+	go b.updateLoop()
+	return b, nil
+}
+
+func isMethodNotFound(err error) bool {
+	_, ok := err.(rpc.ServerError)
+	return ok && strings.HasPrefix(err.Error(), "rpc: can't find")
+}
+
+func (b *Bot) hello() error {
+	req := &protocol.HelloRequest{
+		Id:      b.client.ClientId,
+		Version: protocol.Version,
+	}
+	rep := new(protocol.HelloResponse)
+	err := b.client.Call("Player.Hello", req, rep)
+	if isMethodNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if protocol.Version < rep.MinVersion {
+		return errors.New("bot protocol is too old for the server")
+	}
+	b.caps = make(map[string]bool)
+	for _, name := range rep.Caps {
+		b.caps[name] = true
+	}
+	return nil
+}
+
+func (b *Bot) login(opt Options) error {
+	if opt.Name == "" && opt.Token == "" {
+		return nil
+	}
+	req := &protocol.LoginRequest{
+		Id:    b.client.ClientId,
+		Name:  opt.Name,
+		Token: opt.Token,
+	}
+	err := b.client.Call("Player.Login", req, new(protocol.LoginResponse))
+	if isMethodNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// Close disconnects the bot.
+func (b *Bot) Close() error {
+	b.mutex.Lock()
+	if b.closed {
+		b.mutex.Unlock()
+		return nil
+	}
+	b.closed = true
+	close(b.done)
+	b.mutex.Unlock()
+	b.world.Close()
+	if b.client.Client != nil {
+		b.client.Close()
+	}
+	return b.conn.Close()
+}
+
+// Done is closed when the bot is closed or kicked.
+func (b *Bot) Done() <-chan struct{} {
+	return b.done
+}
+
+// Kicked returns the reason the server kicked the bot, empty if it wasn't.
+func (b *Bot) Kicked() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.kicked
+}
+
+// Id returns the player id given by the server.
+func (b *Bot) Id() int32 {
+	return b.client.ClientId
+}
+
+func (b *Bot) call(method string, req, rep interface{}) error {
+	b.mutex.Lock()
+	closed := b.closed
+	b.mutex.Unlock()
+	if closed {
+		return ErrClosed
+	}
+	err := b.client.Call(method, req, rep)
+	if isMethodNotFound(err) {
+		return ErrUnsupported
+	}
+	return err
+}
+
+func (b *Bot) updateLoop() {
+	tick := time.NewTicker(updateInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-b.done:
+			return
+		case <-tick.C:
+			b.sendState()
+		}
+	}
+}
+
+func (b *Bot) sendState() error {
+	b.mutex.Lock()
+	req := &proto.UpdateStateRequest{
+		Id:    b.client.ClientId,
+		State: b.state,
+	}
+	b.mutex.Unlock()
+	rep := new(protocol.UpdateStateResponse)
+	err := b.call("Player.UpdateState", req, rep)
+	if err != nil {
+		return err
+	}
+	b.mutex.Lock()
+	b.players = rep.Players
+	delete(b.players, b.client.ClientId)
+	b.mutex.Unlock()
+	return nil
+}
+
+// Position returns the position of the bot.
+func (b *Bot) Position() mgl32.Vec3 {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return mgl32.Vec3{b.state.X, b.state.Y, b.state.Z}
+}
+
+// MoveTo puts the bot at pos and tells the server at once.
+func (b *Bot) MoveTo(pos mgl32.Vec3) error {
+	b.mutex.Lock()
+	b.state.X, b.state.Y, b.state.Z = pos.X(), pos.Y(), pos.Z()
+	b.mutex.Unlock()
+	return b.sendState()
+}
+
+// Walk moves the bot toward target at speed blocks per second, sliding
+// along the blocks in the way, and returns where it stopped.
+func (b *Bot) Walk(target mgl32.Vec3, speed float32) mgl32.Vec3 {
+	step := speed * float32(updateInterval.Seconds())
+	pos := b.Position()
+	for {
+		d := target.Sub(pos)
+		if d.Len() <= step {
+			pos = target
+		} else {
+			pos = pos.Add(d.Normalize().Mul(step))
+		}
+		b.Chunk(world.NearBlock(pos).Chunkid())
+		next, _ := b.world.Collide(pos)
+		stuck := next.ApproxEqual(b.Position())
+		if b.MoveTo(next) != nil || stuck || next.ApproxEqual(target) {
+			return next
+		}
+		pos = next
+		time.Sleep(updateInterval)
+	}
+}
+
+// Look turns the bot, rx is the yaw and ry the pitch in degrees.
+func (b *Bot) Look(rx, ry float32) error {
+	b.mutex.Lock()
+	b.state.Rx, b.state.Ry = rx, ry
+	b.mutex.Unlock()
+	return b.sendState()
+}
+
+// Players returns the other players seen at the last update.
+func (b *Bot) Players() map[int32]proto.PlayerState {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	players := make(map[int32]proto.PlayerState, len(b.players))
+	for id, s := range b.players {
+		players[id] = s
+	}
+	return players
+}
+
+// Chunk returns the chunk id with the server changes applied, it waits for
+// the chunk to load. A chunk evicted while loading is asked for again, the
+// chunk returned once the bot is closed may not be loaded.
+func (b *Bot) Chunk(id world.Vec3) *world.Chunk {
+	for {
+		chunk := b.world.Chunk(id)
+		select {
+		case <-chunk.Done():
+		case <-b.done:
+			return chunk
+		}
+		if chunk.Loaded() {
+			return chunk
+		}
+	}
+}
+
+// Block returns the block at id, loading its chunk if needed.
+func (b *Bot) Block(id world.Vec3) int {
+	return b.Chunk(id.Chunkid()).Block(id)
+}
+
+// Ground returns the y of the top of the ground at x, z, leaving out plants
+// and clouds.
+func (b *Bot) Ground(x, z int) int {
+	cid := world.Vec3{X: x, Y: 0, Z: z}.Chunkid()
+	h := b.Chunk(cid).Heightmap()
+	return h.Height[x-cid.X*world.ChunkWidth][z-cid.Z*world.ChunkWidth]
+}
+
+// World returns the world seen by the bot, for the queries not covered by Bot.
+func (b *Bot) World() *world.World {
+	return b.world
+}
+
+// Place puts a block of type tp at id.
+func (b *Bot) Place(id world.Vec3, tp int) error {
+	b.Chunk(id.Chunkid())
+	cid := id.Chunkid()
+	req := &proto.UpdateBlockRequest{
+		Id: b.client.ClientId,
+		P:  cid.X,
+		Q:  cid.Z,
+		X:  id.X,
+		Y:  id.Y,
+		Z:  id.Z,
+		W:  tp,
+	}
+	err := b.call("Block.UpdateBlock", req, new(proto.UpdateBlockResponse))
+	if err != nil {
+		return err
+	}
+	b.world.UpdateBlock(id, tp)
+	return nil
+}
+
+// Dig removes the block at id at once, the bot doesn't wait the mining time.
+func (b *Bot) Dig(id world.Vec3) error {
+	return b.Place(id, 0)
+}
+
+// Chat sends a chat message, ErrUnsupported if the server has no chat.
+func (b *Bot) Chat(text string) error {
+	if b.caps != nil && !b.caps[protocol.CapChat] {
+		return ErrUnsupported
+	}
+	req := &protocol.ChatRequest{
+		Id:   b.client.ClientId,
+		Text: text,
+	}
+	return b.call("Player.Chat", req, new(protocol.ChatResponse))
+}
+
+// source loads the chunks from the server only, a bot keeps nothing.
+type source struct {
+	b *Bot
+}
+
+func (s source) RangeBlocks(id world.Vec3, f func(bid world.Vec3, w int)) error {
+	return nil
+}
+
+func (s source) UpdateBlock(id world.Vec3, w int) error {
+	return nil
+}
+
+func (s source) FetchChunk(id world.Vec3, f func(bid world.Vec3, w int)) error {
+	req := &proto.FetchChunkRequest{
+		P: id.X,
+		Q: id.Z,
+	}
+	rep := new(proto.FetchChunkResponse)
+	if err := s.b.call("Block.FetchChunk", req, rep); err != nil {
+		return err
+	}
+	for _, block := range rep.Blocks {
+		f(world.Vec3{X: block[0], Y: block[1], Z: block[2]}, block[3])
+	}
+	return nil
+}
+
+type blockService struct {
+	b *Bot
+}
+
+func (s *blockService) UpdateBlock(req *proto.UpdateBlockRequest, rep *proto.UpdateBlockResponse) error {
+	s.b.world.UpdateBlock(world.Vec3{X: req.X, Y: req.Y, Z: req.Z}, req.W)
+	return nil
+}
+
+type playerService struct {
+	b *Bot
+}
+
+func (s *playerService) RemovePlayer(req *proto.RemovePlayerRequest, rep *proto.RemovePlayerResponse) error {
+	s.b.mutex.Lock()
+	delete(s.b.players, req.Id)
+	s.b.mutex.Unlock()
+	return nil
+}
+
+func (s *playerService) Kick(req *protocol.KickRequest, rep *protocol.KickResponse) error {
+	s.b.mutex.Lock()
+	s.b.kicked = req.Reason
+	s.b.mutex.Unlock()
+	go s.b.Close()
+	return nil
+}
+
+func (s *playerService) SetPermissions(req *protocol.SetPermissionsRequest, rep *protocol.SetPermissionsResponse) error {
+	return nil
+}
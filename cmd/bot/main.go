@@ -0,0 +1,158 @@
+// Command bot is an example of the bot package: it logs in, says hello,
+// builds a small marker and follows the nearest player. With -n it starts
+// that many bots wandering around, a cheap load test for a server.
+package main
+
+import (
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/icexin/gocraft/bot"
+	"github.com/icexin/gocraft/world"
+)
+
+var (
+	serverAddr = flag.String("s", "localhost:8421", "server address")
+	botName    = flag.String("name", "bot", "bot name, suffixed with a number when -n > 1")
+	botToken   = flag.String("token", "", "login token")
+	useTLS     = flag.Bool("tls", false, "connect with tls")
+	botCount   = flag.Int("n", 1, "number of bots, more than one wander instead of following")
+	duration   = flag.Duration("t", 0, "stop after this time, 0 runs until killed")
+)
+
+const (
+	walkSpeed = 4
+	// distance the follower keeps from the player
+	followDistance = 3
+)
+
+// feet returns the position standing on the ground at x, z.
+func feet(b *bot.Bot, x, z float32) mgl32.Vec3 {
+	bx, bz := int(math.Round(float64(x))), int(math.Round(float64(z)))
+	return mgl32.Vec3{x, float32(b.Ground(bx, bz) + 2), z}
+}
+
+// marker stacks three bricks next to the bot.
+func marker(b *bot.Bot) error {
+	pos := world.NearBlock(b.Position())
+	ground := b.Ground(pos.X+1, pos.Z)
+	for y := 1; y <= 3; y++ {
+		err := b.Place(world.Vec3{X: pos.X + 1, Y: ground + y, Z: pos.Z}, world.Brick)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func follow(b *bot.Bot, stop <-chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		case <-b.Done():
+			return
+		case <-time.After(time.Second / 2):
+		}
+		pos := b.Position()
+		var (
+			target mgl32.Vec3
+			found  bool
+		)
+		for _, p := range b.Players() {
+			ppos := mgl32.Vec3{p.X, p.Y, p.Z}
+			if !found || ppos.Sub(pos).Len() < target.Sub(pos).Len() {
+				target, found = ppos, true
+			}
+		}
+		if !found {
+			continue
+		}
+		d := target.Sub(pos)
+		rx := mgl32.RadToDeg(float32(math.Atan2(float64(d.Z()), float64(d.X()))))
+		ry := mgl32.RadToDeg(float32(math.Atan2(float64(d.Y()), math.Hypot(float64(d.X()), float64(d.Z())))))
+		b.Look(rx, ry)
+		if d.Len() > followDistance {
+			goal := pos.Add(d.Mul(1 - followDistance/d.Len()))
+			b.Walk(feet(b, goal.X(), goal.Z()), walkSpeed)
+		}
+	}
+}
+
+func wander(b *bot.Bot, stop <-chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		case <-b.Done():
+			return
+		default:
+		}
+		pos := b.Position()
+		angle := rand.Float64() * 2 * math.Pi
+		x := pos.X() + float32(8*math.Cos(angle))
+		z := pos.Z() + float32(8*math.Sin(angle))
+		b.Walk(feet(b, x, z), walkSpeed)
+	}
+}
+
+func run(name string, wg *sync.WaitGroup, stop <-chan struct{}) {
+	defer wg.Done()
+	opt := bot.Options{Name: name, Token: *botToken}
+	if *useTLS {
+		opt.TLS = &tls.Config{}
+	}
+	b, err := bot.Dial(*serverAddr, opt)
+	if err != nil {
+		log.Printf("%s: %s", name, err)
+		return
+	}
+	defer b.Close()
+	log.Printf("%s: connected as player %d", name, b.Id())
+
+	if err := b.MoveTo(feet(b, 0, 0)); err != nil {
+		log.Printf("%s: %s", name, err)
+		return
+	}
+	err = b.Chat(fmt.Sprintf("hello from %s", name))
+	if err != nil && err != bot.ErrUnsupported {
+		log.Printf("%s: chat:%s", name, err)
+	}
+	if *botCount > 1 {
+		wander(b, stop)
+		return
+	}
+	if err := marker(b); err != nil {
+		log.Printf("%s: place:%s", name, err)
+	}
+	log.Printf("%s: %d players around", name, len(b.Players()))
+	follow(b, stop)
+	if reason := b.Kicked(); reason != "" {
+		log.Printf("%s: kicked:%s", name, reason)
+	}
+}
+
+func main() {
+	flag.Parse()
+	stop := make(chan struct{})
+	if *duration > 0 {
+		time.AfterFunc(*duration, func() { close(stop) })
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < *botCount; i++ {
+		name := *botName
+		if *botCount > 1 {
+			name = fmt.Sprintf("%s%d", *botName, i)
+		}
+		wg.Add(1)
+		go run(name, &wg, stop)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,290 @@
+package game
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/icexin/gocraft/net"
+	"github.com/icexin/gocraft/world"
+)
+
+var animalsEnabled = flags.Bool("animals", true, "spawn the passive animals, single player only")
+
+const (
+	// seconds a baby takes to grow up
+	growTime = 600
+	// seconds an animal fed stays in love, and until it breeds again
+	loveTime      = 30
+	breedCooldown = 300
+
+	// animals spawned in a chunk up to the cap, bred up to the other
+	animalChunkCap = 4
+	breedChunkCap  = 10
+	// chance of a herd in a grassy chunk populated
+	herdChance = 0.3
+	// ticks between the spawns around the player, and their distance in
+	// chunks
+	animalSpawnTicks = 30 * tickRate
+	animalSpawnRange = 4
+
+	// blocks the animals see a partner and the food held from
+	partnerRange = 8
+	temptRange   = 6
+	// ticks an animal hurt runs away
+	fleeTicks = 5 * tickRate
+)
+
+// the kind ids of the animals, saved in the store
+const (
+	AnimalSheep int32 = iota + 1
+	AnimalCow
+	AnimalChicken
+)
+
+func init() {
+	for _, k := range []*EntityKind{
+		{
+			Id: AnimalSheep, Name: "sheep",
+			Body: world.Cloud, Head: world.Plank, Legs: world.Plank,
+			Size: mgl32.Vec3{0.9, 0.6, 0.6}, HeadSize: 0.4, LegHeight: 0.5,
+			Health: 8, Speed: 1.2, RunSpeed: 3.5,
+			Food: world.TallGrass, Drop: world.Cloud,
+		},
+		{
+			Id: AnimalCow, Name: "cow",
+			Body: world.Wood, Head: world.Dirt, Legs: world.Dirt,
+			Size: mgl32.Vec3{1.1, 0.7, 0.7}, HeadSize: 0.45, LegHeight: 0.6,
+			Health: 10, Speed: 1, RunSpeed: 3.2,
+			Food: world.TallGrass,
+		},
+		{
+			Id: AnimalChicken, Name: "chicken",
+			Body: world.Snow, Head: world.Snow, Legs: world.Sand,
+			Size: mgl32.Vec3{0.45, 0.4, 0.35}, HeadSize: 0.25, LegHeight: 0.25,
+			Health: 4, Speed: 1.3, RunSpeed: 4,
+			Food: world.SunFlower,
+		},
+	} {
+		k.think = animalThink
+		RegisterEntityKind(k)
+	}
+	entitySpawners = append(entitySpawners, spawnAnimals)
+
+	RegisterCommand(&Command{
+		Name:  "summon",
+		Usage: "/summon KIND [baby]",
+		Run: func(g *Game, args *Args) (string, error) {
+			var names []string
+			for _, k := range sortedEntityKinds(nil) {
+				names = append(names, k.Name)
+			}
+			name := args.Choice("kind", names...)
+			baby := args.Len() > 0 && args.Choice("age", "baby") == "baby"
+			if err := args.Err(); err != nil {
+				return "", err
+			}
+			kind := sortedEntityKinds(func(k *EntityKind) bool { return k.Name == name })[0]
+			front := g.camera.Front()
+			pos := g.camera.Pos().Add(mgl32.Vec3{front.X(), 0, front.Z()}.Normalize().Mul(3))
+			if !g.entities.loaded[world.NearBlock(pos).Chunkid()] {
+				return "", fmt.Errorf("chunk not loaded")
+			}
+			e := newEntity(kind, pos, float32(rand.Float64()*2*math.Pi))
+			if baby {
+				e.Age = 0
+			}
+			g.entities.Add(e)
+			if baby {
+				name = "baby " + name
+			}
+			return fmt.Sprintf("summoned %s, %d entities", name, g.entities.Len()), nil
+		},
+	})
+}
+
+func animalsOn() bool {
+	return *animalsEnabled && net.ServerAddr() == ""
+}
+
+// isAnimal picks the kinds of passive animals, the ones that breed.
+func isAnimal(k *EntityKind) bool {
+	return k.Food != 0
+}
+
+// populateChunk may put a herd in a chunk loaded the first time, the same
+// herd for a seed.
+func (g *Game) populateChunk(cid world.Vec3) {
+	if !animalsOn() {
+		return
+	}
+	r := rand.New(rand.NewSource(world.Seed ^ int64(cid.X)*73856093 ^ int64(cid.Z)*19349663))
+	if r.Float32() < herdChance {
+		g.spawnHerd(r, cid, 2+r.Intn(3))
+	}
+}
+
+// spawnAnimals spawns a few animals in a grassy chunk around the player
+// now and then, up to animalChunkCap.
+func spawnAnimals(g *Game) {
+	if !animalsOn() || g.ticker.tick%animalSpawnTicks != 0 {
+		return
+	}
+	r := g.ticker.Rand()
+	dx, dz := r.Intn(2*animalSpawnRange+1)-animalSpawnRange, r.Intn(2*animalSpawnRange+1)-animalSpawnRange
+	if dx >= -1 && dx <= 1 && dz >= -1 && dz <= 1 {
+		// not under the eyes of the player
+		return
+	}
+	center := world.NearBlock(g.camera.Pos()).Chunkid()
+	g.spawnHerd(r, world.Vec3{X: center.X + dx, Z: center.Z + dz}, 1+r.Intn(2))
+}
+
+// spawnHerd spawns up to n animals of a kind on the grass of chunk cid.
+func (g *Game) spawnHerd(r *rand.Rand, cid world.Vec3, n int) {
+	if !g.entities.loaded[cid] {
+		return
+	}
+	kinds := sortedEntityKinds(isAnimal)
+	kind := kinds[r.Intn(len(kinds))]
+	for i := 0; i < n && g.entities.Count(cid, isAnimal) < animalChunkCap; i++ {
+		x := cid.X*world.ChunkWidth + r.Intn(world.ChunkWidth)
+		z := cid.Z*world.ChunkWidth + r.Intn(world.ChunkWidth)
+		if pos, ok := g.grassSurface(cid, x, z); ok {
+			g.entities.Add(newEntity(kind, pos, r.Float32()*2*math.Pi))
+		}
+	}
+}
+
+// grassSurface returns the top of the highest block at x, z of chunk cid if
+// it's grass with room above.
+func (g *Game) grassSurface(cid world.Vec3, x, z int) (mgl32.Vec3, bool) {
+	chunk, ok := g.world.PeekChunk(cid)
+	if !ok {
+		return mgl32.Vec3{}, false
+	}
+	for y := chunk.Top(); y >= 0; y-- {
+		w := g.world.Block(world.Vec3{X: x, Y: y, Z: z})
+		if !world.IsObstacle(w) {
+			continue
+		}
+		if w != world.Grass || world.IsObstacle(g.world.Block(world.Vec3{X: x, Y: y + 2, Z: z})) {
+			return mgl32.Vec3{}, false
+		}
+		return mgl32.Vec3{float32(x), float32(y) + 0.5, float32(z)}, true
+	}
+	return mgl32.Vec3{}, false
+}
+
+// flat returns the horizontal part of v.
+func flat(v mgl32.Vec3) mgl32.Vec2 {
+	return mgl32.Vec2{v.X(), v.Z()}
+}
+
+// walkTo sets the walk of e toward the horizontal direction dir at speed.
+func (e *Entity) walkTo(dir mgl32.Vec2, speed float32) {
+	if dir.Len() == 0 {
+		e.walk = mgl32.Vec2{}
+		return
+	}
+	e.walk = dir.Normalize().Mul(speed)
+}
+
+// animalThink runs away when hurt, goes to a partner in love, follows
+// the player holding its food and wanders around otherwise.
+func animalThink(g *Game, e *Entity) {
+	k := e.Kind
+	player := g.camera.Pos()
+	toPlayer := flat(player.Sub(e.Pos))
+	if e.flee > 0 {
+		e.flee--
+		e.walkTo(toPlayer.Mul(-1), k.RunSpeed)
+		return
+	}
+	if e.love > 0 {
+		if mate := g.entities.partner(e); mate != nil {
+			d := flat(mate.Pos.Sub(e.Pos))
+			if d.Len() > k.Size.X() {
+				e.walkTo(d, k.Speed)
+				return
+			}
+			g.breed(e, mate)
+		}
+	}
+	if g.item == k.Food && g.hasItem() && toPlayer.Len() < temptRange {
+		if toPlayer.Len() > 2 {
+			e.walkTo(toPlayer, k.Speed)
+		} else {
+			e.walk = mgl32.Vec2{}
+		}
+		return
+	}
+	wander(g, e)
+}
+
+// wander walks e in a random direction or stops now and then.
+func wander(g *Game, e *Entity) {
+	if e.think > 0 {
+		e.think--
+		return
+	}
+	r := g.ticker.Rand()
+	e.think = 2*tickRate + r.Intn(4*tickRate)
+	if r.Float32() < 0.5 {
+		e.walk = mgl32.Vec2{}
+		return
+	}
+	a := r.Float64() * 2 * math.Pi
+	e.walkTo(mgl32.Vec2{float32(math.Cos(a)), float32(math.Sin(a))}, e.Kind.Speed)
+}
+
+// partner returns the nearest animal of the kind of e in love, nil if none
+// in partnerRange.
+func (es *Entities) partner(e *Entity) *Entity {
+	var mate *Entity
+	dist := float32(partnerRange)
+	for _, x := range es.list {
+		if x == e || x.Kind != e.Kind || x.love == 0 {
+			continue
+		}
+		if d := x.Pos.Sub(e.Pos).Len(); d < dist {
+			mate, dist = x, d
+		}
+	}
+	return mate
+}
+
+// breed has a baby between a and b, below breedChunkCap.
+func (g *Game) breed(a, b *Entity) {
+	a.love, b.love = 0, 0
+	a.Cooldown, b.Cooldown = breedCooldown, breedCooldown
+	pos := a.Pos.Add(b.Pos).Mul(0.5)
+	if g.entities.Count(world.NearBlock(pos).Chunkid(), isAnimal) >= breedChunkCap {
+		return
+	}
+	baby := newEntity(a.Kind, pos, a.Yaw)
+	baby.Age = 0
+	g.entities.Add(baby)
+}
+
+// feedAnimal gives the held item to e if it's its food. An adult falls in
+// love, a baby grows up faster.
+func (g *Game) feedAnimal(e *Entity) {
+	k := e.Kind
+	if k.Food == 0 || g.item != k.Food || !g.hasItem() {
+		return
+	}
+	switch {
+	case e.Age < growTime:
+		e.Age += growTime / 10
+	case e.love == 0 && e.Cooldown == 0:
+		e.love = loveTime
+	default:
+		return
+	}
+	if g.mode == ModeSurvival {
+		g.inventory.Take(g.item)
+	}
+	g.markHit()
+}
@@ -0,0 +1,175 @@
+package game
+
+import (
+	"math"
+
+	"github.com/go-gl/gl/v3.3-core/gl"
+	"github.com/go-gl/glfw/v3.2/glfw"
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/icexin/gocraft/internal/geom"
+	"github.com/icexin/gocraft/render"
+	"github.com/icexin/gocraft/world"
+)
+
+const (
+	// the crack textures are crackStages tiles from crackTile
+	crackTile   = 80
+	crackStages = 8
+
+	placeAnimTime  = 0.15 // seconds
+	placeAnimScale = 0.15 // extra scale of a block just placed
+
+	swingTime = 0.25 // seconds
+	swapTime  = 0.3  // seconds
+	// bob cycles per block walked and bob size in item units
+	bobFrequency = 1.8
+	bobSize      = 0.12
+)
+
+// Placing is the pop animation of the last block placed by the player.
+type Placing struct {
+	block world.Vec3
+	tp    int
+	at    float64
+}
+
+func init() {
+	events.Subscribe(EventBlockPlaced, func(e Event) {
+		p := e.(BlockPlaced)
+		game.startPlacing(p.Id, p.W)
+	})
+}
+
+func (g *Game) startPlacing(id world.Vec3, tp int) {
+	g.placing = Placing{
+		block: id,
+		tp:    tp,
+		at:    glfw.GetTime(),
+	}
+}
+
+// ViewModel animates the held item: it bobs while walking, swings on click
+// and dips out and back in when the item changes.
+type ViewModel struct {
+	bob     float32 // bob phase in radians
+	bobAmp  float32 // 0 standing still, 1 walking
+	swingAt float64
+	swapAt  float64
+	// the item held before the swap, shown in its first half
+	prev int
+}
+
+// Update advances the bob by the distance walked on the ground this frame.
+func (v *ViewModel) Update(dt float64, walked float32) {
+	target := float32(0)
+	if walked > 0 {
+		target = 1
+		v.bob += walked * bobFrequency * math.Pi
+	}
+	// ease the amplitude so the item settles when stopping
+	v.bobAmp += (target - v.bobAmp) * geom.Min(float32(dt)*8, 1)
+}
+
+func (v *ViewModel) Swing() {
+	v.swingAt = glfw.GetTime()
+}
+
+// Swap starts the swap animation from the item prev.
+func (v *ViewModel) Swap(prev int) {
+	v.swapAt = glfw.GetTime()
+	v.prev = prev
+}
+
+// Swapping reports whether the previous item is still shown in the first
+// half of the swap animation.
+func (v *ViewModel) Swapping() bool {
+	return v.swapAt != 0 && glfw.GetTime()-v.swapAt < swapTime/2
+}
+
+// Transform returns the offset of the held item.
+func (v *ViewModel) Transform() mgl32.Mat4 {
+	now := glfw.GetTime()
+	x := geom.Cos(v.bob) * bobSize * v.bobAmp
+	y := -geom.Abs(geom.Sin(v.bob)) * bobSize * v.bobAmp
+	var angle float32
+	if t := (now - v.swingAt) / swingTime; v.swingAt != 0 && t < 1 {
+		s := geom.Sin(float32(t) * math.Pi)
+		x -= s * 0.4
+		y += s * 0.3
+		angle = s * 40
+	}
+	if t := (now - v.swapAt) / swapTime; v.swapAt != 0 && t < 1 {
+		y -= geom.Sin(float32(t)*math.Pi) * 1.5
+	}
+	m := mgl32.Translate3D(x, y, 0)
+	return m.Mul4(mgl32.HomogRotate3DZ(geom.Radian(angle)))
+}
+
+// drawItem draws the held item over the post effects.
+func (g *Game) drawItem() {
+	item := g.item
+	if g.viewModel.Swapping() {
+		item = g.viewModel.prev
+	}
+	shader, texture := g.blockRender.Shader(), g.blockRender.Texture()
+	shader.Begin()
+	texture.Begin()
+	shader.SetUniformAttr(3, g.Dim())
+	width, height := g.win.GetSize()
+	ratio := float32(width) / float32(height)
+	n := 15 / settings.UIScale
+	projection := mgl32.Ortho2D(0, n, 0, n/ratio)
+	model := mgl32.Translate3D(1, 1, 0)
+	model = model.Mul4(g.viewModel.Transform())
+	model = model.Mul4(mgl32.HomogRotate3DX(geom.Radian(10)))
+	model = model.Mul4(mgl32.HomogRotate3DY(geom.Radian(45)))
+	mat := projection.Mul4(model)
+	shader.SetUniformAttr(0, mat)
+	shader.SetUniformAttr(1, mgl32.Vec3{0, 0, 0})
+	shader.SetUniformAttr(2, float32(render.Radius())*world.ChunkWidth)
+	shader.SetUniformAttr(5, float32(0))
+	shader.SetUniformAttr(11, float32(0))
+	// the held item stays still
+	shader.SetUniformAttr(17, float32(0))
+	// grey when none is left to place
+	if !g.hasItem() {
+		shader.SetUniformAttr(16, float32(1))
+	}
+	g.blockRender.BlockMesh(item).Draw()
+	shader.SetUniformAttr(16, float32(0))
+	texture.End()
+	shader.End()
+}
+
+// drawPlacing draws the block just placed a bit larger, shrinking to its
+// size in the chunk mesh, call between Begin and End of the block shader.
+func (g *Game) drawPlacing(mat mgl32.Mat4) {
+	p := g.placing
+	t := float32((glfw.GetTime() - p.at) / placeAnimTime)
+	if p.at == 0 || t >= 1 || g.world.Block(p.block) != p.tp {
+		return
+	}
+	s := 1 + placeAnimScale*(1-t)*(1-t)
+	m := mat.Mul4(mgl32.Translate3D(float32(p.block.X), float32(p.block.Y), float32(p.block.Z)))
+	g.blockRender.Shader().SetUniformAttr(0, m.Mul4(mgl32.Scale3D(s, s, s)))
+	g.blockRender.BlockMesh(p.tp).Draw()
+}
+
+// drawCracks draws the crack texture of the breaking stage over the block
+// being mined, call between Begin and End of the block shader.
+func (g *Game) drawCracks(mat mgl32.Mat4) {
+	id, progress, ok := g.MiningProgress()
+	if !ok || progress <= 0 || g.photoMode {
+		return
+	}
+	stage := int(progress * crackStages)
+	if stage >= crackStages {
+		stage = crackStages - 1
+	}
+	// pull the overlay in front of the block faces
+	gl.Enable(gl.POLYGON_OFFSET_FILL)
+	gl.PolygonOffset(-1, -1)
+	g.blockRender.Shader().SetUniformAttr(0, mat.Mul4(mgl32.Translate3D(float32(id.X), float32(id.Y), float32(id.Z))))
+	g.blockRender.TileMesh(crackTile + stage).Draw()
+	gl.Disable(gl.POLYGON_OFFSET_FILL)
+}
@@ -0,0 +1,547 @@
+package game
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/icexin/gocraft/world"
+)
+
+var anvilY = flags.Int("importy", 0, "added to the y of the imported blocks, 64 keeps the bottom of worlds since 1.18")
+
+const (
+	// Minecraft chunks are 16 blocks wide, regions 32 chunks wide
+	mcChunkWidth  = 16
+	mcRegionWidth = 32
+	// gocraft chunks along a region
+	regionChunks = mcRegionWidth * mcChunkWidth / world.ChunkWidth
+	// mc chunks along a gocraft chunk
+	chunkMCChunks = world.ChunkWidth / mcChunkWidth
+
+	// the packed block states stop spanning two longs at this data version (1.16)
+	dataVersionPadded = 2529
+)
+
+// blocks by name since 1.13, without the minecraft: prefix
+var anvilBlocks = map[string]int{
+	"stone":              world.Stone,
+	"granite":            world.Stone,
+	"diorite":            world.Stone,
+	"andesite":           world.Stone,
+	"tuff":               world.Stone,
+	"deepslate":          world.DarkStone,
+	"obsidian":           world.DarkStone,
+	"stone_bricks":       world.DarkStone,
+	"grass_block":        world.Grass,
+	"dirt":               world.Dirt,
+	"coarse_dirt":        world.Dirt,
+	"podzol":             world.Dirt,
+	"farmland":           world.Dirt,
+	"dirt_path":          world.Dirt,
+	"grass_path":         world.Dirt,
+	"sand":               world.Sand,
+	"red_sand":           world.Sand,
+	"sandstone":          world.Sand,
+	"gravel":             world.Gravel,
+	"cobblestone":        world.Cobble,
+	"mossy_cobblestone":  world.Cobble,
+	"bricks":             world.Brick,
+	"bedrock":            world.Bedrock,
+	"coal_ore":           world.CoalOre,
+	"iron_ore":           world.IronOre,
+	"gold_ore":           world.GoldOre,
+	"diamond_ore":        world.DiamondOre,
+	"glass":              world.Glass,
+	"chest":              world.Chest,
+	"snow_block":         world.Snow,
+	"clay":               world.Cement,
+	"glowstone":          world.LightStone,
+	"sea_lantern":        world.LightStone,
+	"grass":              world.TallGrass,
+	"short_grass":        world.TallGrass,
+	"tall_grass":         world.TallGrass,
+	"fern":               world.TallGrass,
+	"dandelion":          world.YellowFlower,
+	"poppy":              world.RedFlower,
+	"rose_bush":          world.RedFlower,
+	"allium":             world.PurpleFlower,
+	"lilac":              world.PurpleFlower,
+	"sunflower":          world.SunFlower,
+	"oxeye_daisy":        world.WhiteFlower,
+	"azure_bluet":        world.WhiteFlower,
+	"lily_of_the_valley": world.WhiteFlower,
+	"blue_orchid":        world.BlueFlower,
+	"cornflower":         world.BlueFlower,
+}
+
+var anvilGlass = map[string]int{
+	"red":    world.RedGlass,
+	"yellow": world.YellowGlass,
+	"lime":   world.GreenGlass,
+	"green":  world.GreenGlass,
+	"cyan":   world.CyanGlass,
+	"blue":   world.BlueGlass,
+	"purple": world.PurpleGlass,
+}
+
+// anvilBlock maps a block name to a gocraft block, 0 if it has none.
+func anvilBlock(name string) int {
+	name = strings.TrimPrefix(name, "minecraft:")
+	if w, ok := anvilBlocks[name]; ok {
+		return w
+	}
+	switch {
+	case strings.HasPrefix(name, "deepslate_") && strings.HasSuffix(name, "_ore"):
+		return anvilBlock(strings.TrimPrefix(name, "deepslate_"))
+	case strings.HasSuffix(name, "_stained_glass"):
+		if w, ok := anvilGlass[strings.TrimSuffix(name, "_stained_glass")]; ok {
+			return w
+		}
+		return world.Glass
+	case strings.HasSuffix(name, "_planks"):
+		return world.Plank
+	case strings.HasSuffix(name, "_log"), strings.HasSuffix(name, "_wood"):
+		return world.Wood
+	case strings.HasSuffix(name, "_leaves"):
+		return world.Leaves
+	case strings.HasSuffix(name, "_tulip"):
+		return world.RedFlower
+	case strings.HasSuffix(name, "_concrete"), strings.HasSuffix(name, "terracotta"):
+		return world.Cement
+	}
+	return 0
+}
+
+// legacyBlock maps a block id and data value before 1.13 to a gocraft block.
+func legacyBlock(id, data int) int {
+	switch id {
+	case 1:
+		return world.Stone
+	case 2:
+		return world.Grass
+	case 3, 60:
+		return world.Dirt
+	case 4, 48:
+		return world.Cobble
+	case 5:
+		return world.Plank
+	case 7:
+		return world.Bedrock
+	case 12, 24:
+		return world.Sand
+	case 13:
+		return world.Gravel
+	case 14:
+		return world.GoldOre
+	case 15:
+		return world.IronOre
+	case 16:
+		return world.CoalOre
+	case 17, 162:
+		return world.Wood
+	case 18, 161:
+		return world.Leaves
+	case 20:
+		return world.Glass
+	case 31:
+		return world.TallGrass
+	case 37:
+		return world.YellowFlower
+	case 38:
+		switch data {
+		case 1:
+			return world.BlueFlower
+		case 2:
+			return world.PurpleFlower
+		case 3, 8:
+			return world.WhiteFlower
+		}
+		return world.RedFlower
+	case 45:
+		return world.Brick
+	case 49, 98:
+		return world.DarkStone
+	case 54:
+		return world.Chest
+	case 56:
+		return world.DiamondOre
+	case 80:
+		return world.Snow
+	case 82, 159, 172, 251:
+		return world.Cement
+	case 89:
+		return world.LightStone
+	case 95:
+		switch data {
+		case 4:
+			return world.YellowGlass
+		case 5, 13:
+			return world.GreenGlass
+		case 9:
+			return world.CyanGlass
+		case 10:
+			return world.PurpleGlass
+		case 11:
+			return world.BlueGlass
+		case 14:
+			return world.RedGlass
+		}
+		return world.Glass
+	case 175:
+		// the upper half of the double plants is left empty
+		switch data {
+		case 0:
+			return world.SunFlower
+		case 1:
+			return world.PurpleFlower
+		case 2, 3:
+			return world.TallGrass
+		case 4:
+			return world.RedFlower
+		}
+	}
+	return 0
+}
+
+// anvilImport counts the blocks without a gocraft block by name.
+type anvilImport struct {
+	unmapped map[string]int
+	chunks   int
+}
+
+// ImportAnvil writes the chunks of the Minecraft world in dir to the store
+// as saved terrain, replacing the edits of these chunks, and moves the
+// player to the world spawn.
+func ImportAnvil(dir string) error {
+	regionDir := filepath.Join(dir, "region")
+	if _, err := os.Stat(regionDir); err != nil {
+		regionDir = dir
+	}
+	files, err := filepath.Glob(filepath.Join(regionDir, "r.*.*.mca"))
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no region files in %s", regionDir)
+	}
+
+	err = InitStore()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	imp := &anvilImport{unmapped: make(map[string]int)}
+	for _, file := range files {
+		var rx, rz int
+		if _, err := fmt.Sscanf(filepath.Base(file), "r.%d.%d.mca", &rx, &rz); err != nil {
+			gameLog.Warnf("skip region %s:%s", file, err)
+			continue
+		}
+		if err := imp.importRegion(file, rx, rz); err != nil {
+			return fmt.Errorf("region %s: %s", file, err)
+		}
+		gameLog.Infof("imported %s, %d chunks so far", filepath.Base(file), imp.chunks)
+	}
+	imp.logUnmapped()
+
+	spawn, err := readAnvilSpawn(filepath.Join(dir, "level.dat"))
+	if err != nil {
+		gameLog.Warnf("no spawn:%s", err)
+		return nil
+	}
+	return savePlayerState(spawn)
+}
+
+// importRegion imports the gocraft chunks of region rx, rz.
+func (imp *anvilImport) importRegion(file string, rx, rz int) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	if len(data) < 8192 {
+		// no chunk saved yet
+		return nil
+	}
+	for gx := 0; gx < regionChunks; gx++ {
+		for gz := 0; gz < regionChunks; gz++ {
+			cid := world.Vec3{X: rx*regionChunks + gx, Y: 0, Z: rz*regionChunks + gz}
+			blocks := make(map[world.Vec3]int)
+			var missing [][2]int
+			for dx := 0; dx < chunkMCChunks; dx++ {
+				for dz := 0; dz < chunkMCChunks; dz++ {
+					lx, lz := gx*chunkMCChunks+dx, gz*chunkMCChunks+dz
+					root, err := regionChunk(data, filepath.Dir(file), rx, rz, lx, lz)
+					if err != nil {
+						gameLog.Warnf("chunk %d,%d of %s:%s", lx, lz, filepath.Base(file), err)
+					}
+					if root == nil {
+						missing = append(missing, [2]int{dx, dz})
+						continue
+					}
+					x0, z0 := (rx*mcRegionWidth+lx)*mcChunkWidth, (rz*mcRegionWidth+lz)*mcChunkWidth
+					imp.chunkBlocks(root, func(x, y, z, w int) {
+						blocks[world.Vec3{X: x0 + x, Y: y, Z: z0 + z}] = w
+					})
+				}
+			}
+			if len(missing) == chunkMCChunks*chunkMCChunks {
+				continue
+			}
+			if len(missing) > 0 {
+				fillGenerated(cid, blocks, missing)
+			}
+			if err := db.ImportTerrain(cid, blocks); err != nil {
+				return err
+			}
+			imp.chunks++
+		}
+	}
+	return nil
+}
+
+// fillGenerated adds the generated blocks of the quarters of chunk cid no
+// Minecraft chunk covers.
+func fillGenerated(cid world.Vec3, blocks map[world.Vec3]int, missing [][2]int) {
+	for id, w := range world.GenerateChunk(cid) {
+		dx := (id.X - cid.X*world.ChunkWidth) / mcChunkWidth
+		dz := (id.Z - cid.Z*world.ChunkWidth) / mcChunkWidth
+		for _, m := range missing {
+			if m[0] == dx && m[1] == dz {
+				blocks[id] = w
+			}
+		}
+	}
+}
+
+// regionChunk decodes the chunk lx, lz of the region file data, nil if it
+// isn't saved or not fully generated.
+func regionChunk(data []byte, dir string, rx, rz, lx, lz int) (nbtCompound, error) {
+	if len(data) < 8192 {
+		return nil, fmt.Errorf("region header of %d bytes", len(data))
+	}
+	loc := binary.BigEndian.Uint32(data[4*(lz*mcRegionWidth+lx):])
+	offset, sectors := int(loc>>8)*4096, int(loc&0xff)
+	if offset == 0 || sectors == 0 {
+		return nil, nil
+	}
+	if offset+5 > len(data) {
+		return nil, fmt.Errorf("chunk offset %d past the end", offset)
+	}
+	length := int(binary.BigEndian.Uint32(data[offset:]))
+	compression := data[offset+4]
+	var raw []byte
+	if compression&0x80 != 0 {
+		// too large for the region, saved next to it
+		name := fmt.Sprintf("c.%d.%d.mcc", rx*mcRegionWidth+lx, rz*mcRegionWidth+lz)
+		b, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		raw = b
+		compression &^= 0x80
+	} else {
+		if length < 1 || offset+4+length > len(data) {
+			return nil, fmt.Errorf("bad chunk length %d", length)
+		}
+		raw = data[offset+5 : offset+4+length]
+	}
+	var r io.Reader
+	var err error
+	switch compression {
+	case 1:
+		r, err = gzip.NewReader(bytes.NewReader(raw))
+	case 2:
+		r, err = zlib.NewReader(bytes.NewReader(raw))
+	case 3:
+		r = bytes.NewReader(raw)
+	default:
+		return nil, fmt.Errorf("unsupported compression %d", compression)
+	}
+	if err != nil {
+		return nil, err
+	}
+	root, err := readNBT(r)
+	if err != nil {
+		return nil, err
+	}
+	// before 1.18 the chunk is under Level
+	if level := root.compound("Level"); level != nil {
+		level["DataVersion"] = root["DataVersion"]
+		root = level
+	}
+	switch status := strings.TrimPrefix(root.str("Status"), "minecraft:"); status {
+	case "", "full", "postprocessed", "fullchunk":
+	default:
+		// a chunk still being generated, the game keeps its own terrain
+		return nil, nil
+	}
+	return root, nil
+}
+
+// chunkBlocks calls f on the blocks of a Minecraft chunk mapped to gocraft
+// blocks, x and z in the chunk, y moved by -importy. Air and the blocks
+// without a match are skipped.
+func (imp *anvilImport) chunkBlocks(root nbtCompound, f func(x, y, z, w int)) {
+	sections := root.list("sections")
+	if sections == nil {
+		sections = root.list("Sections")
+	}
+	padded := root.int("DataVersion") >= dataVersionPadded
+	for _, s := range sections {
+		section, ok := s.(nbtCompound)
+		if !ok {
+			continue
+		}
+		y0 := section.int("Y")*mcChunkWidth + *anvilY
+		emit := func(i, w int) {
+			y := y0 + i/(mcChunkWidth*mcChunkWidth)
+			if w == 0 || y < 0 || y >= world.ChunkHeight {
+				return
+			}
+			f(i%mcChunkWidth, y, i/mcChunkWidth%mcChunkWidth, w)
+		}
+
+		if ids := section.bytes("Blocks"); ids != nil {
+			add, data := section.bytes("Add"), section.bytes("Data")
+			for i, b := range ids {
+				id := int(b)
+				if add != nil {
+					id |= nibble(add, i) << 8
+				}
+				meta := 0
+				if data != nil {
+					meta = nibble(data, i)
+				}
+				if id != 0 {
+					emit(i, legacyBlock(id, meta))
+				}
+			}
+			continue
+		}
+
+		palette, states := section.list("Palette"), section.longs("BlockStates")
+		if bs := section.compound("block_states"); bs != nil {
+			palette, states = bs.list("palette"), bs.longs("data")
+		}
+		if len(palette) == 0 {
+			continue
+		}
+		mapped := make([]int, len(palette))
+		for i, p := range palette {
+			entry, _ := p.(nbtCompound)
+			name := entry.str("Name")
+			mapped[i] = anvilBlock(name)
+			if mapped[i] == 0 && !isAnvilAir(name) {
+				imp.unmapped[name]++
+			}
+		}
+		if len(states) == 0 {
+			for i := 0; i < mcChunkWidth*mcChunkWidth*mcChunkWidth; i++ {
+				emit(i, mapped[0])
+			}
+			continue
+		}
+		nbits := bits.Len(uint(len(palette) - 1))
+		if nbits < 4 {
+			nbits = 4
+		}
+		for i := 0; i < mcChunkWidth*mcChunkWidth*mcChunkWidth; i++ {
+			idx := paletteIndex(states, i, nbits, padded)
+			if idx < len(mapped) {
+				emit(i, mapped[idx])
+			}
+		}
+	}
+}
+
+func isAnvilAir(name string) bool {
+	return strings.HasSuffix(name, "air")
+}
+
+// paletteIndex returns the palette index of block i packed in nbits bits,
+// padded if an index never spans two longs.
+func paletteIndex(states []int64, i, nbits int, padded bool) int {
+	mask := uint64(1)<<uint(nbits) - 1
+	if padded {
+		per := 64 / nbits
+		word := i / per
+		if word >= len(states) {
+			return 0
+		}
+		return int(uint64(states[word]) >> uint(i%per*nbits) & mask)
+	}
+	bit := i * nbits
+	word, shift := bit/64, uint(bit%64)
+	if word >= len(states) {
+		return 0
+	}
+	v := uint64(states[word]) >> shift
+	if shift+uint(nbits) > 64 && word+1 < len(states) {
+		v |= uint64(states[word+1]) << (64 - shift)
+	}
+	return int(v & mask)
+}
+
+func nibble(b []byte, i int) int {
+	if i/2 >= len(b) {
+		return 0
+	}
+	if i%2 == 0 {
+		return int(b[i/2] & 0xf)
+	}
+	return int(b[i/2] >> 4)
+}
+
+// logUnmapped logs the most common blocks left out.
+func (imp *anvilImport) logUnmapped() {
+	names := make([]string, 0, len(imp.unmapped))
+	for name := range imp.unmapped {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return imp.unmapped[names[i]] > imp.unmapped[names[j]]
+	})
+	if len(names) > 10 {
+		names = names[:10]
+	}
+	for _, name := range names {
+		gameLog.Infof("no gocraft block for %s, left out of %d sections", name, imp.unmapped[name])
+	}
+	gameLog.Infof("imported %d chunks", imp.chunks)
+}
+
+// readAnvilSpawn returns the spawn of the Minecraft world level file.
+func readAnvilSpawn(path string) (PlayerState, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return PlayerState{}, err
+	}
+	defer f.Close()
+	r, err := gzip.NewReader(f)
+	if err != nil {
+		return PlayerState{}, err
+	}
+	root, err := readNBT(r)
+	if err != nil {
+		return PlayerState{}, err
+	}
+	data := root.compound("Data")
+	if data == nil {
+		return PlayerState{}, fmt.Errorf("no Data in %s", path)
+	}
+	return PlayerState{
+		X: float32(data.int("SpawnX")) + 0.5,
+		Y: float32(data.int("SpawnY")+*anvilY) + 2,
+		Z: float32(data.int("SpawnZ")) + 0.5,
+	}, nil
+}
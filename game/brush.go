@@ -0,0 +1,108 @@
+package game
+
+import (
+	"fmt"
+
+	"github.com/icexin/gocraft/net"
+	"github.com/icexin/gocraft/world"
+)
+
+const (
+	defaultBrushRadius = 4
+	maxBrushRadius     = 16
+)
+
+// Brush is a tool used by the left button instead of breaking blocks, the
+// undo brush puts back the generated terrain around the block in sight.
+type Brush struct {
+	active bool
+	radius int
+}
+
+func init() {
+	RegisterCommand(&Command{
+		Name:  "brush",
+		Usage: "/brush undo [radius]|off",
+		Run: func(g *Game, args *Args) (string, error) {
+			brush := args.Choice("brush", "undo", "off")
+			radius := defaultBrushRadius
+			if brush == "undo" && args.Len() > 0 {
+				radius = args.Int("radius")
+				args.Range("radius", float64(radius), 0, maxBrushRadius)
+			}
+			if err := args.Err(); err != nil {
+				return "", err
+			}
+			if brush == "off" {
+				g.brush.active = false
+				return "brush off", nil
+			}
+			g.brush = Brush{active: true, radius: radius}
+			return fmt.Sprintf("undo brush of radius %d, left click to apply", radius), nil
+		},
+	})
+}
+
+// Status returns the brush in use for the window title.
+func (b *Brush) Status() string {
+	if !b.active {
+		return ""
+	}
+	return fmt.Sprintf(" brush:undo r%d", b.radius)
+}
+
+// applyBrush uses the brush on the block in sight.
+func (g *Game) applyBrush() {
+	block, _ := g.world.HitTest(g.camera.Pos(), g.camera.Front())
+	if block == nil {
+		return
+	}
+	n, err := g.undoEdits(*block, g.brush.radius)
+	if err != nil {
+		g.console.Print(err.Error())
+		return
+	}
+	g.console.Print(fmt.Sprintf("reverted %d blocks", n))
+	g.markHit()
+}
+
+// undoEdits reverts the blocks within radius of center to the generated
+// terrain. Only the blocks with a change in the store are looked at, so
+// the rest of the world is left alone.
+func (g *Game) undoEdits(center world.Vec3, radius int) (int, error) {
+	r2 := radius * radius
+	min := world.Vec3{X: center.X - radius, Y: 0, Z: center.Z - radius}.Chunkid()
+	max := world.Vec3{X: center.X + radius, Y: 0, Z: center.Z + radius}.Chunkid()
+	var edits []net.BlockEdit
+	for cx := min.X; cx <= max.X; cx++ {
+		for cz := min.Z; cz <= max.Z; cz++ {
+			cid := world.Vec3{X: cx, Y: 0, Z: cz}
+			if net.ChunkLocked(cid) {
+				continue
+			}
+			var changed []world.Vec3
+			err := db.RangeBlocks(cid, func(bid world.Vec3, w int) {
+				dx, dy, dz := bid.X-center.X, bid.Y-center.Y, bid.Z-center.Z
+				if dx*dx+dy*dy+dz*dz <= r2 {
+					changed = append(changed, bid)
+				}
+			})
+			if err != nil {
+				return 0, err
+			}
+			if len(changed) == 0 {
+				continue
+			}
+			generated := world.GenerateChunk(cid)
+			for _, bid := range changed {
+				if w := generated[bid]; g.world.Block(bid) != w {
+					edits = append(edits, net.BlockEdit{Id: bid, W: w})
+				}
+			}
+		}
+	}
+	if len(edits) > 0 {
+		g.UpdateBlocks(edits...)
+	}
+	return len(edits), nil
+}
@@ -0,0 +1,344 @@
+package game
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/go-gl/glfw/v3.2/glfw"
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/icexin/gocraft/internal/geom"
+)
+
+var (
+	baseFov     = flags.Float64("fov", defaultFov, "vertical field of view in degrees, from 30 to 110")
+	mouseSens   = flags.Float64("sens", defaultSens, "mouse sensitivity, degrees per pixel")
+	invertMouse = flags.Bool("invertmouse", false, "invert the vertical mouse look")
+)
+
+type CameraMovement int
+
+const (
+	MoveForward CameraMovement = iota
+	MoveBackward
+	MoveLeft
+	MoveRight
+)
+
+type Camera struct {
+	pos    mgl32.Vec3
+	up     mgl32.Vec3
+	right  mgl32.Vec3
+	front  mgl32.Vec3
+	wfront mgl32.Vec3
+
+	rotatex, rotatey float32
+	// the angles the mouse moved to, the smoothed camera eases toward them
+	targetx, targety float32
+
+	Sens float32
+	// moving the mouse up looks down
+	InvertY bool
+
+	flying    bool
+	sprinting bool
+	// held zoom key
+	zooming bool
+
+	// field of view in degrees, ramps toward the target fov
+	fov float32
+
+	// view bobbing phase in radians and amplitude, 0 standing still
+	bob, bobAmp float32
+	// strength and time of the last landing dip
+	dip   float32
+	dipAt float64
+}
+
+const (
+	defaultSens = 0.14
+	minSens     = 0.01
+	maxSens     = 1
+
+	defaultFov = 45
+	minFov     = 30
+	maxFov     = 110
+	// added to the base fov while sprinting or flying
+	sprintFov = 8
+	flyingFov = 5
+	// the zoom divides the base fov
+	zoomFactor = 4
+	// degrees per second of the fov ramp, faster by the degrees to go over
+	// fovRampDegrees
+	fovRampSpeed   = 60
+	fovRampDegrees = 10
+	sprintSpeed    = 1.5
+
+	// view bob cycles per block walked, sway and height in blocks
+	viewBobFrequency = 0.9
+	viewBobSway      = 0.04
+	viewBobHeight    = 0.06
+	// the landing dip lasts dipTime, maxDip for a fall at maxDipSpeed, no
+	// dip below minDipSpeed
+	dipTime     = 0.3 // seconds
+	maxDip      = 0.3
+	minDipSpeed = 9
+	maxDipSpeed = 30
+	// how fast the smoothed camera catches up with the mouse, per second
+	smoothCamRate = 12
+)
+
+func NewCamera(pos mgl32.Vec3) *Camera {
+	*baseFov = math.Max(minFov, math.Min(maxFov, *baseFov))
+	*mouseSens = math.Max(minSens, math.Min(maxSens, *mouseSens))
+	c := &Camera{
+		pos:     pos,
+		front:   mgl32.Vec3{0, 0, -1},
+		rotatey: 0,
+		rotatex: -90,
+		targetx: -90,
+		Sens:    float32(*mouseSens),
+		InvertY: *invertMouse,
+		flying:  false,
+		fov:     float32(*baseFov),
+	}
+	c.updateAngles()
+	return c
+}
+
+func (c *Camera) Restore(state PlayerState) {
+	c.pos = mgl32.Vec3{state.X, state.Y, state.Z}
+	c.rotatex, c.targetx = state.Rx, state.Rx
+	c.rotatey, c.targety = state.Ry, state.Ry
+	c.updateAngles()
+}
+
+func (c *Camera) State() PlayerState {
+	return PlayerState{
+		X:  c.pos.X(),
+		Y:  c.pos.Y(),
+		Z:  c.pos.Z(),
+		Rx: c.rotatex,
+		Ry: c.rotatey,
+	}
+}
+
+// Matrix returns the view matrix, from the eye moved by the view bobbing
+// and the landing dip.
+func (c *Camera) Matrix() mgl32.Mat4 {
+	eye := c.pos.Add(c.viewOffset())
+	return mgl32.LookAtV(eye, eye.Add(c.front), c.up)
+}
+
+// viewOffset returns the offset of the eye from the player position.
+func (c *Camera) viewOffset() mgl32.Vec3 {
+	var offset mgl32.Vec3
+	if c.bobAmp > 0 {
+		sway := geom.Cos(c.bob) * viewBobSway * c.bobAmp
+		height := -geom.Abs(geom.Sin(c.bob)) * viewBobHeight * c.bobAmp
+		offset = c.right.Mul(sway).Add(mgl32.Vec3{0, height, 0})
+	}
+	if t := float32(glfw.GetTime()-c.dipAt) / dipTime; c.dip > 0 && t < 1 {
+		offset = offset.Sub(mgl32.Vec3{0, c.dip * geom.Sin(t*math.Pi), 0})
+	}
+	return offset
+}
+
+// UpdateView eases the smoothed angles toward the mouse and advances the
+// view bobbing by the distance walked on the ground this frame.
+func (c *Camera) UpdateView(dt, walked float32) {
+	if *smoothCamEnabled {
+		k := geom.Min(dt*smoothCamRate, 1)
+		c.rotatex += (c.targetx - c.rotatex) * k
+		c.rotatey += (c.targety - c.rotatey) * k
+		c.updateAngles()
+	} else if c.rotatex != c.targetx || c.rotatey != c.targety {
+		c.rotatex, c.rotatey = c.targetx, c.targety
+		c.updateAngles()
+	}
+
+	target := float32(0)
+	if walked > 0 && *viewBobEnabled {
+		target = 1
+		c.bob += walked * viewBobFrequency * math.Pi
+	}
+	c.bobAmp += (target - c.bobAmp) * geom.Min(dt*8, 1)
+	if c.bobAmp < 0.001 {
+		c.bobAmp = 0
+	}
+}
+
+// Land dips the view after a fall landing at speed, in blocks per second.
+func (c *Camera) Land(speed float32) {
+	if !*landDipEnabled || speed < minDipSpeed {
+		return
+	}
+	c.dip = maxDip * geom.Min((speed-minDipSpeed)/(maxDipSpeed-minDipSpeed), 1)
+	c.dipAt = glfw.GetTime()
+}
+
+func (c *Camera) SetPos(pos mgl32.Vec3) {
+	c.pos = pos
+}
+
+func (c *Camera) Pos() mgl32.Vec3 {
+	return c.pos
+}
+
+func (c *Camera) Front() mgl32.Vec3 {
+	return c.front
+}
+
+func (c *Camera) FlipFlying() {
+	c.flying = !c.flying
+}
+
+func (c *Camera) Flying() bool {
+	return c.flying
+}
+
+func (c *Camera) SetSprinting(sprinting bool) {
+	c.sprinting = sprinting
+}
+
+// SetZooming narrows the fov while the zoom key is held.
+func (c *Camera) SetZooming(zooming bool) {
+	c.zooming = zooming
+}
+
+func (c *Camera) Fov() float32 {
+	return c.fov
+}
+
+// UpdateFov moves the fov toward its target, wider while sprinting or flying
+// and narrower while zooming.
+func (c *Camera) UpdateFov(dt float32) {
+	target := float32(*baseFov)
+	switch {
+	case c.zooming:
+		target /= zoomFactor
+	case !*fovRampEnabled:
+	case c.sprinting:
+		target += sprintFov
+	case c.flying:
+		target += flyingFov
+	}
+	step := fovRampSpeed * dt * geom.Max(1, geom.Abs(target-c.fov)/fovRampDegrees)
+	switch {
+	case c.fov < target:
+		c.fov = geom.Min(c.fov+step, target)
+	case c.fov > target:
+		c.fov = geom.Max(c.fov-step, target)
+	}
+}
+
+func (c *Camera) OnAngleChange(dx, dy float32) {
+	if mgl32.Abs(dx) > 200 || mgl32.Abs(dy) > 200 {
+		return
+	}
+	if c.InvertY {
+		dy = -dy
+	}
+	// slower while zoomed, the view moves as much on screen
+	sens := c.Sens
+	if c.zooming {
+		sens *= c.fov / float32(*baseFov)
+	}
+	c.targetx += dx * sens
+	c.targety += dy * sens
+	if c.targety > 89 {
+		c.targety = 89
+	}
+	if c.targety < -89 {
+		c.targety = -89
+	}
+	if !*smoothCamEnabled {
+		c.rotatex, c.rotatey = c.targetx, c.targety
+		c.updateAngles()
+	}
+}
+
+func init() {
+	RegisterCommand(&Command{
+		Name:  "fov",
+		Usage: "/fov [degrees]",
+		Run: func(g *Game, args *Args) (string, error) {
+			if args.Len() == 0 {
+				return fmt.Sprintf("fov %v", *baseFov), nil
+			}
+			fov := args.Float("degrees")
+			args.Range("degrees", fov, minFov, maxFov)
+			if err := args.Err(); err != nil {
+				return "", err
+			}
+			*baseFov = fov
+			return fmt.Sprintf("fov %v", fov), nil
+		},
+	})
+	RegisterCommand(&Command{
+		Name:  "mouse",
+		Usage: "/mouse [sens N|invert on|off]",
+		Run: func(g *Game, args *Args) (string, error) {
+			if args.Len() != 0 {
+				switch args.Choice("setting", "sens", "invert") {
+				case "sens":
+					sens := args.Float("sensitivity")
+					args.Range("sensitivity", sens, minSens, maxSens)
+					if args.Err() == nil {
+						g.camera.Sens = float32(sens)
+					}
+				case "invert":
+					invert := args.Switch("state")
+					if args.Err() == nil {
+						g.camera.InvertY = invert
+					}
+				}
+			}
+			if err := args.Err(); err != nil {
+				return "", err
+			}
+			invert := "off"
+			if g.camera.InvertY {
+				invert = "on"
+			}
+			return fmt.Sprintf("sensitivity %v, invert %s", g.camera.Sens, invert), nil
+		},
+	})
+}
+
+func (c *Camera) OnMoveChange(dir CameraMovement, delta float32) {
+	if c.flying {
+		delta = 5 * delta
+	}
+	if c.sprinting {
+		delta = sprintSpeed * delta
+	}
+	switch dir {
+	case MoveForward:
+		if c.flying {
+			c.pos = c.pos.Add(c.front.Mul(delta))
+		} else {
+			c.pos = c.pos.Add(c.wfront.Mul(delta))
+		}
+	case MoveBackward:
+		if c.flying {
+			c.pos = c.pos.Sub(c.front.Mul(delta))
+		} else {
+			c.pos = c.pos.Sub(c.wfront.Mul(delta))
+		}
+	case MoveLeft:
+		c.pos = c.pos.Sub(c.right.Mul(delta))
+	case MoveRight:
+		c.pos = c.pos.Add(c.right.Mul(delta))
+	}
+}
+func (c *Camera) updateAngles() {
+	front := mgl32.Vec3{
+		geom.Cos(geom.Radian(c.rotatey)) * geom.Cos(geom.Radian(c.rotatex)),
+		geom.Sin(geom.Radian(c.rotatey)),
+		geom.Cos(geom.Radian(c.rotatey)) * geom.Sin(geom.Radian(c.rotatex)),
+	}
+	c.front = front.Normalize()
+	c.right = c.front.Cross(mgl32.Vec3{0, 1, 0}).Normalize()
+	c.up = c.right.Cross(c.front).Normalize()
+	c.wfront = mgl32.Vec3{0, 1, 0}.Cross(c.right).Normalize()
+}
@@ -0,0 +1,52 @@
+#version 330 core
+
+in vec3 Pos;
+
+uniform vec3 center;
+uniform float radius;
+// how far the wind moved the clouds, in blocks
+uniform vec2 offset;
+// noise above which a block of sky is cloudy
+uniform float coverage;
+uniform float dim;
+uniform float shade;
+
+out vec4 FragColor;
+
+// blocks per noise cell
+const float scale = 48;
+
+float hash(vec2 p) {
+    return fract(sin(dot(p, vec2(127.1, 311.7))) * 43758.5453);
+}
+
+float noise(vec2 p) {
+    vec2 i = floor(p);
+    vec2 f = fract(p);
+    vec2 u = f * f * (3 - 2 * f);
+    return mix(mix(hash(i), hash(i + vec2(1, 0)), u.x),
+               mix(hash(i + vec2(0, 1)), hash(i + vec2(1, 1)), u.x), u.y);
+}
+
+float fbm(vec2 p) {
+    float v = 0;
+    float a = 0.5;
+    for (int i = 0; i < 4; i++) {
+        v += a * noise(p);
+        p *= 2;
+        a *= 0.5;
+    }
+    return v;
+}
+
+void main() {
+    // whole blocks, like the cloud blocks they replace
+    vec2 cell = floor(Pos.xz + offset);
+    float alpha = smoothstep(coverage, coverage + 0.05, fbm(cell / scale));
+    // fade out toward the edge of the layer
+    alpha *= 1 - smoothstep(radius * 0.5, radius, distance(Pos.xz, center.xz));
+    if (alpha <= 0) {
+        discard;
+    }
+    FragColor = vec4(vec3(shade * dim), alpha * 0.8);
+}
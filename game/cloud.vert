@@ -0,0 +1,15 @@
+#version 330 core
+
+// a unit square in x and z, spread around center
+in vec3 pos;
+
+uniform mat4 matrix;
+uniform vec3 center;
+uniform float radius;
+
+out vec3 Pos;
+
+void main() {
+    Pos = vec3(center.x + (pos.x * 2 - 1) * radius, center.y, center.z + (pos.z * 2 - 1) * radius);
+    gl_Position = matrix * vec4(Pos, 1.0);
+}
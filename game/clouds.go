@@ -0,0 +1,113 @@
+package game
+
+import (
+	"github.com/faiface/glhf"
+	"github.com/faiface/mainthread"
+	"github.com/go-gl/gl/v3.3-core/gl"
+	"github.com/go-gl/glfw/v3.2/glfw"
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/icexin/gocraft/internal/geom"
+	"github.com/icexin/gocraft/render"
+)
+
+var cloudsEnabled = flags.Bool("clouds", true, "draw the cloud layer")
+
+const (
+	// height of the cloud layer, amid the cloud blocks of the older generator
+	cloudHeight = 68
+	// the layer spreads at least that far around the player, fading out
+	minCloudRadius = 256
+	// blocks per second the wind moves the clouds
+	cloudSpeed = 1.5
+
+	cloudCoverage = 0.62
+	stormCoverage = 0.5
+	stormShade    = 0.55
+)
+
+// CloudRender draws the clouds as a flat translucent layer scrolled by the
+// wind. The blocks are below the layer, so the clouds are drawn before
+// the terrain when the player is under them and after it when above, the
+// depth isn't needed.
+type CloudRender struct {
+	shader *glhf.Shader
+	quad   *render.Lines
+	// how far the wind moved the clouds and when
+	offset   mgl32.Vec2
+	lastTime float64
+}
+
+func NewCloudRender() (*CloudRender, error) {
+	r := &CloudRender{}
+	var err error
+	mainthread.Call(func() {
+		r.shader, err = glhf.NewShader(glhf.AttrFormat{
+			glhf.Attr{Name: "pos", Type: glhf.Vec3},
+		}, glhf.AttrFormat{
+			glhf.Attr{Name: "matrix", Type: glhf.Mat4},
+			glhf.Attr{Name: "center", Type: glhf.Vec3},
+			glhf.Attr{Name: "radius", Type: glhf.Float},
+			glhf.Attr{Name: "offset", Type: glhf.Vec2},
+			glhf.Attr{Name: "coverage", Type: glhf.Float},
+			glhf.Attr{Name: "dim", Type: glhf.Float},
+			glhf.Attr{Name: "shade", Type: glhf.Float},
+		}, cloudVertexSource, cloudFragmentSource)
+		if err != nil {
+			return
+		}
+		r.quad = render.NewLines(r.shader, []float32{
+			0, 0, 0, 1, 0, 0, 1, 0, 1,
+			1, 0, 1, 0, 0, 1, 0, 0, 0,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Draw draws the layer if the player is above it and the terrain is
+// drawn, or below it and the terrain isn't yet. Call on mainthread.
+func (r *CloudRender) Draw(afterTerrain bool) {
+	now := glfw.GetTime()
+	if !afterTerrain {
+		dt := float32(now - r.lastTime)
+		if r.lastTime == 0 {
+			dt = 0
+		}
+		r.lastTime = now
+		r.offset = r.offset.Add(mgl32.Vec2{-cloudSpeed * game.weather.Wind() * dt, 0})
+	}
+	pos := game.camera.Pos()
+	above := pos.Y() > cloudHeight
+	if !*cloudsEnabled || above != afterTerrain {
+		return
+	}
+
+	radius := geom.Max(2*fogDistance(), minCloudRadius)
+	width, height := game.win.GetSize()
+	mat := mgl32.Perspective(geom.Radian(game.camera.Fov()), float32(width)/float32(height), render.NearPlane, 2*radius)
+	mat = mat.Mul4(game.camera.Matrix())
+	coverage, shade := float32(cloudCoverage), float32(1)
+	if game.weather.storm {
+		coverage, shade = stormCoverage, stormShade
+	}
+
+	gl.Disable(gl.DEPTH_TEST)
+	gl.Disable(gl.CULL_FACE)
+	gl.Enable(gl.BLEND)
+	// keep the opaque alpha of the window, screenshots save it
+	gl.BlendFuncSeparate(gl.SRC_ALPHA, gl.ONE_MINUS_SRC_ALPHA, gl.ZERO, gl.ONE)
+	r.shader.Begin()
+	r.shader.SetUniformAttr(1, mgl32.Vec3{pos.X(), cloudHeight, pos.Z()})
+	r.shader.SetUniformAttr(2, radius)
+	r.shader.SetUniformAttr(3, r.offset)
+	r.shader.SetUniformAttr(4, coverage)
+	r.shader.SetUniformAttr(5, game.Dim())
+	r.shader.SetUniformAttr(6, shade)
+	r.quad.Fill(mat)
+	r.shader.End()
+	gl.Disable(gl.BLEND)
+	gl.Enable(gl.CULL_FACE)
+	gl.Enable(gl.DEPTH_TEST)
+}
@@ -0,0 +1,215 @@
+package game
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Command is a console command, Run returns the message shown to the player.
+type Command struct {
+	Name  string
+	Usage string
+	Run   func(g *Game, args *Args) (string, error)
+}
+
+var commands = make(map[string]*Command)
+
+func RegisterCommand(cmd *Command) {
+	commands[cmd.Name] = cmd
+}
+
+// UnknownCommandError is returned for a command name that is neither a
+// command nor an alias of the player language.
+type UnknownCommandError struct {
+	Name string
+}
+
+func (e *UnknownCommandError) Error() string {
+	return tr("unknown command %q, try /help", e.Name)
+}
+
+// ArgError reports a missing, malformed or extra argument with the usage of
+// the command.
+type ArgError struct {
+	Usage string
+	Name  string // name of the argument, empty for extra arguments
+	Value string // empty when missing
+	Want  string // expected form, already localized
+}
+
+func (e *ArgError) Error() string {
+	switch {
+	case e.Name == "":
+		return tr("too many arguments, usage: %s", e.Usage)
+	case e.Value == "":
+		return tr("missing %s, usage: %s", e.Name, e.Usage)
+	}
+	return tr("bad %s %q, want %s, usage: %s", e.Name, e.Value, e.Want, e.Usage)
+}
+
+// Args parses the arguments of a command in order. The getters return the
+// zero value after the first error, Run checks Err once it read them all.
+type Args struct {
+	cmd  *Command
+	list []string
+	next int
+	err  error
+}
+
+// Len returns the number of arguments left.
+func (a *Args) Len() int {
+	return len(a.list) - a.next
+}
+
+// Peek returns the next argument without consuming it, empty if none is left.
+func (a *Args) Peek() string {
+	if a.Len() == 0 {
+		return ""
+	}
+	return a.list[a.next]
+}
+
+func (a *Args) fail(name, value, want string) {
+	if a.err == nil {
+		a.err = &ArgError{Usage: a.cmd.Usage, Name: name, Value: value, Want: want}
+	}
+}
+
+func (a *Args) pop(name string) (string, bool) {
+	if a.err != nil {
+		return "", false
+	}
+	if a.Len() == 0 {
+		a.fail(name, "", "")
+		return "", false
+	}
+	a.next++
+	return a.list[a.next-1], true
+}
+
+func (a *Args) String(name string) string {
+	s, _ := a.pop(name)
+	return s
+}
+
+// Rest returns the arguments left joined by spaces.
+func (a *Args) Rest(name string) string {
+	if a.err == nil && a.Len() == 0 {
+		a.fail(name, "", "")
+	}
+	if a.err != nil {
+		return ""
+	}
+	s := strings.Join(a.list[a.next:], " ")
+	a.next = len(a.list)
+	return s
+}
+
+func (a *Args) Int(name string) int {
+	s, ok := a.pop(name)
+	if !ok {
+		return 0
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		a.fail(name, s, tr("an integer"))
+	}
+	return v
+}
+
+func (a *Args) Float(name string) float64 {
+	s, ok := a.pop(name)
+	if !ok {
+		return 0
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		a.fail(name, s, tr("a number"))
+	}
+	return v
+}
+
+func (a *Args) Bool(name string) bool {
+	s, ok := a.pop(name)
+	if !ok {
+		return false
+	}
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		a.fail(name, s, tr("true or false"))
+	}
+	return v
+}
+
+// Choice returns the argument if it's one of choices.
+func (a *Args) Choice(name string, choices ...string) string {
+	s, ok := a.pop(name)
+	if !ok {
+		return ""
+	}
+	for _, c := range choices {
+		if s == c {
+			return s
+		}
+	}
+	a.fail(name, s, tr("one of %s", strings.Join(choices, "|")))
+	return ""
+}
+
+// Switch parses on or off.
+func (a *Args) Switch(name string) bool {
+	return a.Choice(name, "on", "off") == "on"
+}
+
+// Range checks that v of argument name is within min and max.
+func (a *Args) Range(name string, v, min, max float64) {
+	if a.err == nil && (v < min || v > max) {
+		a.err = errors.New(tr("%s must be within %v and %v", name, min, max))
+	}
+}
+
+// Err returns the first parse error, or an error if some arguments are left.
+func (a *Args) Err() error {
+	if a.err == nil && a.Len() > 0 {
+		a.err = &ArgError{Usage: a.cmd.Usage}
+	}
+	return a.err
+}
+
+// RunCommand runs a command line, the leading slash is optional. The name
+// may be an alias in the player language.
+func RunCommand(g *Game, line string) (string, error) {
+	fields := strings.Fields(strings.TrimPrefix(line, "/"))
+	if len(fields) == 0 {
+		return "", errors.New(tr("empty command"))
+	}
+	name := fields[0]
+	if alias, ok := commandAliases[lang()][name]; ok {
+		name = alias
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		return "", &UnknownCommandError{Name: fields[0]}
+	}
+	return cmd.Run(g, &Args{cmd: cmd, list: fields[1:]})
+}
+
+func init() {
+	RegisterCommand(&Command{
+		Name:  "help",
+		Usage: "/help",
+		Run: func(g *Game, args *Args) (string, error) {
+			if err := args.Err(); err != nil {
+				return "", err
+			}
+			var usages []string
+			for _, cmd := range commands {
+				usages = append(usages, cmd.Usage)
+			}
+			sort.Strings(usages)
+			return strings.Join(usages, "  "), nil
+		},
+	})
+}
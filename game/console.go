@@ -0,0 +1,91 @@
+package game
+
+import (
+	"strings"
+
+	"github.com/go-gl/glfw/v3.2/glfw"
+)
+
+// how long the output of a command stays in the title
+const consoleMessageTime = 5 // seconds
+
+// Console is the command line, there is no text rendering so the line
+// being typed and the command output are shown in the window title.
+type Console struct {
+	active  bool
+	line    []rune
+	message string
+	shownAt float64
+}
+
+func (c *Console) Open() {
+	c.active = true
+	c.line = c.line[:0]
+}
+
+func (c *Console) Close() {
+	c.active = false
+}
+
+func (c *Console) Active() bool {
+	return c.active
+}
+
+func (c *Console) Input(r rune) {
+	if c.active {
+		c.line = append(c.line, r)
+	}
+}
+
+func (c *Console) Backspace() {
+	if n := len(c.line); n > 0 {
+		c.line = c.line[:n-1]
+	}
+}
+
+// Submit closes the console and returns the typed line.
+func (c *Console) Submit() string {
+	c.active = false
+	return strings.TrimSpace(string(c.line))
+}
+
+func (c *Console) Print(msg string) {
+	c.message = msg
+	c.shownAt = glfw.GetTime()
+}
+
+// Title returns the console text shown in the window title.
+func (c *Console) Title() string {
+	if c.active {
+		return "> " + string(c.line) + "_"
+	}
+	if c.message != "" && glfw.GetTime()-c.shownAt < consoleMessageTime {
+		return c.message
+	}
+	return ""
+}
+
+func (g *Game) onCharCallback(win *glfw.Window, char rune) {
+	g.console.Input(char)
+	g.itemScreen.Input(char)
+}
+
+// onConsoleKey handles the keys while the console is open.
+func (g *Game) onConsoleKey(key glfw.Key) {
+	switch key {
+	case glfw.KeyEscape:
+		g.console.Close()
+	case glfw.KeyBackspace:
+		g.console.Backspace()
+	case glfw.KeyEnter, glfw.KeyKPEnter:
+		line := g.console.Submit()
+		if line == "" {
+			return
+		}
+		msg, err := RunCommand(g, line)
+		if err != nil {
+			msg = err.Error()
+		}
+		g.console.Print(msg)
+	}
+}
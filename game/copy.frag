@@ -0,0 +1,11 @@
+#version 330 core
+
+in vec2 Tex;
+
+uniform sampler2D color;
+
+out vec4 FragColor;
+
+void main() {
+    FragColor = vec4(texture(color, Tex).rgb, 1);
+}
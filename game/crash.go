@@ -0,0 +1,114 @@
+package game
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"runtime/debug"
+	"runtime/pprof"
+	"sync"
+	"time"
+
+	"github.com/icexin/gocraft/net"
+	"github.com/icexin/gocraft/world"
+)
+
+// block edits kept for the crash reports
+const recentEditsSize = 64
+
+type editRecord struct {
+	time time.Time
+	id   world.Vec3
+	w    int
+	from string // "local" or "server"
+}
+
+// RecentEdits is a ring of the last block edits, safe for concurrent use.
+type RecentEdits struct {
+	mutex sync.Mutex
+	list  [recentEditsSize]editRecord
+	next  int
+	n     int
+}
+
+var recentEdits = &RecentEdits{}
+
+func (r *RecentEdits) Add(id world.Vec3, w int, from string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.list[r.next] = editRecord{time.Now(), id, w, from}
+	r.next = (r.next + 1) % recentEditsSize
+	if r.n < recentEditsSize {
+		r.n++
+	}
+}
+
+// List returns the edits from the oldest.
+func (r *RecentEdits) List() []editRecord {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	list := make([]editRecord, 0, r.n)
+	for i := 0; i < r.n; i++ {
+		list = append(list, r.list[(r.next-r.n+i+recentEditsSize)%recentEditsSize])
+	}
+	return list
+}
+
+var crashOnce sync.Once
+
+// crashGuard writes a crash report when the goroutine panics and panics
+// again, defer it first thing in the goroutines of the game.
+func crashGuard() {
+	if v := recover(); v != nil {
+		ReportCrash(v, debug.Stack())
+		panic(v)
+	}
+}
+
+// ReportCrash saves the panic, the stacks, the player, the loaded chunks and
+// the last block edits in crash-<date>.txt, once: the first panic ends the
+// game.
+func ReportCrash(v interface{}, stack []byte) {
+	crashOnce.Do(func() {
+		// a report failing halfway must not hide the panic
+		defer func() {
+			if err := recover(); err != nil {
+				gameLog.Errorf("crash report: %v", err)
+			}
+		}()
+		name := fmt.Sprintf("crash-%s.txt", time.Now().Format("20060102-150405"))
+		f, err := os.Create(name)
+		if err != nil {
+			gameLog.Errorf("crash report: %s", err)
+			return
+		}
+		defer f.Close()
+		writeCrashReport(f, v, stack)
+		gameLog.Errorf("crash report saved to %s", name)
+	})
+}
+
+func writeCrashReport(w io.Writer, v interface{}, stack []byte) {
+	fmt.Fprintf(w, "gocraft crash at %s\n\npanic: %v\n\n%s\n", time.Now().Format(time.RFC3339), v, stack)
+	if game != nil && game.camera != nil {
+		state := game.camera.State()
+		fmt.Fprintf(w, "player: %+v chunk %v\n", state, world.NearBlock(game.camera.Pos()).Chunkid())
+	}
+	if net.ServerAddr() != "" {
+		fmt.Fprintf(w, "server: %s %s\n", net.ServerAddr(), net.ConnectionState())
+	}
+	if game != nil && game.world != nil {
+		chunks := game.world.LoadedChunks()
+		fmt.Fprintf(w, "\nloaded chunks (%d), id version loaded:\n", len(chunks))
+		for _, c := range chunks {
+			fmt.Fprintf(w, "  %v %d %v\n", c.Id(), c.Version(), c.Loaded())
+		}
+	}
+	edits := recentEdits.List()
+	fmt.Fprintf(w, "\nlast block edits (%d):\n", len(edits))
+	for _, e := range edits {
+		fmt.Fprintf(w, "  %s %s %v -> %d\n", e.time.Format("15:04:05.000"), e.from, e.id, e.w)
+	}
+	fmt.Fprintf(w, "\ngoroutines:\n")
+	pprof.Lookup("goroutine").WriteTo(w, 2)
+}
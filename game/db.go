@@ -0,0 +1,56 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/icexin/gocraft/net"
+	"github.com/icexin/gocraft/store"
+	"github.com/icexin/gocraft/world"
+)
+
+var (
+	dbpath  = flags.String("db", "gocraft.db", "db file name")
+	profile = flags.String("profile", "", "player profile, each one has its own position, inventory and spawn, defaults to -name")
+)
+
+// the store of the world played, a cache of the server chunks when online
+var db *store.Store
+
+func InitStore() error {
+	var path string
+	if *dbpath != "" {
+		path = *dbpath
+	}
+	if net.ServerAddr() != "" {
+		name := strings.NewReplacer("://", "_", "/", "_").Replace(net.ServerAddr())
+		path = fmt.Sprintf("cache_%s.db", name)
+	}
+	if path == "" {
+		return errors.New("empty db path")
+	}
+	var err error
+	db, err = store.NewStore(path)
+	if err != nil {
+		return err
+	}
+	db.SetPlayerSlot(playerSlot())
+	return nil
+}
+
+// playerSlot names the player state of the world played by the profile,
+// the local worlds are told apart by seed.
+func playerSlot() string {
+	name := *profile
+	if name == "" {
+		name = net.PlayerName()
+	}
+	if name == "" {
+		name = store.DefaultProfile
+	}
+	if net.ServerAddr() != "" {
+		return net.ServerAddr() + "/" + name
+	}
+	return fmt.Sprintf("local-%d/%s", world.Seed, name)
+}
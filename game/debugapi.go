@@ -0,0 +1,186 @@
+package game
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/icexin/gocraft/net"
+	"github.com/icexin/gocraft/render"
+	"github.com/icexin/gocraft/world"
+)
+
+const maxRenderRadius = 32
+
+// serveDebugAPI registers the debug API of g, served with pprof on -pprof
+// for the tests driving the game and remote debugging: /debug/world,
+// /debug/meshes and /debug/chunk report as json, /debug/radius and
+// /debug/teleport take a POST. Called once the game is built.
+func serveDebugAPI(g *Game) {
+	http.HandleFunc("/debug/world", g.serveWorld)
+	http.HandleFunc("/debug/meshes", g.serveMeshes)
+	http.HandleFunc("/debug/chunk", g.serveChunk)
+	http.HandleFunc("/debug/radius", g.serveRadius)
+	http.HandleFunc("/debug/teleport", g.serveTeleport)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+// intParams parses the int query parameters names of r.
+func intParams(r *http.Request, names ...string) ([]int, error) {
+	values := make([]int, len(names))
+	for i, name := range names {
+		v, err := strconv.Atoi(r.FormValue(name))
+		if err != nil {
+			return nil, fmt.Errorf("bad %s %q", name, r.FormValue(name))
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+func postOnly(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodPost {
+		http.Error(w, "use POST", http.StatusMethodNotAllowed)
+		return false
+	}
+	return true
+}
+
+// serveWorld reports the player, the chunk cache and the rpc stats.
+func (g *Game) serveWorld(w http.ResponseWriter, r *http.Request) {
+	var state PlayerState
+	var cid world.Vec3
+	var stat render.Stat
+	render.FrameTasks.Call(func() {
+		state = g.camera.State()
+		cid = world.NearBlock(g.camera.Pos()).Chunkid()
+		stat = g.blockRender.Stat()
+	})
+	var chunks []world.Vec3
+	for _, c := range g.world.LoadedChunks() {
+		chunks = append(chunks, c.Id())
+	}
+	writeJSON(w, map[string]interface{}{
+		"player": state,
+		"chunk":  cid,
+		"radius": render.Radius(),
+		"world":  g.world.Stats(),
+		"chunks": chunks,
+		"meshes": map[string]interface{}{
+			"cached":    stat.CacheChunks,
+			"rendered":  stat.RendingChunks,
+			"faces":     stat.Faces,
+			"drawcalls": stat.DrawCalls,
+		},
+		"rpc": net.Stat.Stats(),
+	})
+}
+
+type meshInfo struct {
+	Id      world.Vec3
+	Faces   int
+	Stale   bool
+	Version uint64
+	Missing []world.Vec3 `json:",omitempty"`
+}
+
+// serveMeshes lists the meshes of the mesh cache.
+func (g *Game) serveMeshes(w http.ResponseWriter, r *http.Request) {
+	var list []meshInfo
+	meshes := g.blockRender.Meshes()
+	for _, id := range meshes.Ids() {
+		mesh, ok := meshes.Load(id)
+		if !ok {
+			continue
+		}
+		list = append(list, meshInfo{
+			Id:      id,
+			Faces:   mesh.Faces(),
+			Stale:   mesh.Stale(),
+			Version: mesh.Version(),
+			Missing: mesh.Missing(),
+		})
+	}
+	writeJSON(w, list)
+}
+
+type blockInfo struct {
+	X, Y, Z int
+	W       int
+}
+
+// serveChunk dumps the blocks of the chunk at ?x=&z=, in chunk units, the
+// chunk is loaded if it isn't.
+func (g *Game) serveChunk(w http.ResponseWriter, r *http.Request) {
+	v, err := intParams(r, "x", "z")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	chunk := g.world.Chunk(world.Vec3{X: v[0], Y: 0, Z: v[1]})
+	blocks := []blockInfo{}
+	chunk.RangeBlocks(func(id world.Vec3, tp int) {
+		blocks = append(blocks, blockInfo{id.X, id.Y, id.Z, tp})
+	})
+	writeJSON(w, map[string]interface{}{
+		"id":      chunk.Id(),
+		"version": chunk.Version(),
+		"loaded":  chunk.Loaded(),
+		"blocks":  blocks,
+	})
+}
+
+// serveRadius sets the render radius to ?r=.
+func (g *Game) serveRadius(w http.ResponseWriter, r *http.Request) {
+	if !postOnly(w, r) {
+		return
+	}
+	v, err := intParams(r, "r")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if v[0] < 1 || v[0] > maxRenderRadius {
+		http.Error(w, fmt.Sprintf("radius out of range [1, %d]", maxRenderRadius), http.StatusBadRequest)
+		return
+	}
+	render.FrameTasks.Call(func() {
+		g.setRenderRadius(v[0])
+	})
+	writeJSON(w, map[string]int{"radius": v[0]})
+}
+
+// setRenderRadius changes the render radius and the chunk cache with it.
+func (g *Game) setRenderRadius(n int) {
+	settings.RenderRadius = n
+	render.SetRadius(n)
+	g.world.Resize(worldCacheSize(n))
+	g.blockRender.CheckChunks()
+}
+
+// serveTeleport moves the player to ?x=&y=&z=, in blocks, keeping the view.
+func (g *Game) serveTeleport(w http.ResponseWriter, r *http.Request) {
+	if !postOnly(w, r) {
+		return
+	}
+	v, err := intParams(r, "x", "y", "z")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var state PlayerState
+	render.FrameTasks.Call(func() {
+		state = g.camera.State()
+		state.X, state.Y, state.Z = float32(v[0]), float32(v[1]), float32(v[2])
+		g.camera.Restore(state)
+		g.vy = 0
+	})
+	writeJSON(w, state)
+}
@@ -0,0 +1,130 @@
+package game
+
+import (
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/icexin/gocraft/internal/geom"
+	"github.com/icexin/gocraft/render"
+	"github.com/icexin/gocraft/world"
+)
+
+func init() {
+	RegisterCommand(&Command{
+		Name:  "debug",
+		Usage: "/debug chunks|hitbox|ray on|off",
+		Run: func(g *Game, args *Args) (string, error) {
+			what := args.Choice("overlay", "chunks", "hitbox", "ray")
+			on := args.Switch("state")
+			if err := args.Err(); err != nil {
+				return "", err
+			}
+			d := &g.lineRender.debug
+			switch what {
+			case "chunks":
+				d.chunks = on
+			case "hitbox":
+				d.hitbox = on
+			case "ray":
+				d.ray = on
+				if !on {
+					d.setRay(nil, nil, false)
+				}
+			}
+			if on {
+				return what + " on", nil
+			}
+			return what + " off", nil
+		},
+	})
+}
+
+// DebugDraw is the state of the /debug overlays: the borders of the chunks
+// around the player with the mesh sections of the current one, the box
+// Collide keeps out of the blocks, and the ray of the last block placed or
+// mined with the blocks it stepped through.
+type DebugDraw struct {
+	chunks bool
+	hitbox bool
+	ray    bool
+
+	rayLine *render.Lines
+	path    []world.Vec3
+	hit     bool // the last block of path was hit
+}
+
+// setRay replaces the recorded ray, call on mainthread.
+func (d *DebugDraw) setRay(line *render.Lines, path []world.Vec3, hit bool) {
+	if d.rayLine != nil {
+		d.rayLine.Release()
+	}
+	d.rayLine, d.path, d.hit = line, path, hit
+}
+
+// RecordRay keeps the ray cast from pos along front by a block action for
+// /debug ray, call on mainthread.
+func (r *LineRender) RecordRay(pos, front mgl32.Vec3) {
+	if !r.debug.ray {
+		return
+	}
+	path := game.world.RayPath(pos, front)
+	if len(path) == 0 {
+		return
+	}
+	// the line ends at the center of the block hit or of the last one
+	end := path[len(path)-1]
+	line := render.NewLines(r.shader, []float32{
+		pos[0], pos[1], pos[2],
+		float32(end.X), float32(end.Y), float32(end.Z),
+	})
+	r.debug.setRay(line, path, game.world.HasBlock(end))
+}
+
+// drawBox outlines box with the unit cube.
+func (r *LineRender) drawBox(mat mgl32.Mat4, box geom.AABB) {
+	size := box.Max.Sub(box.Min)
+	center := box.Min.Add(size.Mul(0.5))
+	m := mat.Mul4(mgl32.Translate3D(center[0], center[1], center[2]))
+	r.cube.Draw(m.Mul4(mgl32.Scale3D(size[0], size[1], size[2])))
+}
+
+func (r *LineRender) drawDebug(mat mgl32.Mat4) {
+	d := &r.debug
+	if d.chunks {
+		cid := world.NearBlock(game.camera.Pos()).Chunkid()
+		r.shader.SetUniformAttr(1, mgl32.Vec4{1, 1, 0, 1})
+		for dx := -1; dx <= 1; dx++ {
+			for dz := -1; dz <= 1; dz++ {
+				id := world.Vec3{X: cid.X + dx, Y: 0, Z: cid.Z + dz}
+				r.drawBox(mat, render.ChunkAABB(id, 0, world.ChunkHeight-1))
+			}
+		}
+		r.shader.SetUniformAttr(1, mgl32.Vec4{0, 0.5, 1, 1})
+		for y := 0; y < world.ChunkHeight; y += render.SectionHeight {
+			r.drawBox(mat, render.ChunkAABB(cid, y, y+render.SectionHeight-1))
+		}
+	}
+	if d.hitbox {
+		r.shader.SetUniformAttr(1, mgl32.Vec4{1, 1, 1, 1})
+		r.drawBox(mat, world.PlayerBox(game.camera.Pos()))
+	}
+	if d.ray && d.rayLine != nil {
+		r.shader.SetUniformAttr(1, mgl32.Vec4{1, 0, 0, 1})
+		d.rayLine.Draw(mat)
+		for i, id := range d.path {
+			if i == len(d.path)-1 && d.hit {
+				r.shader.SetUniformAttr(1, mgl32.Vec4{1, 0.2, 0.2, 1})
+				r.drawBox(mat, blockAABB(id, 1.04))
+				break
+			}
+			r.shader.SetUniformAttr(1, mgl32.Vec4{1, 0.6, 0.6, 1})
+			r.drawBox(mat, blockAABB(id, 0.3))
+		}
+	}
+	r.shader.SetUniformAttr(1, mgl32.Vec4{0, 0, 0, 1})
+}
+
+// blockAABB returns a box of size centered on block id.
+func blockAABB(id world.Vec3, size float32) geom.AABB {
+	c := mgl32.Vec3{float32(id.X), float32(id.Y), float32(id.Z)}
+	h := mgl32.Vec3{size / 2, size / 2, size / 2}
+	return geom.AABB{Min: c.Sub(h), Max: c.Add(h)}
+}
@@ -0,0 +1,107 @@
+package game
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/icexin/gocraft/render"
+)
+
+var devMode = flags.Bool("dev", false, "watch render/block.vert, render/block.frag and the texture, reloading them when they change")
+
+// how often -dev looks at the files
+const devWatchTime = 500 * time.Millisecond
+
+// the block shader sources read by -dev, the embedded ones are used otherwise
+const (
+	devVertexFile   = "render/block.vert"
+	devFragmentFile = "render/block.frag"
+)
+
+// fileWatcher polls the modification time of files.
+type fileWatcher struct {
+	mtimes map[string]time.Time
+}
+
+func newFileWatcher() *fileWatcher {
+	return &fileWatcher{mtimes: make(map[string]time.Time)}
+}
+
+// Changed reports whether one of files was modified, created or removed
+// since the last call.
+func (w *fileWatcher) Changed(files ...string) bool {
+	changed := false
+	for _, file := range files {
+		var mtime time.Time
+		if info, err := os.Stat(file); err == nil {
+			mtime = info.ModTime()
+		}
+		if last, ok := w.mtimes[file]; ok && !last.Equal(mtime) {
+			changed = true
+		}
+		w.mtimes[file] = mtime
+	}
+	return changed
+}
+
+// devTextureFiles returns the files of the atlas and of the resource pack.
+func devTextureFiles() []string {
+	files := []string{render.TexturePath()}
+	if *packPath != "" {
+		files = append(files, *packPath,
+			filepath.Join(*packPath, render.PackTexture),
+			filepath.Join(*packPath, render.PackBlocks))
+	}
+	return files
+}
+
+// devWatchLoop reloads the block shader and the textures when their files
+// change.
+func (g *Game) devWatchLoop() {
+	defer crashGuard()
+	w := newFileWatcher()
+	w.Changed(devVertexFile, devFragmentFile)
+	w.Changed(devTextureFiles()...)
+	renderLog.Infof("dev mode, watching %s, %s and %v", devVertexFile, devFragmentFile, devTextureFiles())
+	for range time.Tick(devWatchTime) {
+		if w.Changed(devVertexFile, devFragmentFile) {
+			vertexSource, err := os.ReadFile(devVertexFile)
+			if err != nil {
+				renderLog.Errorf("reload shader:%s", err)
+				continue
+			}
+			fragmentSource, err := os.ReadFile(devFragmentFile)
+			if err != nil {
+				renderLog.Errorf("reload shader:%s", err)
+				continue
+			}
+			render.FrameTasks.Post(func() {
+				g.reloadBlockShader(string(vertexSource), string(fragmentSource))
+			})
+		}
+		if w.Changed(devTextureFiles()...) {
+			render.FrameTasks.Post(func() {
+				if err := g.SetResourcePack(render.CurrentPack().Path); err != nil {
+					renderLog.Errorf("reload textures:%s", err)
+					g.console.Print("reload textures: " + err.Error())
+				}
+			})
+		}
+	}
+}
+
+// reloadBlockShader compiles the block shader from the sources and rebuilds
+// the meshes, the old shader is kept if they don't compile. Call on
+// mainthread.
+func (g *Game) reloadBlockShader(vertexSource, fragmentSource string) {
+	shader, err := render.NewBlockShader(vertexSource, fragmentSource)
+	if err != nil {
+		renderLog.Errorf("reload shader:%s", err)
+		g.console.Print("reload shader: " + err.Error())
+		return
+	}
+	g.blockRender.SetShader(shader)
+	g.blockRender.DirtyAll()
+	renderLog.Infof("reloaded %s and %s", devVertexFile, devFragmentFile)
+}
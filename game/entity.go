@@ -0,0 +1,560 @@
+package game
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/icexin/gocraft/internal/geom"
+	"github.com/icexin/gocraft/render"
+	"github.com/icexin/gocraft/world"
+)
+
+// version of the entity encoding in the store
+const entityDataVersion = 1
+
+const (
+	entityGravity = 20
+	entityJump    = 7.5
+	// how fast the entities turn to their walking direction
+	entityTurnSpeed = 8
+	// the reach of the player, the length of the World.HitTest rays
+	entityReach = 8
+	// ticks between the saves of the changed chunks
+	entitySaveTicks = 30 * tickRate
+	// seconds an entity hit can't be hurt again
+	entityHitCooldown = 0.5
+	// blocks per second an entity hit is pushed back, slowing down at the
+	// friction rate
+	entityKnockback = 6
+	entityFriction  = 8
+	// health taken by a hit of the player
+	playerAttack = 2
+)
+
+// EntityKind describes a type of entity, the body, head and legs are drawn
+// with the block meshes of their types, the model facing +x.
+type EntityKind struct {
+	Id   int32 // saved in the store, never reuse one
+	Name string
+
+	Body, Head, Legs int
+	// length along x, width along z and height of the body
+	Size      mgl32.Vec3
+	HeadSize  float32
+	LegHeight float32
+	// two legs and the head on top of the body instead of four legs and
+	// the head in front
+	Upright bool
+	// attacks the player
+	Hostile bool
+
+	Health int
+	// blocks per second walking and running away
+	Speed, RunSpeed float32
+	// the block type fed to breed it, 0 if it doesn't breed
+	Food int
+	// the block type collected in survival mode when killed, 0 if none
+	Drop int
+
+	// think runs the behavior of an entity every tick
+	think func(g *Game, e *Entity)
+}
+
+var (
+	entityKinds = make(map[int32]*EntityKind)
+	// entitySpawners are called every tick to spawn the entities around the
+	// player
+	entitySpawners []func(g *Game)
+)
+
+func RegisterEntityKind(k *EntityKind) {
+	if _, ok := entityKinds[k.Id]; ok {
+		panic(fmt.Sprintf("entity kind %d registered twice", k.Id))
+	}
+	entityKinds[k.Id] = k
+}
+
+// sortedEntityKinds returns the kinds by id, keep is nil or picks the kinds
+// returned.
+func sortedEntityKinds(keep func(k *EntityKind) bool) []*EntityKind {
+	var kinds []*EntityKind
+	for _, k := range entityKinds {
+		if keep == nil || keep(k) {
+			kinds = append(kinds, k)
+		}
+	}
+	sort.Slice(kinds, func(i, j int) bool { return kinds[i].Id < kinds[j].Id })
+	return kinds
+}
+
+// Entity is a creature moving in the world, its position at the feet.
+type Entity struct {
+	Kind   *EntityKind
+	Pos    mgl32.Vec3
+	Yaw    float32 // radians, 0 facing +x
+	Health int
+	// seconds since born, the animals born adult start at growTime
+	Age float32
+	// seconds until the animal breeds again
+	Cooldown float32
+
+	vy       float32
+	onGround bool
+	// the walking direction and speed, the yaw turns to it
+	walk mgl32.Vec2
+	// the behavior state, in ticks
+	think int
+	flee  int
+	// seconds left in love, not saved
+	love float32
+	// the knockback speed and the seconds until it can be hurt again
+	push mgl32.Vec2
+	hurt float32
+	// the blocks to walk to the target and the seconds until the next attack
+	path   []world.Vec3
+	attack float32
+}
+
+func newEntity(kind *EntityKind, pos mgl32.Vec3, yaw float32) *Entity {
+	return &Entity{
+		Kind:   kind,
+		Pos:    pos,
+		Yaw:    yaw,
+		Health: kind.Health,
+		Age:    growTime,
+	}
+}
+
+// Height returns the height of the bounding box, half the size while
+// young.
+func (e *Entity) Height() float32 {
+	head := e.Kind.HeadSize / 2
+	if e.Kind.Upright {
+		head = e.Kind.HeadSize
+	}
+	return (e.Kind.LegHeight + e.Kind.Size.Y() + head) * e.scale()
+}
+
+func (e *Entity) Chunkid() world.Vec3 {
+	return world.NearBlock(e.Pos).Chunkid()
+}
+
+// Block returns the block of the feet.
+func (e *Entity) Block() world.Vec3 {
+	return world.NearBlock(e.Pos.Add(mgl32.Vec3{0, 0.5, 0}))
+}
+
+func (e *Entity) scale() float32 {
+	if e.Age < growTime {
+		return 0.5 + 0.5*e.Age/growTime
+	}
+	return 1
+}
+
+// box returns the bounding box of the entity.
+func (e *Entity) box() (min, max mgl32.Vec3) {
+	s := e.scale()
+	r := geom.Max(e.Kind.Size.X(), e.Kind.Size.Z()) / 2 * s
+	return e.Pos.Sub(mgl32.Vec3{r, 0, r}), e.Pos.Add(mgl32.Vec3{r, e.Height(), r})
+}
+
+// Entities holds the entities of the loaded chunks. The chunks are
+// populated the first time they load, their entities are saved when they
+// unload and loaded back with them. Call on mainthread.
+type Entities struct {
+	list []*Entity
+	// the chunks whose entities are in list
+	loaded map[world.Vec3]bool
+	// the chunks whose saved entities are out of date
+	dirty map[world.Vec3]bool
+	ticks int
+}
+
+func (es *Entities) init() {
+	if es.loaded == nil {
+		es.loaded = make(map[world.Vec3]bool)
+		es.dirty = make(map[world.Vec3]bool)
+	}
+}
+
+func (es *Entities) Len() int {
+	return len(es.list)
+}
+
+func (es *Entities) Add(e *Entity) {
+	es.init()
+	es.list = append(es.list, e)
+	es.dirty[e.Chunkid()] = true
+}
+
+func (es *Entities) Remove(e *Entity) {
+	for i, x := range es.list {
+		if x == e {
+			es.list = append(es.list[:i], es.list[i+1:]...)
+			es.dirty[e.Chunkid()] = true
+			return
+		}
+	}
+}
+
+// Count returns the entities of the kinds picked by keep in chunk cid, all
+// kinds if keep is nil.
+func (es *Entities) Count(cid world.Vec3, keep func(k *EntityKind) bool) int {
+	n := 0
+	for _, e := range es.list {
+		if (keep == nil || keep(e.Kind)) && e.Chunkid() == cid {
+			n++
+		}
+	}
+	return n
+}
+
+// onChunkLoaded loads the saved entities of a chunk or populates it the
+// first time, called from the world load pipeline.
+func (es *Entities) onChunkLoaded(g *Game, cid world.Vec3) {
+	data, ok := db.GetEntities(cid)
+	render.FrameTasks.Post(func() {
+		es.init()
+		if es.loaded[cid] {
+			return
+		}
+		es.loaded[cid] = true
+		if !ok {
+			es.dirty[cid] = true
+			g.populateChunk(cid)
+			return
+		}
+		list, err := decodeEntities(data)
+		if err != nil {
+			storeLog.Errorf("load entities of chunk %v error:%s", cid, err)
+		}
+		es.list = append(es.list, list...)
+	})
+}
+
+// Tick runs the behaviors and saves and drops the entities of the
+// unloaded chunks.
+func (es *Entities) Tick(g *Game) {
+	es.init()
+	// the behaviors may add and remove entities
+	for _, e := range append([]*Entity(nil), es.list...) {
+		if e.Kind.think != nil {
+			e.Kind.think(g, e)
+		}
+	}
+	for _, spawn := range entitySpawners {
+		spawn(g)
+	}
+	// the chunks unloaded this tick are saved at once
+	unloaded := make(map[world.Vec3]bool)
+	for cid := range es.loaded {
+		if _, ok := g.world.PeekChunk(cid); !ok {
+			unloaded[cid] = true
+		}
+	}
+	if len(unloaded) != 0 {
+		es.save(unloaded)
+		list := es.list[:0]
+		for _, e := range es.list {
+			if !unloaded[e.Chunkid()] {
+				list = append(list, e)
+			}
+		}
+		es.list = list
+		for cid := range unloaded {
+			delete(es.loaded, cid)
+		}
+	}
+	es.ticks++
+	if es.ticks%entitySaveTicks == 0 {
+		es.Save()
+	}
+}
+
+// Save saves the entities of the changed chunks and the chunks with
+// entities, they moved.
+func (es *Entities) Save() {
+	chunks := make(map[world.Vec3]bool)
+	for cid := range es.dirty {
+		chunks[cid] = true
+	}
+	for _, e := range es.list {
+		chunks[e.Chunkid()] = true
+	}
+	es.save(chunks)
+}
+
+func (es *Entities) save(chunks map[world.Vec3]bool) {
+	if len(chunks) == 0 {
+		return
+	}
+	lists := make(map[world.Vec3][]*Entity)
+	for _, e := range es.list {
+		if cid := e.Chunkid(); chunks[cid] {
+			lists[cid] = append(lists[cid], e)
+		}
+	}
+	data := make(map[world.Vec3][]byte, len(chunks))
+	for cid := range chunks {
+		data[cid] = encodeEntities(lists[cid])
+		delete(es.dirty, cid)
+	}
+	if err := db.UpdateEntities(data); err != nil {
+		storeLog.Errorf("save entities of %d chunks error:%s", len(data), err)
+	}
+}
+
+// Update moves the entities, they fall, walk and step up a block by
+// jumping, and stay in the loaded chunks.
+func (es *Entities) Update(g *Game, dt float32) {
+	for _, e := range es.list {
+		e.Age += dt
+		e.Cooldown = geom.Max(e.Cooldown-dt, 0)
+		e.love = geom.Max(e.love-dt, 0)
+		e.hurt = geom.Max(e.hurt-dt, 0)
+		e.attack = geom.Max(e.attack-dt, 0)
+		e.push = e.push.Mul(geom.Max(1-entityFriction*dt, 0))
+		es.move(g, e, dt)
+	}
+}
+
+func (es *Entities) move(g *Game, e *Entity, dt float32) {
+	if e.walk.Len() > 0 {
+		d := float32(math.Atan2(float64(e.walk.Y()), float64(e.walk.X()))) - e.Yaw
+		d = float32(math.Remainder(float64(d), 2*math.Pi))
+		e.Yaw += d * geom.Min(entityTurnSpeed*dt, 1)
+	}
+	if v := e.walk.Add(e.push); v.Len() > 0 {
+		next := e.Pos.Add(mgl32.Vec3{v.X() * dt, 0, v.Y() * dt})
+		// the block in front of the body
+		min, max := e.box()
+		ahead := v.Normalize().Mul((max.X() - min.X()) / 2)
+		feet := world.NearBlock(next.Add(mgl32.Vec3{ahead.X(), 0.5, ahead.Y()}))
+		switch {
+		case !es.loaded[feet.Chunkid()]:
+			e.walk, e.push = mgl32.Vec2{}, mgl32.Vec2{}
+		case !es.blocked(g, e, feet):
+			from := e.Chunkid()
+			e.Pos = next
+			if cid := e.Chunkid(); cid != from {
+				es.dirty[from] = true
+				es.dirty[cid] = true
+			}
+		case e.onGround && !es.blocked(g, e, feet.Up()):
+			e.vy = entityJump
+		default:
+			// think again
+			e.walk, e.push = mgl32.Vec2{}, mgl32.Vec2{}
+			e.think = 0
+		}
+	}
+
+	e.vy -= entityGravity * dt
+	y := e.Pos.Y() + e.vy*dt
+	e.onGround = false
+	if e.vy <= 0 {
+		ground := world.NearBlock(mgl32.Vec3{e.Pos.X(), y - 0.01, e.Pos.Z()})
+		if world.IsObstacle(g.world.Block(ground)) {
+			y = float32(ground.Y) + 0.5
+			e.vy = 0
+			e.onGround = true
+		}
+	} else if world.IsObstacle(g.world.Block(world.NearBlock(mgl32.Vec3{e.Pos.X(), y + e.Height(), e.Pos.Z()}))) {
+		y = e.Pos.Y()
+		e.vy = 0
+	}
+	e.Pos[1] = y
+}
+
+// blocked reports whether an entity with its feet in block id hits a block.
+func (es *Entities) blocked(g *Game, e *Entity, id world.Vec3) bool {
+	for h := float32(0); h < e.Height(); h++ {
+		if world.IsObstacle(g.world.Block(world.Vec3{X: id.X, Y: id.Y + int(h), Z: id.Z})) {
+			return true
+		}
+	}
+	return false
+}
+
+// HitTest returns the entity hit by the ray from pos along the unit vector
+// vec before block, the block hit by World.HitTest, and its distance.
+func (es *Entities) HitTest(pos, vec mgl32.Vec3, block *world.Vec3) (*Entity, float32) {
+	maxLen := float32(entityReach)
+	if block != nil {
+		b := mgl32.Vec3{float32(block.X), float32(block.Y), float32(block.Z)}
+		half := mgl32.Vec3{0.5, 0.5, 0.5}
+		if t, ok := rayBox(pos, vec, b.Sub(half), b.Add(half)); ok {
+			maxLen = t
+		}
+	}
+	var hit *Entity
+	for _, e := range es.list {
+		min, max := e.box()
+		if t, ok := rayBox(pos, vec, min, max); ok && t < maxLen {
+			hit, maxLen = e, t
+		}
+	}
+	return hit, maxLen
+}
+
+// attackEntity hits the entity under the cross, false if there is none
+// before the block.
+func (g *Game) attackEntity() bool {
+	block, _ := g.world.HitTest(g.camera.Pos(), g.camera.Front())
+	e, _ := g.entities.HitTest(g.camera.Pos(), g.camera.Front(), block)
+	if e == nil {
+		return false
+	}
+	g.hurtEntity(e, playerAttack, g.camera.Pos())
+	g.markHit()
+	return true
+}
+
+// hurtEntity takes damage from the health of e hit from pos, unless it was
+// hit less than entityHitCooldown ago. It's knocked back and runs away, or
+// drops its block in survival mode when killed.
+func (g *Game) hurtEntity(e *Entity, damage int, pos mgl32.Vec3) {
+	if e.hurt > 0 {
+		return
+	}
+	e.Health -= damage
+	if e.Health <= 0 {
+		g.entities.Remove(e)
+		if g.mode == ModeSurvival && e.Kind.Drop != 0 {
+			g.inventory.Add(e.Kind.Drop, 1)
+		}
+		return
+	}
+	e.hurt = entityHitCooldown
+	e.vy = entityJump / 2
+	if away := flat(e.Pos.Sub(pos)); away.Len() > 0 {
+		e.push = away.Normalize().Mul(entityKnockback)
+	}
+	e.flee = fleeTicks
+}
+
+// rayBox returns the distance along the ray from pos along vec to the box
+// from min to max.
+func rayBox(pos, vec, min, max mgl32.Vec3) (float32, bool) {
+	near, far := float32(math.Inf(-1)), float32(math.Inf(1))
+	for i := 0; i < 3; i++ {
+		if vec[i] == 0 {
+			if pos[i] < min[i] || pos[i] > max[i] {
+				return 0, false
+			}
+			continue
+		}
+		t1, t2 := (min[i]-pos[i])/vec[i], (max[i]-pos[i])/vec[i]
+		if t1 > t2 {
+			t1, t2 = t2, t1
+		}
+		near, far = geom.Max(near, t1), geom.Min(far, t2)
+	}
+	if near > far || far < 0 {
+		return 0, false
+	}
+	return geom.Max(near, 0), true
+}
+
+// drawEntities draws the entities with the block meshes, call between
+// Begin and End of the block shader.
+func (g *Game) drawEntities(mat mgl32.Mat4) {
+	shader := g.blockRender.Shader()
+	for _, e := range g.entities.list {
+		k := e.Kind
+		s := e.scale()
+		base := mat.Mul4(mgl32.Translate3D(e.Pos.X(), e.Pos.Y(), e.Pos.Z()))
+		base = base.Mul4(mgl32.HomogRotate3DY(-e.Yaw)).Mul4(mgl32.Scale3D(s, s, s))
+		draw := func(tp int, center, size mgl32.Vec3) {
+			model := mgl32.Translate3D(center.X(), center.Y(), center.Z()).Mul4(mgl32.Scale3D(size.X(), size.Y(), size.Z()))
+			shader.SetUniformAttr(0, base.Mul4(model))
+			g.blockRender.BlockMesh(tp).Draw()
+		}
+		body := k.Size
+		draw(k.Body, mgl32.Vec3{0, k.LegHeight + body.Y()/2, 0}, body)
+		head := mgl32.Vec3{k.HeadSize, k.HeadSize, k.HeadSize}
+		leg := mgl32.Vec3{body.Z() / 4, k.LegHeight, body.Z() / 4}
+		legs := [][2]float32{{1, 1}, {1, -1}, {-1, 1}, {-1, -1}}
+		if k.Upright {
+			draw(k.Head, mgl32.Vec3{0, k.LegHeight + body.Y() + k.HeadSize/2, 0}, head)
+			leg = mgl32.Vec3{body.X() * 0.8, k.LegHeight, body.Z() * 0.4}
+			legs = [][2]float32{{0, 1}, {0, -1}}
+		} else {
+			draw(k.Head, mgl32.Vec3{body.X() / 2, k.LegHeight + body.Y(), 0}, head)
+		}
+		for _, c := range legs {
+			draw(k.Legs, mgl32.Vec3{c[0] * (body.X() - leg.X()) / 2, k.LegHeight / 2, c[1] * (body.Z() - leg.Z()) / 2}, leg)
+		}
+	}
+	shader.SetUniformAttr(0, mat)
+}
+
+type entityRecord struct {
+	Kind     int32
+	X, Y, Z  float32
+	Yaw      float32
+	Health   int32
+	Age      float32
+	Cooldown float32
+}
+
+// encodeEntities encodes list as the version byte, a count and the
+// records in little endian.
+func encodeEntities(list []*Entity) []byte {
+	buf := new(bytes.Buffer)
+	buf.WriteByte(entityDataVersion)
+	binary.Write(buf, binary.LittleEndian, int32(len(list)))
+	for _, e := range list {
+		binary.Write(buf, binary.LittleEndian, &entityRecord{
+			Kind:     e.Kind.Id,
+			X:        e.Pos.X(),
+			Y:        e.Pos.Y(),
+			Z:        e.Pos.Z(),
+			Yaw:      e.Yaw,
+			Health:   int32(e.Health),
+			Age:      e.Age,
+			Cooldown: e.Cooldown,
+		})
+	}
+	return buf.Bytes()
+}
+
+// decodeEntities decodes the entities of a chunk, skipping the unknown
+// kinds.
+func decodeEntities(b []byte) ([]*Entity, error) {
+	if len(b) == 0 {
+		return nil, fmt.Errorf("empty entity data")
+	}
+	if b[0] > entityDataVersion {
+		return nil, fmt.Errorf("entity data version %d is newer than %d", b[0], entityDataVersion)
+	}
+	buf := bytes.NewReader(b[1:])
+	var n int32
+	if err := binary.Read(buf, binary.LittleEndian, &n); err != nil {
+		return nil, fmt.Errorf("bad entity data:%s", err)
+	}
+	var list []*Entity
+	for i := int32(0); i < n; i++ {
+		var rec entityRecord
+		if err := binary.Read(buf, binary.LittleEndian, &rec); err != nil {
+			return list, fmt.Errorf("bad entity data:%s", err)
+		}
+		kind, ok := entityKinds[rec.Kind]
+		if !ok {
+			continue
+		}
+		list = append(list, &Entity{
+			Kind:     kind,
+			Pos:      mgl32.Vec3{rec.X, rec.Y, rec.Z},
+			Yaw:      rec.Yaw,
+			Health:   int(rec.Health),
+			Age:      rec.Age,
+			Cooldown: rec.Cooldown,
+		})
+	}
+	return list, nil
+}
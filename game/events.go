@@ -0,0 +1,104 @@
+package game
+
+import (
+	"sync"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/icexin/gocraft/world"
+)
+
+type EventKind int
+
+const (
+	EventBlockPlaced EventKind = iota
+	EventBlockBroken
+	EventPlayerMoved
+	EventChunkLoaded
+	EventPlayerJoined
+	EventDamage
+	EventDeath
+)
+
+// Event is published on the event bus, the handlers switch on its concrete type.
+type Event interface {
+	Kind() EventKind
+}
+
+// BlockPlaced is published when the player places block W at Id, on the
+// main thread.
+type BlockPlaced struct {
+	Id world.Vec3
+	W  int
+}
+
+// BlockBroken is published when the player breaks block W at Id, on the
+// main thread.
+type BlockBroken struct {
+	Id world.Vec3
+	W  int
+}
+
+// PlayerMoved is published every frame the player moves, on the main thread.
+type PlayerMoved struct {
+	From, To mgl32.Vec3
+}
+
+// ChunkLoaded is published once the saved and fetched changes of a chunk
+// are applied, from the world load pipeline.
+type ChunkLoaded struct {
+	Chunk   *world.Chunk
+	Changed bool
+}
+
+// PlayerJoined is published when another player shows up, from the rpc
+// handlers.
+type PlayerJoined struct {
+	Id int32
+}
+
+// Damage is published when the player is hurt, on the main thread.
+type Damage struct {
+	Amount int
+	Reason string
+}
+
+// Death is published when the player dies, on the main thread.
+type Death struct {
+	Reason string
+}
+
+func (BlockPlaced) Kind() EventKind  { return EventBlockPlaced }
+func (BlockBroken) Kind() EventKind  { return EventBlockBroken }
+func (PlayerMoved) Kind() EventKind  { return EventPlayerMoved }
+func (ChunkLoaded) Kind() EventKind  { return EventChunkLoaded }
+func (PlayerJoined) Kind() EventKind { return EventPlayerJoined }
+func (Damage) Kind() EventKind       { return EventDamage }
+func (Death) Kind() EventKind        { return EventDeath }
+
+// EventBus calls the handlers subscribed to an event kind in subscription
+// order, on the goroutine publishing the event. Subsystems like the
+// animations and the plugins hook into the game through it instead of
+// being called by Game.
+type EventBus struct {
+	mutex    sync.RWMutex
+	handlers map[EventKind][]func(Event)
+}
+
+var events = &EventBus{
+	handlers: make(map[EventKind][]func(Event)),
+}
+
+func (b *EventBus) Subscribe(kind EventKind, f func(Event)) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.handlers[kind] = append(b.handlers[kind], f)
+}
+
+func (b *EventBus) Publish(e Event) {
+	b.mutex.RLock()
+	handlers := b.handlers[e.Kind()]
+	b.mutex.RUnlock()
+	for _, f := range handlers {
+		f(e)
+	}
+}
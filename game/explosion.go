@@ -0,0 +1,78 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+
+	"github.com/icexin/gocraft/internal/geom"
+	"github.com/icexin/gocraft/net"
+	"github.com/icexin/gocraft/world"
+)
+
+const (
+	defaultExplosionPower = 4
+	maxExplosionPower     = 12
+	// blocks lose this much power per unit of resistance
+	resistanceFactor = 0.3
+	// width of the crater edge where blocks are removed by chance
+	craterEdge = 1.5
+)
+
+func init() {
+	RegisterCommand(&Command{
+		Name:  "explode",
+		Usage: "/explode [power]",
+		Run: func(g *Game, args *Args) (string, error) {
+			power := float64(defaultExplosionPower)
+			if args.Len() > 0 {
+				power = args.Float("power")
+			}
+			if err := args.Err(); err != nil {
+				return "", err
+			}
+			block, _ := g.world.HitTest(g.camera.Pos(), g.camera.Front())
+			if block == nil {
+				return "", errors.New(tr("no block in sight"))
+			}
+			n := g.Explode(*block, float32(power))
+			return fmt.Sprintf("%d blocks destroyed", n), nil
+		},
+	})
+}
+
+// Explode removes the blocks around center, a block survives if its
+// resistance eats the power left at its distance. Blocks near the edge of
+// the crater are removed by chance so the crater isn't a perfect sphere.
+// It returns the number of destroyed blocks.
+func (g *Game) Explode(center world.Vec3, power float32) int {
+	if power > maxExplosionPower {
+		power = maxExplosionPower
+	}
+	r := int(power + 1)
+	var edits []net.BlockEdit
+	for dy := -r; dy <= r; dy++ {
+		for dz := -r; dz <= r; dz++ {
+			for dx := -r; dx <= r; dx++ {
+				id := world.Vec3{X: center.X + dx, Y: center.Y + dy, Z: center.Z + dz}
+				tp := g.world.Block(id)
+				if tp <= 0 || net.ChunkLocked(id.Chunkid()) {
+					continue
+				}
+				dist := geom.Sqrt(float32(dx*dx + dy*dy + dz*dz))
+				left := power - dist - world.BlockResistance(tp)*resistanceFactor
+				if left <= 0 {
+					continue
+				}
+				if left < craterEdge && rand.Float32() > left/craterEdge {
+					continue
+				}
+				edits = append(edits, net.BlockEdit{Id: id, W: 0})
+			}
+		}
+	}
+	if len(edits) > 0 {
+		g.UpdateBlocks(edits...)
+	}
+	return len(edits)
+}
@@ -0,0 +1,354 @@
+package game
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/icexin/gocraft/internal/geom"
+	"github.com/icexin/gocraft/render"
+	"github.com/icexin/gocraft/world"
+)
+
+const (
+	maxExportRadius = 256
+	// the largest model of a .vox file, bigger exports are split
+	voxModelSize = 256
+)
+
+func init() {
+	RegisterCommand(&Command{
+		Name:  "export",
+		Usage: "/export vox|obj [radius|x1 y1 z1 x2 y2 z2]",
+		Run: func(g *Game, args *Args) (string, error) {
+			format := args.Choice("format", "vox", "obj")
+			box := exportBox{all: true}
+			switch args.Len() {
+			case 0:
+			case 1:
+				r := args.Int("radius")
+				args.Range("radius", float64(r), 1, maxExportRadius)
+				c := world.NearBlock(g.camera.Pos())
+				box = newExportBox(c.X-r, c.Y-r, c.Z-r, c.X+r, c.Y+r, c.Z+r)
+			default:
+				x1, y1, z1 := args.Int("x1"), args.Int("y1"), args.Int("z1")
+				x2, y2, z2 := args.Int("x2"), args.Int("y2"), args.Int("z2")
+				box = newExportBox(x1, y1, z1, x2, y2, z2)
+			}
+			if err := args.Err(); err != nil {
+				return "", err
+			}
+			var chunks []*world.Chunk
+			for _, c := range g.world.LoadedChunks() {
+				if c.Loaded() && box.hasChunk(c.Id()) {
+					chunks = append(chunks, c)
+				}
+			}
+			if len(chunks) == 0 {
+				return "", fmt.Errorf("no loaded chunk to export")
+			}
+			name := fmt.Sprintf("export-%s.%s", time.Now().Format("20060102-150405"), format)
+			go func() {
+				defer crashGuard()
+				var n int
+				var err error
+				if format == "vox" {
+					n, err = exportVox(name, g.world, chunks, box)
+				} else {
+					n, err = exportObj(name, g.world, chunks, box)
+				}
+				msg := fmt.Sprintf("exported %d blocks to %s", n, name)
+				if err != nil {
+					msg = fmt.Sprintf("export error:%s", err)
+					gameLog.Errorf("%s", msg)
+				}
+				render.FrameTasks.Post(func() {
+					g.console.Print(msg)
+				})
+			}()
+			return fmt.Sprintf("exporting %d chunks to %s", len(chunks), name), nil
+		},
+	})
+}
+
+// exportBox is the region exported, all the loaded chunks if all is set.
+type exportBox struct {
+	all      bool
+	min, max world.Vec3
+}
+
+func newExportBox(x1, y1, z1, x2, y2, z2 int) exportBox {
+	return exportBox{
+		min: world.Vec3{X: geom.MinInt(x1, x2), Y: geom.MinInt(y1, y2), Z: geom.MinInt(z1, z2)},
+		max: world.Vec3{X: geom.MaxInt(x1, x2), Y: geom.MaxInt(y1, y2), Z: geom.MaxInt(z1, z2)},
+	}
+}
+
+func (b exportBox) has(id world.Vec3) bool {
+	return b.all || id.X >= b.min.X && id.X <= b.max.X &&
+		id.Y >= b.min.Y && id.Y <= b.max.Y &&
+		id.Z >= b.min.Z && id.Z <= b.max.Z
+}
+
+func (b exportBox) hasChunk(cid world.Vec3) bool {
+	if b.all {
+		return true
+	}
+	x0, z0 := cid.X*world.ChunkWidth, cid.Z*world.ChunkWidth
+	return x0 <= b.max.X && x0+world.ChunkWidth > b.min.X &&
+		z0 <= b.max.Z && z0+world.ChunkWidth > b.min.Z
+}
+
+// exportBlocks calls f on the blocks of chunks inside box with the block
+// reader of their snapshot, the blocks out of the box read as air.
+func exportBlocks(w *world.World, chunks []*world.Chunk, box exportBox, f func(id world.Vec3, tp int, block func(world.Vec3) int)) {
+	for _, chunk := range chunks {
+		c := w.BorderSnapshot(chunk)
+		block := func(id world.Vec3) int {
+			if !box.has(id) {
+				return 0
+			}
+			return c.Block(id)
+		}
+		c.RangeBlocks(func(id world.Vec3, tp int) {
+			if box.has(id) {
+				f(id, tp, block)
+			}
+		})
+	}
+}
+
+// voxWriter writes the chunks of a MagicaVoxel file, RIFF style: id,
+// content size, children size, content.
+type voxWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (v *voxWriter) write(data ...interface{}) {
+	for _, d := range data {
+		if v.err == nil {
+			v.err = binary.Write(v.w, binary.LittleEndian, d)
+		}
+	}
+}
+
+func (v *voxWriter) chunk(id string, content []byte) {
+	v.write([]byte(id), int32(len(content)), int32(0), content)
+}
+
+// voxContent encodes the values of a chunk content, strings and dicts as
+// .vox expects them.
+func voxContent(values ...interface{}) []byte {
+	buf := new(bytes.Buffer)
+	for _, value := range values {
+		switch v := value.(type) {
+		case string:
+			binary.Write(buf, binary.LittleEndian, int32(len(v)))
+			buf.WriteString(v)
+		case map[string]string:
+			keys := make([]string, 0, len(v))
+			for k := range v {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			binary.Write(buf, binary.LittleEndian, int32(len(keys)))
+			for _, k := range keys {
+				binary.Write(buf, binary.LittleEndian, int32(len(k)))
+				buf.WriteString(k)
+				binary.Write(buf, binary.LittleEndian, int32(len(v[k])))
+				buf.WriteString(v[k])
+			}
+		default:
+			binary.Write(buf, binary.LittleEndian, v)
+		}
+	}
+	return buf.Bytes()
+}
+
+// exportVox writes the blocks to a MagicaVoxel .vox file, z up, one model
+// per voxModelSize cube placed by the scene graph. The colors are the
+// average colors of the top tiles.
+func exportVox(name string, w *world.World, chunks []*world.Chunk, box exportBox) (int, error) {
+	type model struct {
+		cell   [3]int
+		voxels []byte
+	}
+	models := make(map[[3]int]*model)
+	palette := make(map[int]byte)
+	var colors []int
+	min := box.min
+	if box.all {
+		min = world.Vec3{X: chunks[0].Id().X * world.ChunkWidth, Y: 0, Z: chunks[0].Id().Z * world.ChunkWidth}
+		for _, c := range chunks {
+			min.X = geom.MinInt(min.X, c.Id().X*world.ChunkWidth)
+			min.Z = geom.MinInt(min.Z, c.Id().Z*world.ChunkWidth)
+		}
+	}
+	n := 0
+	exportBlocks(w, chunks, box, func(id world.Vec3, tp int, block func(world.Vec3) int) {
+		idx, ok := palette[tp]
+		if !ok {
+			if len(colors) == 255 {
+				// out of colors, the last one is shared
+				idx = 255
+			} else {
+				colors = append(colors, tp)
+				idx = byte(len(colors))
+			}
+			palette[tp] = idx
+		}
+		// y up to z up, x stays and the z axis turns to -y
+		x, y, z := id.X-min.X, id.Z-min.Z, id.Y-min.Y
+		cell := [3]int{x / voxModelSize, y / voxModelSize, z / voxModelSize}
+		m, ok := models[cell]
+		if !ok {
+			m = &model{cell: cell}
+			models[cell] = m
+		}
+		m.voxels = append(m.voxels, byte(x%voxModelSize), byte(voxModelSize-1-y%voxModelSize), byte(z%voxModelSize), idx)
+		n++
+	})
+	if n == 0 {
+		return 0, fmt.Errorf("nothing to export")
+	}
+	list := make([]*model, 0, len(models))
+	for _, m := range models {
+		list = append(list, m)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		a, b := list[i].cell, list[j].cell
+		if a[0] != b[0] {
+			return a[0] < b[0]
+		}
+		if a[1] != b[1] {
+			return a[1] < b[1]
+		}
+		return a[2] < b[2]
+	})
+
+	var body bytes.Buffer
+	v := &voxWriter{w: &body}
+	for _, m := range list {
+		v.chunk("SIZE", voxContent(int32(voxModelSize), int32(voxModelSize), int32(voxModelSize)))
+		v.chunk("XYZI", voxContent(int32(len(m.voxels)/4), m.voxels))
+	}
+	// scene graph: a root transform, a group, then a transform and a
+	// shape per model, the transforms move the model centers
+	v.chunk("nTRN", voxContent(int32(0), map[string]string{}, int32(1), int32(-1), int32(-1), int32(1), map[string]string{}))
+	group := []interface{}{int32(1), map[string]string{}, int32(len(list))}
+	for i := range list {
+		group = append(group, int32(2+2*i))
+	}
+	v.chunk("nGRP", voxContent(group...))
+	for i, m := range list {
+		t := fmt.Sprintf("%d %d %d",
+			m.cell[0]*voxModelSize+voxModelSize/2,
+			-(m.cell[1]*voxModelSize + voxModelSize/2),
+			m.cell[2]*voxModelSize+voxModelSize/2)
+		v.chunk("nTRN", voxContent(int32(2+2*i), map[string]string{}, int32(3+2*i), int32(-1), int32(0), int32(1), map[string]string{"_t": t}))
+		v.chunk("nSHP", voxContent(int32(3+2*i), map[string]string{}, int32(1), int32(i), map[string]string{}))
+	}
+	tiles := newTileColors()
+	rgba := make([]byte, 256*4)
+	for i, tp := range colors {
+		c := tiles.color(render.CurrentPack().Tiles(tp)[2])
+		copy(rgba[i*4:], []byte{c.R, c.G, c.B, c.A})
+	}
+	v.chunk("RGBA", rgba)
+	if v.err != nil {
+		return 0, v.err
+	}
+
+	f, err := os.Create(name)
+	if err != nil {
+		return 0, err
+	}
+	out := &voxWriter{w: f}
+	out.write([]byte("VOX "), int32(150), []byte("MAIN"), int32(0), int32(body.Len()), body.Bytes())
+	err = out.err
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return n, err
+}
+
+// exportObj writes the visible faces of the blocks to a Wavefront .obj
+// with a .mtl using the block atlas, saved as a png next to it, the uvs are
+// the ones of the chunk meshes.
+func exportObj(name string, w *world.World, chunks []*world.Chunk, box exportBox) (int, error) {
+	base := name[:len(name)-len(filepath.Ext(name))]
+	atlas := base + ".png"
+	mtl := base + ".mtl"
+	img := &image.NRGBA{Pix: render.CurrentPack().Pix, Stride: render.CurrentPack().Rect.Dx() * 4, Rect: render.CurrentPack().Rect}
+	// the uvs count the rows from the top of the atlas, .obj from the bottom
+	if err := savePNG(atlas, flipImage(img)); err != nil {
+		return 0, err
+	}
+	err := os.WriteFile(mtl, []byte(fmt.Sprintf("newmtl blocks\nKd 1 1 1\nmap_Kd %s\nmap_d %s\n", filepath.Base(atlas), filepath.Base(atlas))), 0666)
+	if err != nil {
+		return 0, err
+	}
+
+	f, err := os.Create(name)
+	if err != nil {
+		return 0, err
+	}
+	out := bufio.NewWriter(f)
+	fmt.Fprintf(out, "# gocraft export\nmtllib %s\nusemtl blocks\n", filepath.Base(mtl))
+	n, nvertex := 0, 0
+	var vertices []float32
+	exportBlocks(w, chunks, box, func(id world.Vec3, tp int, block func(world.Vec3) int) {
+		visible := func(nb int) bool {
+			return nb <= 0 || world.IsTransparent(nb) && !(world.IsTranslucent(tp) && nb == tp)
+		}
+		show := [...]bool{
+			visible(block(id.Left())),
+			visible(block(id.Right())),
+			visible(block(id.Up())),
+			visible(block(id.Down())),
+			visible(block(id.Front())),
+			visible(block(id.Back())),
+		}
+		if world.IsPlant(tp) {
+			vertices = render.MakePlantData(vertices[:0], show, id, render.Textures.Texture(tp))
+		} else {
+			vertices = render.MakeCubeData(vertices[:0], show, id, render.Textures.Texture(tp))
+		}
+		if len(vertices) == 0 {
+			return
+		}
+		n++
+		// x y z u v nx ny nz, the faces are the triangles a b c, c d a
+		for i := 0; i < len(vertices); i += 8 {
+			v := vertices[i : i+8]
+			fmt.Fprintf(out, "v %g %g %g\nvt %g %g\nvn %g %g %g\n", v[0], v[1], v[2], v[3], v[4], v[5], v[6], v[7])
+		}
+		for i := 0; i < len(vertices)/8; i += 3 {
+			a, b, c := nvertex+i+1, nvertex+i+2, nvertex+i+3
+			fmt.Fprintf(out, "f %d/%d/%d %d/%d/%d %d/%d/%d\n", a, a, a, b, b, b, c, c, c)
+		}
+		nvertex += len(vertices) / 8
+	})
+	err = out.Flush()
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return n, err
+}
+
+func flipImage(img *image.NRGBA) *image.NRGBA {
+	b := img.Bounds()
+	flipped := image.NewNRGBA(b)
+	for y := 0; y < b.Dy(); y++ {
+		copy(flipped.Pix[y*flipped.Stride:(y+1)*flipped.Stride], img.Pix[(b.Dy()-1-y)*img.Stride:])
+	}
+	return flipped
+}
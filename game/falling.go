@@ -0,0 +1,100 @@
+package game
+
+import (
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/icexin/gocraft/internal/geom"
+	"github.com/icexin/gocraft/net"
+	"github.com/icexin/gocraft/world"
+)
+
+const (
+	fallingTickDelay = 2 // ticks before an unsupported block starts falling
+	fallingGravity   = 20
+	maxFallingSpeed  = 40
+	// moves per tick, a block never falls more than half a block at once
+	fallingSteps = 4
+)
+
+// IsFalling reports whether blocks of type tp fall when unsupported.
+func IsFalling(tp int) bool {
+	return tp == world.Sand || tp == world.Gravel
+}
+
+// FallingBlock is a sand or gravel block falling, it's placed back in the
+// world on the first obstacle below.
+type FallingBlock struct {
+	tp  int
+	pos mgl32.Vec3
+	vy  float32
+	// pos before the last tick
+	prev mgl32.Vec3
+}
+
+func init() {
+	blockTickers[world.Sand] = tickFalling
+	blockTickers[world.Gravel] = tickFalling
+}
+
+// tickFalling turns an unsupported block into a falling block.
+func tickFalling(g *Game, id world.Vec3) {
+	tp := g.world.Block(id)
+	if !IsFalling(tp) || world.IsObstacle(g.world.Block(id.Down())) {
+		return
+	}
+	g.UpdateBlocks(net.BlockEdit{Id: id, W: 0})
+	pos := mgl32.Vec3{float32(id.X), float32(id.Y), float32(id.Z)}
+	g.falling = append(g.falling, &FallingBlock{
+		tp:   tp,
+		pos:  pos,
+		prev: pos,
+	})
+}
+
+// scheduleFalling checks the blocks that may lose their support after an edit.
+func (g *Game) scheduleFalling(e net.BlockEdit) {
+	if IsFalling(e.W) {
+		g.ticker.Schedule(e.Id, fallingTickDelay)
+	}
+	if !world.IsObstacle(e.W) {
+		g.ticker.Schedule(e.Id.Up(), fallingTickDelay)
+	}
+}
+
+// stepFalling moves the falling blocks of one tick, paused with the ticks.
+func (g *Game) stepFalling() {
+	for _, b := range g.falling {
+		b.prev = b.pos
+	}
+	for i := 0; i < fallingSteps; i++ {
+		g.updateFalling(1.0 / tickRate / fallingSteps)
+	}
+}
+
+// updateFalling moves the falling blocks by dt seconds and lands them.
+func (g *Game) updateFalling(dt float64) {
+	falling := g.falling[:0]
+	for _, b := range g.falling {
+		b.vy = geom.Min(b.vy+fallingGravity*float32(dt), maxFallingSpeed)
+		next := b.pos.Sub(mgl32.Vec3{0, b.vy * float32(dt), 0})
+		below := world.NearBlock(next).Down()
+		if next.Y() <= float32(below.Y)+1 && world.IsObstacle(g.world.Block(below)) {
+			// land on the block below, replacing plants and fire
+			g.UpdateBlocks(net.BlockEdit{Id: below.Up(), W: b.tp})
+			continue
+		}
+		b.pos = next
+		falling = append(falling, b)
+	}
+	g.falling = falling
+}
+
+// drawFalling draws the falling blocks with the block meshes, call between
+// Begin and End of the block shader.
+func (g *Game) drawFalling(mat mgl32.Mat4) {
+	partial := g.ticker.Partial()
+	for _, b := range g.falling {
+		pos := b.prev.Add(b.pos.Sub(b.prev).Mul(partial))
+		g.blockRender.Shader().SetUniformAttr(0, mat.Mul4(mgl32.Translate3D(pos.X(), pos.Y(), pos.Z())))
+		g.blockRender.BlockMesh(b.tp).Draw()
+	}
+}
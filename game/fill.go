@@ -0,0 +1,95 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/icexin/gocraft/internal/geom"
+	"github.com/icexin/gocraft/net"
+	"github.com/icexin/gocraft/world"
+)
+
+// the most blocks a /fill changes at once, the update queue sends them in
+// batches
+const maxFillBlocks = 32 * 32 * 32
+
+func init() {
+	RegisterCommand(&Command{
+		Name:  "fill",
+		Usage: "/fill x1 y1 z1 x2 y2 z2 type",
+		Run: func(g *Game, args *Args) (string, error) {
+			var corners [6]int
+			for i, name := range [...]string{"x1", "y1", "z1", "x2", "y2", "z2"} {
+				corners[i] = args.Int(name)
+			}
+			w := args.Int("type")
+			if err := args.Err(); err != nil {
+				return "", err
+			}
+			if w != 0 && !placeable(w) {
+				return "", fmt.Errorf("unknown block type %d", w)
+			}
+			if g.mode == ModeSurvival {
+				return "", errors.New("fill needs the creative mode")
+			}
+			a := world.Vec3{X: corners[0], Y: corners[1], Z: corners[2]}
+			b := world.Vec3{X: corners[3], Y: corners[4], Z: corners[5]}
+			n, skipped, err := g.fill(a, b, w)
+			if err != nil {
+				return "", err
+			}
+			msg := fmt.Sprintf("filled %d blocks", n)
+			if skipped > 0 {
+				msg += fmt.Sprintf(", %d protected left alone", skipped)
+			}
+			return msg, nil
+		},
+	})
+}
+
+// placeable reports whether the player can hold blocks of type w.
+func placeable(w int) bool {
+	for _, item := range availableItems {
+		if item == w {
+			return true
+		}
+	}
+	return false
+}
+
+// fill sets the blocks of the box between corners a and b to w, 0 clears
+// them. The changed blocks are queued for the server at once through
+// UpdateBlocks, the blocks of the locked chunks are skipped.
+func (g *Game) fill(a, b world.Vec3, w int) (n, skipped int, err error) {
+	min := world.Vec3{X: geom.MinInt(a.X, b.X), Y: geom.MinInt(a.Y, b.Y), Z: geom.MinInt(a.Z, b.Z)}
+	max := world.Vec3{X: geom.MaxInt(a.X, b.X), Y: geom.MaxInt(a.Y, b.Y), Z: geom.MaxInt(a.Z, b.Z)}
+	if min.Y < 0 || max.Y >= world.ChunkHeight {
+		return 0, 0, fmt.Errorf("y must be within 0 and %d", world.ChunkHeight-1)
+	}
+	// the differences as unsigned can't overflow
+	dx, dz := uint64(max.X)-uint64(min.X), uint64(max.Z)-uint64(min.Z)
+	if dx >= maxFillBlocks || dz >= maxFillBlocks ||
+		(dx+1)*(dz+1)*uint64(max.Y-min.Y+1) > maxFillBlocks {
+		return 0, 0, fmt.Errorf("more than the %d blocks of a fill", maxFillBlocks)
+	}
+	var edits []net.BlockEdit
+	for x := min.X; x <= max.X; x++ {
+		for z := min.Z; z <= max.Z; z++ {
+			for y := min.Y; y <= max.Y; y++ {
+				id := world.Vec3{X: x, Y: y, Z: z}
+				if g.world.Block(id) == w {
+					continue
+				}
+				if net.ChunkLocked(id.Chunkid()) {
+					skipped++
+					continue
+				}
+				edits = append(edits, net.BlockEdit{Id: id, W: w})
+			}
+		}
+	}
+	if len(edits) > 0 {
+		g.UpdateBlocks(edits...)
+	}
+	return len(edits), skipped, nil
+}
@@ -0,0 +1,139 @@
+package game
+
+import (
+	"fmt"
+
+	"github.com/go-gl/glfw/v3.2/glfw"
+	"github.com/icexin/gocraft/net"
+	"github.com/icexin/gocraft/world"
+)
+
+const (
+	fireTickDelay = 20 // ticks between two fire updates
+	maxFireAge    = 12 // fire updates before burning out
+	// fire without fuel below and around burns out sooner
+	maxFireAgeNoFuel = 3
+
+	fireDamage         = 1   // health per hit
+	fireDamageInterval = 0.5 // seconds
+)
+
+// burn chance of the flammable blocks per fire update
+var blockFlammability = map[int]float32{
+	world.Wood:   0.1,
+	world.Plank:  0.2,
+	world.Leaves: 0.4,
+	world.Chest:  0.15,
+	world.Bed:    0.3,
+}
+
+func flammability(tp int) float32 {
+	if world.IsPlant(tp) && tp != world.Fire {
+		return 0.6
+	}
+	return blockFlammability[tp]
+}
+
+// GameRules are the world rules changed by /gamerule.
+type GameRules struct {
+	FireSpread bool
+}
+
+var gameRules = GameRules{
+	FireSpread: true,
+}
+
+type fireState struct {
+	ages map[world.Vec3]int
+}
+
+var fires = fireState{
+	ages: make(map[world.Vec3]int),
+}
+
+func init() {
+	blockTickers[world.Fire] = tickFire
+	randomTickers[world.Fire] = randomTickFire
+	RegisterCommand(&Command{
+		Name:  "gamerule",
+		Usage: "/gamerule fireSpread [true|false]",
+		Run: func(g *Game, args *Args) (string, error) {
+			args.Choice("rule", "fireSpread")
+			v := gameRules.FireSpread
+			if args.Len() > 0 {
+				v = args.Bool("value")
+			}
+			if err := args.Err(); err != nil {
+				return "", err
+			}
+			gameRules.FireSpread = v
+			return fmt.Sprintf("fireSpread = %v", gameRules.FireSpread), nil
+		},
+	})
+}
+
+// Ignite sets fire at id if it's air.
+func (g *Game) Ignite(id world.Vec3) {
+	if g.world.Block(id) != 0 {
+		return
+	}
+	fires.ages[id] = 0
+	g.UpdateBlocks(net.BlockEdit{Id: id, W: world.Fire})
+	g.ticker.Schedule(id, fireTickDelay+g.ticker.Rand().Intn(fireTickDelay))
+}
+
+// randomTickFire wakes up the fires without a scheduled tick, like the
+// fires loaded from the store, so they spread and burn out.
+func randomTickFire(g *Game, id world.Vec3) {
+	if _, ok := fires.ages[id]; ok {
+		return
+	}
+	fires.ages[id] = 0
+	g.ticker.Schedule(id, fireTickDelay)
+}
+
+func tickFire(g *Game, id world.Vec3) {
+	neighbors := []world.Vec3{id.Left(), id.Right(), id.Up(), id.Down(), id.Front(), id.Back()}
+	fuel := false
+	for _, n := range neighbors {
+		if flammability(g.world.Block(n)) > 0 {
+			fuel = true
+			break
+		}
+	}
+
+	age := fires.ages[id] + 1
+	if age > maxFireAge || (!fuel && age > maxFireAgeNoFuel) {
+		delete(fires.ages, id)
+		g.UpdateBlocks(net.BlockEdit{Id: id, W: 0})
+		return
+	}
+	fires.ages[id] = age
+
+	if gameRules.FireSpread {
+		for _, n := range neighbors {
+			tp := g.world.Block(n)
+			if net.ChunkLocked(n.Chunkid()) || g.ticker.Rand().Float32() >= flammability(tp) {
+				continue
+			}
+			// the block burns away and the fire takes its place
+			g.UpdateBlocks(net.BlockEdit{Id: n, W: 0})
+			g.Ignite(n)
+		}
+	}
+	g.ticker.Schedule(id, fireTickDelay+g.ticker.Rand().Intn(fireTickDelay))
+}
+
+// checkFireDamage hurts the player standing in fire.
+func (g *Game) checkFireDamage() {
+	head := world.NearBlock(g.camera.Pos())
+	if g.world.Block(head) != world.Fire && g.world.Block(head.Down()) != world.Fire {
+		return
+	}
+	now := glfw.GetTime()
+	if now-g.lastDamage < fireDamageInterval {
+		return
+	}
+	g.lastDamage = now
+	g.Damage(fireDamage, "burned to death")
+}
@@ -0,0 +1,15 @@
+package game
+
+import "flag"
+
+// flags are the command line flags of the game, added to the ones of the
+// program by AddFlags.
+var flags = flag.NewFlagSet("game", flag.ContinueOnError)
+
+// AddFlags adds the flags of the game to fs: the db and the profile, the
+// quality settings, the camera, the post effects and the spawns.
+func AddFlags(fs *flag.FlagSet) {
+	flags.VisitAll(func(f *flag.Flag) {
+		fs.Var(f.Value, f.Name, f.Usage)
+	})
+}
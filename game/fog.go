@@ -0,0 +1,85 @@
+package game
+
+import (
+	"fmt"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/icexin/gocraft/render"
+)
+
+var (
+	fogMode    = flags.String("fog", "smooth", "fog curve: smooth, linear, exp or exp2")
+	fogStart   = flags.Float64("fogstart", 0, "where the fog starts, a fraction of the fog distance")
+	fogEnd     = flags.Float64("fogend", 1, "where the fog ends, a fraction of the fog distance")
+	fogDensity = flags.Float64("fogdensity", 3, "density of the exp and exp2 fog")
+)
+
+// the fog curves by fogmode in fog.glsl
+var fogModes = [...]string{"smooth", "linear", "exp", "exp2"}
+
+var (
+	clearSky = mgl32.Vec3{0.57, 0.71, 0.77}
+	stormSky = mgl32.Vec3{0.42, 0.47, 0.52}
+	nightSky = mgl32.Vec3{0.02, 0.03, 0.08}
+)
+
+// skyColor returns the color of the sky before the dim, greyer in a storm
+// and darker at night. The fog takes it so the far blocks fade into the sky.
+func skyColor() mgl32.Vec3 {
+	sky := clearSky
+	if game.weather.storm {
+		sky = stormSky
+	}
+	night := game.postRender.Grade.Night
+	return sky.Mul(1 - night).Add(nightSky.Mul(night))
+}
+
+func currentFog() render.Fog {
+	d := fogDistance()
+	f := render.Fog{
+		Start:   float32(*fogStart) * d,
+		End:     float32(*fogEnd) * d,
+		Density: float32(*fogDensity),
+		Color:   skyColor(),
+	}
+	for i, name := range fogModes {
+		if name == *fogMode {
+			f.Mode = int32(i)
+		}
+	}
+	return eyeFog(f)
+}
+
+func init() {
+	RegisterCommand(&Command{
+		Name:  "fog",
+		Usage: "/fog [smooth|linear|exp|exp2|range START END|density N]",
+		Run: func(g *Game, args *Args) (string, error) {
+			if args.Len() != 0 {
+				switch setting := args.Choice("setting", append(fogModes[:], "range", "density")...); setting {
+				case "range":
+					start, end := args.Float("start"), args.Float("end")
+					args.Range("start", start, 0, end)
+					args.Range("end", end, start, 1)
+					if args.Err() == nil {
+						*fogStart, *fogEnd = start, end
+					}
+				case "density":
+					density := args.Float("density")
+					args.Range("density", density, 0.1, 20)
+					if args.Err() == nil {
+						*fogDensity = density
+					}
+				default:
+					if args.Err() == nil {
+						*fogMode = setting
+					}
+				}
+			}
+			if err := args.Err(); err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("fog %s from %v to %v, density %v", *fogMode, *fogStart, *fogEnd, *fogDensity), nil
+		},
+	})
+}
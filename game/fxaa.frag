@@ -0,0 +1,41 @@
+#version 330 core
+
+in vec2 Tex;
+
+uniform sampler2D color;
+uniform vec2 texel;
+
+out vec4 FragColor;
+
+// the console FXAA of Timothy Lottes, one edge search along the gradient
+const float span_max = 8;
+const float reduce_mul = 1.0 / 8;
+const float reduce_min = 1.0 / 128;
+const vec3 luma = vec3(0.299, 0.587, 0.114);
+
+void main() {
+    vec3 rgbM = texture(color, Tex).rgb;
+    float lumaNW = dot(texture(color, Tex + vec2(-1, -1) * texel).rgb, luma);
+    float lumaNE = dot(texture(color, Tex + vec2(1, -1) * texel).rgb, luma);
+    float lumaSW = dot(texture(color, Tex + vec2(-1, 1) * texel).rgb, luma);
+    float lumaSE = dot(texture(color, Tex + vec2(1, 1) * texel).rgb, luma);
+    float lumaM = dot(rgbM, luma);
+    float lumaMin = min(lumaM, min(min(lumaNW, lumaNE), min(lumaSW, lumaSE)));
+    float lumaMax = max(lumaM, max(max(lumaNW, lumaNE), max(lumaSW, lumaSE)));
+
+    vec2 dir = vec2(-((lumaNW + lumaNE) - (lumaSW + lumaSE)), (lumaNW + lumaSW) - (lumaNE + lumaSE));
+    float reduce = max((lumaNW + lumaNE + lumaSW + lumaSE) * 0.25 * reduce_mul, reduce_min);
+    float scale = 1 / (min(abs(dir.x), abs(dir.y)) + reduce);
+    dir = clamp(dir * scale, vec2(-span_max), vec2(span_max)) * texel;
+
+    vec3 rgbA = 0.5 * (texture(color, Tex + dir * (1.0 / 3 - 0.5)).rgb +
+                       texture(color, Tex + dir * (2.0 / 3 - 0.5)).rgb);
+    vec3 rgbB = rgbA * 0.5 + 0.25 * (texture(color, Tex - dir * 0.5).rgb +
+                                     texture(color, Tex + dir * 0.5).rgb);
+    float lumaB = dot(rgbB, luma);
+    if (lumaB < lumaMin || lumaB > lumaMax) {
+        FragColor = vec4(rgbA, 1);
+    } else {
+        FragColor = vec4(rgbB, 1);
+    }
+}
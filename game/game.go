@@ -0,0 +1,895 @@
+// Package game is the gocraft client: the window and the input, the player,
+// the entities and the weather, and the passes drawn around the block render
+// of package render. It talks to the server through package net and keeps
+// the edits and the player in package store.
+package game
+
+import (
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	_ "image/png"
+
+	"github.com/faiface/glhf"
+	"github.com/faiface/mainthread"
+	"github.com/go-gl/gl/v3.3-core/gl"
+	"github.com/go-gl/glfw/v3.2/glfw"
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/icexin/gocraft-server/proto"
+	"github.com/icexin/gocraft/internal/logging"
+	"github.com/icexin/gocraft/net"
+	"github.com/icexin/gocraft/render"
+	"github.com/icexin/gocraft/world"
+)
+
+var (
+	frameBudget = flags.Duration("framebudget", 4*time.Millisecond, "main thread time per frame for the mesh uploads and releases")
+
+	game *Game
+)
+
+type Game struct {
+	win *glfw.Window
+
+	camera   *Camera
+	lx, ly   float64
+	vy       float32
+	prevtime float64
+
+	blockRender  *render.BlockRender
+	lineRender   *LineRender
+	playerRender *PlayerRender
+	postRender   *PostRender
+	shadowRender *ShadowRender
+	lodRender    *LODRender
+	cloudRender  *CloudRender
+
+	world   *world.World
+	itemidx int
+	item    int
+	fps     FPS
+
+	exclusiveMouse bool
+	closed         bool
+
+	lastInput float64
+	afk       bool
+
+	scanOverlay bool
+	scanning    int32
+
+	mining     Mining
+	touch      TouchControls
+	console    Console
+	itemScreen ItemScreen
+	ticker     Ticker
+	timelapse  Timelapse
+	weather    Weather
+	brush      Brush
+
+	health     int
+	lastDamage float64
+	mode       GameMode
+	inventory  *Inventory
+
+	falling  []*FallingBlock
+	entities Entities
+
+	// photo mode hides the HUD and enables the photo effects
+	photoMode  bool
+	screenshot bool
+
+	debug     bool
+	lastHit   float64 // time of the last block broken or placed
+	placing   Placing
+	viewModel ViewModel
+}
+
+const (
+	afkTimeout = 120 // seconds
+	afkDim     = 0.7
+
+	hitMarkerTime = 0.2 // seconds
+)
+
+func initGL(w, h int) *glfw.Window {
+	err := glfw.Init()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	glfw.WindowHint(glfw.ContextVersionMajor, 3)
+	glfw.WindowHint(glfw.ContextVersionMinor, 3)
+	glfw.WindowHint(glfw.OpenGLProfile, glfw.OpenGLCoreProfile)
+	glfw.WindowHint(glfw.OpenGLForwardCompatible, gl.TRUE)
+	glfw.WindowHint(glfw.Samples, *msaaFlag)
+
+	win, err := glfw.CreateWindow(w, h, "gocraft", nil, nil)
+	if err != nil && *msaaFlag > 0 {
+		gpuLog.Warnf("create window with %d samples error:%s, retry without multisampling", *msaaFlag, err)
+		glfw.WindowHint(glfw.Samples, 0)
+		win, err = glfw.CreateWindow(w, h, "gocraft", nil, nil)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	win.MakeContextCurrent()
+	err = gl.Init()
+	if err != nil {
+		log.Fatal(err)
+	}
+	glfw.SwapInterval(1) // enable vsync
+	gl.Enable(gl.DEPTH_TEST)
+	gl.Enable(gl.CULL_FACE)
+	return win
+}
+
+// worldCacheSize holds the chunks in view and the ones prefetched ahead.
+func worldCacheSize(radius int) int {
+	return radius * radius * 5
+}
+
+// worldSource loads the world changes from the local store and the server.
+type worldSource struct{}
+
+func (worldSource) RangeBlocks(id world.Vec3, f func(bid world.Vec3, w int)) error {
+	return db.RangeBlocks(id, f)
+}
+
+func (worldSource) UpdateBlock(id world.Vec3, w int) error {
+	return db.UpdateBlock(id, w)
+}
+
+func (worldSource) FetchChunk(id world.Vec3, f func(bid world.Vec3, w int)) error {
+	return net.ClientFetchChunk(id, f)
+}
+
+func (worldSource) SaveChunk(id world.Vec3, blocks map[world.Vec3]int) error {
+	return db.UpdateTerrain(id, blocks)
+}
+
+func (worldSource) LoadChunk(id world.Vec3) (map[world.Vec3]int, error) {
+	return db.GetTerrain(id)
+}
+
+// serverHandler applies the changes pushed by the server to the game.
+type serverHandler struct{}
+
+func (serverHandler) UpdateBlock(id world.Vec3, w int) {
+	recentEdits.Add(id, w, "server")
+	game.world.UpdateBlock(id, w)
+	game.blockRender.DirtyChunk(id.Chunkid())
+}
+
+func (serverHandler) RemovePlayer(id int32) {
+	game.playerRender.Remove(id)
+}
+
+func (serverHandler) Reconnected() {
+	for _, id := range game.world.Resync() {
+		game.blockRender.DirtyChunk(id)
+	}
+}
+
+func (serverHandler) RetryFetches() {
+	if game == nil {
+		return
+	}
+	for _, id := range game.world.RetryFetches() {
+		game.blockRender.DirtyChunk(id)
+	}
+}
+
+// blockScene draws the game around the chunk meshes of the block render.
+type blockScene struct{}
+
+func (blockScene) Camera() render.Camera {
+	return game.camera
+}
+
+func (blockScene) Size() (int, int) {
+	return game.win.GetSize()
+}
+
+func (blockScene) BindShadows(shader *glhf.Shader) {
+	game.shadowRender.bind(shader)
+}
+
+func (blockScene) ChunkShade(id world.Vec3) float32 {
+	return lockedShadeOf(id)
+}
+
+func (blockScene) DrawBlocks(mat mgl32.Mat4) {
+	game.drawFalling(mat)
+	game.drawEntities(mat)
+	game.drawPlacing(mat)
+	game.drawCracks(mat)
+}
+
+func (blockScene) RecordMeshBuild(d time.Duration) {
+	profiler.RecordMeshBuild(d)
+}
+
+func (blockScene) RecordChunkLoad(d time.Duration) {
+	profiler.RecordChunkLoad(d)
+}
+
+// frame returns the light and the weather of the frame for the block render.
+func (g *Game) frame() *render.Frame {
+	season := CurrentSeason()
+	return &render.Frame{
+		Dim:     g.Dim(),
+		Time:    float32(glfw.GetTime()),
+		Foliage: season.Foliage,
+		Snow:    season.Snow,
+		Wind:    g.weather.Wind(),
+		Fog:     currentFog(),
+	}
+}
+
+func NewGame(w, h int) (*Game, error) {
+	var (
+		err  error
+		game *Game
+	)
+	game = new(Game)
+	game.item = availableItems[0]
+	game.health = maxHealth
+	game.inventory = NewInventory()
+
+	mainthread.Call(func() {
+		win := initGL(w, h)
+		InitGPUCaps()
+		InitSettings(render.GPU.Renderer)
+		win.SetMouseButtonCallback(game.onMouseButtonCallback)
+		win.SetCursorPosCallback(game.onCursorPosCallback)
+		win.SetFramebufferSizeCallback(game.onFrameBufferSizeCallback)
+		win.SetKeyCallback(game.onKeyCallback)
+		win.SetCharCallback(game.onCharCallback)
+		game.win = win
+	})
+	game.world = world.New(worldCacheSize(render.Radius()), worldSource{}, game.onChunkLoaded)
+	game.camera = NewCamera(mgl32.Vec3{0, 16, 0})
+	if !settings.AmbientOcclusion {
+		render.SetLightMode("off")
+	}
+	game.blockRender, err = render.NewBlockRender(game.world, blockScene{})
+	if err != nil {
+		return nil, err
+	}
+	game.lineRender, err = NewLineRender()
+	if err != nil {
+		return nil, err
+	}
+	game.playerRender, err = NewPlayerRender()
+	if err != nil {
+		return nil, err
+	}
+	game.postRender, err = NewPostRender()
+	if err != nil {
+		return nil, err
+	}
+	game.shadowRender, err = NewShadowRender()
+	if err != nil {
+		return nil, err
+	}
+	game.lodRender, err = NewLODRender()
+	if err != nil {
+		return nil, err
+	}
+	game.cloudRender, err = NewCloudRender()
+	if err != nil {
+		return nil, err
+	}
+	publishStats(game)
+	serveDebugAPI(game)
+	go game.blockRender.UpdateLoop()
+	go game.lodRender.UpdateLoop()
+	go game.syncPlayerLoop()
+	if *devMode {
+		go game.devWatchLoop()
+	}
+	game.ticker.Restore()
+	worldStats.Restore()
+	go worldStats.saveLoop()
+	go game.ticker.Loop(game)
+	return game, nil
+}
+
+func (g *Game) setExclusiveMouse(exclusive bool) {
+	if exclusive {
+		g.win.SetInputMode(glfw.CursorMode, glfw.CursorDisabled)
+	} else {
+		g.win.SetInputMode(glfw.CursorMode, glfw.CursorNormal)
+	}
+	g.exclusiveMouse = exclusive
+}
+
+func (g *Game) dirtyBlock(id world.Vec3) {
+	cid := id.Chunkid()
+	g.blockRender.DirtyChunk(cid)
+	neighbors := []world.Vec3{id.Left(), id.Right(), id.Front(), id.Back()}
+	for _, neighbor := range neighbors {
+		chunkid := neighbor.Chunkid()
+		if chunkid != cid {
+			g.blockRender.DirtyChunk(chunkid)
+		}
+	}
+}
+
+// onChunkLoaded rebuilds the meshes around a chunk changed by the store or
+// the server, the border faces of the neighbors saw the generated terrain.
+// Unchanged, it only rebuilds the neighbors meshed before it was generated,
+// their border faces saw no chunk at all.
+func (g *Game) onChunkLoaded(chunk *world.Chunk, changed bool) {
+	atomic.AddInt64(&memStats.chunksLoaded, 1)
+	events.Publish(ChunkLoaded{chunk, changed})
+	id := chunk.Id()
+	g.entities.onChunkLoaded(g, id)
+	if changed {
+		g.blockRender.DirtyChunk(id)
+	}
+	neighbors := []world.Vec3{
+		{X: id.X - 1, Y: 0, Z: id.Z},
+		{X: id.X + 1, Y: 0, Z: id.Z},
+		{X: id.X, Y: 0, Z: id.Z - 1},
+		{X: id.X, Y: 0, Z: id.Z + 1},
+	}
+	for _, nb := range neighbors {
+		if changed {
+			g.blockRender.DirtyChunk(nb)
+		} else {
+			g.blockRender.NeighborLoaded(nb, id)
+		}
+	}
+}
+
+// UpdateBlocks applies local edits to the world and sends them to the server,
+// tools that change many blocks at once should use it instead of World.UpdateBlock.
+func (g *Game) UpdateBlocks(edits ...net.BlockEdit) {
+	for _, e := range edits {
+		recentEdits.Add(e.Id, e.W, "local")
+		g.world.UpdateBlock(e.Id, e.W)
+		g.dirtyBlock(e.Id)
+		g.scheduleFalling(e)
+	}
+	net.ClientUpdateBlocks(edits...)
+}
+
+func (g *Game) onMouseButtonCallback(win *glfw.Window, button glfw.MouseButton, action glfw.Action, mod glfw.ModifierKey) {
+	g.onInput()
+	if *touchEnabled {
+		// the mouse stands in for a finger
+		if button == glfw.MouseButton1 {
+			x, y := win.GetCursorPos()
+			if action == glfw.Press {
+				g.touch.Down(g, 0, float32(x), float32(y))
+			} else {
+				g.touch.Up(g, 0)
+			}
+		}
+		return
+	}
+	if g.itemScreen.Active() {
+		g.onItemScreenClick(button, action)
+		return
+	}
+	if !g.exclusiveMouse {
+		g.setExclusiveMouse(true)
+		return
+	}
+	if action == glfw.Press {
+		g.viewModel.Swing()
+	}
+	if button == glfw.MouseButton2 && action == glfw.Press {
+		g.useItem()
+	}
+	if button == glfw.MouseButton3 && action == glfw.Press {
+		g.pickBlock()
+	}
+	if button == glfw.MouseButton1 {
+		if action == glfw.Press && g.brush.active {
+			g.applyBrush()
+			return
+		}
+		if action == glfw.Press && !g.attackEntity() {
+			g.startMining()
+		}
+		if action == glfw.Release {
+			g.stopMining()
+		}
+	}
+}
+
+// useItem places the held item in front of the block under the cross, or
+// sleeps if it's a bed.
+func (g *Game) useItem() {
+	head := world.NearBlock(g.camera.Pos())
+	foot := head.Down()
+	block, prev := g.world.HitTest(g.camera.Pos(), g.camera.Front())
+	g.lineRender.RecordRay(g.camera.Pos(), g.camera.Front())
+	if e, _ := g.entities.HitTest(g.camera.Pos(), g.camera.Front(), block); e != nil {
+		g.feedAnimal(e)
+		return
+	}
+	if block != nil && g.world.Block(*block) == world.Bed {
+		g.useBed(*block)
+		return
+	}
+	if prev != nil && *prev != head && *prev != foot {
+		if !g.canEdit(*prev) || !g.hasItem() {
+			return
+		}
+		if g.item == world.Fire {
+			g.Ignite(*prev)
+		} else {
+			g.UpdateBlocks(net.BlockEdit{Id: *prev, W: g.item})
+			events.Publish(BlockPlaced{*prev, g.item})
+		}
+		g.markHit()
+	}
+}
+
+// pickBlock holds the type of the block under the cross.
+func (g *Game) pickBlock() {
+	block, _ := g.world.HitTest(g.camera.Pos(), g.camera.Front())
+	if block == nil {
+		return
+	}
+	if w := g.world.Block(*block); w != 0 && w != g.item {
+		g.holdItem(w)
+	}
+}
+
+// holdItem switches the held item to w, the items cycled by E and R go on
+// from w if it's one of them.
+func (g *Game) holdItem(w int) {
+	for i, item := range availableItems {
+		if item == w {
+			g.itemidx = i
+			break
+		}
+	}
+	g.viewModel.Swap(g.item)
+	g.item = w
+}
+
+func (g *Game) jump() {
+	block := g.CurrentBlockid()
+	if g.world.HasBlock(world.Vec3{X: block.X, Y: block.Y - 2, Z: block.Z}) {
+		g.vy = 8
+	}
+}
+
+func (g *Game) onFrameBufferSizeCallback(window *glfw.Window, width, height int) {
+	gl.Viewport(0, 0, int32(width), int32(height))
+}
+
+func (g *Game) onCursorPosCallback(win *glfw.Window, xpos float64, ypos float64) {
+	if *touchEnabled {
+		g.touch.Move(g, 0, float32(xpos), float32(ypos))
+		return
+	}
+	if g.itemScreen.Active() {
+		g.onItemScreenCursor(xpos, ypos)
+		return
+	}
+	if !g.exclusiveMouse {
+		return
+	}
+	g.onInput()
+	if g.lx == 0 && g.ly == 0 {
+		g.lx, g.ly = xpos, ypos
+		return
+	}
+	dx, dy := xpos-g.lx, g.ly-ypos
+	g.lx, g.ly = xpos, ypos
+	g.camera.OnAngleChange(float32(dx), float32(dy))
+}
+
+func (g *Game) onKeyCallback(win *glfw.Window, key glfw.Key, scancode int, action glfw.Action, mods glfw.ModifierKey) {
+	g.onInput()
+	if action != glfw.Press && action != glfw.Repeat {
+		return
+	}
+	if g.console.Active() {
+		g.onConsoleKey(key)
+		return
+	}
+	if action != glfw.Press {
+		return
+	}
+	if g.itemScreen.Active() {
+		g.onItemScreenKey(key)
+		return
+	}
+	switch key {
+	case glfw.KeySlash:
+		g.console.Open()
+	case glfw.KeyTab:
+		g.toggleFlying()
+	case glfw.KeySpace:
+		g.jump()
+	case glfw.KeyE:
+		g.openItemScreen()
+	case glfw.KeyF1:
+		g.photoMode = !g.photoMode
+	case glfw.KeyF2:
+		g.screenshot = true
+	case glfw.KeyF3:
+		g.debug = !g.debug
+	case glfw.KeyF7:
+		g.cyclePreset()
+	case glfw.KeyF8:
+		g.scanOverlay = !g.scanOverlay
+		if !g.scanOverlay {
+			g.lineRender.SetHighlight(nil)
+		}
+	case glfw.KeyR:
+		g.holdItem(availableItems[(g.itemidx+len(availableItems)-1)%len(availableItems)])
+	}
+}
+
+func (g *Game) cyclePreset() {
+	g.applyPreset(nextPreset(settings.Preset))
+}
+
+func (g *Game) applyPreset(name string) {
+	ApplyPreset(name)
+	g.world.Resize(worldCacheSize(render.Radius()))
+	gameLog.Infof("switch to %s preset", settings.Preset)
+}
+
+func (g *Game) handleKeyInput(dt float64) {
+	speed := float32(0.1)
+	if g.camera.flying {
+		speed = 0.2
+	}
+	// keys typed in the console or the item screen don't move the player
+	typing := g.console.Active() || g.itemScreen.Active()
+	if g.win.GetKey(glfw.KeyEscape) == glfw.Press && !typing {
+		g.setExclusiveMouse(false)
+	}
+	g.camera.SetZooming(g.win.GetKey(glfw.KeyC) == glfw.Press && !typing)
+	forward := g.win.GetKey(glfw.KeyW) == glfw.Press && !typing
+	g.camera.SetSprinting(forward && g.win.GetKey(glfw.KeyLeftControl) == glfw.Press)
+	if forward {
+		g.camera.OnMoveChange(MoveForward, speed)
+	}
+	if g.win.GetKey(glfw.KeyS) == glfw.Press && !typing {
+		g.camera.OnMoveChange(MoveBackward, speed)
+	}
+	if g.win.GetKey(glfw.KeyA) == glfw.Press && !typing {
+		g.camera.OnMoveChange(MoveLeft, speed)
+	}
+	if g.win.GetKey(glfw.KeyD) == glfw.Press && !typing {
+		g.camera.OnMoveChange(MoveRight, speed)
+	}
+	g.touch.Update(g, speed)
+	pos := g.camera.Pos()
+	stop := false
+	if !g.camera.Flying() {
+		g.vy -= float32(dt * 20)
+		if g.vy < -50 {
+			g.vy = -50
+		}
+		pos = mgl32.Vec3{pos.X(), pos.Y() + g.vy*float32(dt), pos.Z()}
+	}
+
+	pos, stop = g.world.Collide(pos)
+	if stop {
+		if g.vy < 0 {
+			g.camera.Land(-g.vy)
+		}
+		g.vy = 0
+	}
+	g.camera.SetPos(pos)
+}
+
+// updateViewModel bobs the held item and the view by the distance walked
+// since last.
+func (g *Game) updateViewModel(dt float64, last mgl32.Vec3) {
+	var walked float32
+	if !g.camera.Flying() && g.vy == 0 {
+		d := g.camera.Pos().Sub(last)
+		walked = mgl32.Vec2{d.X(), d.Z()}.Len()
+	}
+	g.viewModel.Update(dt, walked)
+	g.camera.UpdateView(float32(dt), walked)
+}
+
+func (g *Game) onInput() {
+	g.lastInput = glfw.GetTime()
+	if g.afk {
+		g.setAFK(false)
+	}
+}
+
+func (g *Game) checkAFK() {
+	if !g.afk && glfw.GetTime()-g.lastInput > afkTimeout {
+		g.setAFK(true)
+	}
+}
+
+func (g *Game) setAFK(afk bool) {
+	g.afk = afk
+	go net.ClientSetAFK(afk)
+}
+
+// Dim returns the brightness factor of the screen, it's dimmed while afk
+// and flashes with lightning.
+func (g *Game) Dim() float32 {
+	dim := g.weather.Brightness()
+	if g.afk {
+		dim *= afkDim
+	}
+	return dim
+}
+
+// updateScanOverlay outlines the nearby blocks of the held item type.
+func (g *Game) updateScanOverlay() {
+	if !g.scanOverlay || !atomic.CompareAndSwapInt32(&g.scanning, 0, 1) {
+		return
+	}
+	center, item := g.CurrentBlockid(), g.item
+	go func() {
+		defer atomic.StoreInt32(&g.scanning, 0)
+		ids, err := scanBlocks(g.world, center, 32, func(tp int) bool {
+			return tp == item
+		})
+		if err == errScanRateLimited {
+			return
+		}
+		if err != nil {
+			gameLog.Warnf("scan error:%s", err)
+		}
+		render.FrameTasks.Post(func() {
+			if err != nil {
+				g.scanOverlay = false
+			}
+			g.lineRender.SetHighlight(ids)
+		})
+	}()
+}
+
+func (g *Game) markHit() {
+	g.lastHit = glfw.GetTime()
+}
+
+// HitMarker returns the progress in [0, 1) of the hit marker animation.
+func (g *Game) HitMarker() (float32, bool) {
+	t := glfw.GetTime() - g.lastHit
+	if g.lastHit == 0 || t >= hitMarkerTime {
+		return 0, false
+	}
+	return float32(t / hitMarkerTime), true
+}
+
+func (g *Game) CurrentBlockid() world.Vec3 {
+	pos := g.camera.Pos()
+	return world.NearBlock(pos)
+}
+
+func (g *Game) ShouldClose() bool {
+	return g.closed
+}
+
+func (g *Game) renderStat() {
+	g.fps.Update()
+	p := g.camera.Pos()
+	cid := world.NearBlock(p).Chunkid()
+	stat := g.blockRender.Stat()
+	title := fmt.Sprintf("[%.2f %.2f %.2f] %v [%d/%d %d] %d", p.X(), p.Y(), p.Z(),
+		cid, stat.RendingChunks, stat.CacheChunks, stat.Faces, g.fps.Fps())
+	if *yearLength > 0 {
+		title += " " + CurrentSeason().Name()
+	}
+	if g.health < maxHealth {
+		title += fmt.Sprintf(" hp:%d", g.health)
+	}
+	if g.mode == ModeSurvival {
+		title += " survival"
+	}
+	if g.afk {
+		title += " afk"
+	}
+	if g.debug {
+		title += fmt.Sprintf(" calls:%d", stat.DrawCalls)
+	}
+	title += g.ticker.Status()
+	title += g.brush.Status()
+	title += g.timelapse.Status()
+	if net.ServerAddr() != "" {
+		state := net.ConnectionState()
+		title += " " + state.String()
+		if state == net.ConnOnline {
+			title += " " + net.Stat.Summary()
+		}
+		if g.debug {
+			title += fmt.Sprintf(" edit:%dms", net.UpdateLatency().Milliseconds())
+		}
+		if state == net.ConnKicked || state == net.ConnIncompatible || state == net.ConnRejected {
+			title += ": " + net.DropReason()
+		}
+	}
+	if g.itemScreen.Active() {
+		title += " | " + g.itemScreen.Title()
+	} else if msg := g.console.Title(); msg != "" {
+		title += " | " + msg
+	} else if line := logging.Tail.Title(); g.debug && line != "" {
+		title += " | " + line
+	}
+	g.win.SetTitle(title)
+}
+
+func (g *Game) syncPlayerLoop() {
+	defer crashGuard()
+	tick := time.NewTicker(time.Second / 10)
+	for range tick.C {
+		g.updatePlayers()
+	}
+}
+
+// updatePlayers sends the player state and shows the players of the area
+// of interest, the chunks in the render radius.
+func (g *Game) updatePlayers() {
+	radius := float32(render.Radius() * world.ChunkWidth)
+	players, ok := net.ClientUpdatePlayerState(proto.PlayerState(g.camera.State()), radius)
+	if !ok {
+		return
+	}
+	for id, p := range players {
+		g.playerRender.UpdateOrAdd(id, p.State, p.Time, p.AFK)
+	}
+	// players not sent left the area of interest
+	for _, id := range g.playerRender.Ids() {
+		if _, ok := players[id]; !ok {
+			g.playerRender.Remove(id)
+		}
+	}
+}
+
+func (g *Game) Update() {
+	mainthread.Call(func() {
+		defer crashGuard()
+		start := time.Now()
+		defer func() {
+			d := time.Since(start)
+			memStats.recordFrame(d)
+			profiler.EndFrame(d)
+		}()
+		var dt float64
+		now := glfw.GetTime()
+		dt = now - g.prevtime
+		g.prevtime = now
+		if dt > 0.02 {
+			dt = 0.02
+		}
+		render.FrameTasks.Run(*frameBudget)
+
+		last := g.camera.Pos()
+		g.handleKeyInput(dt)
+		if pos := g.camera.Pos(); pos != last {
+			events.Publish(PlayerMoved{last, pos})
+		}
+		g.updateViewModel(dt, last)
+		g.camera.UpdateFov(float32(dt))
+		g.updateMining(dt)
+		g.entities.Update(g, float32(dt))
+		g.weather.Update(g, now, dt)
+		g.checkFireDamage()
+		g.checkDeath()
+		g.checkAFK()
+		g.updateScanOverlay()
+		g.updateEyeEffects(dt)
+
+		g.shadowRender.Draw()
+		g.timelapse.Capture(g, now)
+		g.postRender.Begin()
+		sky := skyColor().Mul(g.Dim())
+		gl.ClearColor(sky.X(), sky.Y(), sky.Z(), 1)
+		gl.Clear(gl.COLOR_BUFFER_BIT | gl.DEPTH_BUFFER_BIT)
+
+		profiler.Begin(passBlock)
+		g.cloudRender.Draw(false)
+		g.lodRender.Draw()
+		g.blockRender.Draw(g.frame())
+		g.cloudRender.Draw(true)
+		profiler.End()
+		profiler.Begin(passLine)
+		g.lineRender.Draw()
+		profiler.End()
+		profiler.Begin(passPlayer)
+		g.playerRender.Draw()
+		profiler.End()
+		g.postRender.End()
+		if !g.photoMode {
+			g.lineRender.DrawHUD()
+			g.drawItem()
+			if g.itemScreen.Active() {
+				g.lineRender.DrawItemScreen()
+				g.drawItemScreen()
+			}
+		}
+		if g.screenshot {
+			g.screenshot = false
+			name, err := Screenshot()
+			if err != nil {
+				gameLog.Errorf("screenshot error:%s", err)
+			} else {
+				g.console.Print("saved " + name)
+			}
+		}
+
+		g.renderStat()
+
+		g.win.SwapBuffers()
+		glfw.PollEvents()
+		g.closed = g.win.ShouldClose()
+	})
+}
+
+type FPS struct {
+	lastUpdate time.Time
+	cnt        int
+	fps        int
+}
+
+func (f *FPS) Update() {
+	f.cnt++
+	now := time.Now()
+	p := now.Sub(f.lastUpdate)
+	if p >= time.Second {
+		f.fps = int(float64(f.cnt) / p.Seconds())
+		f.cnt = 0
+		f.lastUpdate = now
+	}
+}
+
+func (f *FPS) Fps() int {
+	return f.fps
+}
+
+// Run runs the game until the window is closed, call from mainthread.Run
+// after the flags are parsed and the plugins loaded.
+func Run() {
+	defer crashGuard()
+	err := LoadTextureDesc()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = InitStore()
+	if err != nil {
+		log.Panic(err)
+	}
+	defer db.Close()
+
+	err = net.InitClient(serverHandler{}, db)
+	if err != nil {
+		log.Panic(err)
+	}
+	defer net.CloseClient()
+
+	game, err = NewGame(800, 600)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	game.RestorePlayer(loadPlayerData())
+	fpsCap := settings.FPSCap
+	tick := time.NewTicker(time.Second / time.Duration(fpsCap))
+	for !game.ShouldClose() {
+		<-tick.C
+		game.Update()
+		if fpsCap != settings.FPSCap {
+			fpsCap = settings.FPSCap
+			tick.Reset(time.Second / time.Duration(fpsCap))
+		}
+	}
+	savePlayerData(game.PlayerData())
+	game.entities.Save()
+	worldStats.Save()
+}
@@ -0,0 +1,31 @@
+package game
+
+import (
+	"fmt"
+
+	"github.com/icexin/gocraft/render"
+)
+
+// InitGPUCaps detects the GPU and turns off the features it can't run,
+// call on mainthread before InitSettings.
+func InitGPUCaps() {
+	render.GPU = render.DetectGPUCaps()
+	gpuLog.Infof("%s, shadows:%s", &render.GPU, onOff(shadowMaps()))
+	if render.LightMode() == "volume" && !render.GPU.LightVolumes() {
+		gpuLog.Warnf("3d textures too small for the light volumes, use baked light")
+		render.SetLightMode("baked")
+	}
+}
+
+func init() {
+	RegisterCommand(&Command{
+		Name:  "gpu",
+		Usage: "/gpu",
+		Run: func(g *Game, args *Args) (string, error) {
+			if err := args.Err(); err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%s, shadows:%s", &render.GPU, onOff(shadowMaps())), nil
+		},
+	})
+}
@@ -0,0 +1,43 @@
+#version 330 core
+
+in vec2 Tex;
+
+uniform sampler2D color;
+uniform sampler2D depth;
+uniform vec2 texel;
+uniform float near;
+uniform float far;
+uniform float underwater;
+uniform float night;
+uniform float vignette;
+uniform float inblock;
+
+out vec4 FragColor;
+
+const vec3 water_tint = vec3(0.35, 0.6, 0.85);
+const vec3 water_fog = vec3(0.05, 0.18, 0.3);
+// blocks of clear water
+const float water_view = 24;
+const vec3 moonlight = vec3(0.8, 0.9, 1.15);
+// what's left of the view from inside a block
+const float inblock_view = 0.06;
+
+float linear_depth(vec2 uv) {
+    float z = texture(depth, uv).r * 2 - 1;
+    return 2 * near * far / (far + near - z * (far - near));
+}
+
+void main() {
+    vec3 c = texture(color, Tex).rgb;
+    // the eye loses the colors in the dark, leave a cold gray
+    float luma = dot(c, vec3(0.299, 0.587, 0.114));
+    c = mix(c, luma * moonlight, night * 0.7);
+    // the water absorbs the red first and hides what's far
+    float fade = clamp(linear_depth(Tex) / water_view, 0, 1);
+    c = mix(c, mix(c * water_tint, water_fog, fade), underwater);
+    // the faces behind the ones the eye went through are hidden in the dark
+    c *= 1 - inblock * (1 - inblock_view);
+    vec2 d = Tex - 0.5;
+    c *= 1 - vignette * 0.4 * smoothstep(0.3, 0.75, length(d));
+    FragColor = vec4(c, 1);
+}
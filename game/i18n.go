@@ -0,0 +1,72 @@
+package game
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+var langFlag = flags.String("lang", "", "language of the messages: en or zh, taken from $LANG by default")
+
+// The messages are looked up by their english format, a missing translation
+// falls back to english.
+var translations = map[string]map[string]string{
+	"zh": {
+		"empty command":                 "空命令",
+		"unknown command %q, try /help": "未知命令 %q，试试 /帮助",
+		"missing %s, usage: %s":         "缺少 %s，用法：%s",
+		"bad %s %q, want %s, usage: %s": "%s %q 无效，应为 %s，用法：%s",
+		"too many arguments, usage: %s": "参数过多，用法：%s",
+		"%s must be within %v and %v":   "%s 必须在 %v 到 %v 之间",
+		"an integer":                    "整数",
+		"a number":                      "数字",
+		"true or false":                 "true 或 false",
+		"one of %s":                     "%s 之一",
+		"no block in sight":             "视线内没有方块",
+		"this area is protected":        "该区域受保护",
+		"the window has no samples, restart with -msaa 4": "窗口没有多重采样，请用 -msaa 4 重新启动",
+	},
+}
+
+// commandAliases are the localized names of the commands, the english names
+// always work.
+var commandAliases = map[string]map[string]string{
+	"zh": {
+		"帮助":    "help",
+		"出生点":   "spawn",
+		"设置出生点": "setspawn",
+		"爆炸":    "explode",
+		"天气":    "weather",
+		"游戏规则":  "gamerule",
+		"效果":    "effect",
+		"触屏":    "touch",
+		"刻":     "tick",
+		"材质包":   "pack",
+		"笔刷":    "brush",
+		"填充":    "fill",
+		"显卡":    "gpu",
+		"设置":    "settings",
+		"统计":    "stats",
+		"延时":    "timelapse",
+	},
+}
+
+// lang returns the language of the messages from -lang or $LANG, zh_CN.UTF-8 gives zh.
+func lang() string {
+	l := *langFlag
+	if l == "" {
+		l = os.Getenv("LANG")
+	}
+	if i := strings.IndexAny(l, "_.-"); i >= 0 {
+		l = l[:i]
+	}
+	return strings.ToLower(l)
+}
+
+// tr formats a message in the language of the player.
+func tr(format string, args ...interface{}) string {
+	if t, ok := translations[lang()][format]; ok {
+		format = t
+	}
+	return fmt.Sprintf(format, args...)
+}
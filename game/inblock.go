@@ -0,0 +1,45 @@
+package game
+
+import (
+	"github.com/icexin/gocraft/internal/geom"
+	"github.com/icexin/gocraft/render"
+	"github.com/icexin/gocraft/world"
+)
+
+const (
+	// how fast the in block effect comes and goes, per second
+	inBlockRate = 12
+	// blocks seen inside a block and under water
+	inBlockFog    = 3
+	underwaterFog = 24
+)
+
+// updateEyeEffects darkens the view when the eye is inside an opaque block,
+// its faces are culled from inside and would show the caves behind.
+func (g *Game) updateEyeEffects(dt float64) {
+	w := g.world.Block(world.NearBlock(g.camera.Pos()))
+	target := float32(0)
+	if !world.IsTransparent(w) {
+		target = 1
+	}
+	grade := &g.postRender.Grade
+	grade.InBlock += (target - grade.InBlock) * geom.Min(float32(dt)*inBlockRate, 1)
+	if target == 0 && grade.InBlock < 0.01 {
+		grade.InBlock = 0
+	}
+}
+
+// eyeFog narrows the fog of f around the eye inside a block or under water.
+func eyeFog(f render.Fog) render.Fog {
+	grade := game.postRender.Grade
+	shrink := func(f render.Fog, end, k float32) render.Fog {
+		if k <= 0 || f.End <= end {
+			return f
+		}
+		f.End += (end - f.End) * k
+		f.Start *= 1 - k
+		return f
+	}
+	f = shrink(f, underwaterFog, grade.Underwater)
+	return shrink(f, inBlockFog, grade.InBlock)
+}
@@ -0,0 +1,218 @@
+package game
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// GameMode decides whether the blocks are counted.
+type GameMode int32
+
+const (
+	// every block without limit, flying allowed
+	ModeCreative GameMode = iota
+	// the blocks broken are collected in the inventory, no flying
+	ModeSurvival
+)
+
+var gameModeNames = [...]string{"creative", "survival"}
+
+func (m GameMode) String() string {
+	if m < 0 || int(m) >= len(gameModeNames) {
+		return fmt.Sprintf("mode%d", int32(m))
+	}
+	return gameModeNames[m]
+}
+
+// Inventory counts the blocks collected in survival mode by block type.
+type Inventory struct {
+	counts map[int]int
+}
+
+func NewInventory() *Inventory {
+	return &Inventory{counts: make(map[int]int)}
+}
+
+// Count returns the blocks of type item held.
+func (inv *Inventory) Count(item int) int {
+	return inv.counts[item]
+}
+
+func (inv *Inventory) Add(item, n int) {
+	inv.counts[item] += n
+	if inv.counts[item] <= 0 {
+		delete(inv.counts, item)
+	}
+}
+
+// Take removes a block of type item, false if there is none.
+func (inv *Inventory) Take(item int) bool {
+	if inv.counts[item] <= 0 {
+		return false
+	}
+	inv.Add(item, -1)
+	return true
+}
+
+// Items returns the block types held, sorted.
+func (inv *Inventory) Items() []int {
+	items := make([]int, 0, len(inv.counts))
+	for item := range inv.counts {
+		items = append(items, item)
+	}
+	sort.Ints(items)
+	return items
+}
+
+func init() {
+	events.Subscribe(EventBlockBroken, func(e Event) {
+		if game.mode == ModeSurvival {
+			game.inventory.Add(e.(BlockBroken).W, 1)
+		}
+	})
+	events.Subscribe(EventBlockPlaced, func(e Event) {
+		if game.mode == ModeSurvival {
+			game.inventory.Take(e.(BlockPlaced).W)
+		}
+	})
+	RegisterCommand(&Command{
+		Name:  "gamemode",
+		Usage: "/gamemode creative|survival",
+		Run: func(g *Game, args *Args) (string, error) {
+			mode := args.Choice("mode", gameModeNames[:]...)
+			if err := args.Err(); err != nil {
+				return "", err
+			}
+			for m, name := range gameModeNames {
+				if name == mode {
+					g.setGameMode(GameMode(m))
+				}
+			}
+			return "game mode " + mode, nil
+		},
+	})
+	RegisterCommand(&Command{
+		Name:  "profiles",
+		Usage: "/profiles",
+		Run: func(g *Game, args *Args) (string, error) {
+			if err := args.Err(); err != nil {
+				return "", err
+			}
+			slots := db.PlayerSlots()
+			if len(slots) == 0 {
+				return "no saved profile, playing " + playerSlot(), nil
+			}
+			return fmt.Sprintf("playing %s, saved %s", playerSlot(), strings.Join(slots, ", ")), nil
+		},
+	})
+}
+
+func (g *Game) setGameMode(mode GameMode) {
+	g.mode = mode
+	if mode == ModeSurvival && g.camera.Flying() {
+		g.camera.FlipFlying()
+	}
+}
+
+// hasItem reports whether the held block can be placed, always in
+// creative mode.
+func (g *Game) hasItem() bool {
+	return g.mode != ModeSurvival || g.inventory.Count(g.item) > 0
+}
+
+// toggleFlying starts or stops flying, creative mode only.
+func (g *Game) toggleFlying() {
+	if g.mode == ModeSurvival {
+		return
+	}
+	g.camera.FlipFlying()
+}
+
+// PlayerData returns the player data kept by the store.
+func (g *Game) PlayerData() PlayerData {
+	return PlayerData{
+		State:     g.camera.State(),
+		Item:      g.item,
+		Mode:      g.mode,
+		Health:    g.health,
+		Inventory: g.inventory,
+	}
+}
+
+// RestorePlayer puts back the player data saved by the store.
+func (g *Game) RestorePlayer(d PlayerData) {
+	g.camera.Restore(d.State)
+	for i, item := range availableItems {
+		if item == d.Item {
+			g.itemidx, g.item = i, item
+		}
+	}
+	g.setGameMode(d.Mode)
+	if d.Health > 0 && d.Health <= maxHealth {
+		g.health = d.Health
+	}
+	if d.Inventory != nil {
+		g.inventory = d.Inventory
+	}
+}
+
+// the segments of a digit as x, y, width and height in a 0.6x1 cell, y
+// going down: top, top right, bottom right, bottom, bottom left, top left
+// and middle
+var digitSegments = [7][4]float32{
+	{0, 0, 0.6, 0.12},
+	{0.48, 0, 0.12, 0.5},
+	{0.48, 0.5, 0.12, 0.5},
+	{0, 0.88, 0.6, 0.12},
+	{0, 0.5, 0.12, 0.5},
+	{0, 0, 0.12, 0.5},
+	{0, 0.44, 0.6, 0.12},
+}
+
+// the lit segments of the digits, bit i for digitSegments[i]
+var digitMasks = [10]uint8{0x3f, 0x06, 0x5b, 0x4f, 0x66, 0x6d, 0x7d, 0x07, 0x7f, 0x6f}
+
+// drawNumber draws n with its digits of height size from x, y at the top
+// left.
+func (r *LineRender) drawNumber(project mgl32.Mat4, n int, x, y, size float32) {
+	for _, c := range strconv.Itoa(n) {
+		mask := digitMasks[c-'0']
+		for i, seg := range digitSegments {
+			if mask&(1<<uint(i)) == 0 {
+				continue
+			}
+			model := mgl32.Translate3D(x+seg[0]*size, y+seg[1]*size, 0)
+			r.quad.Fill(project.Mul4(model.Mul4(mgl32.Scale3D(seg[2]*size, seg[3]*size, 1))))
+		}
+		x += 0.8 * size
+	}
+}
+
+// drawItemCount draws the blocks of the held type left in survival mode
+// at the bottom right of the held item, drawn by BlockRender.drawItem.
+func (r *LineRender) drawItemCount() {
+	if game.mode != ModeSurvival {
+		return
+	}
+	width, height := game.win.GetFramebufferSize()
+	project := mgl32.Ortho2D(0, float32(width), float32(height), 0)
+	// pixels per unit of the held item projection
+	u := float32(width) / (15 / settings.UIScale)
+	size := u * 0.45
+	count := game.inventory.Count(game.item)
+	color := mgl32.Vec4{1, 1, 1, 1}
+	if count == 0 {
+		color = mgl32.Vec4{0.6, 0.6, 0.6, 1}
+	}
+	x, y := 1.5*u, float32(height)-0.3*u-size
+	// a shadow under the digits
+	r.shader.SetUniformAttr(1, mgl32.Vec4{0, 0, 0, 1})
+	r.drawNumber(project, count, x+size*0.08, y+size*0.08, size)
+	r.shader.SetUniformAttr(1, color)
+	r.drawNumber(project, count, x, y, size)
+	r.shader.SetUniformAttr(1, mgl32.Vec4{0, 0, 0, 1})
+}
@@ -0,0 +1,86 @@
+package game
+
+import "github.com/icexin/gocraft/render"
+
+// LoadTextureDesc loads the resource pack of -pack and the block textures.
+func LoadTextureDesc() error {
+	pack, err := render.LoadResourcePack(*packPath)
+	if err != nil {
+		return err
+	}
+	render.UseResourcePack(pack)
+	return nil
+}
+
+var availableItems = []int{
+	1,
+	2,
+	3,
+	4,
+	5,
+	6,
+	7,
+	8,
+	9,
+	10,
+	11,
+	12,
+	13,
+	14,
+	15,
+	16,
+	17,
+	18,
+	19,
+	20,
+	21,
+	22,
+	23,
+	32,
+	33,
+	34,
+	35,
+	36,
+	37,
+	38,
+	39,
+	40,
+	41,
+	42,
+	43,
+	44,
+	45,
+	46,
+	47,
+	48,
+	49,
+	50,
+	51,
+	52,
+	53,
+	54,
+	55,
+	56,
+	57,
+	58,
+	59,
+	60,
+	61,
+	62,
+	63,
+	64,
+	65,
+	66,
+	67,
+	68,
+	69,
+	70,
+	71,
+	72,
+	73,
+	74,
+	75,
+	76,
+	77,
+	78,
+}
@@ -0,0 +1,217 @@
+package game
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-gl/gl/v3.3-core/gl"
+	"github.com/go-gl/glfw/v3.2/glfw"
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/icexin/gocraft/internal/geom"
+	"github.com/icexin/gocraft/render"
+	"github.com/icexin/gocraft/world"
+)
+
+// columns of the item screen grid
+const itemScreenColumns = 10
+
+var (
+	itemScreenShade = mgl32.Vec4{0, 0, 0, 0.5}
+	itemCellColor   = mgl32.Vec4{0.25, 0.25, 0.25, 0.8}
+	itemHoverColor  = mgl32.Vec4{0.55, 0.55, 0.55, 0.9}
+	itemHeldColor   = mgl32.Vec4{0.8, 0.75, 0.4, 0.9}
+)
+
+// ItemScreen is the grid of the blocks opened with E. There is no text
+// rendering, the block type typed to search is shown in the window title.
+type ItemScreen struct {
+	active bool
+	query  []rune
+	// index in Items of the cell under the cursor, -1 if none
+	hover int
+}
+
+func (s *ItemScreen) Active() bool {
+	return s.active
+}
+
+// Input adds a digit to the searched block type.
+func (s *ItemScreen) Input(r rune) {
+	if s.active && r >= '0' && r <= '9' {
+		s.query = append(s.query, r)
+		s.hover = -1
+	}
+}
+
+func (s *ItemScreen) Backspace() {
+	if n := len(s.query); n > 0 {
+		s.query = s.query[:n-1]
+		s.hover = -1
+	}
+}
+
+// Items returns the availableItems whose type contains the typed digits.
+func (s *ItemScreen) Items() []int {
+	if len(s.query) == 0 {
+		return availableItems
+	}
+	query := string(s.query)
+	var items []int
+	for _, item := range availableItems {
+		if strings.Contains(strconv.Itoa(item), query) {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Title returns the search shown in the window title.
+func (s *ItemScreen) Title() string {
+	return fmt.Sprintf("block type: %s_ (%d)", string(s.query), len(s.Items()))
+}
+
+// itemGridLayout returns the top left corner of the grid and the size of a
+// cell in a window of width x height. The grid keeps the size of the whole
+// list while searching.
+func itemGridLayout(width, height float32) (x0, y0, cell float32) {
+	rows := (len(availableItems) + itemScreenColumns - 1) / itemScreenColumns
+	cell = width / (itemScreenColumns + 2)
+	if h := height / float32(rows+2); h < cell {
+		cell = h
+	}
+	x0 = (width - itemScreenColumns*cell) / 2
+	y0 = (height - float32(rows)*cell) / 2
+	return
+}
+
+// cellAt returns the index in Items of the cell at x, y in window
+// coordinates, -1 if none.
+func (s *ItemScreen) cellAt(x, y float32) int {
+	width, height := game.win.GetSize()
+	x0, y0, cell := itemGridLayout(float32(width), float32(height))
+	if x < x0 || y < y0 {
+		return -1
+	}
+	col, row := int((x-x0)/cell), int((y-y0)/cell)
+	i := row*itemScreenColumns + col
+	if col >= itemScreenColumns || i >= len(s.Items()) {
+		return -1
+	}
+	return i
+}
+
+func (g *Game) openItemScreen() {
+	g.stopMining()
+	g.itemScreen.active = true
+	g.itemScreen.query = g.itemScreen.query[:0]
+	g.itemScreen.hover = -1
+	g.setExclusiveMouse(false)
+}
+
+func (g *Game) closeItemScreen() {
+	g.itemScreen.active = false
+	g.setExclusiveMouse(true)
+	// the cursor jumps back to where it was hidden
+	g.lx, g.ly = 0, 0
+}
+
+// onItemScreenKey handles the keys while the item screen is open.
+func (g *Game) onItemScreenKey(key glfw.Key) {
+	switch key {
+	case glfw.KeyEscape, glfw.KeyE:
+		g.closeItemScreen()
+	case glfw.KeyBackspace:
+		g.itemScreen.Backspace()
+	case glfw.KeyEnter, glfw.KeyKPEnter:
+		// the first block found
+		if items := g.itemScreen.Items(); len(items) != 0 {
+			g.holdItem(items[0])
+			g.closeItemScreen()
+		}
+	}
+}
+
+func (g *Game) onItemScreenCursor(x, y float64) {
+	g.itemScreen.hover = g.itemScreen.cellAt(float32(x), float32(y))
+}
+
+func (g *Game) onItemScreenClick(button glfw.MouseButton, action glfw.Action) {
+	if button != glfw.MouseButton1 || action != glfw.Press {
+		return
+	}
+	x, y := g.win.GetCursorPos()
+	i := g.itemScreen.cellAt(float32(x), float32(y))
+	if i < 0 {
+		return
+	}
+	g.holdItem(g.itemScreen.Items()[i])
+	g.closeItemScreen()
+}
+
+// DrawItemScreen shades the screen and draws the cells of the grid.
+func (r *LineRender) DrawItemScreen() {
+	width, height := game.win.GetSize()
+	w, h := float32(width), float32(height)
+	project := mgl32.Ortho2D(0, w, h, 0)
+	x0, y0, cell := itemGridLayout(w, h)
+	gl.Disable(gl.DEPTH_TEST)
+	gl.Enable(gl.BLEND)
+	gl.BlendFuncSeparate(gl.SRC_ALPHA, gl.ONE_MINUS_SRC_ALPHA, gl.ZERO, gl.ONE)
+	r.shader.Begin()
+	r.shader.SetUniformAttr(1, itemScreenShade)
+	r.quad.Fill(project.Mul4(mgl32.Scale3D(w, h, 1)))
+	for i, item := range game.itemScreen.Items() {
+		color := itemCellColor
+		switch {
+		case i == game.itemScreen.hover:
+			color = itemHoverColor
+		case item == game.item:
+			color = itemHeldColor
+		}
+		x := x0 + float32(i%itemScreenColumns)*cell
+		y := y0 + float32(i/itemScreenColumns)*cell
+		// a gap between the cells
+		gap := cell * 0.05
+		model := mgl32.Translate3D(x+gap, y+gap, 0).Mul4(mgl32.Scale3D(cell-2*gap, cell-2*gap, 1))
+		r.shader.SetUniformAttr(1, color)
+		r.quad.Fill(project.Mul4(model))
+	}
+	r.shader.SetUniformAttr(1, mgl32.Vec4{0, 0, 0, 1})
+	r.shader.End()
+	gl.Disable(gl.BLEND)
+	gl.Enable(gl.DEPTH_TEST)
+}
+
+// drawItemScreen draws the blocks in the cells of the grid, like the held
+// item but at full brightness.
+func (g *Game) drawItemScreen() {
+	width, height := g.win.GetSize()
+	w, h := float32(width), float32(height)
+	x0, y0, cell := itemGridLayout(w, h)
+	// y goes up, the faces keep their winding
+	project := mgl32.Ortho(0, w, 0, h, -cell, cell)
+	gl.Clear(gl.DEPTH_BUFFER_BIT)
+	shader, texture := g.blockRender.Shader(), g.blockRender.Texture()
+	shader.Begin()
+	texture.Begin()
+	shader.SetUniformAttr(1, mgl32.Vec3{0, 0, 0})
+	shader.SetUniformAttr(2, float32(render.Radius())*world.ChunkWidth)
+	shader.SetUniformAttr(3, float32(1))
+	shader.SetUniformAttr(5, float32(0))
+	shader.SetUniformAttr(11, float32(0))
+	shader.SetUniformAttr(17, float32(0))
+	for i, item := range g.itemScreen.Items() {
+		x := x0 + (float32(i%itemScreenColumns)+0.5)*cell
+		y := y0 + (float32(i/itemScreenColumns)+0.5)*cell
+		size := cell * 0.45
+		model := mgl32.Translate3D(x, h-y, 0)
+		model = model.Mul4(mgl32.Scale3D(size, size, size))
+		model = model.Mul4(mgl32.HomogRotate3DX(geom.Radian(30)))
+		model = model.Mul4(mgl32.HomogRotate3DY(geom.Radian(45)))
+		shader.SetUniformAttr(0, project.Mul4(model))
+		g.blockRender.BlockMesh(item).Draw()
+	}
+	texture.End()
+	shader.End()
+}
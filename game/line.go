@@ -0,0 +1,171 @@
+package game
+
+import (
+	"github.com/faiface/glhf"
+	"github.com/faiface/mainthread"
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/icexin/gocraft/render"
+	"github.com/icexin/gocraft/world"
+)
+
+type LineRender struct {
+	shader *glhf.Shader
+	cross  *render.Lines
+	marker *render.Lines
+
+	// touch controls
+	circle  *render.Lines
+	chevron *render.Lines
+
+	// unit cube wireframe shared by the block wireframe and the scan overlay
+	cube      *render.Lines
+	highlight []world.Vec3
+	// unit square filled by the profiler bars
+	quad *render.Lines
+
+	debug DebugDraw
+}
+
+func NewLineRender() (*LineRender, error) {
+	r := &LineRender{}
+	var err error
+	mainthread.Call(func() {
+		r.shader, err = glhf.NewShader(glhf.AttrFormat{
+			glhf.Attr{Name: "pos", Type: glhf.Vec3},
+		}, glhf.AttrFormat{
+			glhf.Attr{Name: "matrix", Type: glhf.Mat4},
+			glhf.Attr{Name: "color", Type: glhf.Vec4},
+		}, lineVertexSource, lineFragmentSource)
+
+		if err != nil {
+			return
+		}
+		r.cross = makeCross(r.shader)
+		r.marker = makeHitMarker(r.shader)
+		r.circle = makeCircle(r.shader, 32)
+		r.chevron = makeChevron(r.shader)
+		all := [...]bool{true, true, true, true, true, true}
+		r.cube = render.NewLines(r.shader, render.MakeWireFrameData(nil, all))
+		r.quad = render.NewLines(r.shader, []float32{
+			0, 0, 0, 1, 0, 0, 1, 1, 0,
+			1, 1, 0, 0, 1, 0, 0, 0, 0,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *LineRender) drawCross() {
+	width, height := game.win.GetFramebufferSize()
+	project := mgl32.Ortho2D(0, float32(width), float32(height), 0)
+	model := mgl32.Translate3D(float32(width/2), float32(height/2), 0)
+	size := float32(height/30) * settings.UIScale
+	model = model.Mul4(mgl32.Scale3D(size, size, 0))
+	r.cross.Draw(project.Mul4(model))
+
+	// the hit marker spreads out and fades to the cross color
+	if t, ok := game.HitMarker(); ok {
+		s := 1 + t*0.5
+		c := 1 - t
+		r.shader.SetUniformAttr(1, mgl32.Vec4{c, c, c, 1})
+		r.marker.Draw(project.Mul4(model.Mul4(mgl32.Scale3D(s, s, 0))))
+		r.shader.SetUniformAttr(1, mgl32.Vec4{0, 0, 0, 1})
+	}
+}
+
+func (r *LineRender) drawWireFrame(mat mgl32.Mat4) {
+	block, _ := game.world.HitTest(game.camera.Pos(), game.camera.Front())
+	if block == nil {
+		return
+	}
+
+	mat = mat.Mul4(mgl32.Translate3D(float32(block.X), float32(block.Y), float32(block.Z)))
+	mat = mat.Mul4(mgl32.Scale3D(1.06, 1.06, 1.06))
+
+	id := *block
+	show := [...]bool{
+		world.IsTransparent(game.world.Block(id.Left())),
+		world.IsTransparent(game.world.Block(id.Right())),
+		world.IsTransparent(game.world.Block(id.Up())),
+		world.IsTransparent(game.world.Block(id.Down())),
+		world.IsTransparent(game.world.Block(id.Front())),
+		world.IsTransparent(game.world.Block(id.Back())),
+	}
+	// r.cube holds the edges of the six faces in order, 8 vertices per face
+	const faceVertices = 8
+	for face, ok := range show {
+		if ok {
+			r.cube.DrawRange(mat, face*faceVertices, faceVertices)
+		}
+	}
+}
+
+// SetHighlight sets the blocks outlined by the scan overlay, call on mainthread.
+func (r *LineRender) SetHighlight(ids []world.Vec3) {
+	r.highlight = ids
+}
+
+func (r *LineRender) drawHighlight(mat mgl32.Mat4) {
+	for _, id := range r.highlight {
+		m := mat.Mul4(mgl32.Translate3D(float32(id.X), float32(id.Y), float32(id.Z)))
+		r.cube.Draw(m.Mul4(mgl32.Scale3D(1.02, 1.02, 1.02)))
+	}
+}
+
+func (r *LineRender) drawBolts(mat mgl32.Mat4) {
+	if len(game.weather.bolts) == 0 {
+		return
+	}
+	r.shader.SetUniformAttr(1, mgl32.Vec4{1, 1, 0.9, 1})
+	for _, b := range game.weather.bolts {
+		b.lines.Draw(mat)
+	}
+}
+
+func (r *LineRender) Draw() {
+	mat := game.blockRender.Matrix()
+
+	r.shader.Begin()
+	r.shader.SetUniformAttr(1, mgl32.Vec4{0, 0, 0, 1})
+	if !game.photoMode {
+		r.drawWireFrame(mat)
+		r.drawHighlight(mat)
+		r.drawDebug(mat)
+	}
+	r.drawBolts(mat)
+	r.shader.End()
+}
+
+// DrawHUD draws the cross hair and the touch controls over the post effects.
+func (r *LineRender) DrawHUD() {
+	r.shader.Begin()
+	r.shader.SetUniformAttr(1, mgl32.Vec4{0, 0, 0, 1})
+	r.drawCross()
+	r.drawItemCount()
+	if *touchEnabled {
+		r.drawTouch()
+	}
+	if game.debug {
+		r.drawProfile()
+	}
+	r.shader.End()
+}
+
+// makeHitMarker makes four short diagonal strokes around the cross.
+func makeHitMarker(shader *glhf.Shader) *render.Lines {
+	return render.NewLines(shader, []float32{
+		0.2, 0.2, 0, 0.45, 0.45, 0,
+		-0.2, 0.2, 0, -0.45, 0.45, 0,
+		0.2, -0.2, 0, 0.45, -0.45, 0,
+		-0.2, -0.2, 0, -0.45, -0.45, 0,
+	})
+}
+
+func makeCross(shader *glhf.Shader) *render.Lines {
+	return render.NewLines(shader, []float32{
+		-0.5, 0, 0, 0.5, 0, 0,
+		0, -0.5, 0, 0, 0.5, 0,
+	})
+}
@@ -0,0 +1,24 @@
+#version 330 core
+
+in vec4 Color;
+in float diff;
+in float fog_factor;
+uniform float dim;
+uniform vec3 foliage;
+uniform float snow;
+uniform vec3 fogcolor;
+
+out vec4 FragColor;
+
+
+void main() {
+    vec3 color = Color.rgb;
+    // the alpha marks the foliage tops, tinted and snowed like in block.frag
+    if (Color.a > 0.5) {
+        color = clamp(color * foliage, 0, 1);
+        color = mix(color, vec3(0.95, 0.97, 1), snow);
+    }
+    color = (0.5 + diff * 0.5) * color;
+    color = mix(color, fogcolor, fog_factor);
+    FragColor = vec4(color * dim, 1);
+}
@@ -0,0 +1,337 @@
+package game
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/faiface/glhf"
+	"github.com/faiface/mainthread"
+	"github.com/go-gl/gl/v3.3-core/gl"
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/icexin/gocraft/internal/geom"
+	"github.com/icexin/gocraft/render"
+	"github.com/icexin/gocraft/world"
+)
+
+var lodRadius = flags.Int("lod", 0, "radius in chunks of the low detail terrain drawn beyond -r, 0 disables it")
+
+const (
+	// columns per quad of the low detail tiles, the coarse step starts at
+	// twice the render radius
+	lodNearStep = 4
+	lodFarStep  = 8
+	// tiles uploaded in a frame
+	lodBatch = 16
+)
+
+// LODRender draws the chunks between the render radius and -lod as coarse
+// heightmaps, one quad per lodNearStep or lodFarStep columns, made from the
+// terrain noise without generating the chunks. The plants, trees,
+// structures and changes of the players are left out, the tiles are too
+// far to tell. They are drawn first with their own far plane and the depth
+// is cleared before the chunks.
+type LODRender struct {
+	shader *glhf.Shader
+	sigch  chan struct{}
+	// chunk of the player and render radius at the last update
+	center world.Vec3
+	radius int
+
+	mutex sync.Mutex
+	tiles map[world.Vec3]*lodTile
+	// average color of the top tile by block type, reset with the pack
+	colors map[int]mgl32.Vec4
+}
+
+type lodTile struct {
+	mesh *render.Mesh
+	step int
+	box  geom.AABB
+}
+
+func NewLODRender() (*LODRender, error) {
+	r := &LODRender{
+		sigch:  make(chan struct{}, 1),
+		tiles:  make(map[world.Vec3]*lodTile),
+		colors: make(map[int]mgl32.Vec4),
+	}
+	var err error
+	mainthread.Call(func() {
+		r.shader, err = glhf.NewShader(glhf.AttrFormat{
+			glhf.Attr{Name: "pos", Type: glhf.Vec3},
+			glhf.Attr{Name: "color", Type: glhf.Vec4},
+			glhf.Attr{Name: "normal", Type: glhf.Vec3},
+		}, append(glhf.AttrFormat{
+			glhf.Attr{Name: "matrix", Type: glhf.Mat4},
+			glhf.Attr{Name: "camera", Type: glhf.Vec3},
+			glhf.Attr{Name: "fogdis", Type: glhf.Float},
+			glhf.Attr{Name: "dim", Type: glhf.Float},
+			glhf.Attr{Name: "foliage", Type: glhf.Vec3},
+			glhf.Attr{Name: "snow", Type: glhf.Float},
+		}, render.FogUniforms...), render.ShaderInclude(lodVertexSource, render.FogSource), lodFragmentSource)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// index of fogstart in the uniforms of the lod shader
+const lodFogUniform = 6
+
+func lodEnabled() bool {
+	return *lodRadius > render.Radius()
+}
+
+// fogDistance is where the fog hides the terrain, at the end of the low
+// detail terrain when it's drawn.
+func fogDistance() float32 {
+	if lodEnabled() {
+		return float32(*lodRadius * world.ChunkWidth)
+	}
+	return float32(render.Radius() * world.ChunkWidth)
+}
+
+// lodStep returns the columns per quad of the tile of chunk id, nothing in
+// the render radius.
+func lodStep(center, id world.Vec3) int {
+	dx, dz := id.X-center.X, id.Z-center.Z
+	d := dx*dx + dz*dz
+	n := render.Radius()
+	switch {
+	case d <= n*n || d > *lodRadius**lodRadius:
+		return 0
+	case d <= 4*n*n:
+		return lodNearStep
+	}
+	return lodFarStep
+}
+
+// Reset drops the tiles, they are built again with the colors of the
+// current resource pack. Call on mainthread.
+func (r *LODRender) Reset() {
+	r.mutex.Lock()
+	tiles := r.tiles
+	r.tiles = make(map[world.Vec3]*lodTile)
+	r.colors = make(map[int]mgl32.Vec4)
+	r.mutex.Unlock()
+	for _, tile := range tiles {
+		tile.mesh.Release()
+	}
+	r.check()
+}
+
+func (r *LODRender) check() {
+	select {
+	case r.sigch <- struct{}{}:
+	default:
+	}
+}
+
+func (r *LODRender) UpdateLoop() {
+	defer crashGuard()
+	for range r.sigch {
+		r.update()
+	}
+}
+
+// update builds the missing tiles around the player and drops the ones out
+// of range or of another step.
+func (r *LODRender) update() {
+	if !lodEnabled() {
+		return
+	}
+	center := world.NearBlock(game.camera.Pos()).Chunkid()
+	n := *lodRadius
+	var added []world.Vec3
+	var removed []*render.Mesh
+	r.mutex.Lock()
+	for id, tile := range r.tiles {
+		if lodStep(center, id) != tile.step {
+			removed = append(removed, tile.mesh)
+			delete(r.tiles, id)
+		}
+	}
+	for dx := -n; dx <= n; dx++ {
+		for dz := -n; dz <= n; dz++ {
+			id := world.Vec3{X: center.X + dx, Z: center.Z + dz}
+			if _, ok := r.tiles[id]; !ok && lodStep(center, id) != 0 {
+				added = append(added, id)
+			}
+		}
+	}
+	r.mutex.Unlock()
+	if len(removed) != 0 {
+		render.FrameTasks.Post(func() {
+			for _, mesh := range removed {
+				mesh.Release()
+			}
+		})
+	}
+	if len(added) == 0 {
+		return
+	}
+
+	sort.Slice(added, func(i, j int) bool {
+		di := (added[i].X-center.X)*(added[i].X-center.X) + (added[i].Z-center.Z)*(added[i].Z-center.Z)
+		dj := (added[j].X-center.X)*(added[j].X-center.X) + (added[j].Z-center.Z)*(added[j].Z-center.Z)
+		return di < dj
+	})
+	// the rest is built by the next update, the player may have moved
+	if len(added) > lodBatch {
+		added = added[:lodBatch]
+		r.check()
+	}
+	tiles := make([]*lodTile, len(added))
+	data := make([][]float32, len(added))
+	for i, id := range added {
+		tiles[i], data[i] = r.makeTile(id, lodStep(center, id))
+	}
+	render.FrameTasks.Call(func() {
+		for i, tile := range tiles {
+			tile.mesh = render.NewMesh(r.shader, data[i])
+		}
+	})
+	r.mutex.Lock()
+	for i, id := range added {
+		r.tiles[id] = tiles[i]
+	}
+	r.mutex.Unlock()
+}
+
+// color returns the average color of the top tile of block type w, the
+// alpha is 1 for the foliage tiles.
+func (r *LODRender) color(w int) mgl32.Vec4 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if c, ok := r.colors[w]; ok {
+		return c
+	}
+	pack := render.CurrentPack()
+	t := pack.Tiles(w)[2]
+	size := pack.TileSize()
+	// the atlas is sampled upside down, the first row of tiles is at the
+	// bottom of the image
+	x0 := (t % 16) * size
+	y0 := pack.Rect.Dy() - (t/16+1)*size
+	var sum [3]float32
+	var count float32
+	for y := y0; y < y0+size; y++ {
+		for x := x0; x < x0+size; x++ {
+			i := (y*pack.Rect.Dx() + x) * 4
+			if pack.Pix[i+3] == 0 {
+				continue
+			}
+			for k := range sum {
+				sum[k] += float32(pack.Pix[i+k])
+			}
+			count++
+		}
+	}
+	var c mgl32.Vec4
+	if count != 0 {
+		c = mgl32.Vec4{sum[0] / count / 255, sum[1] / count / 255, sum[2] / count / 255, 0}
+	}
+	if t == 14 || t == 32 {
+		c[3] = 1
+	}
+	r.colors[w] = c
+	return c
+}
+
+// makeTile returns the tile of chunk id and the vertices of its heightmap,
+// sampling the terrain every step columns.
+func (r *LODRender) makeTile(id world.Vec3, step int) (*lodTile, []float32) {
+	cells := world.ChunkWidth / step
+	x0, z0 := id.X*world.ChunkWidth, id.Z*world.ChunkWidth
+	// the samples reach one step over the tile for the normals
+	size := cells + 3
+	heights := make([]float32, size*size)
+	types := make([]int, size*size)
+	for i := 0; i < size; i++ {
+		for j := 0; j < size; j++ {
+			h, w := world.TerrainHeight(x0+(i-1)*step, z0+(j-1)*step)
+			heights[i*size+j] = float32(h) - 0.5
+			types[i*size+j] = w
+		}
+	}
+	vertex := func(data []float32, i, j int, color mgl32.Vec4) []float32 {
+		at := func(i, j int) float32 {
+			return heights[(i+1)*size+j+1]
+		}
+		normal := mgl32.Vec3{at(i-1, j) - at(i+1, j), float32(2 * step), at(i, j-1) - at(i, j+1)}.Normalize()
+		return append(data,
+			float32(x0+i*step)-0.5, at(i, j), float32(z0+j*step)-0.5,
+			color[0], color[1], color[2], color[3],
+			normal[0], normal[1], normal[2],
+		)
+	}
+	data := make([]float32, 0, cells*cells*6*10)
+	miny, maxy := float32(world.ChunkHeight), float32(0)
+	for i := 0; i < cells; i++ {
+		for j := 0; j < cells; j++ {
+			color := r.color(types[(i+1)*size+j+1])
+			// wound like the top faces of MakeCubeData
+			data = vertex(data, i, j+1, color)
+			data = vertex(data, i+1, j+1, color)
+			data = vertex(data, i+1, j, color)
+			data = vertex(data, i+1, j, color)
+			data = vertex(data, i, j, color)
+			data = vertex(data, i, j+1, color)
+		}
+	}
+	for i := 1; i < size-1; i++ {
+		for j := 1; j < size-1; j++ {
+			h := heights[i*size+j]
+			if h < miny {
+				miny = h
+			}
+			if h > maxy {
+				maxy = h
+			}
+		}
+	}
+	tile := &lodTile{
+		step: step,
+		box: geom.AABB{
+			Min: mgl32.Vec3{float32(x0) - 0.5, miny, float32(z0) - 0.5},
+			Max: mgl32.Vec3{float32(x0+world.ChunkWidth) - 0.5, maxy, float32(z0+world.ChunkWidth) - 0.5},
+		},
+	}
+	return tile, data
+}
+
+// Draw draws the tiles in view and clears the depth for the chunks, call
+// on mainthread before them.
+func (r *LODRender) Draw() {
+	if !lodEnabled() {
+		return
+	}
+	if center := world.NearBlock(game.camera.Pos()).Chunkid(); center != r.center || render.Radius() != r.radius {
+		r.center, r.radius = center, render.Radius()
+		r.check()
+	}
+	far := fogDistance()
+	width, height := game.win.GetSize()
+	mat := mgl32.Perspective(geom.Radian(game.camera.Fov()), float32(width)/float32(height), 1, far)
+	mat = mat.Mul4(game.camera.Matrix())
+	frustum := geom.NewFrustum(mat)
+
+	season := CurrentSeason()
+	r.shader.Begin()
+	r.shader.SetUniformAttr(0, mat)
+	r.shader.SetUniformAttr(1, game.camera.Pos())
+	currentFog().Bind(r.shader, 2, lodFogUniform)
+	r.shader.SetUniformAttr(3, game.Dim())
+	r.shader.SetUniformAttr(4, season.Foliage)
+	r.shader.SetUniformAttr(5, season.Snow)
+	r.mutex.Lock()
+	for _, tile := range r.tiles {
+		if frustum.IntersectsAABB(tile.box) {
+			tile.mesh.Draw()
+		}
+	}
+	r.mutex.Unlock()
+	r.shader.End()
+	gl.Clear(gl.DEPTH_BUFFER_BIT)
+}
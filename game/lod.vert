@@ -0,0 +1,23 @@
+#version 330 core
+
+layout(location = 0) in vec3 pos;
+layout(location = 1) in vec4 color;
+layout(location = 2) in vec3 normal;
+
+uniform mat4 matrix;
+uniform vec3 camera;
+
+out vec4 Color;
+out float diff;
+out float fog_factor;
+
+const vec3 lightdir = normalize(vec3(-1, 1, -1));
+
+void main() {
+    gl_Position = matrix * vec4(pos, 1.0);
+    float camera_distance = distance(pos, camera);
+    // fog is in fog.glsl, included by the game
+    fog_factor = fog(camera_distance);
+    Color = color;
+    diff = max(0, dot(normal, lightdir));
+}
@@ -0,0 +1,36 @@
+package game
+
+import "github.com/icexin/gocraft/internal/logging"
+
+var (
+	gameLog   = logging.New("game")
+	renderLog = logging.New("render")
+	gpuLog    = logging.New("gpu")
+	netLog    = logging.New("net")
+	storeLog  = logging.New("store")
+)
+
+func init() {
+	RegisterCommand(&Command{
+		Name:  "log",
+		Usage: "/log error|warn|info|debug|overlay [on|off]",
+		Run: func(g *Game, args *Args) (string, error) {
+			what := args.Choice("level", "error", "warn", "info", "debug", "overlay")
+			if what == "overlay" {
+				on := args.Switch("state")
+				if err := args.Err(); err != nil {
+					return "", err
+				}
+				logging.Tail.Show(on)
+				return "log overlay " + onOff(on) + ", shown with F3", nil
+			}
+			if err := args.Err(); err != nil {
+				return "", err
+			}
+			if level, ok := logging.ParseLevel(what); ok {
+				logging.SetVerbosity(level)
+			}
+			return "log level " + what, nil
+		},
+	})
+}
@@ -0,0 +1,242 @@
+package game
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"os"
+	"sort"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/icexin/gocraft/internal/geom"
+	"github.com/icexin/gocraft/render"
+	"github.com/icexin/gocraft/world"
+)
+
+var mapRadius = flags.Int("mapradius", 8, "chunks around the saved player position added to the exported maps")
+
+// chunks loaded at the same time by the map export
+const mapBatch = 64
+
+// mapSource reads the changes from the store only, the export doesn't
+// touch the server nor write anything.
+type mapSource struct{}
+
+func (mapSource) RangeBlocks(id world.Vec3, f func(bid world.Vec3, w int)) error {
+	return db.RangeBlocks(id, f)
+}
+
+func (mapSource) UpdateBlock(id world.Vec3, w int) error {
+	return nil
+}
+
+func (mapSource) FetchChunk(id world.Vec3, f func(bid world.Vec3, w int)) error {
+	return nil
+}
+
+// exploredChunks returns the chunks fetched from the server, the chunks with
+// saved changes and the chunks around the player, and the edit count of
+// each column.
+func exploredChunks() ([]world.Vec3, map[[2]int]int, error) {
+	set := make(map[world.Vec3]bool)
+	edits := make(map[[2]int]int)
+	err := db.RangeSyncedChunks(func(id world.Vec3) {
+		set[id] = true
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	err = db.RangeEdits(func(bid world.Vec3, w int) {
+		set[bid.Chunkid()] = true
+		edits[[2]int{bid.X, bid.Z}]++
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	state := loadPlayerData().State
+	center := world.NearBlock(mgl32.Vec3{state.X, state.Y, state.Z}).Chunkid()
+	n := *mapRadius
+	for dx := -n; dx <= n; dx++ {
+		for dz := -n; dz <= n; dz++ {
+			if dx*dx+dz*dz <= n*n {
+				set[world.Vec3{X: center.X + dx, Y: 0, Z: center.Z + dz}] = true
+			}
+		}
+	}
+	ids := make([]world.Vec3, 0, len(set))
+	for id := range set {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if ids[i].X != ids[j].X {
+			return ids[i].X < ids[j].X
+		}
+		return ids[i].Z < ids[j].Z
+	})
+	return ids, edits, nil
+}
+
+// tileColors averages the texture tiles, the see-through texels are left out.
+type tileColors struct {
+	pix    []uint8
+	stride int
+	size   int // of a tile in pixels
+	colors map[int]color.NRGBA
+}
+
+// newTileColors returns the average colors of the tiles of the current pack.
+func newTileColors() *tileColors {
+	return &tileColors{
+		pix:    render.CurrentPack().Pix,
+		stride: render.CurrentPack().Rect.Dx() * 4,
+		size:   render.CurrentPack().TileSize(),
+		colors: make(map[int]color.NRGBA),
+	}
+}
+
+func (t *tileColors) color(idx int) color.NRGBA {
+	if c, ok := t.colors[idx]; ok {
+		return c
+	}
+	x0, y0 := idx%16*t.size, (15-idx/16)*t.size
+	var r, g, b, n int
+	for y := y0; y < y0+t.size; y++ {
+		for x := x0; x < x0+t.size; x++ {
+			p := t.pix[y*t.stride+x*4:]
+			if p[3] < 255 || p[0] == 255 && p[1] == 0 && p[2] == 255 {
+				continue
+			}
+			r, g, b, n = r+int(p[0]), g+int(p[1]), b+int(p[2]), n+1
+		}
+	}
+	c := color.NRGBA{A: 255}
+	if n != 0 {
+		c.R, c.G, c.B = uint8(r/n), uint8(g/n), uint8(b/n)
+	}
+	t.colors[idx] = c
+	return c
+}
+
+// heatColor maps t in [0, 1] to black, red, yellow then white.
+func heatColor(t float64) color.NRGBA {
+	clamp := func(x float64) uint8 {
+		return uint8(math.Max(0, math.Min(1, x)) * 255)
+	}
+	return color.NRGBA{clamp(t * 3), clamp(t*3 - 1), clamp(t*3 - 2), 255}
+}
+
+func savePNG(name string, img image.Image) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	err = png.Encode(f, img)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// ExportMaps writes the height, surface and edit density maps of the
+// explored world, one pixel per block with north up.
+func ExportMaps(prefix string) error {
+	err := LoadTextureDesc()
+	if err != nil {
+		return err
+	}
+	tiles := newTileColors()
+
+	err = InitStore()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	ids, edits, err := exploredChunks()
+	if err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return fmt.Errorf("nothing explored")
+	}
+	min, max := ids[0], ids[0]
+	for _, id := range ids {
+		min.X, min.Z = geom.MinInt(min.X, id.X), geom.MinInt(min.Z, id.Z)
+		max.X, max.Z = geom.MaxInt(max.X, id.X), geom.MaxInt(max.Z, id.Z)
+	}
+	x0, z0 := min.X*world.ChunkWidth, min.Z*world.ChunkWidth
+	bounds := image.Rect(0, 0, (max.X-min.X+1)*world.ChunkWidth, (max.Z-min.Z+1)*world.ChunkWidth)
+	gameLog.Infof("export %d chunks, %dx%d blocks", len(ids), bounds.Dx(), bounds.Dy())
+
+	heights := make([]int, bounds.Dx()*bounds.Dy())
+	for i := range heights {
+		heights[i] = -1
+	}
+	surface := image.NewNRGBA(bounds)
+	loaded := make(chan *world.Chunk, mapBatch)
+	w := world.New(mapBatch, mapSource{}, func(chunk *world.Chunk, changed bool) {
+		loaded <- chunk
+	})
+	defer w.Close()
+	for i := 0; i < len(ids); i += mapBatch {
+		batch := ids[i:]
+		if len(batch) > mapBatch {
+			batch = batch[:mapBatch]
+		}
+		w.Chunks(batch)
+		for range batch {
+			chunk := <-loaded
+			h := chunk.Heightmap()
+			cx, cz := chunk.Id().X*world.ChunkWidth-x0, chunk.Id().Z*world.ChunkWidth-z0
+			for dx := 0; dx < world.ChunkWidth; dx++ {
+				for dz := 0; dz < world.ChunkWidth; dz++ {
+					if h.Height[dx][dz] < 0 {
+						continue
+					}
+					x, z := cx+dx, cz+dz
+					heights[z*bounds.Dx()+x] = h.Height[dx][dz]
+					top := render.CurrentPack().Tiles(h.Block[dx][dz])[2]
+					surface.SetNRGBA(x, z, tiles.color(top))
+				}
+			}
+		}
+	}
+
+	low, high := world.ChunkHeight, 0
+	for _, y := range heights {
+		if y >= 0 {
+			low, high = geom.MinInt(low, y), geom.MaxInt(high, y)
+		}
+	}
+	height := image.NewGray(bounds)
+	for i, y := range heights {
+		if y >= 0 {
+			height.Pix[i] = uint8(32 + 223*(y-low)/geom.MaxInt(high-low, 1))
+		}
+	}
+
+	// edits on a log scale so a few busy builds don't hide the rest
+	density := image.NewNRGBA(bounds)
+	most := 0
+	for _, n := range edits {
+		most = geom.MaxInt(most, n)
+	}
+	for col, n := range edits {
+		t := math.Log1p(float64(n)) / math.Log1p(float64(most))
+		density.SetNRGBA(col[0]-x0, col[1]-z0, heatColor(0.2+0.8*t))
+	}
+
+	for name, img := range map[string]image.Image{
+		"height":  height,
+		"surface": surface,
+		"edits":   density,
+	} {
+		file := fmt.Sprintf("%s_%s.png", prefix, name)
+		if err := savePNG(file, img); err != nil {
+			return err
+		}
+		gameLog.Infof("saved %s", file)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package game
+
+import (
+	"expvar"
+	"sync/atomic"
+	"time"
+
+	"github.com/icexin/gocraft/internal/metrics"
+	"github.com/icexin/gocraft/render"
+	"github.com/icexin/gocraft/store"
+)
+
+// latency buckets in milliseconds of the frames
+var frameBuckets = []float64{4, 8, 16, 33, 50, 100}
+
+// MemStats counts the chunks loaded and the frames, served as json at
+// /debug/vars with -pprof.
+type MemStats struct {
+	chunksLoaded int64
+
+	frames *metrics.Histogram
+}
+
+var memStats = &MemStats{
+	frames: metrics.NewHistogram(frameBuckets),
+}
+
+// recordFrame counts the time the main thread spent on a frame.
+func (s *MemStats) recordFrame(d time.Duration) {
+	s.frames.Record(d)
+}
+
+// publishStats registers the stats of g in expvar and /metrics, called once
+// the game is built.
+func publishStats(g *Game) {
+	serveMetrics(g)
+	expvar.Publish("chunks", expvar.Func(func() interface{} {
+		return g.world.Stats()
+	}))
+	expvar.Publish("meshes", expvar.Func(func() interface{} {
+		return g.blockRender.Meshes().Len()
+	}))
+	expvar.Publish("frame_tasks", expvar.Func(func() interface{} {
+		return render.FrameTasks.Len()
+	}))
+	expvar.Publish("face_pool", expvar.Func(func() interface{} {
+		return render.Counts.FacePool()
+	}))
+	expvar.Publish("bolt_tx_ms", expvar.Func(func() interface{} {
+		return map[string]interface{}{
+			"update": store.UpdateDurations.Buckets(),
+			"view":   store.ViewDurations.Buckets(),
+		}
+	}))
+	expvar.Publish("frame_ms", expvar.Func(func() interface{} {
+		return memStats.frames.Buckets()
+	}))
+	expvar.Publish("vbo_pool", expvar.Func(func() interface{} {
+		return render.Counts.VBOPool()
+	}))
+	expvar.Publish("counters", expvar.Func(func() interface{} {
+		return map[string]int64{
+			"chunks_loaded":  atomic.LoadInt64(&memStats.chunksLoaded),
+			"meshes_built":   atomic.LoadInt64(&render.Counts.MeshesBuilt),
+			"faces_rendered": atomic.LoadInt64(&render.Counts.FacesRendered),
+		}
+	}))
+	expvar.Publish("frame_profile", expvar.Func(func() interface{} {
+		return profiler.Stats()
+	}))
+}
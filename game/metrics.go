@@ -0,0 +1,44 @@
+package game
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/icexin/gocraft/internal/metrics"
+	"github.com/icexin/gocraft/net"
+	"github.com/icexin/gocraft/render"
+	"github.com/icexin/gocraft/store"
+)
+
+func init() {
+	http.Handle("/debug/net", net.Stat)
+}
+
+// serveMetrics registers /metrics, the counters and gauges of g in the
+// Prometheus text format, served with -pprof. Called once the game is built.
+func serveMetrics(g *Game) {
+	http.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		bw := bufio.NewWriter(w)
+		g.writeMetrics(bw)
+		bw.Flush()
+	})
+}
+
+func (g *Game) writeMetrics(w io.Writer) {
+	stats := g.world.Stats()
+	metrics.Write(w, "gocraft_chunks_cached", "gauge", "Chunks in the world cache.", float64(stats.Chunks))
+	metrics.Write(w, "gocraft_chunks_loading", "gauge", "Chunks in the load pipeline.", float64(stats.Loading))
+	metrics.Write(w, "gocraft_chunks_loaded_total", "counter", "Chunks through the load pipeline.", float64(atomic.LoadInt64(&memStats.chunksLoaded)))
+	metrics.Write(w, "gocraft_meshes_cached", "gauge", "Chunk meshes in the mesh cache.", float64(g.blockRender.Meshes().Len()))
+	metrics.Write(w, "gocraft_meshes_built_total", "counter", "Chunk meshes built.", float64(atomic.LoadInt64(&render.Counts.MeshesBuilt)))
+	metrics.Write(w, "gocraft_faces_rendered", "gauge", "Chunk faces drawn in the last frame.", float64(atomic.LoadInt64(&render.Counts.FacesRendered)))
+	metrics.Write(w, "gocraft_store_pending_edits", "gauge", "Block edits waiting to be committed to bolt.", float64(db.Pending()))
+	metrics.Write(w, "gocraft_vbo_pool_bytes", "gauge", "Bytes of vertex buffers kept for reuse.", float64(atomic.LoadInt64(&render.Counts.VBOPooled)))
+	memStats.frames.WriteMetric(w, "gocraft_frame_duration_seconds", "Main thread time of the frames.")
+	store.UpdateDurations.WriteMetric(w, "gocraft_bolt_update_duration_seconds", "Bolt write transactions.")
+	store.ViewDurations.WriteMetric(w, "gocraft_bolt_view_duration_seconds", "Bolt read transactions.")
+	net.Stat.WriteMetrics(w)
+}
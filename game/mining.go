@@ -0,0 +1,99 @@
+package game
+
+import (
+	"github.com/faiface/mainthread"
+	"github.com/go-gl/glfw/v3.2/glfw"
+	"github.com/icexin/gocraft/net"
+	"github.com/icexin/gocraft/world"
+)
+
+const mineProgressInterval = 0.25 // seconds
+
+// Mining tracks the block being broken by the local player.
+type Mining struct {
+	active   bool
+	block    world.Vec3
+	tp       int
+	progress float32
+	lastSent float64
+}
+
+func (g *Game) startMining() {
+	block, _ := g.world.HitTest(g.camera.Pos(), g.camera.Front())
+	g.lineRender.RecordRay(g.camera.Pos(), g.camera.Front())
+	if block == nil || !g.canEdit(*block) {
+		g.mining.active = false
+		return
+	}
+	g.mining = Mining{
+		active:   true,
+		block:    *block,
+		tp:       g.world.Block(*block),
+		lastSent: glfw.GetTime(),
+	}
+	net.SendMineEvent(*block, net.MineStart, 0)
+}
+
+func (g *Game) stopMining() {
+	if g.mining.active {
+		net.SendMineEvent(g.mining.block, net.MineStop, g.mining.progress)
+	}
+	g.mining.active = false
+}
+
+// updateMining advances the breaking progress while the mouse is held on the same block.
+func (g *Game) updateMining(dt float64) {
+	m := &g.mining
+	if !m.active {
+		return
+	}
+	block, _ := g.world.HitTest(g.camera.Pos(), g.camera.Front())
+	if block == nil || *block != m.block || g.world.Block(m.block) != m.tp {
+		g.stopMining()
+		if block != nil {
+			g.startMining()
+		}
+		return
+	}
+	hardness := world.BlockHardness(m.tp)
+	if hardness < 0 {
+		// unbreakable
+		return
+	}
+	if hardness > 0 {
+		m.progress += float32(dt) / hardness
+	} else {
+		m.progress = 1
+	}
+	if m.progress < 1 {
+		if now := glfw.GetTime(); now-m.lastSent > mineProgressInterval {
+			m.lastSent = now
+			net.SendMineEvent(m.block, net.MineProgress, m.progress)
+		}
+		return
+	}
+	m.active = false
+	g.breakBlock(m.block, m.tp)
+	g.markHit()
+}
+
+// breakBlock removes the block locally and asks the server to arbitrate,
+// the block is restored if another player won it.
+func (g *Game) breakBlock(id world.Vec3, tp int) {
+	g.world.UpdateBlock(id, 0)
+	g.dirtyBlock(id)
+	events.Publish(BlockBroken{id, tp})
+	go func() {
+		if granted, w := net.ClientMineBlock(id); !granted {
+			mainthread.CallNonBlock(func() {
+				g.world.UpdateBlock(id, w)
+				g.dirtyBlock(id)
+			})
+		}
+	}()
+}
+
+// MiningProgress returns the block being broken and the progress in [0, 1).
+func (g *Game) MiningProgress() (world.Vec3, float32, bool) {
+	return g.mining.block, g.mining.progress, g.mining.active
+}
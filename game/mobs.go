@@ -0,0 +1,170 @@
+package game
+
+import (
+	"math"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/icexin/gocraft/internal/geom"
+	"github.com/icexin/gocraft/net"
+	"github.com/icexin/gocraft/render"
+	"github.com/icexin/gocraft/world"
+)
+
+var mobsEnabled = flags.Bool("mobs", true, "spawn the hostile mobs in the dark in survival mode, single player only")
+
+const (
+	// ticks between the spawns, mobs spawn on the blocks darker than
+	// mobSpawnLight, in the caves and outside at night
+	mobSpawnTicks = 2 * tickRate
+	mobSpawnLight = 100
+	// mobs around the player and in a chunk
+	maxMobs     = 12
+	mobChunkCap = 2
+	// blocks from the player the mobs spawn at, they despawn further
+	// than mobDespawnRange
+	minMobSpawnRange = 24
+	maxMobSpawnRange = 40
+	mobDespawnRange  = 64
+
+	// blocks the mobs see the player from, and ticks between the paths
+	// found to it
+	mobSight       = 24
+	mobRepathTicks = tickRate / 2
+	// blocks a mob reaches the player from, seconds between the attacks
+	// and the health they take
+	mobReach          = 1.2
+	mobAttackCooldown = 1
+	mobDamage         = 3
+	// blocks the player is pushed back by an attack
+	playerKnockback = 0.6
+)
+
+// the kind ids of the mobs, after the animals
+const (
+	MobZombie int32 = iota + 64
+)
+
+func init() {
+	RegisterEntityKind(&EntityKind{
+		Id: MobZombie, Name: "zombie",
+		Body: world.Cobble, Head: world.Grass, Legs: world.DarkStone,
+		Size: mgl32.Vec3{0.3, 0.7, 0.6}, HeadSize: 0.4, LegHeight: 0.75,
+		Upright: true, Hostile: true,
+		Health: 10, Speed: 1.8, RunSpeed: 1.8,
+		think: mobThink,
+	})
+	entitySpawners = append(entitySpawners, spawnMobs)
+}
+
+func mobsOn(g *Game) bool {
+	return *mobsEnabled && net.ServerAddr() == "" && g.mode == ModeSurvival
+}
+
+func isMob(k *EntityKind) bool {
+	return k.Hostile
+}
+
+// spawnMobs spawns a mob on a dark block around the player now and then,
+// in the caves under the player and on the ground at night.
+func spawnMobs(g *Game) {
+	if !mobsOn(g) || g.ticker.tick%mobSpawnTicks != 0 {
+		return
+	}
+	mobs := 0
+	for _, e := range g.entities.list {
+		if isMob(e.Kind) {
+			mobs++
+		}
+	}
+	if mobs >= maxMobs {
+		return
+	}
+	r := g.ticker.Rand()
+	a := r.Float64() * 2 * math.Pi
+	d := float64(minMobSpawnRange + r.Intn(maxMobSpawnRange-minMobSpawnRange))
+	feet := world.NearBlock(g.camera.Pos()).Down()
+	x, z := feet.X+int(math.Cos(a)*d), feet.Z+int(math.Sin(a)*d)
+	cid := world.Vec3{X: x, Z: z}.Chunkid()
+	if !g.entities.loaded[cid] || g.entities.Count(cid, isMob) >= mobChunkCap {
+		return
+	}
+	kinds := sortedEntityKinds(isMob)
+	kind := kinds[r.Intn(len(kinds))]
+	walker := newWalker(g, int(math.Ceil(float64(newEntity(kind, mgl32.Vec3{}, 0).Height()))))
+	var spots []world.Vec3
+	for y := feet.Y + mobSight/2; y >= feet.Y-mobSight/2; y-- {
+		id := world.Vec3{X: x, Y: y, Z: z}
+		if walker.stands(id) && render.LightLevel(g.world, id, g.postRender.Grade.Night) < mobSpawnLight {
+			spots = append(spots, id)
+		}
+	}
+	if len(spots) == 0 {
+		return
+	}
+	id := spots[r.Intn(len(spots))]
+	pos := mgl32.Vec3{float32(id.X), float32(id.Y) - 0.5, float32(id.Z)}
+	g.entities.Add(newEntity(kind, pos, r.Float32()*2*math.Pi))
+}
+
+// mobThink chases the player in sight along the path found over the
+// blocks and attacks on contact, wanders around otherwise. The mobs far
+// from the player despawn.
+func mobThink(g *Game, e *Entity) {
+	// the knockback is enough, the mobs don't run away
+	e.flee = 0
+	eye := g.camera.Pos()
+	toPlayer := flat(eye.Sub(e.Pos))
+	if toPlayer.Len() > mobDespawnRange {
+		g.entities.Remove(e)
+		return
+	}
+	if !mobsOn(g) || toPlayer.Len() > mobSight {
+		e.path = nil
+		wander(g, e)
+		return
+	}
+
+	// the wandering may have left a longer wait
+	if e.think--; e.think <= 0 || e.think > mobRepathTicks {
+		e.think = mobRepathTicks
+		walker := newWalker(g, int(math.Ceil(float64(e.Height()))))
+		e.path = walker.FindPath(e.Block(), world.NearBlock(eye).Down())
+	}
+	// the blocks reached
+	for len(e.path) > 0 {
+		next := e.path[0]
+		if flat(mgl32.Vec3{float32(next.X), 0, float32(next.Z)}.Sub(e.Pos)).Len() > 0.3 {
+			break
+		}
+		e.path = e.path[1:]
+	}
+	switch {
+	case len(e.path) > 0:
+		next := e.path[0]
+		e.walkTo(flat(mgl32.Vec3{float32(next.X), 0, float32(next.Z)}.Sub(e.Pos)), e.Kind.Speed)
+	case toPlayer.Len() > mobReach/2:
+		e.walkTo(toPlayer, e.Kind.Speed)
+	default:
+		e.walk = mgl32.Vec2{}
+	}
+
+	// the player is about 1.6 blocks tall
+	touching := eye.Y() > e.Pos.Y() && eye.Y()-1.6 < e.Pos.Y()+e.Height()
+	if toPlayer.Len() < mobReach && touching && e.attack == 0 {
+		e.attack = mobAttackCooldown
+		g.knockPlayer(toPlayer)
+		g.Damage(mobDamage, "killed by a "+e.Kind.Name)
+	}
+}
+
+// knockPlayer pushes the player along the horizontal direction dir with a
+// hop.
+func (g *Game) knockPlayer(dir mgl32.Vec2) {
+	if dir.Len() == 0 {
+		return
+	}
+	dir = dir.Normalize().Mul(playerKnockback)
+	pos, _ := g.world.Collide(g.camera.Pos().Add(mgl32.Vec3{dir.X(), 0, dir.Y()}))
+	g.camera.SetPos(pos)
+	g.vy = geom.Max(g.vy, 5)
+}
@@ -0,0 +1,247 @@
+package game
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// NBT tags of the Minecraft saves
+const (
+	tagEnd = iota
+	tagByte
+	tagShort
+	tagInt
+	tagLong
+	tagFloat
+	tagDouble
+	tagByteArray
+	tagString
+	tagList
+	tagCompound
+	tagIntArray
+	tagLongArray
+)
+
+const (
+	// bounds the arrays and lists read, the elements are allocated as they
+	// are read so a corrupted length fails at the end of the data instead of
+	// allocating it
+	maxNBTLen = 1 << 24
+	// elements allocated at once
+	nbtChunkLen = 4096
+	// bounds the lists and compounds nested
+	maxNBTDepth = 512
+)
+
+// nbtCompound is a decoded compound tag, the values are int8, int16, int32,
+// int64, float32, float64, []byte, string, []interface{}, nbtCompound,
+// []int32 or []int64.
+type nbtCompound map[string]interface{}
+
+func (c nbtCompound) compound(name string) nbtCompound {
+	v, _ := c[name].(nbtCompound)
+	return v
+}
+
+func (c nbtCompound) list(name string) []interface{} {
+	v, _ := c[name].([]interface{})
+	return v
+}
+
+func (c nbtCompound) str(name string) string {
+	v, _ := c[name].(string)
+	return v
+}
+
+func (c nbtCompound) bytes(name string) []byte {
+	v, _ := c[name].([]byte)
+	return v
+}
+
+func (c nbtCompound) longs(name string) []int64 {
+	v, _ := c[name].([]int64)
+	return v
+}
+
+// int returns the integer tag name of any size, 0 if missing.
+func (c nbtCompound) int(name string) int {
+	switch v := c[name].(type) {
+	case int8:
+		return int(v)
+	case int16:
+		return int(v)
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	}
+	return 0
+}
+
+type nbtReader struct {
+	r     *bufio.Reader
+	err   error
+	depth int // lists and compounds being read
+}
+
+// readNBT decodes the root compound of r.
+func readNBT(r io.Reader) (nbtCompound, error) {
+	d := &nbtReader{r: bufio.NewReader(r)}
+	tag := d.byte()
+	d.string()
+	if d.err != nil {
+		return nil, d.err
+	}
+	if tag != tagCompound {
+		return nil, fmt.Errorf("nbt root tag %d isn't a compound", tag)
+	}
+	v := d.value(tagCompound)
+	if d.err != nil {
+		return nil, d.err
+	}
+	return v.(nbtCompound), nil
+}
+
+func (d *nbtReader) read(v interface{}) {
+	if d.err == nil {
+		d.err = binary.Read(d.r, binary.BigEndian, v)
+	}
+}
+
+func (d *nbtReader) byte() byte {
+	var b byte
+	d.read(&b)
+	return b
+}
+
+func (d *nbtReader) length() int {
+	var n int32
+	d.read(&n)
+	if d.err == nil && (n < 0 || n > maxNBTLen) {
+		d.err = fmt.Errorf("bad nbt length %d", n)
+	}
+	if d.err != nil {
+		return 0
+	}
+	return int(n)
+}
+
+func (d *nbtReader) string() string {
+	var n uint16
+	d.read(&n)
+	if d.err != nil {
+		return ""
+	}
+	b := make([]byte, n)
+	_, d.err = io.ReadFull(d.r, b)
+	return string(b)
+}
+
+// nbtChunk returns the number of elements to read next out of the n left.
+func nbtChunk(n int) int {
+	if n > nbtChunkLen {
+		return nbtChunkLen
+	}
+	return n
+}
+
+func (d *nbtReader) bytes(n int) []byte {
+	var v []byte
+	for len(v) < n && d.err == nil {
+		k := nbtChunk(n - len(v))
+		v = append(v, make([]byte, k)...)
+		_, d.err = io.ReadFull(d.r, v[len(v)-k:])
+	}
+	return v
+}
+
+func (d *nbtReader) ints(n int) []int32 {
+	var v []int32
+	for len(v) < n && d.err == nil {
+		k := nbtChunk(n - len(v))
+		v = append(v, make([]int32, k)...)
+		d.read(v[len(v)-k:])
+	}
+	return v
+}
+
+func (d *nbtReader) longs(n int) []int64 {
+	var v []int64
+	for len(v) < n && d.err == nil {
+		k := nbtChunk(n - len(v))
+		v = append(v, make([]int64, k)...)
+		d.read(v[len(v)-k:])
+	}
+	return v
+}
+
+func (d *nbtReader) value(tag byte) interface{} {
+	if d.err != nil {
+		return nil
+	}
+	if tag == tagList || tag == tagCompound {
+		if d.depth >= maxNBTDepth {
+			d.err = fmt.Errorf("nbt nested deeper than %d", maxNBTDepth)
+			return nil
+		}
+		d.depth++
+		defer func() { d.depth-- }()
+	}
+	switch tag {
+	case tagByte:
+		var v int8
+		d.read(&v)
+		return v
+	case tagShort:
+		var v int16
+		d.read(&v)
+		return v
+	case tagInt:
+		var v int32
+		d.read(&v)
+		return v
+	case tagLong:
+		var v int64
+		d.read(&v)
+		return v
+	case tagFloat:
+		var v float32
+		d.read(&v)
+		return v
+	case tagDouble:
+		var v float64
+		d.read(&v)
+		return v
+	case tagByteArray:
+		return d.bytes(d.length())
+	case tagString:
+		return d.string()
+	case tagList:
+		elem := d.byte()
+		n := d.length()
+		v := make([]interface{}, 0, nbtChunk(n))
+		for len(v) < n && d.err == nil {
+			v = append(v, d.value(elem))
+		}
+		return v
+	case tagCompound:
+		v := make(nbtCompound)
+		for d.err == nil {
+			tag := d.byte()
+			if tag == tagEnd {
+				break
+			}
+			name := d.string()
+			v[name] = d.value(tag)
+		}
+		return v
+	case tagIntArray:
+		return d.ints(d.length())
+	case tagLongArray:
+		return d.longs(d.length())
+	}
+	d.err = fmt.Errorf("unknown nbt tag %d", tag)
+	return nil
+}
@@ -0,0 +1,207 @@
+package game
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// nbtWriter encodes the test data, big endian as the Minecraft saves.
+type nbtWriter struct {
+	bytes.Buffer
+}
+
+func (w *nbtWriter) put(v interface{}) *nbtWriter {
+	binary.Write(w, binary.BigEndian, v)
+	return w
+}
+
+func (w *nbtWriter) str(s string) *nbtWriter {
+	return w.put(uint16(len(s))).put([]byte(s))
+}
+
+// named writes the tag and the name of a compound entry.
+func (w *nbtWriter) named(tag byte, name string) *nbtWriter {
+	return w.put(tag).str(name)
+}
+
+func validNBT() []byte {
+	w := new(nbtWriter)
+	w.named(tagCompound, "")
+	w.named(tagByte, "b").put(int8(-3))
+	w.named(tagShort, "s").put(int16(300))
+	w.named(tagInt, "i").put(int32(70000))
+	w.named(tagLong, "l").put(int64(1 << 40))
+	w.named(tagFloat, "f").put(float32(1.5))
+	w.named(tagDouble, "d").put(float64(-2.25))
+	w.named(tagByteArray, "ba").put(int32(3)).put([]byte{1, 2, 3})
+	w.named(tagString, "str").str("minecraft:stone")
+	w.named(tagList, "list").put(byte(tagInt)).put(int32(2)).put(int32(7)).put(int32(8))
+	w.named(tagCompound, "c")
+	w.named(tagString, "Status").str("full")
+	w.put(byte(tagEnd))
+	w.named(tagIntArray, "ia").put(int32(2)).put([]int32{-1, 1})
+	w.named(tagLongArray, "la").put(int32(1)).put([]int64{1 << 50})
+	w.put(byte(tagEnd))
+	return w.Bytes()
+}
+
+func TestReadNBT(t *testing.T) {
+	root, err := readNBT(bytes.NewReader(validNBT()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := nbtCompound{
+		"b":    int8(-3),
+		"s":    int16(300),
+		"i":    int32(70000),
+		"l":    int64(1 << 40),
+		"f":    float32(1.5),
+		"d":    float64(-2.25),
+		"ba":   []byte{1, 2, 3},
+		"str":  "minecraft:stone",
+		"list": []interface{}{int32(7), int32(8)},
+		"c":    nbtCompound{"Status": "full"},
+		"ia":   []int32{-1, 1},
+		"la":   []int64{1 << 50},
+	}
+	if !reflect.DeepEqual(root, want) {
+		t.Errorf("readNBT = %v, want %v", root, want)
+	}
+	if root.int("s") != 300 || root.compound("c").str("Status") != "full" {
+		t.Error("the accessors don't read the values back")
+	}
+}
+
+// nested returns a root compound holding depth lists of lists.
+func nested(depth int) []byte {
+	w := new(nbtWriter)
+	w.named(tagCompound, "")
+	w.named(tagList, "x")
+	for i := 1; i < depth; i++ {
+		w.put(byte(tagList)).put(int32(1))
+	}
+	w.put(byte(tagByte)).put(int32(0))
+	w.put(byte(tagEnd))
+	return w.Bytes()
+}
+
+func TestReadNBTMalformed(t *testing.T) {
+	root := func(f func(w *nbtWriter)) []byte {
+		w := new(nbtWriter)
+		w.named(tagCompound, "")
+		f(w)
+		return w.Bytes()
+	}
+	tests := []struct {
+		name string
+		data []byte
+		err  string
+	}{
+		{"empty", nil, "EOF"},
+		{"root not a compound", new(nbtWriter).named(tagInt, "").put(int32(1)).Bytes(), "isn't a compound"},
+		{"no end", root(func(w *nbtWriter) {}), "EOF"},
+		{"truncated name", root(func(w *nbtWriter) { w.put(byte(tagInt)).put(uint16(10)).put([]byte("ab")) }), "EOF"},
+		{"unknown tag", root(func(w *nbtWriter) { w.named(42, "x") }), "unknown nbt tag"},
+		{"negative length", root(func(w *nbtWriter) { w.named(tagByteArray, "x").put(int32(-1)) }), "bad nbt length"},
+		{"length over the cap", root(func(w *nbtWriter) { w.named(tagIntArray, "x").put(int32(maxNBTLen + 1)) }), "bad nbt length"},
+		// the lengths claim more than the data holds
+		{"huge byte array", root(func(w *nbtWriter) { w.named(tagByteArray, "x").put(int32(maxNBTLen)).put([]byte{1}) }), "EOF"},
+		{"huge long array", root(func(w *nbtWriter) { w.named(tagLongArray, "x").put(int32(maxNBTLen)).put(int64(1)) }), "EOF"},
+		{"huge list", root(func(w *nbtWriter) { w.named(tagList, "x").put(byte(tagCompound)).put(int32(maxNBTLen)) }), "EOF"},
+		{"list of ends", root(func(w *nbtWriter) { w.named(tagList, "x").put(byte(tagEnd)).put(int32(5)) }), "unknown nbt tag 0"},
+		{"too deep", nested(maxNBTDepth + 1), "nested deeper"},
+	}
+	for _, tt := range tests {
+		_, err := readNBT(bytes.NewReader(tt.data))
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: error %v, want %q", tt.name, err, tt.err)
+		}
+	}
+	if _, err := readNBT(bytes.NewReader(nested(maxNBTDepth - 1))); err != nil {
+		t.Errorf("nested %d deep: %s", maxNBTDepth-1, err)
+	}
+}
+
+// TestReadNBTMutations decodes random corruptions of valid data, the
+// decoder must fail cleanly.
+func TestReadNBTMutations(t *testing.T) {
+	valid := validNBT()
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 5000; i++ {
+		data := append([]byte(nil), valid...)
+		for n := 1 + r.Intn(4); n > 0; n-- {
+			data[r.Intn(len(data))] = byte(r.Intn(256))
+		}
+		if r.Intn(4) == 0 {
+			data = data[:r.Intn(len(data))]
+		}
+		readNBT(bytes.NewReader(data))
+	}
+}
+
+// region returns a region file holding data as chunk 0, 0 with the
+// compression.
+func region(data []byte, compression byte) []byte {
+	b := make([]byte, 8192, 8192+5+len(data))
+	binary.BigEndian.PutUint32(b, 2<<8|uint32(1+(5+len(data))/4096))
+	b = append(b, 0, 0, 0, 0, compression)
+	binary.BigEndian.PutUint32(b[8192:], uint32(1+len(data)))
+	return append(b, data...)
+}
+
+func TestRegionChunk(t *testing.T) {
+	root, err := regionChunk(region(validNBT(), 3), "", 0, 0, 0, 0)
+	if err != nil || root == nil || root.str("str") != "minecraft:stone" {
+		t.Errorf("regionChunk = %v, %v", root, err)
+	}
+	if root, err := regionChunk(region(validNBT(), 3), "", 0, 0, 1, 0); root != nil || err != nil {
+		t.Errorf("chunk not saved = %v, %v, want nil, nil", root, err)
+	}
+
+	pastEnd := region(validNBT(), 3)
+	binary.BigEndian.PutUint32(pastEnd, 9<<8|1)
+	badLength := region(validNBT(), 3)
+	binary.BigEndian.PutUint32(badLength[8192:], 1<<30)
+	tests := []struct {
+		name string
+		data []byte
+		err  string
+	}{
+		{"short header", make([]byte, 100), "region header"},
+		{"offset past the end", pastEnd, "past the end"},
+		{"bad length", badLength, "bad chunk length"},
+		{"unknown compression", region(validNBT(), 9), "unsupported compression"},
+		{"bad zlib", region([]byte("not zlib"), 2), "zlib"},
+		{"bad gzip", region([]byte("this is not gzip data"), 1), "gzip"},
+		{"bad nbt", region([]byte{tagCompound, 0, 0, tagIntArray, 0, 0, 0x7f, 0, 0, 0}, 3), "bad nbt length"},
+	}
+	for _, tt := range tests {
+		_, err := regionChunk(tt.data, "", 0, 0, 0, 0)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: error %v, want %q", tt.name, err, tt.err)
+		}
+	}
+}
+
+// TestRegionChunkMutations decodes random corruptions of the header and of
+// the chunk, regionChunk must fail cleanly.
+func TestRegionChunkMutations(t *testing.T) {
+	valid := region(validNBT(), 3)
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 2000; i++ {
+		data := append([]byte(nil), valid...)
+		for n := 1 + r.Intn(4); n > 0; n-- {
+			// the location of chunk 0, 0 or the chunk itself
+			at := r.Intn(4)
+			if r.Intn(2) == 0 {
+				at = 8192 + r.Intn(len(data)-8192)
+			}
+			data[at] = byte(r.Intn(256))
+		}
+		regionChunk(data, "", 0, 0, 0, 0)
+	}
+}
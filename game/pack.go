@@ -0,0 +1,48 @@
+package game
+
+import (
+	"github.com/icexin/gocraft/render"
+)
+
+var packPath = flags.String("pack", "", "resource pack, a directory or a zip overriding texture.png and the block textures")
+
+// SetResourcePack swaps the textures at runtime, call on mainthread.
+func (g *Game) SetResourcePack(path string) error {
+	pack, err := render.LoadResourcePack(path)
+	if err != nil {
+		return err
+	}
+	render.UseResourcePack(pack)
+	g.blockRender.SetAtlas(pack)
+	g.playerRender.SetAtlas(pack)
+	g.lodRender.Reset()
+	g.blockRender.DirtyAll()
+	renderLog.Infof("use resource pack %q", path)
+	return nil
+}
+
+func init() {
+	RegisterCommand(&Command{
+		Name:  "pack",
+		Usage: "/pack [path|none]",
+		Run: func(g *Game, args *Args) (string, error) {
+			if args.Len() == 0 {
+				if render.CurrentPack().Path == "" {
+					return "default textures", nil
+				}
+				return "resource pack " + render.CurrentPack().Path, nil
+			}
+			path := args.Rest("path")
+			if path == "none" {
+				path = ""
+			}
+			if err := g.SetResourcePack(path); err != nil {
+				return "", err
+			}
+			if path == "" {
+				return "default textures", nil
+			}
+			return "resource pack " + path, nil
+		},
+	})
+}
@@ -0,0 +1,161 @@
+package game
+
+import (
+	"container/heap"
+
+	"github.com/icexin/gocraft/internal/geom"
+	"github.com/icexin/gocraft/world"
+)
+
+const (
+	// nodes expanded by findPath before giving up
+	maxPathNodes = 1024
+	// blocks a walker drops down in one step
+	maxPathDrop = 3
+)
+
+type pathNode struct {
+	id   world.Vec3
+	cost int // blocks moved from the start, up and down included
+	est  int // cost plus the distance left
+	seq  int
+}
+
+type pathQueue []pathNode
+
+func (q pathQueue) Len() int { return len(q) }
+func (q pathQueue) Less(i, j int) bool {
+	if q[i].est != q[j].est {
+		return q[i].est < q[j].est
+	}
+	return q[i].seq < q[j].seq
+}
+func (q pathQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *pathQueue) Push(x interface{}) { *q = append(*q, x.(pathNode)) }
+func (q *pathQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	x := old[n-1]
+	*q = old[:n-1]
+	return x
+}
+
+// Walker finds the paths of an entity height blocks tall, the blocks are
+// the ones of the feet. It walks in the loaded chunks only, looked up once
+// per search.
+type Walker struct {
+	g      *Game
+	height int
+	// the chunks read by the search, nil if not loaded
+	chunks map[world.Vec3]*world.Chunk
+}
+
+func newWalker(g *Game, height int) *Walker {
+	return &Walker{g: g, height: height, chunks: make(map[world.Vec3]*world.Chunk)}
+}
+
+// block returns the block id, -1 if its chunk isn't loaded.
+func (w *Walker) block(id world.Vec3) int {
+	cid := id.Chunkid()
+	chunk, ok := w.chunks[cid]
+	if !ok {
+		if w.g.entities.loaded[cid] {
+			chunk, _ = w.g.world.PeekChunk(cid)
+		}
+		w.chunks[cid] = chunk
+	}
+	if chunk == nil {
+		return -1
+	}
+	return chunk.Block(id)
+}
+
+// free reports whether the walker fits with its feet in block id.
+func (w *Walker) free(id world.Vec3) bool {
+	for y := 0; y < w.height; y++ {
+		if tp := w.block(world.Vec3{X: id.X, Y: id.Y + y, Z: id.Z}); tp == -1 || world.IsObstacle(tp) {
+			return false
+		}
+	}
+	return true
+}
+
+// stands reports whether the walker can stand with its feet in block id.
+func (w *Walker) stands(id world.Vec3) bool {
+	return w.free(id) && world.IsObstacle(w.block(id.Down()))
+}
+
+// neighbors returns the blocks reached from id in one step: the sides,
+// a block up by jumping and up to maxPathDrop blocks down.
+func (w *Walker) neighbors(id world.Vec3) []world.Vec3 {
+	var next []world.Vec3
+	for _, n := range [...]world.Vec3{id.Left(), id.Right(), id.Front(), id.Back()} {
+		switch {
+		case w.stands(n):
+			next = append(next, n)
+		case w.stands(n.Up()):
+			// room to jump above the head
+			if w.free(id.Up()) {
+				next = append(next, n.Up())
+			}
+		case w.free(n):
+			for d := 1; d <= maxPathDrop; d++ {
+				n = n.Down()
+				if !w.free(n) {
+					break
+				}
+				if w.stands(n) {
+					next = append(next, n)
+					break
+				}
+			}
+		}
+	}
+	return next
+}
+
+func pathDistance(a, b world.Vec3) int {
+	return geom.AbsInt(a.X-b.X) + geom.AbsInt(a.Y-b.Y) + geom.AbsInt(a.Z-b.Z)
+}
+
+// FindPath returns the blocks to walk from the block from to the block to
+// with A*, from excluded. If to can't be reached within maxPathNodes it's
+// the path to the block found closest to it, nil if that's from.
+func (w *Walker) FindPath(from, to world.Vec3) []world.Vec3 {
+	prev := map[world.Vec3]world.Vec3{from: from}
+	costs := map[world.Vec3]int{from: 0}
+	queue := pathQueue{{id: from, est: pathDistance(from, to)}}
+	best, bestDist := from, pathDistance(from, to)
+	for n := 0; len(queue) > 0 && n < maxPathNodes; n++ {
+		node := heap.Pop(&queue).(pathNode)
+		if node.cost > costs[node.id] {
+			// a cheaper way was found after queueing it
+			continue
+		}
+		if d := pathDistance(node.id, to); d < bestDist {
+			best, bestDist = node.id, d
+		}
+		if node.id == to {
+			break
+		}
+		for _, next := range w.neighbors(node.id) {
+			// a step costs its blocks up and down, jumping is slower and
+			// the distance left never overestimates the cost
+			cost := node.cost + pathDistance(node.id, next)
+			if c, ok := costs[next]; ok && c <= cost {
+				continue
+			}
+			costs[next] = cost
+			prev[next] = node.id
+			heap.Push(&queue, pathNode{id: next, cost: cost, est: cost + pathDistance(next, to), seq: n})
+		}
+	}
+	var path []world.Vec3
+	for id := best; id != from; id = prev[id] {
+		path = append(path, id)
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path
+}
@@ -0,0 +1,26 @@
+package game
+
+import (
+	"github.com/icexin/gocraft/net"
+	"github.com/icexin/gocraft/world"
+)
+
+// how much a chunk the player can't edit is grayed out
+const lockedShade = 0.5
+
+// canEdit tells the player when block id can't be edited.
+func (g *Game) canEdit(id world.Vec3) bool {
+	if !net.ChunkLocked(id.Chunkid()) {
+		return true
+	}
+	g.console.Print(tr("this area is protected"))
+	return false
+}
+
+// lockedShadeOf returns the shade of the mesh of chunk id in the block shader.
+func lockedShadeOf(id world.Vec3) float32 {
+	if net.ChunkLocked(id) {
+		return lockedShade
+	}
+	return 0
+}
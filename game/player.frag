@@ -2,6 +2,7 @@
 
 in vec2 Tex;
 uniform sampler2D tex;
+uniform float dim;
 
 out vec4 FragColor;
 
@@ -10,5 +11,5 @@ void main() {
     if (color == vec3(1,0,1)) {
         discard;
     }
-    FragColor = vec4(color, 1);
+    FragColor = vec4(color * dim, 1);
 }
@@ -0,0 +1,247 @@
+package game
+
+import (
+	"sort"
+	"time"
+
+	"github.com/faiface/glhf"
+	"github.com/faiface/mainthread"
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/icexin/gocraft-server/proto"
+	"github.com/icexin/gocraft/internal/geom"
+	"github.com/icexin/gocraft/net"
+	"github.com/icexin/gocraft/render"
+	"github.com/icexin/gocraft/world"
+)
+
+var (
+	interpDelay      = flags.Duration("interp", 100*time.Millisecond, "interpolation delay of remote players")
+	maxExtrapolation = flags.Duration("extrap", 250*time.Millisecond, "max extrapolation time of remote players")
+)
+
+type PlayerState struct {
+	X, Y, Z float32
+	Rx, Ry  float32
+}
+
+type playerState struct {
+	PlayerState
+	time float64
+}
+
+const maxSnapshots = 32
+
+type Player struct {
+	// snapshots ordered by time
+	snapshots []playerState
+	afk       bool
+
+	shader *glhf.Shader
+	mesh   *render.Mesh
+}
+
+// mixAngle interpolates angles in degrees along the shortest path.
+func mixAngle(a, b, factor float32) float32 {
+	d := b - a
+	for d > 180 {
+		d -= 360
+	}
+	for d < -180 {
+		d += 360
+	}
+	return a + d*factor
+}
+
+func mixState(s1, s2 PlayerState, t float32) PlayerState {
+	return PlayerState{
+		X:  geom.Mix(s1.X, s2.X, t),
+		Y:  geom.Mix(s1.Y, s2.Y, t),
+		Z:  geom.Mix(s1.Z, s2.Z, t),
+		Rx: mixAngle(s1.Rx, s2.Rx, t),
+		Ry: geom.Mix(s1.Ry, s2.Ry, t),
+	}
+}
+
+// stateAt computes the player state at time t. States are interpolated between
+// the snapshots around t, after the last snapshot the player keeps moving at
+// its last velocity for at most maxExtrapolation and stops.
+func (p *Player) stateAt(t float64) PlayerState {
+	n := len(p.snapshots)
+	if n == 0 {
+		return PlayerState{}
+	}
+	first, last := p.snapshots[0], p.snapshots[n-1]
+	if n == 1 || t <= first.time {
+		return first.PlayerState
+	}
+	if t >= last.time {
+		prev := p.snapshots[n-2]
+		dt := last.time - prev.time
+		if dt <= 0 {
+			return last.PlayerState
+		}
+		ahead := t - last.time
+		if max := maxExtrapolation.Seconds(); ahead > max {
+			ahead = max
+		}
+		s := mixState(prev.PlayerState, last.PlayerState, float32(1+ahead/dt))
+		// don't extrapolate the looking direction
+		s.Rx, s.Ry = last.Rx, last.Ry
+		return s
+	}
+	i := sort.Search(n, func(i int) bool {
+		return p.snapshots[i].time > t
+	})
+	s1, s2 := p.snapshots[i-1], p.snapshots[i]
+	f := float32((t - s1.time) / (s2.time - s1.time))
+	return mixState(s1.PlayerState, s2.PlayerState, f)
+}
+
+func (p *Player) computeMat() mgl32.Mat4 {
+	s := p.stateAt(net.Now() - interpDelay.Seconds())
+	if p.afk {
+		// head down while away
+		s.Ry = -60
+	}
+
+	front := mgl32.Vec3{
+		geom.Cos(geom.Radian(s.Ry)) * geom.Cos(geom.Radian(s.Rx)),
+		geom.Sin(geom.Radian(s.Ry)),
+		geom.Cos(geom.Radian(s.Ry)) * geom.Sin(geom.Radian(s.Rx)),
+	}.Normalize()
+	right := front.Cross(mgl32.Vec3{0, 1, 0})
+	up := right.Cross(front).Normalize()
+	pos := mgl32.Vec3{s.X, s.Y, s.Z}
+	return mgl32.LookAtV(pos, pos.Add(front), up).Inv()
+}
+
+func (p *Player) UpdateState(s playerState) {
+	n := len(p.snapshots)
+	if n > 0 && s.time <= p.snapshots[n-1].time {
+		// out of order or duplicated state
+		return
+	}
+	if n == maxSnapshots {
+		copy(p.snapshots, p.snapshots[1:])
+		p.snapshots = p.snapshots[:n-1]
+	}
+	p.snapshots = append(p.snapshots, s)
+}
+
+func (p *Player) Draw(mat mgl32.Mat4) {
+	mat = mat.Mul4(p.computeMat())
+
+	p.shader.SetUniformAttr(0, mat)
+	p.mesh.Draw()
+}
+
+func (p *Player) Release() {
+	p.mesh.Release()
+}
+
+type PlayerRender struct {
+	shader  *glhf.Shader
+	texture *glhf.Texture
+	players map[int32]*Player
+}
+
+func NewPlayerRender() (*PlayerRender, error) {
+	var (
+		err error
+	)
+	img, rect := render.CurrentPack().Pix, render.CurrentPack().Rect
+
+	r := &PlayerRender{
+		players: make(map[int32]*Player),
+	}
+	mainthread.Call(func() {
+		r.shader, err = glhf.NewShader(glhf.AttrFormat{
+			glhf.Attr{Name: "pos", Type: glhf.Vec3},
+			glhf.Attr{Name: "tex", Type: glhf.Vec2},
+			glhf.Attr{Name: "normal", Type: glhf.Vec3},
+		}, glhf.AttrFormat{
+			glhf.Attr{Name: "matrix", Type: glhf.Mat4},
+			glhf.Attr{Name: "dim", Type: glhf.Float},
+		}, playerVertexSource, playerFragmentSource)
+
+		if err != nil {
+			return
+		}
+		r.texture = glhf.NewTexture(rect.Dx(), rect.Dy(), false, img)
+
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// SetAtlas replaces the texture atlas, call on mainthread.
+func (r *PlayerRender) SetAtlas(pack *render.ResourcePack) {
+	r.texture = glhf.NewTexture(pack.Rect.Dx(), pack.Rect.Dy(), false, pack.Pix)
+}
+
+// UpdateOrAdd updates the state of player id, t is the server time of the state.
+func (r *PlayerRender) UpdateOrAdd(id int32, s proto.PlayerState, t float64, afk bool) {
+	state := playerState{
+		PlayerState: PlayerState{
+			X:  s.X,
+			Y:  s.Y,
+			Z:  s.Z,
+			Rx: s.Rx,
+			Ry: s.Ry,
+		},
+		time: t,
+	}
+
+	p, ok := r.players[id]
+	if !ok {
+		netLog.Infof("add new player %d", id)
+		cubeData := render.MakeCubeData([]float32{}, [...]bool{true, true, true, true, true, true}, world.Vec3{X: 0, Y: 0, Z: 0}, render.Textures.Texture(64))
+		var mesh *render.Mesh
+		render.FrameTasks.Call(func() {
+			mesh = render.NewMesh(r.shader, cubeData)
+		})
+		p = &Player{
+			shader: r.shader,
+			mesh:   mesh,
+		}
+		r.players[id] = p
+		events.Publish(PlayerJoined{id})
+	}
+	p.afk = afk
+	p.UpdateState(state)
+}
+
+func (r *PlayerRender) Ids() []int32 {
+	ids := make([]int32, 0, len(r.players))
+	for id := range r.players {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func (r *PlayerRender) Remove(id int32) {
+	netLog.Infof("remove player %d", id)
+	p, ok := r.players[id]
+	if ok {
+		render.FrameTasks.Post(func() {
+			p.Release()
+		})
+	}
+	delete(r.players, id)
+
+}
+
+func (r *PlayerRender) Draw() {
+	mat := game.blockRender.Matrix()
+	r.shader.Begin()
+	r.texture.Begin()
+	r.shader.SetUniformAttr(1, game.Dim())
+	for _, p := range r.players {
+		p.Draw(mat)
+	}
+	r.texture.End()
+	r.shader.End()
+}
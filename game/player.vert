@@ -1,8 +1,8 @@
 #version 330 core
 
-in vec3 pos;
-in vec2 tex;
-in vec3 normal;
+layout(location = 0) in vec3 pos;
+layout(location = 1) in vec2 tex;
+layout(location = 2) in vec3 normal;
 
 uniform mat4 matrix;
 
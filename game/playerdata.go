@@ -0,0 +1,115 @@
+package game
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// version of the PlayerData encoding, bump it when adding a field and keep
+// decoding the older ones
+const playerDataVersion = 1
+
+// PlayerData is what the store keeps of the player besides the spawn.
+type PlayerData struct {
+	State PlayerState
+	// the held block type
+	Item      int
+	Mode      GameMode
+	Health    int
+	Inventory *Inventory
+}
+
+// MarshalBinary encodes d as the version byte followed by the fields in
+// little endian, the inventory as a count and sorted type, count pairs.
+func (d *PlayerData) MarshalBinary() ([]byte, error) {
+	buf := new(bytes.Buffer)
+	buf.WriteByte(playerDataVersion)
+	binary.Write(buf, binary.LittleEndian, &d.State)
+	binary.Write(buf, binary.LittleEndian, [...]int32{int32(d.Item), int32(d.Mode), int32(d.Health)})
+	var items []int
+	if d.Inventory != nil {
+		items = d.Inventory.Items()
+	}
+	binary.Write(buf, binary.LittleEndian, int32(len(items)))
+	for _, item := range items {
+		binary.Write(buf, binary.LittleEndian, [...]int32{int32(item), int32(d.Inventory.Count(item))})
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes the versions up to playerDataVersion.
+func (d *PlayerData) UnmarshalBinary(b []byte) error {
+	if len(b) == 0 {
+		return fmt.Errorf("empty player data")
+	}
+	version := b[0]
+	if version > playerDataVersion {
+		return fmt.Errorf("player data version %d is newer than %d", version, playerDataVersion)
+	}
+	buf := bytes.NewReader(b[1:])
+	var fields [3]int32
+	var n int32
+	err := binary.Read(buf, binary.LittleEndian, &d.State)
+	if err == nil {
+		err = binary.Read(buf, binary.LittleEndian, &fields)
+	}
+	if err == nil {
+		err = binary.Read(buf, binary.LittleEndian, &n)
+	}
+	if err != nil {
+		return fmt.Errorf("bad player data:%s", err)
+	}
+	d.Item, d.Mode, d.Health = int(fields[0]), GameMode(fields[1]), int(fields[2])
+	d.Inventory = NewInventory()
+	for i := int32(0); i < n; i++ {
+		var stack [2]int32
+		if err := binary.Read(buf, binary.LittleEndian, &stack); err != nil {
+			return fmt.Errorf("bad player data:%s", err)
+		}
+		d.Inventory.Add(int(stack[0]), int(stack[1]))
+	}
+	return nil
+}
+
+// loadPlayerData returns the saved player data, a full health creative
+// player if there is none. The position saved alone by the older versions
+// is read back.
+func loadPlayerData() PlayerData {
+	d := PlayerData{
+		State:     PlayerState{Y: 16},
+		Item:      availableItems[0],
+		Health:    maxHealth,
+		Inventory: NewInventory(),
+	}
+	value, legacy := db.GetPlayerData()
+	if value != nil {
+		saved := d
+		if err := saved.UnmarshalBinary(value); err != nil {
+			storeLog.Errorf("player data:%s", err)
+			return d
+		}
+		return saved
+	}
+	if legacy != nil {
+		binary.Read(bytes.NewBuffer(legacy), binary.LittleEndian, &d.State)
+	}
+	return d
+}
+
+// savePlayerData saves the player data, encoded with its version.
+func savePlayerData(d PlayerData) error {
+	value, err := d.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return db.UpdatePlayerData(value)
+}
+
+// savePlayerState saves the position of the player, keeping the rest of
+// the player data.
+func savePlayerState(state PlayerState) error {
+	d := loadPlayerData()
+	d.State = state
+	return savePlayerData(d)
+}
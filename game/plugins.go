@@ -0,0 +1,143 @@
+package game
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	goplugin "plugin"
+	"strings"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/icexin/gocraft/net"
+	"github.com/icexin/gocraft/plugin"
+	"github.com/icexin/gocraft/render"
+	"github.com/icexin/gocraft/world"
+)
+
+var pluginDir = flags.String("plugins", "", "directory of the plugins (*.so) to load")
+
+// LoadPlugins opens the plugins of -plugins and adds their blocks and
+// commands, call before the textures are loaded.
+func LoadPlugins() error {
+	if *pluginDir != "" {
+		files, err := ioutil.ReadDir(*pluginDir)
+		if err != nil {
+			return err
+		}
+		for _, f := range files {
+			if f.IsDir() || !strings.HasSuffix(f.Name(), ".so") {
+				continue
+			}
+			// the init of the plugin registers it
+			if _, err := goplugin.Open(filepath.Join(*pluginDir, f.Name())); err != nil {
+				return fmt.Errorf("plugin %s: %s", f.Name(), err)
+			}
+		}
+	}
+	for _, p := range plugin.Plugins() {
+		if err := installPlugin(p); err != nil {
+			return fmt.Errorf("plugin %s: %s", p.Name, err)
+		}
+		subscribePlugin(p)
+		gameLog.Infof("loaded plugin %s", p.Name)
+	}
+	return nil
+}
+
+func installPlugin(p *plugin.Plugin) error {
+	for _, b := range p.Blocks {
+		if b.Type < plugin.FirstBlock {
+			return fmt.Errorf("block type %d is below %d", b.Type, plugin.FirstBlock)
+		}
+		if _, ok := render.ItemDesc[b.Type]; ok {
+			return fmt.Errorf("block type %d already exists", b.Type)
+		}
+		for _, t := range b.Tiles {
+			if t < 0 || t >= 256 {
+				return fmt.Errorf("tile %d of block %d out of the atlas", t, b.Type)
+			}
+		}
+		render.ItemDesc[b.Type] = b.Tiles
+		availableItems = append(availableItems, b.Type)
+		world.RegisterBlock(b.Type, b.Hardness, b.Resistance)
+	}
+	for _, c := range p.Commands {
+		if _, ok := commands[c.Name]; ok {
+			return fmt.Errorf("command %s already exists", c.Name)
+		}
+		run := c.Run
+		RegisterCommand(&Command{
+			Name:  c.Name,
+			Usage: c.Usage,
+			Run: func(g *Game, args *Args) (string, error) {
+				words := args.list[args.next:]
+				args.next = len(args.list)
+				return run(pluginGame{g}, words)
+			},
+		})
+	}
+	return nil
+}
+
+// pluginGame is the Game seen by the plugins.
+type pluginGame struct {
+	g *Game
+}
+
+func (p pluginGame) Block(id world.Vec3) int {
+	return p.g.world.Block(id)
+}
+
+func (p pluginGame) SetBlocks(edits ...plugin.Edit) {
+	list := make([]net.BlockEdit, len(edits))
+	for i, e := range edits {
+		list[i] = net.BlockEdit{Id: e.Id, W: e.W}
+	}
+	p.g.UpdateBlocks(list...)
+}
+
+func (p pluginGame) Player() mgl32.Vec3 {
+	return p.g.camera.Pos()
+}
+
+func (p pluginGame) Print(msg string) {
+	p.g.console.Print(msg)
+}
+
+// subscribePlugin hooks the handlers of p to the event bus.
+func subscribePlugin(p *plugin.Plugin) {
+	if f := p.BlockPlaced; f != nil {
+		events.Subscribe(EventBlockPlaced, func(e Event) {
+			ev := e.(BlockPlaced)
+			f(pluginGame{game}, ev.Id, ev.W)
+		})
+	}
+	if f := p.BlockBroken; f != nil {
+		events.Subscribe(EventBlockBroken, func(e Event) {
+			ev := e.(BlockBroken)
+			f(pluginGame{game}, ev.Id, ev.W)
+		})
+	}
+	if f := p.PlayerMoved; f != nil {
+		events.Subscribe(EventPlayerMoved, func(e Event) {
+			ev := e.(PlayerMoved)
+			f(pluginGame{game}, ev.From, ev.To)
+		})
+	}
+	if f := p.ChunkGenerated; f != nil {
+		events.Subscribe(EventChunkLoaded, func(e Event) {
+			f(e.(ChunkLoaded).Chunk)
+		})
+	}
+	if f := p.PlayerJoined; f != nil {
+		events.Subscribe(EventPlayerJoined, func(e Event) {
+			f(e.(PlayerJoined).Id)
+		})
+	}
+	if f := p.Damage; f != nil {
+		events.Subscribe(EventDamage, func(e Event) {
+			ev := e.(Damage)
+			f(pluginGame{game}, ev.Amount, ev.Reason)
+		})
+	}
+}
@@ -0,0 +1,35 @@
+#version 330 core
+
+in vec2 Tex;
+
+uniform sampler2D color;
+uniform sampler2D depth;
+uniform vec2 texel;
+uniform float near;
+uniform float far;
+
+out vec4 FragColor;
+
+const int taps = 12;
+const float max_radius = 6;
+
+float linear_depth(vec2 uv) {
+    float z = texture(depth, uv).r * 2 - 1;
+    return 2 * near * far / (far + near - z * (far - near));
+}
+
+void main() {
+    vec3 c = texture(color, Tex).rgb;
+    // focus on what the cross hair looks at
+    float focus = linear_depth(vec2(0.5, 0.5));
+    float d = linear_depth(Tex);
+    float coc = clamp(abs(d - focus) / max(focus, 1), 0, 1) * max_radius;
+    vec3 sum = c;
+    for (int i = 0; i < taps; i++) {
+        float a = 6.2831853 * float(i) / float(taps);
+        vec2 off = vec2(cos(a), sin(a)) * coc * texel;
+        sum += texture(color, Tex + off).rgb;
+        sum += texture(color, Tex + off * 0.5).rgb;
+    }
+    FragColor = vec4(sum / float(taps * 2 + 1), 1);
+}
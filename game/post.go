@@ -0,0 +1,358 @@
+package game
+
+import (
+	"fmt"
+	"image"
+	"sort"
+	"time"
+
+	"github.com/faiface/glhf"
+	"github.com/faiface/mainthread"
+	"github.com/go-gl/gl/v3.3-core/gl"
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/icexin/gocraft/internal/geom"
+	"github.com/icexin/gocraft/render"
+	"github.com/icexin/gocraft/world"
+)
+
+var (
+	dofEnabled       = flags.Bool("dof", true, "depth of field in photo mode")
+	fovRampEnabled   = flags.Bool("fovramp", true, "widen the field of view while sprinting or flying")
+	vignetteEnabled  = flags.Bool("vignette", false, "darken the corners of the screen")
+	fxaaEnabled      = flags.Bool("fxaa", false, "smooth the edges with FXAA")
+	viewBobEnabled   = flags.Bool("bob", false, "bob the view while walking")
+	smoothCamEnabled = flags.Bool("smoothcam", false, "smooth the mouse look")
+	landDipEnabled   = flags.Bool("landdip", false, "dip the view when landing from a fall")
+)
+
+func init() {
+	RegisterCommand(&Command{
+		Name:  "effect",
+		Usage: "/effect dof|fovramp|vignette|fxaa|bob|smoothcam|landdip|clouds on|off",
+		Run: func(g *Game, args *Args) (string, error) {
+			effect := args.Choice("effect", "dof", "fovramp", "vignette", "fxaa", "bob", "smoothcam", "landdip", "clouds")
+			on := args.Switch("state")
+			if err := args.Err(); err != nil {
+				return "", err
+			}
+			switch effect {
+			case "dof":
+				*dofEnabled = on
+			case "fovramp":
+				*fovRampEnabled = on
+			case "vignette":
+				*vignetteEnabled = on
+			case "fxaa":
+				*fxaaEnabled = on
+			case "bob":
+				*viewBobEnabled = on
+			case "smoothcam":
+				*smoothCamEnabled = on
+			case "landdip":
+				*landDipEnabled = on
+			case "clouds":
+				*cloudsEnabled = on
+			}
+			if on {
+				return effect + " on", nil
+			}
+			return effect + " off", nil
+		},
+	})
+}
+
+// Uniforms of every post effect shader, the ones of the effect follow from
+// index len(postUniforms). The vertex shader is post.vert, giving Tex.
+var postUniforms = glhf.AttrFormat{
+	glhf.Attr{Name: "color", Type: glhf.Int},
+	glhf.Attr{Name: "depth", Type: glhf.Int},
+	glhf.Attr{Name: "texel", Type: glhf.Vec2},
+	glhf.Attr{Name: "near", Type: glhf.Float},
+	glhf.Attr{Name: "far", Type: glhf.Float},
+}
+
+// Order of the builtin effects, FXAA comes last so it smooths the edges of
+// what the other passes drew.
+const (
+	dofOrder   = 10
+	gradeOrder = 20
+	fxaaOrder  = 100
+)
+
+// PostEffect is a full screen pass of the post chain, its fragment shader
+// reads the output of the previous pass from color.
+type PostEffect struct {
+	Name  string
+	Order int // the passes run by increasing order
+	// Enabled reports whether the pass runs this frame
+	Enabled func() bool
+	// Bind sets the uniforms of the effect, may be nil
+	Bind func(s *glhf.Shader)
+
+	shader *glhf.Shader
+}
+
+// Grade is the color grading of the world, the features set the factors
+// from 0 to 1 every frame.
+type Grade struct {
+	Underwater float32
+	Night      float32
+	// the eye is inside an opaque block
+	InBlock float32
+}
+
+// PostRender draws the world into an offscreen framebuffer and runs the
+// effect chain when copying it to the window, the HUD is drawn after it so
+// it's never blurred.
+type PostRender struct {
+	Grade Grade
+
+	copy    *PostEffect
+	effects []*PostEffect
+	passes  []*PostEffect
+	quad    *render.Mesh
+
+	// the passes ping-pong between the two color textures, they share the depth
+	fbo           [2]uint32
+	color         [2]uint32
+	depth         uint32
+	width, height int
+}
+
+func NewPostRender() (*PostRender, error) {
+	r := &PostRender{}
+	var err error
+	mainthread.Call(func() {
+		r.copy = &PostEffect{Name: "copy"}
+		if err = r.compile(r.copy, copyFragmentSource, nil); err != nil {
+			return
+		}
+		r.quad = render.NewMesh(r.copy.shader, []float32{
+			-1, -1, 1, -1, 1, 1,
+			1, 1, -1, 1, -1, -1,
+		})
+		err = r.AddEffect(&PostEffect{
+			Name:    "dof",
+			Order:   dofOrder,
+			Enabled: func() bool { return game.photoMode && *dofEnabled },
+		}, postFragmentSource, nil)
+		if err != nil {
+			return
+		}
+		err = r.AddEffect(&PostEffect{
+			Name:    "grade",
+			Order:   gradeOrder,
+			Enabled: r.grading,
+			Bind: func(s *glhf.Shader) {
+				vignette := float32(0)
+				if *vignetteEnabled {
+					vignette = 1
+				}
+				s.SetUniformAttr(5, r.Grade.Underwater)
+				s.SetUniformAttr(6, r.Grade.Night)
+				s.SetUniformAttr(7, vignette)
+				s.SetUniformAttr(8, r.Grade.InBlock)
+			},
+		}, gradeFragmentSource, glhf.AttrFormat{
+			glhf.Attr{Name: "underwater", Type: glhf.Float},
+			glhf.Attr{Name: "night", Type: glhf.Float},
+			glhf.Attr{Name: "vignette", Type: glhf.Float},
+			glhf.Attr{Name: "inblock", Type: glhf.Float},
+		})
+		if err != nil {
+			return
+		}
+		err = r.AddEffect(&PostEffect{
+			Name:    "fxaa",
+			Order:   fxaaOrder,
+			Enabled: func() bool { return *fxaaEnabled },
+		}, fxaaFragmentSource, nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *PostRender) compile(e *PostEffect, fragment string, uniforms glhf.AttrFormat) error {
+	format := append(append(glhf.AttrFormat{}, postUniforms...), uniforms...)
+	shader, err := glhf.NewShader(glhf.AttrFormat{
+		glhf.Attr{Name: "pos", Type: glhf.Vec2},
+	}, format, postVertexSource, fragment)
+	if err != nil {
+		return fmt.Errorf("post effect %s: %s", e.Name, err)
+	}
+	shader.Begin()
+	shader.SetUniformAttr(0, int32(0))
+	shader.SetUniformAttr(1, int32(1))
+	shader.End()
+	e.shader = shader
+	return nil
+}
+
+// AddEffect compiles the fragment shader of e and adds it to the chain,
+// uniforms are the ones of the effect after postUniforms. Call on mainthread.
+func (r *PostRender) AddEffect(e *PostEffect, fragment string, uniforms glhf.AttrFormat) error {
+	if err := r.compile(e, fragment, uniforms); err != nil {
+		return err
+	}
+	r.effects = append(r.effects, e)
+	sort.SliceStable(r.effects, func(i, j int) bool {
+		return r.effects[i].Order < r.effects[j].Order
+	})
+	return nil
+}
+
+func (r *PostRender) grading() bool {
+	return r.Grade.Underwater > 0 || r.Grade.Night > 0 || r.Grade.InBlock > 0 || *vignetteEnabled
+}
+
+// Active reports whether the world goes through the offscreen framebuffer
+// this frame, for the post effects or a render scale other than 1.
+func (r *PostRender) Active() bool {
+	r.passes = r.passes[:0]
+	for _, e := range r.effects {
+		if e.Enabled() {
+			r.passes = append(r.passes, e)
+		}
+	}
+	return len(r.passes) != 0 || settings.RenderScale != 1
+}
+
+// scaledSize returns the size of the offscreen framebuffer for a window of
+// width x height, bounded by the texture size limit.
+func scaledSize(width, height int) (int, int) {
+	max := int(render.GPU.MaxTextureSize)
+	w := geom.MaxInt(1, geom.MinInt(max, int(float32(width)*settings.RenderScale)))
+	h := geom.MaxInt(1, geom.MinInt(max, int(float32(height)*settings.RenderScale)))
+	return w, h
+}
+
+func newColorTexture(width, height int) uint32 {
+	var tex uint32
+	gl.GenTextures(1, &tex)
+	gl.BindTexture(gl.TEXTURE_2D, tex)
+	gl.TexImage2D(gl.TEXTURE_2D, 0, gl.RGBA8, int32(width), int32(height), 0, gl.RGBA, gl.UNSIGNED_BYTE, nil)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.LINEAR)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.LINEAR)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
+	return tex
+}
+
+func (r *PostRender) resize(width, height int) {
+	if r.fbo[0] != 0 && width == r.width && height == r.height {
+		return
+	}
+	r.release()
+	r.width, r.height = width, height
+	gl.GenTextures(1, &r.depth)
+	gl.BindTexture(gl.TEXTURE_2D, r.depth)
+	gl.TexImage2D(gl.TEXTURE_2D, 0, gl.DEPTH_COMPONENT24, int32(width), int32(height), 0, gl.DEPTH_COMPONENT, gl.FLOAT, nil)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.NEAREST)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.NEAREST)
+
+	for i := range r.fbo {
+		r.color[i] = newColorTexture(width, height)
+		gl.GenFramebuffers(1, &r.fbo[i])
+		gl.BindFramebuffer(gl.FRAMEBUFFER, r.fbo[i])
+		gl.FramebufferTexture2D(gl.FRAMEBUFFER, gl.COLOR_ATTACHMENT0, gl.TEXTURE_2D, r.color[i], 0)
+		gl.FramebufferTexture2D(gl.FRAMEBUFFER, gl.DEPTH_ATTACHMENT, gl.TEXTURE_2D, r.depth, 0)
+		if status := gl.CheckFramebufferStatus(gl.FRAMEBUFFER); status != gl.FRAMEBUFFER_COMPLETE {
+			gpuLog.Errorf("post framebuffer incomplete:0x%x", status)
+		}
+	}
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+	gl.BindFramebuffer(gl.FRAMEBUFFER, 0)
+}
+
+func (r *PostRender) release() {
+	if r.fbo[0] != 0 {
+		gl.DeleteFramebuffers(2, &r.fbo[0])
+		gl.DeleteTextures(2, &r.color[0])
+		gl.DeleteTextures(1, &r.depth)
+		r.fbo[0] = 0
+	}
+}
+
+// Begin redirects the world drawing to the offscreen framebuffer when needed.
+func (r *PostRender) Begin() {
+	if !r.Active() {
+		return
+	}
+	r.resize(scaledSize(game.win.GetFramebufferSize()))
+	gl.BindFramebuffer(gl.FRAMEBUFFER, r.fbo[0])
+	gl.Viewport(0, 0, int32(r.width), int32(r.height))
+}
+
+// End runs the effect chain, the last pass stretches the world to the
+// window. The window may be multisampled, which glBlitFramebuffer can't
+// write to, so even a plain copy is a textured quad.
+func (r *PostRender) End() {
+	if !r.Active() {
+		return
+	}
+	passes := r.passes
+	if len(passes) == 0 {
+		passes = append(passes, r.copy)
+	}
+	width, height := game.win.GetFramebufferSize()
+	// the depth texture stays attached to fbo[0] while sampled, nothing may write it
+	gl.Disable(gl.DEPTH_TEST)
+	gl.DepthMask(false)
+	gl.ActiveTexture(gl.TEXTURE1)
+	gl.BindTexture(gl.TEXTURE_2D, r.depth)
+	gl.ActiveTexture(gl.TEXTURE0)
+	src := 0
+	for i, e := range passes {
+		if i == len(passes)-1 {
+			gl.BindFramebuffer(gl.FRAMEBUFFER, 0)
+			gl.Viewport(0, 0, int32(width), int32(height))
+		} else {
+			gl.BindFramebuffer(gl.FRAMEBUFFER, r.fbo[1-src])
+		}
+		e.shader.Begin()
+		e.shader.SetUniformAttr(2, mgl32.Vec2{1 / float32(r.width), 1 / float32(r.height)})
+		e.shader.SetUniformAttr(3, float32(render.NearPlane))
+		e.shader.SetUniformAttr(4, float32(render.Radius()*world.ChunkWidth))
+		if e.Bind != nil {
+			e.Bind(e.shader)
+		}
+		gl.BindTexture(gl.TEXTURE_2D, r.color[src])
+		r.quad.Draw()
+		e.shader.End()
+		src = 1 - src
+	}
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+	gl.DepthMask(true)
+	gl.Clear(gl.DEPTH_BUFFER_BIT)
+	gl.Enable(gl.DEPTH_TEST)
+}
+
+// readScreen returns the window content, call on mainthread after drawing
+// the frame and before swapping the buffers.
+func readScreen() *image.NRGBA {
+	width, height := game.win.GetFramebufferSize()
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	gl.ReadPixels(0, 0, int32(width), int32(height), gl.RGBA, gl.UNSIGNED_BYTE, gl.Ptr(img.Pix))
+	// opengl rows go from the bottom up
+	stride := img.Stride
+	for y := 0; y < height/2; y++ {
+		a := img.Pix[y*stride : (y+1)*stride]
+		b := img.Pix[(height-1-y)*stride : (height-y)*stride]
+		for i := range a {
+			a[i], b[i] = b[i], a[i]
+		}
+	}
+	for i := 3; i < len(img.Pix); i += 4 {
+		img.Pix[i] = 255
+	}
+	return img
+}
+
+// Screenshot saves the window content as a png, call on mainthread after
+// drawing the frame and before swapping the buffers.
+func Screenshot() (string, error) {
+	name := fmt.Sprintf("screenshot-%s.png", time.Now().Format("20060102-150405"))
+	return name, savePNG(name, readScreen())
+}
@@ -0,0 +1,11 @@
+#version 330 core
+
+// shared by the post effects, which draw the same quad
+layout(location = 0) in vec2 pos;
+
+out vec2 Tex;
+
+void main() {
+    gl_Position = vec4(pos, 0, 1);
+    Tex = pos * 0.5 + 0.5;
+}
@@ -0,0 +1,207 @@
+package game
+
+import (
+	"sync"
+	"time"
+
+	"github.com/go-gl/gl/v3.3-core/gl"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// render passes timed on the GPU
+const (
+	passBlock = iota
+	passLine
+	passPlayer
+	numPasses
+)
+
+var passNames = [numPasses]string{"block", "line", "player"}
+
+// the timer queries of a frame are read queryFrames frames later, when the
+// GPU is done with them, so reading them never stalls
+const queryFrames = 3
+
+// Profiler times the render passes with GPU timer queries and the main
+// thread, mesh builds and chunk loads on the CPU. It runs with the debug
+// info (F3) or -pprof: the times are drawn as stacked bars under the debug
+// info and served as frame_profile in /debug/vars. The times are moving
+// averages in milliseconds.
+type Profiler struct {
+	// per frame slot, generated on first use
+	queries [queryFrames][numPasses]uint32
+	issued  [queryFrames][numPasses]bool
+	slot    int
+	pass    int // running query, -1 if none
+
+	mutex     sync.Mutex
+	gpu       [numPasses]float64
+	frame     float64 // main thread
+	meshBuild float64
+	chunkLoad float64
+}
+
+var profiler = &Profiler{pass: -1}
+
+// timed by the profiler without the debug screen, set by SetProfiling
+var profiling bool
+
+// SetProfiling times the passes and the mesh updates even with the debug
+// screen off, for the runs served to pprof. Call before Run.
+func SetProfiling(on bool) {
+	profiling = on
+}
+
+func (p *Profiler) enabled() bool {
+	return game.debug || profiling
+}
+
+// average moves the average *avg toward d.
+func average(avg *float64, d time.Duration) {
+	ms := d.Seconds() * 1000
+	if *avg == 0 {
+		*avg = ms
+		return
+	}
+	*avg += (ms - *avg) * 0.1
+}
+
+// Begin starts timing pass on the GPU, call on mainthread.
+func (p *Profiler) Begin(pass int) {
+	if !p.enabled() {
+		return
+	}
+	q := &p.queries[p.slot]
+	if q[0] == 0 {
+		gl.GenQueries(numPasses, &q[0])
+	}
+	gl.BeginQuery(gl.TIME_ELAPSED, q[pass])
+	p.issued[p.slot][pass] = true
+	p.pass = pass
+}
+
+// End stops timing the pass of Begin, call on mainthread.
+func (p *Profiler) End() {
+	if p.pass < 0 {
+		return
+	}
+	gl.EndQuery(gl.TIME_ELAPSED)
+	p.pass = -1
+}
+
+// EndFrame records the main thread time of the frame and reads the queries
+// of the oldest frame in flight, call on mainthread.
+func (p *Profiler) EndFrame(d time.Duration) {
+	if !p.enabled() {
+		return
+	}
+	p.slot = (p.slot + 1) % queryFrames
+	var elapsed [numPasses]time.Duration
+	var done [numPasses]bool
+	for pass, issued := range p.issued[p.slot] {
+		if !issued {
+			continue
+		}
+		q := p.queries[p.slot][pass]
+		var available int32
+		gl.GetQueryObjectiv(q, gl.QUERY_RESULT_AVAILABLE, &available)
+		if available == 0 {
+			continue
+		}
+		var ns uint64
+		gl.GetQueryObjectui64v(q, gl.QUERY_RESULT, &ns)
+		elapsed[pass], done[pass] = time.Duration(ns), true
+		p.issued[p.slot][pass] = false
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	average(&p.frame, d)
+	for pass := range elapsed {
+		if done[pass] {
+			average(&p.gpu[pass], elapsed[pass])
+		}
+	}
+}
+
+// RecordMeshBuild records the CPU time of a chunk mesh, from any goroutine.
+func (p *Profiler) RecordMeshBuild(d time.Duration) {
+	p.mutex.Lock()
+	average(&p.meshBuild, d)
+	p.mutex.Unlock()
+}
+
+// RecordChunkLoad records the time the mesh update waited for a batch of
+// chunks to be generated or loaded, from any goroutine.
+func (p *Profiler) RecordChunkLoad(d time.Duration) {
+	p.mutex.Lock()
+	average(&p.chunkLoad, d)
+	p.mutex.Unlock()
+}
+
+// Stats returns the times for /debug/vars.
+func (p *Profiler) Stats() map[string]interface{} {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	gpu := make(map[string]float64, numPasses)
+	for pass, ms := range p.gpu {
+		gpu[passNames[pass]] = ms
+	}
+	return map[string]interface{}{
+		"enabled":       p.enabled(),
+		"gpu_ms":        gpu,
+		"frame_ms":      p.frame,
+		"mesh_build_ms": p.meshBuild,
+		"chunk_load_ms": p.chunkLoad,
+	}
+}
+
+// colors of the bars: the GPU passes, then the main thread, mesh builds and
+// chunk loads
+var profileColors = [...]mgl32.Vec4{
+	{0.2, 0.8, 0.2, 1},
+	{0.9, 0.9, 0.2, 1},
+	{0.2, 0.5, 1, 1},
+	{0.7, 0.7, 0.7, 1},
+	{1, 0.5, 0.1, 1},
+	{0.7, 0.3, 0.9, 1},
+}
+
+// drawProfile draws the times of the profiler as bars at the top left, the
+// GPU passes stacked on the first one, the main thread, the mesh builds and
+// the chunk loads on the next ones. The white tick is at 1/60 s.
+func (r *LineRender) drawProfile() {
+	const (
+		barHeight = 6
+		tick      = 1000.0 / 60 // ms
+	)
+	profiler.mutex.Lock()
+	gpu := profiler.gpu
+	rows := [][]float64{gpu[:], {profiler.frame}, {profiler.meshBuild}, {profiler.chunkLoad}}
+	profiler.mutex.Unlock()
+
+	width, height := game.win.GetFramebufferSize()
+	project := mgl32.Ortho2D(0, float32(width), float32(height), 0)
+	scale := settings.UIScale
+	// pixels per millisecond, the tick at a fifth of the width
+	px := float32(width) / 5 / tick
+	x0, y0 := 10*scale, 10*scale
+	color := 0
+	for i, row := range rows {
+		y := y0 + float32(i)*(barHeight+2)*scale
+		x := x0
+		for _, ms := range row {
+			w := float32(ms) * px
+			r.shader.SetUniformAttr(1, profileColors[color])
+			model := mgl32.Translate3D(x, y, 0).Mul4(mgl32.Scale3D(w, barHeight*scale, 1))
+			r.quad.Fill(project.Mul4(model))
+			x += w
+			color++
+		}
+	}
+	r.shader.SetUniformAttr(1, mgl32.Vec4{1, 1, 1, 1})
+	x := x0 + tick*px
+	model := mgl32.Translate3D(x, y0, 0).Mul4(mgl32.Scale3D(1, float32(len(rows))*(barHeight+2)*scale, 1))
+	r.quad.Fill(project.Mul4(model))
+	r.shader.SetUniformAttr(1, mgl32.Vec4{0, 0, 0, 1})
+}
@@ -0,0 +1,72 @@
+package game
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/icexin/gocraft/net"
+	"github.com/icexin/gocraft/world"
+)
+
+const (
+	scanInterval   = time.Second
+	maxScanRadius  = 64
+	maxScanResults = 512
+)
+
+var (
+	errScanDenied      = errors.New("block scanning needs operator permission on a server")
+	errScanRateLimited = errors.New("block scanning is rate limited")
+
+	scanMutex sync.Mutex
+	lastScan  time.Time
+)
+
+func scanPermitted() bool {
+	return net.ServerAddr() == "" || net.Op()
+}
+
+// scanBlocks returns the blocks of w within radius of center matching match.
+// Only loaded chunks are scanned, chunks are never loaded or generated by a scan.
+// Scans are allowed offline or for server operators, at most once per scanInterval.
+func scanBlocks(w *world.World, center world.Vec3, radius int, match func(tp int) bool) ([]world.Vec3, error) {
+	if !scanPermitted() {
+		return nil, errScanDenied
+	}
+	scanMutex.Lock()
+	if time.Since(lastScan) < scanInterval {
+		scanMutex.Unlock()
+		return nil, errScanRateLimited
+	}
+	lastScan = time.Now()
+	scanMutex.Unlock()
+
+	if radius > maxScanRadius {
+		radius = maxScanRadius
+	}
+	min := world.Vec3{X: center.X - radius, Y: 0, Z: center.Z - radius}.Chunkid()
+	max := world.Vec3{X: center.X + radius, Y: 0, Z: center.Z + radius}.Chunkid()
+	var ret []world.Vec3
+	for p := min.X; p <= max.X; p++ {
+		for q := min.Z; q <= max.Z; q++ {
+			chunk, ok := w.PeekChunk(world.Vec3{X: p, Y: 0, Z: q})
+			if !ok {
+				continue
+			}
+			chunk.RangeBlocks(func(id world.Vec3, tp int) {
+				if len(ret) >= maxScanResults {
+					return
+				}
+				dx, dy, dz := id.X-center.X, id.Y-center.Y, id.Z-center.Z
+				if dx*dx+dy*dy+dz*dz > radius*radius {
+					return
+				}
+				if match(tp) {
+					ret = append(ret, id)
+				}
+			})
+		}
+	}
+	return ret, nil
+}
@@ -0,0 +1,80 @@
+package game
+
+import (
+	"math"
+	"time"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/icexin/gocraft/net"
+)
+
+var (
+	yearLength = flags.Duration("seasons", 0, "length of a year of seasons, 0 disables seasons")
+)
+
+var seasonNames = [...]string{"spring", "summer", "autumn", "winter"}
+
+// foliage colors of the middle of each season
+var seasonFoliage = [...]mgl32.Vec3{
+	{0.9, 1.05, 0.85},
+	{1, 1, 1},
+	{1.25, 0.9, 0.55},
+	{0.8, 0.85, 0.8},
+}
+
+// worldTime returns the time driving the seasons, the server clock when
+// online so that all players see the same season.
+func worldTime() float64 {
+	if net.ServerAddr() != "" {
+		return net.Now()
+	}
+	return float64(time.Now().UnixNano()) / 1e9
+}
+
+// Season is the tint of the world at a point of the year.
+type Season struct {
+	// position in the year, 0 is the beginning of spring
+	Phase float64
+	// temperature from -1 in the middle of winter to 1 in the middle of summer
+	Temperature float32
+	Foliage     mgl32.Vec3
+	// snow coverage of the ground from 0 to 1
+	Snow float32
+}
+
+func (s Season) Name() string {
+	return seasonNames[int(s.Phase*4)%4]
+}
+
+// CurrentSeason returns the season now, a neutral one if seasons are disabled.
+func CurrentSeason() Season {
+	if *yearLength <= 0 {
+		return Season{Phase: 0.375, Temperature: 1, Foliage: seasonFoliage[1]}
+	}
+	year := yearLength.Seconds()
+	phase := math.Mod(worldTime(), year) / year
+	return makeSeason(phase)
+}
+
+func makeSeason(phase float64) Season {
+	// warmest in the middle of summer, coldest in the middle of winter
+	temp := float32(math.Cos(2 * math.Pi * (phase - 0.375)))
+	// blend the foliage of the two closest season middles
+	p := phase*4 - 0.5
+	if p < 0 {
+		p += 4
+	}
+	i := int(p)
+	f := float32(p - float64(i))
+	a, b := seasonFoliage[i%4], seasonFoliage[(i+1)%4]
+	s := Season{
+		Phase:       phase,
+		Temperature: temp,
+		Foliage:     a.Mul(1 - f).Add(b.Mul(f)),
+	}
+	// the ground is covered with snow when it's cold enough
+	if temp < -0.5 {
+		s.Snow = (-0.5 - temp) * 2
+	}
+	return s
+}
@@ -0,0 +1,225 @@
+package game
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/go-gl/gl/v3.3-core/gl"
+	"github.com/icexin/gocraft/render"
+)
+
+var (
+	presetName  = flags.String("preset", "auto", "quality preset: low, medium, high, handheld or auto")
+	shadowsFlag = flags.Bool("shadows", false, "sun shadows, on in the high preset")
+	msaaFlag    = flags.Int("msaa", 4, "multisampling samples of the window, 0 disables it")
+	renderScale = flags.Float64("renderscale", 1, "resolution of the world relative to the window, from 0.25 to 2")
+)
+
+const (
+	minRenderScale = 0.25
+	maxRenderScale = 2
+)
+
+// Settings holds the quality options that can be switched as a whole by a preset.
+type Settings struct {
+	Preset           string
+	RenderRadius     int
+	AmbientOcclusion bool
+	Shadows          bool
+	FPSCap           int
+	UIScale          float32
+	// multisampling, needs a window made with -msaa
+	MSAA bool
+	// the world is drawn at this fraction of the window size and stretched,
+	// below 1 for slow gpus and above 1 for supersampling
+	RenderScale float32
+}
+
+var presetOrder = []string{"low", "medium", "high", "handheld"}
+
+var qualityPresets = map[string]Settings{
+	"low": {
+		RenderRadius: 4,
+		FPSCap:       30,
+		UIScale:      1,
+		RenderScale:  0.75,
+	},
+	"medium": {
+		RenderRadius:     6,
+		AmbientOcclusion: true,
+		FPSCap:           60,
+		UIScale:          1,
+		MSAA:             true,
+		RenderScale:      1,
+	},
+	"high": {
+		RenderRadius:     10,
+		AmbientOcclusion: true,
+		Shadows:          true,
+		FPSCap:           60,
+		UIScale:          1,
+		MSAA:             true,
+		RenderScale:      1,
+	},
+	// small screen, shared memory gpu and battery
+	"handheld": {
+		RenderRadius:     4,
+		AmbientOcclusion: true,
+		FPSCap:           40,
+		UIScale:          1.5,
+		RenderScale:      0.75,
+	},
+}
+
+var settings = qualityPresets["medium"]
+
+// detectPreset guesses a preset from the GL_RENDERER string.
+func detectPreset(renderer string) string {
+	r := strings.ToLower(renderer)
+	contains := func(subs ...string) bool {
+		for _, s := range subs {
+			if strings.Contains(r, s) {
+				return true
+			}
+		}
+		return false
+	}
+	switch {
+	case contains("llvmpipe", "softpipe", "swiftshader", "software"):
+		return "low"
+	case contains("vangogh", "van gogh", "custom gpu 0405", "steam deck", "tegra", "adreno", "mali"):
+		return "handheld"
+	case contains("intel", "iris", "uhd graphics", "hd graphics", "radeon graphics", "vega 8", "apple"):
+		return "medium"
+	}
+	return "high"
+}
+
+func flagPassed(name string) bool {
+	passed := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			passed = true
+		}
+	})
+	return passed
+}
+
+// InitSettings must be called after the GL context is created.
+func InitSettings(renderer string) {
+	name := *presetName
+	if name == "auto" {
+		name = detectPreset(renderer)
+		gpuLog.Infof("renderer %q, use %s preset", renderer, name)
+	}
+	if _, ok := qualityPresets[name]; !ok {
+		gameLog.Warnf("unknown preset %q, use medium", name)
+		name = "medium"
+	}
+	ApplyPreset(name)
+}
+
+func ApplyPreset(name string) {
+	s, ok := qualityPresets[name]
+	if !ok {
+		return
+	}
+	s.Preset = name
+	// explicit command line flags win over the preset
+	if flagPassed("r") {
+		s.RenderRadius = render.Radius()
+	}
+	if flagPassed("shadows") {
+		s.Shadows = *shadowsFlag
+	}
+	if flagPassed("msaa") {
+		s.MSAA = *msaaFlag > 0
+	}
+	if flagPassed("renderscale") {
+		s.RenderScale = float32(*renderScale)
+	}
+	if s.Shadows && !shadowMaps() {
+		gpuLog.Warnf("gpu can't run the shadow maps, shadows off")
+		s.Shadows = false
+	}
+	settings = s
+	render.SetRadius(s.RenderRadius)
+	SetRenderScale(s.RenderScale)
+	SetMSAA(s.MSAA)
+}
+
+// SetMSAA switches the multisampling, off if the window has no samples, call
+// on mainthread.
+func SetMSAA(on bool) {
+	settings.MSAA = on && render.GPU.Samples > 0
+	if settings.MSAA {
+		gl.Enable(gl.MULTISAMPLE)
+	} else {
+		gl.Disable(gl.MULTISAMPLE)
+	}
+}
+
+// SetRenderScale clamps the render scale to the supported range, the
+// offscreen framebuffer is resized on the next frame.
+func SetRenderScale(scale float32) {
+	settings.RenderScale = float32(math.Max(minRenderScale, math.Min(maxRenderScale, float64(scale))))
+}
+
+func onOff(on bool) string {
+	if on {
+		return "on"
+	}
+	return "off"
+}
+
+func init() {
+	RegisterCommand(&Command{
+		Name:  "settings",
+		Usage: "/settings [preset low|medium|high|handheld, msaa on|off, scale 0.25-2]",
+		Run: func(g *Game, args *Args) (string, error) {
+			if args.Len() != 0 {
+				switch args.Choice("setting", "preset", "msaa", "scale") {
+				case "preset":
+					name := args.Choice("preset", presetOrder...)
+					if err := args.Err(); err != nil {
+						return "", err
+					}
+					g.applyPreset(name)
+				case "msaa":
+					on := args.Switch("msaa")
+					if err := args.Err(); err != nil {
+						return "", err
+					}
+					if on && render.GPU.Samples == 0 {
+						return "", errors.New(tr("the window has no samples, restart with -msaa 4"))
+					}
+					SetMSAA(on)
+				case "scale":
+					scale := args.Float("scale")
+					args.Range("scale", scale, minRenderScale, maxRenderScale)
+					if err := args.Err(); err != nil {
+						return "", err
+					}
+					SetRenderScale(float32(scale))
+				default:
+					return "", args.Err()
+				}
+			}
+			return fmt.Sprintf("preset %s, radius %d, shadows %s, msaa %s (%dx), scale %g",
+				settings.Preset, settings.RenderRadius, onOff(settings.Shadows),
+				onOff(settings.MSAA), render.GPU.Samples, settings.RenderScale), nil
+		},
+	})
+}
+
+func nextPreset(name string) string {
+	for i, p := range presetOrder {
+		if p == name {
+			return presetOrder[(i+1)%len(presetOrder)]
+		}
+	}
+	return presetOrder[0]
+}
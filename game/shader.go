@@ -0,0 +1,50 @@
+package game
+
+import _ "embed"
+
+var (
+	//go:embed line.vert
+	lineVertexSource string
+
+	//go:embed line.frag
+	lineFragmentSource string
+
+	//go:embed player.vert
+	playerVertexSource string
+
+	//go:embed player.frag
+	playerFragmentSource string
+
+	//go:embed post.vert
+	postVertexSource string
+
+	//go:embed post.frag
+	postFragmentSource string
+
+	//go:embed copy.frag
+	copyFragmentSource string
+
+	//go:embed grade.frag
+	gradeFragmentSource string
+
+	//go:embed fxaa.frag
+	fxaaFragmentSource string
+
+	//go:embed lod.vert
+	lodVertexSource string
+
+	//go:embed lod.frag
+	lodFragmentSource string
+
+	//go:embed cloud.vert
+	cloudVertexSource string
+
+	//go:embed cloud.frag
+	cloudFragmentSource string
+
+	//go:embed shadow.vert
+	shadowVertexSource string
+
+	//go:embed shadow.frag
+	shadowFragmentSource string
+)
@@ -0,0 +1,12 @@
+#version 330 core
+
+in vec2 Tex;
+uniform sampler2D tex;
+
+void main() {
+    // plants and leaves cast the shadow of their texture
+    vec3 color = vec3(texture(tex, vec2(Tex.x, 1-Tex.y)));
+    if (color == vec3(1,0,1)) {
+        discard;
+    }
+}
@@ -0,0 +1,176 @@
+package game
+
+import (
+	"github.com/faiface/glhf"
+	"github.com/faiface/mainthread"
+	"github.com/go-gl/gl/v3.3-core/gl"
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/icexin/gocraft/internal/geom"
+	"github.com/icexin/gocraft/render"
+	"github.com/icexin/gocraft/world"
+)
+
+const (
+	shadowCascades = 3
+	shadowSize     = 2048
+	// height range of the blocks that can cast a shadow into a cascade
+	shadowDepth = world.ChunkHeight
+)
+
+// half width in blocks of each cascade, the last one is cut to the render radius
+var shadowExtents = [shadowCascades]float32{16, 48, 128}
+
+// set when the shadow framebuffer turned out incomplete
+var shadowBroken bool
+
+// shadowMaps reports whether the cascaded shadow maps fit in the limits of
+// the GPU.
+func shadowMaps() bool {
+	return render.GPU.MaxArrayLayers >= shadowCascades && render.GPU.MaxTextureSize >= shadowSize && !shadowBroken
+}
+
+// sunDir points to the sun, the same as lightdir in block.vert.
+var sunDir = mgl32.Vec3{-1, 1, -1}.Normalize()
+
+// ShadowRender draws the depth of the chunks and players seen from the sun
+// into a texture array, one layer per cascade. The cascades are nested
+// squares around the player, the block shader uses the smallest one
+// covering a fragment.
+type ShadowRender struct {
+	shader *glhf.Shader
+	fbo    uint32
+	depth  uint32
+
+	mats [shadowCascades]mgl32.Mat4
+}
+
+func NewShadowRender() (*ShadowRender, error) {
+	r := &ShadowRender{}
+	var err error
+	mainthread.Call(func() {
+		r.shader, err = glhf.NewShader(glhf.AttrFormat{
+			glhf.Attr{Name: "pos", Type: glhf.Vec3},
+			glhf.Attr{Name: "tex", Type: glhf.Vec2},
+		}, glhf.AttrFormat{
+			glhf.Attr{Name: "matrix", Type: glhf.Mat4},
+		}, shadowVertexSource, shadowFragmentSource)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// init allocates the shadow maps the first time shadows are on, so the
+// presets without shadows don't pay for the memory.
+func (r *ShadowRender) init() {
+	if r.fbo != 0 {
+		return
+	}
+	gl.GenTextures(1, &r.depth)
+	gl.BindTexture(gl.TEXTURE_2D_ARRAY, r.depth)
+	gl.TexImage3D(gl.TEXTURE_2D_ARRAY, 0, gl.DEPTH_COMPONENT24, shadowSize, shadowSize, shadowCascades, 0, gl.DEPTH_COMPONENT, gl.FLOAT, nil)
+	// linear filtering of the comparison gives a soft edge of one texel
+	gl.TexParameteri(gl.TEXTURE_2D_ARRAY, gl.TEXTURE_MIN_FILTER, gl.LINEAR)
+	gl.TexParameteri(gl.TEXTURE_2D_ARRAY, gl.TEXTURE_MAG_FILTER, gl.LINEAR)
+	gl.TexParameteri(gl.TEXTURE_2D_ARRAY, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_2D_ARRAY, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_2D_ARRAY, gl.TEXTURE_COMPARE_MODE, gl.COMPARE_REF_TO_TEXTURE)
+	gl.TexParameteri(gl.TEXTURE_2D_ARRAY, gl.TEXTURE_COMPARE_FUNC, gl.LEQUAL)
+	gl.BindTexture(gl.TEXTURE_2D_ARRAY, 0)
+
+	gl.GenFramebuffers(1, &r.fbo)
+	gl.BindFramebuffer(gl.FRAMEBUFFER, r.fbo)
+	gl.DrawBuffer(gl.NONE)
+	gl.ReadBuffer(gl.NONE)
+	gl.FramebufferTextureLayer(gl.FRAMEBUFFER, gl.DEPTH_ATTACHMENT, r.depth, 0, 0)
+	if status := gl.CheckFramebufferStatus(gl.FRAMEBUFFER); status != gl.FRAMEBUFFER_COMPLETE {
+		gpuLog.Warnf("shadow framebuffer incomplete:0x%x, shadows off", status)
+		shadowBroken = true
+		settings.Shadows = false
+	}
+	gl.BindFramebuffer(gl.FRAMEBUFFER, 0)
+}
+
+// cascadeMat returns the sun projection of the square of half width extent
+// centered on center, snapped to the texels so the shadow edges don't
+// shimmer when the player moves.
+func cascadeMat(center mgl32.Vec3, extent float32) mgl32.Mat4 {
+	view := mgl32.LookAtV(sunDir, mgl32.Vec3{0, 0, 0}, mgl32.Vec3{0, 1, 0})
+	c := view.Mul4x1(center.Vec4(1))
+	texel := 2 * extent / shadowSize
+	x := geom.Floor(c.X()/texel) * texel
+	y := geom.Floor(c.Y()/texel) * texel
+	// the view looks down -z
+	d := -c.Z()
+	proj := mgl32.Ortho(x-extent, x+extent, y-extent, y+extent, d-shadowDepth, d+shadowDepth)
+	return proj.Mul4(view)
+}
+
+// Draw renders the shadow maps, call on mainthread before drawing the world.
+func (r *ShadowRender) Draw() {
+	if !settings.Shadows {
+		return
+	}
+	r.init()
+	if !settings.Shadows {
+		return
+	}
+
+	// center the cascades a bit ahead of the player where most of the view is
+	pos := game.camera.Pos()
+	front := game.camera.Front()
+	ahead := mgl32.Vec3{front.X(), 0, front.Z()}
+	if ahead.Len() > 0 {
+		ahead = ahead.Normalize()
+	}
+	maxExtent := float32(render.Radius() * world.ChunkWidth)
+	for i, extent := range shadowExtents {
+		if extent > maxExtent {
+			extent = maxExtent
+		}
+		r.mats[i] = cascadeMat(pos.Add(ahead.Mul(extent/2)), extent)
+	}
+
+	gl.BindFramebuffer(gl.FRAMEBUFFER, r.fbo)
+	gl.Viewport(0, 0, shadowSize, shadowSize)
+	gl.Enable(gl.POLYGON_OFFSET_FILL)
+	gl.PolygonOffset(2, 4)
+	// both faces cast so a thin wall shades the ground behind it
+	gl.Disable(gl.CULL_FACE)
+	r.shader.Begin()
+	game.blockRender.Texture().Begin()
+	for i, mat := range r.mats {
+		gl.FramebufferTextureLayer(gl.FRAMEBUFFER, gl.DEPTH_ATTACHMENT, r.depth, 0, int32(i))
+		gl.Clear(gl.DEPTH_BUFFER_BIT)
+		r.shader.SetUniformAttr(0, mat)
+		game.blockRender.DrawMeshes(mat)
+		for _, p := range game.playerRender.players {
+			r.shader.SetUniformAttr(0, mat.Mul4(p.computeMat()))
+			p.mesh.Draw()
+		}
+	}
+	game.blockRender.Texture().End()
+	r.shader.End()
+	gl.Disable(gl.POLYGON_OFFSET_FILL)
+	gl.Enable(gl.CULL_FACE)
+	gl.BindFramebuffer(gl.FRAMEBUFFER, 0)
+	width, height := game.win.GetFramebufferSize()
+	gl.Viewport(0, 0, int32(width), int32(height))
+}
+
+// bind sets the shadow uniforms of the block shader, call between Begin and
+// End of the block shader.
+func (r *ShadowRender) bind(shader *glhf.Shader) {
+	if !settings.Shadows || r.fbo == 0 {
+		shader.SetUniformAttr(11, float32(0))
+		return
+	}
+	gl.ActiveTexture(gl.TEXTURE2)
+	gl.BindTexture(gl.TEXTURE_2D_ARRAY, r.depth)
+	gl.ActiveTexture(gl.TEXTURE0)
+	shader.SetUniformAttr(11, float32(1))
+	for i, mat := range r.mats {
+		shader.SetUniformAttr(12+i, mat)
+	}
+}
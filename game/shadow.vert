@@ -0,0 +1,14 @@
+#version 330 core
+
+// same locations as the block and player shaders to draw their meshes
+layout(location = 0) in vec3 pos;
+layout(location = 1) in vec2 tex;
+
+uniform mat4 matrix;
+
+out vec2 Tex;
+
+void main() {
+    gl_Position = matrix * vec4(pos, 1.0);
+    Tex = tex;
+}
@@ -0,0 +1,149 @@
+package game
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/icexin/gocraft/world"
+)
+
+const (
+	// falling below it kills the player
+	voidHeight = -64
+	// highest block looked up when placing the player on the ground
+	maxGroundHeight = 128
+
+	maxHealth = 20
+)
+
+func init() {
+	RegisterCommand(&Command{
+		Name:  "spawn",
+		Usage: "/spawn",
+		Run: func(g *Game, args *Args) (string, error) {
+			if err := args.Err(); err != nil {
+				return "", err
+			}
+			g.Respawn()
+			return "teleported to spawn", nil
+		},
+	})
+	RegisterCommand(&Command{
+		Name:  "setspawn",
+		Usage: "/setspawn",
+		Run: func(g *Game, args *Args) (string, error) {
+			if err := args.Err(); err != nil {
+				return "", err
+			}
+			err := saveSpawn(Spawn{PlayerState: g.camera.State()})
+			if err != nil {
+				return "", err
+			}
+			return "spawn point set", nil
+		},
+	})
+}
+
+// Spawn is the respawn location of the player, set by /setspawn or a bed.
+type Spawn struct {
+	PlayerState
+	// the bed block, the spawn is dropped when the bed is gone
+	HasBed     int32
+	BX, BY, BZ int32
+}
+
+// saveSpawn saves the spawn of the player slot, its fields in little endian.
+func saveSpawn(spawn Spawn) error {
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.LittleEndian, &spawn)
+	return db.UpdateSpawn(buf.Bytes())
+}
+
+// loadSpawn returns the saved spawn, false if there is none.
+func loadSpawn() (Spawn, bool) {
+	var spawn Spawn
+	value := db.GetSpawn()
+	if value == nil {
+		return spawn, false
+	}
+	ok := binary.Read(bytes.NewBuffer(value), binary.LittleEndian, &spawn) == nil
+	return spawn, ok
+}
+
+// groundState returns a state standing on the highest block at x, z.
+func (g *Game) groundState(x, z int) PlayerState {
+	y := maxGroundHeight
+	for ; y > 0; y-- {
+		if world.IsObstacle(g.world.Block(world.Vec3{X: x, Y: y, Z: z})) {
+			break
+		}
+	}
+	return PlayerState{X: float32(x), Y: float32(y + 2), Z: float32(z), Rx: -90}
+}
+
+// spawnState returns where the player respawns, the world origin unless a
+// spawn was set, spawns set by a bed are dropped when the bed is broken.
+func (g *Game) spawnState() PlayerState {
+	spawn, ok := loadSpawn()
+	if !ok {
+		return g.groundState(0, 0)
+	}
+	if spawn.HasBed != 0 {
+		bed := world.Vec3{X: int(spawn.BX), Y: int(spawn.BY), Z: int(spawn.BZ)}
+		if g.world.Block(bed) != world.Bed {
+			gameLog.Infof("bed at %v is gone, respawn at world spawn", bed)
+			return g.groundState(0, 0)
+		}
+	}
+	return spawn.PlayerState
+}
+
+// useBed sets the spawn on top of the bed block id.
+func (g *Game) useBed(id world.Vec3) {
+	state := g.camera.State()
+	state.X, state.Y, state.Z = float32(id.X), float32(id.Y+2), float32(id.Z)
+	err := saveSpawn(Spawn{
+		PlayerState: state,
+		HasBed:      1,
+		BX:          int32(id.X),
+		BY:          int32(id.Y),
+		BZ:          int32(id.Z),
+	})
+	if err != nil {
+		storeLog.Errorf("set spawn error:%s", err)
+		return
+	}
+	g.console.Print("respawn point set")
+}
+
+// Respawn moves the player back to the spawn point.
+func (g *Game) Respawn() {
+	s := g.spawnState()
+	g.camera.Restore(s)
+	g.vy = 0
+	g.mining.active = false
+}
+
+// Die respawns the player, reason is shown in the title.
+func (g *Game) Die(reason string) {
+	gameLog.Infof("player died:%s", reason)
+	events.Publish(Death{reason})
+	g.Respawn()
+	g.health = maxHealth
+	g.console.Print(reason)
+}
+
+// Damage hurts the player, reason is the death message.
+func (g *Game) Damage(amount int, reason string) {
+	g.health -= amount
+	events.Publish(Damage{amount, reason})
+	if g.health <= 0 {
+		g.Die(reason)
+	}
+}
+
+func (g *Game) checkDeath() {
+	if g.camera.Pos().Y() < voidHeight {
+		g.Die("fell out of the world")
+	}
+}
@@ -0,0 +1,288 @@
+package game
+
+import (
+	"container/heap"
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/faiface/mainthread"
+	"github.com/icexin/gocraft/render"
+	"github.com/icexin/gocraft/world"
+)
+
+const (
+	tickRate = 20 // simulation ticks per second
+	// blocks picked per tick in every 32x32x32 section of the loaded chunks,
+	// the default random tick speed of a world
+	randomTicksPerSection = 24
+
+	// bounds of /tick rate, speed and step
+	minTickRate  = 0.1
+	maxTickRate  = 200
+	maxTickSpeed = 4096
+	maxTickSteps = 10000
+)
+
+var (
+	// blockTickers are called when a scheduled tick of a block type is due.
+	blockTickers = make(map[int]func(g *Game, id world.Vec3))
+	// randomTickers are called when a block of the type is picked by the random tick.
+	randomTickers = make(map[int]func(g *Game, id world.Vec3))
+)
+
+type scheduledTick struct {
+	id  world.Vec3
+	due uint64
+	seq uint64 // keeps the ticks due at the same time in schedule order
+}
+
+type tickQueue []scheduledTick
+
+func (q tickQueue) Len() int { return len(q) }
+func (q tickQueue) Less(i, j int) bool {
+	if q[i].due != q[j].due {
+		return q[i].due < q[j].due
+	}
+	return q[i].seq < q[j].seq
+}
+func (q tickQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *tickQueue) Push(x interface{}) { *q = append(*q, x.(scheduledTick)) }
+func (q *tickQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	x := old[n-1]
+	*q = old[:n-1]
+	return x
+}
+
+// Ticker runs the block simulation at a fixed rate on its own clock, the
+// ticks don't depend on the frame rate. The ticks run on mainthread and the
+// randomness comes from a generator seeded by the world seed, so the same
+// world and the same edits give the same simulation.
+type Ticker struct {
+	tick  uint64
+	seq   uint64
+	queue tickQueue
+	rand  *rand.Rand
+
+	// set by /tick for debugging, the rendering keeps its own pace
+	rate   float64 // ticks per second
+	frozen bool
+	// steps of /tick step left, run a few every frame
+	steps int
+	// when the last tick ran, the rendering interpolates in between
+	stepped time.Time
+	// random ticks per section, saved with the world
+	randomSpeed int
+}
+
+func init() {
+	RegisterCommand(&Command{
+		Name:  "tick",
+		Usage: "/tick [rate N|default, freeze, step [N], speed N]",
+		Run: func(g *Game, args *Args) (string, error) {
+			return g.ticker.command(g, args)
+		},
+	})
+}
+
+// Restore loads the random tick speed of the world, call before Loop.
+func (t *Ticker) Restore() {
+	t.rate = tickRate
+	t.randomSpeed = randomTicksPerSection
+	if speed, ok := db.GetRandomTickSpeed(); ok {
+		t.randomSpeed = speed
+	}
+}
+
+func (t *Ticker) command(g *Game, args *Args) (string, error) {
+	if args.Len() == 0 {
+		return fmt.Sprintf("tick %d, %g ticks/s, random speed %d%s", t.tick, t.rate, t.randomSpeed, t.Status()), nil
+	}
+	switch args.Choice("command", "rate", "freeze", "step", "speed") {
+	case "rate":
+		rate := float64(tickRate)
+		if args.Peek() == "default" {
+			args.String("rate")
+		} else {
+			rate = args.Float("rate")
+			args.Range("rate", rate, minTickRate, maxTickRate)
+		}
+		if err := args.Err(); err != nil {
+			return "", err
+		}
+		t.rate = rate
+		return fmt.Sprintf("tick rate %g/s", t.rate), nil
+	case "freeze":
+		if err := args.Err(); err != nil {
+			return "", err
+		}
+		t.frozen = !t.frozen
+		if t.frozen {
+			return fmt.Sprintf("ticks frozen at %d", t.tick), nil
+		}
+		return "ticks running", nil
+	case "step":
+		n := 1
+		if args.Len() > 0 {
+			n = args.Int("steps")
+			args.Range("steps", float64(n), 1, maxTickSteps)
+		}
+		if err := args.Err(); err != nil {
+			return "", err
+		}
+		// the first step runs now, the others within the frame budget
+		t.step(g)
+		n--
+		if n == 0 {
+			return fmt.Sprintf("stepped to tick %d", t.tick), nil
+		}
+		if t.steps == 0 {
+			render.FrameTasks.Post(func() { t.runSteps(g) })
+		}
+		t.steps += n
+		if t.steps > maxTickSteps {
+			t.steps = maxTickSteps
+		}
+		return fmt.Sprintf("stepping to tick %d", t.tick+uint64(t.steps)), nil
+	case "speed":
+		speed := args.Int("speed")
+		args.Range("speed", float64(speed), 0, maxTickSpeed)
+		if err := args.Err(); err != nil {
+			return "", err
+		}
+		t.randomSpeed = speed
+		if err := db.UpdateRandomTickSpeed(t.randomSpeed); err != nil {
+			storeLog.Errorf("save random tick speed error:%s", err)
+		}
+		return fmt.Sprintf("random tick speed %d", t.randomSpeed), nil
+	}
+	return "", args.Err()
+}
+
+// Status returns the tick controls changed by /tick for the window title.
+func (t *Ticker) Status() string {
+	s := ""
+	if t.rate != tickRate {
+		s += fmt.Sprintf(" tick:%g/s", t.rate)
+	}
+	if t.frozen {
+		s += " frozen"
+	}
+	if t.steps > 0 {
+		s += fmt.Sprintf(" stepping:%d", t.steps)
+	}
+	return s
+}
+
+// runSteps runs one of the steps left and queues itself again, the frame
+// tasks run it as long as the frame budget allows.
+func (t *Ticker) runSteps(g *Game) {
+	if t.steps == 0 {
+		return
+	}
+	t.step(g)
+	t.steps--
+	if t.steps > 0 {
+		render.FrameTasks.Post(func() { t.runSteps(g) })
+	}
+}
+
+// Schedule ticks block id after delay ticks, call on mainthread.
+func (t *Ticker) Schedule(id world.Vec3, delay int) {
+	if delay < 1 {
+		delay = 1
+	}
+	t.seq++
+	heap.Push(&t.queue, scheduledTick{id: id, due: t.tick + uint64(delay), seq: t.seq})
+}
+
+// Rand returns the random generator of the simulation, tickers should use it
+// instead of the global one, call on mainthread.
+func (t *Ticker) Rand() *rand.Rand {
+	if t.rand == nil {
+		t.rand = rand.New(rand.NewSource(world.Seed))
+	}
+	return t.rand
+}
+
+// Loop runs the ticks until the program exits, a busy main thread slows the
+// simulation down instead of queueing up ticks.
+func (t *Ticker) Loop(g *Game) {
+	defer crashGuard()
+	interval := time.Second / tickRate
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for range tick.C {
+		next := interval
+		mainthread.Call(func() {
+			if !t.frozen {
+				t.step(g)
+			}
+			next = time.Duration(float64(time.Second) / t.rate)
+		})
+		if next != interval {
+			interval = next
+			tick.Reset(interval)
+		}
+	}
+}
+
+func (t *Ticker) step(g *Game) {
+	t.tick++
+	t.stepped = time.Now()
+	for len(t.queue) > 0 && t.queue[0].due <= t.tick {
+		s := heap.Pop(&t.queue).(scheduledTick)
+		if f, ok := blockTickers[g.world.Block(s.id)]; ok {
+			f(g, s.id)
+		}
+	}
+	t.randomTick(g)
+	g.stepFalling()
+	g.entities.Tick(g)
+}
+
+// Partial returns the part of the current tick elapsed in [0, 1], 1 when
+// frozen, used to draw the moves of the ticks smoothly.
+func (t *Ticker) Partial() float32 {
+	if t.frozen {
+		return 1
+	}
+	p := float32(time.Since(t.stepped).Seconds() * t.rate)
+	if p > 1 {
+		return 1
+	}
+	return p
+}
+
+// randomTick picks random blocks of the loaded chunks and calls their random tickers.
+func (t *Ticker) randomTick(g *Game) {
+	if len(randomTickers) == 0 {
+		return
+	}
+	chunks := g.world.LoadedChunks()
+	sort.Slice(chunks, func(i, j int) bool {
+		a, b := chunks[i].Id(), chunks[j].Id()
+		if a.X != b.X {
+			return a.X < b.X
+		}
+		return a.Z < b.Z
+	})
+	r := t.Rand()
+	for _, chunk := range chunks {
+		cid := chunk.Id()
+		sections := chunk.Top()/world.ChunkWidth + 1
+		for i := 0; i < sections*t.randomSpeed; i++ {
+			id := world.Vec3{
+				X: cid.X*world.ChunkWidth + r.Intn(world.ChunkWidth),
+				Y: r.Intn(sections * world.ChunkWidth),
+				Z: cid.Z*world.ChunkWidth + r.Intn(world.ChunkWidth),
+			}
+			if f, ok := randomTickers[chunk.Block(id)]; ok {
+				f(g, id)
+			}
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package game
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-gl/gl/v3.3-core/gl"
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/icexin/gocraft/internal/geom"
+)
+
+const (
+	defaultOrbitRadius = 24
+	maxOrbitRadius     = 128
+	orbitHeight        = 0.5  // of the radius, above the center
+	orbitStep          = 2    // degrees per saved frame
+	minLapseInterval   = 0.05 // seconds
+)
+
+// Timelapse saves a numbered sequence of frames at a regular interval of
+// time or simulation ticks, seen from the camera fixed at the start or
+// orbiting the block looked at. The frames are drawn before the player view
+// and never shown, the player keeps playing meanwhile.
+type Timelapse struct {
+	active bool
+	dir    string
+	frame  int
+
+	// one of them is set
+	interval float64 // seconds
+	ticks    uint64
+	next     float64
+	nextTick uint64
+
+	view   PlayerState
+	orbit  bool
+	center mgl32.Vec3
+	radius float32
+	angle  float32 // degrees
+}
+
+func init() {
+	RegisterCommand(&Command{
+		Name:  "timelapse",
+		Usage: "/timelapse start <seconds|Nt> [fixed|orbit [radius]] | stop",
+		Run: func(g *Game, args *Args) (string, error) {
+			return g.timelapse.command(g, args)
+		},
+	})
+}
+
+func (t *Timelapse) command(g *Game, args *Args) (string, error) {
+	if args.Len() == 0 {
+		if !t.active {
+			return "no timelapse", nil
+		}
+		return fmt.Sprintf("timelapse %s, %d frames", t.dir, t.frame), nil
+	}
+	switch args.Choice("command", "start", "stop") {
+	case "start":
+		every := args.String("interval")
+		var (
+			seconds float64
+			ticks   int
+			err     error
+		)
+		if strings.HasSuffix(every, "t") {
+			ticks, err = strconv.Atoi(strings.TrimSuffix(every, "t"))
+			if err != nil || ticks < 1 {
+				return "", &ArgError{Usage: args.cmd.Usage, Name: "interval", Value: every, Want: tr("an integer")}
+			}
+		} else {
+			seconds, err = strconv.ParseFloat(every, 64)
+			if err != nil || seconds < minLapseInterval {
+				return "", &ArgError{Usage: args.cmd.Usage, Name: "interval", Value: every, Want: tr("a number")}
+			}
+		}
+		orbit, radius := false, float64(defaultOrbitRadius)
+		if args.Len() > 0 {
+			orbit = args.Choice("view", "fixed", "orbit") == "orbit"
+			if orbit && args.Len() > 0 {
+				radius = args.Float("radius")
+				args.Range("radius", radius, 1, maxOrbitRadius)
+			}
+		}
+		if err := args.Err(); err != nil {
+			return "", err
+		}
+		if err := t.start(g, seconds, uint64(ticks), orbit, float32(radius)); err != nil {
+			return "", err
+		}
+		return "timelapse to " + t.dir, nil
+	case "stop":
+		if err := args.Err(); err != nil {
+			return "", err
+		}
+		if !t.active {
+			return "no timelapse", nil
+		}
+		t.active = false
+		return fmt.Sprintf("saved %d frames in %s", t.frame, t.dir), nil
+	}
+	return "", args.Err()
+}
+
+func (t *Timelapse) start(g *Game, seconds float64, ticks uint64, orbit bool, radius float32) error {
+	dir := "timelapse-" + time.Now().Format("20060102-150405")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	*t = Timelapse{
+		active:   true,
+		dir:      dir,
+		interval: seconds,
+		ticks:    ticks,
+		view:     g.camera.State(),
+		orbit:    orbit,
+		radius:   radius,
+	}
+	// orbit around the block in sight, or the player if there is none
+	t.center = g.camera.Pos()
+	if block, _ := g.world.HitTest(g.camera.Pos(), g.camera.Front()); block != nil {
+		t.center = mgl32.Vec3{float32(block.X), float32(block.Y), float32(block.Z)}
+	}
+	return nil
+}
+
+// due reports whether a frame must be captured now.
+func (t *Timelapse) due(g *Game, now float64) bool {
+	if !t.active {
+		return false
+	}
+	if t.ticks != 0 {
+		if g.ticker.tick < t.nextTick {
+			return false
+		}
+		t.nextTick = g.ticker.tick + t.ticks
+		return true
+	}
+	if now < t.next {
+		return false
+	}
+	t.next = now + t.interval
+	return true
+}
+
+// orbitView returns the camera on the orbit looking at the center.
+func (t *Timelapse) orbitView() PlayerState {
+	a := float64(geom.Radian(t.angle))
+	pos := t.center.Add(mgl32.Vec3{
+		t.radius * float32(math.Cos(a)),
+		t.radius * orbitHeight,
+		t.radius * float32(math.Sin(a)),
+	})
+	d := t.center.Sub(pos).Normalize()
+	return PlayerState{
+		X:  pos.X(),
+		Y:  pos.Y(),
+		Z:  pos.Z(),
+		Rx: mgl32.RadToDeg(float32(math.Atan2(float64(d.Z()), float64(d.X())))),
+		Ry: mgl32.RadToDeg(float32(math.Asin(float64(d.Y())))),
+	}
+}
+
+// Capture draws a frame from the timelapse camera and saves it in the
+// background when it's due, call on mainthread before drawing the frame.
+func (t *Timelapse) Capture(g *Game, now float64) {
+	if !t.due(g, now) {
+		return
+	}
+	view := t.view
+	if t.orbit {
+		view = t.orbitView()
+		t.angle = float32(math.Mod(float64(t.angle+orbitStep), 360))
+	}
+	state := g.camera.State()
+	g.camera.Restore(view)
+	g.postRender.Begin()
+	sky := skyColor()
+	gl.ClearColor(sky.X(), sky.Y(), sky.Z(), 1)
+	gl.Clear(gl.COLOR_BUFFER_BIT | gl.DEPTH_BUFFER_BIT)
+	g.lodRender.Draw()
+	g.blockRender.Draw(g.frame())
+	g.playerRender.Draw()
+	g.postRender.End()
+	img := readScreen()
+	g.camera.Restore(state)
+
+	t.frame++
+	name := filepath.Join(t.dir, fmt.Sprintf("frame-%05d.png", t.frame))
+	go func() {
+		if err := savePNG(name, img); err != nil {
+			gameLog.Errorf("timelapse error:%s", err)
+		}
+	}()
+}
+
+// Status returns the timelapse state for the window title.
+func (t *Timelapse) Status() string {
+	if !t.active {
+		return ""
+	}
+	return fmt.Sprintf(" timelapse:%d", t.frame)
+}
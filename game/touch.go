@@ -0,0 +1,253 @@
+package game
+
+import (
+	"math"
+
+	"github.com/faiface/glhf"
+	"github.com/go-gl/glfw/v3.2/glfw"
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/icexin/gocraft/render"
+)
+
+var (
+	touchEnabled = flags.Bool("touch", false, "on-screen touch controls, for tablets")
+)
+
+const (
+	touchTapTime   = 0.25 // seconds, a shorter press places the held item
+	touchLongPress = 0.4  // seconds, a longer press breaks the block
+	touchSlop      = 10   // pixels a press can move and still be a tap
+	touchLookSens  = 0.5  // look speed relative to the mouse
+	touchDeadZone  = 0.2  // fraction of the joystick radius
+)
+
+func init() {
+	RegisterCommand(&Command{
+		Name:  "touch",
+		Usage: "/touch on|off",
+		Run: func(g *Game, args *Args) (string, error) {
+			on := args.Switch("state")
+			if err := args.Err(); err != nil {
+				return "", err
+			}
+			g.setTouch(on)
+			if on {
+				return "touch controls on", nil
+			}
+			return "touch controls off", nil
+		},
+	})
+}
+
+func (g *Game) setTouch(on bool) {
+	g.touch.Reset(g)
+	*touchEnabled = on
+	g.setExclusiveMouse(false)
+}
+
+type touchRole int
+
+const (
+	touchStick touchRole = iota
+	touchLook
+	touchButton
+)
+
+// touchPoint is a finger on the screen, or the left mouse button when the
+// touch controls are used on desktop.
+type touchPoint struct {
+	role        touchRole
+	start, last mgl32.Vec2
+	at          float64
+	moved       bool
+	mining      bool
+}
+
+// TouchControls maps pointer events to the player controls. A press on the
+// left half of the screen starts a virtual joystick, dragging on the right
+// half looks around, a tap there places the held item and a long press
+// breaks the block under the cross. Jump and fly are buttons at the bottom
+// right. Pointers are identified by id so a touch screen can drive several
+// at once.
+type TouchControls struct {
+	points map[int]*touchPoint
+}
+
+// touchLayout returns the jump and fly button centers, the button radius
+// and the joystick radius in a w x h window.
+func touchLayout(w, h float32) (jump, fly mgl32.Vec2, button, stick float32) {
+	button = h / 14 * settings.UIScale
+	stick = h / 8 * settings.UIScale
+	jump = mgl32.Vec2{w - 2*button, h - 2*button}
+	fly = mgl32.Vec2{w - 2*button, h - 5*button}
+	return
+}
+
+func (t *TouchControls) Down(g *Game, id int, x, y float32) {
+	if t.points == nil {
+		t.points = make(map[int]*touchPoint)
+	}
+	w, h := g.win.GetSize()
+	jump, fly, button, _ := touchLayout(float32(w), float32(h))
+	p := mgl32.Vec2{x, y}
+	pt := &touchPoint{
+		start: p,
+		last:  p,
+		at:    glfw.GetTime(),
+	}
+	switch {
+	case p.Sub(jump).Len() < button:
+		pt.role = touchButton
+		g.jump()
+	case p.Sub(fly).Len() < button:
+		pt.role = touchButton
+		g.toggleFlying()
+	case x < float32(w)/2:
+		pt.role = touchStick
+	default:
+		pt.role = touchLook
+	}
+	t.points[id] = pt
+}
+
+func (t *TouchControls) Move(g *Game, id int, x, y float32) {
+	pt, ok := t.points[id]
+	if !ok {
+		return
+	}
+	p := mgl32.Vec2{x, y}
+	if p.Sub(pt.start).Len() > touchSlop {
+		pt.moved = true
+	}
+	if pt.role == touchLook {
+		d := p.Sub(pt.last).Mul(touchLookSens)
+		g.camera.OnAngleChange(d.X(), -d.Y())
+	}
+	pt.last = p
+}
+
+func (t *TouchControls) Up(g *Game, id int) {
+	pt, ok := t.points[id]
+	if !ok {
+		return
+	}
+	delete(t.points, id)
+	if pt.role != touchLook {
+		return
+	}
+	if pt.mining {
+		g.stopMining()
+		return
+	}
+	if !pt.moved && glfw.GetTime()-pt.at < touchTapTime {
+		g.viewModel.Swing()
+		g.useItem()
+	}
+}
+
+// Reset lifts all the pointers.
+func (t *TouchControls) Reset(g *Game) {
+	for id := range t.points {
+		t.Up(g, id)
+	}
+}
+
+// Update walks by the joystick and starts mining on a long press, speed is
+// the walking speed of a full stick.
+func (t *TouchControls) Update(g *Game, speed float32) {
+	now := glfw.GetTime()
+	w, h := g.win.GetSize()
+	_, _, _, stick := touchLayout(float32(w), float32(h))
+	for _, pt := range t.points {
+		switch pt.role {
+		case touchStick:
+			d := stickOffset(pt, stick).Mul(1 / stick)
+			if d.Len() < touchDeadZone {
+				continue
+			}
+			if d.Y() < 0 {
+				g.camera.OnMoveChange(MoveForward, -d.Y()*speed)
+			} else {
+				g.camera.OnMoveChange(MoveBackward, d.Y()*speed)
+			}
+			if d.X() < 0 {
+				g.camera.OnMoveChange(MoveLeft, -d.X()*speed)
+			} else {
+				g.camera.OnMoveChange(MoveRight, d.X()*speed)
+			}
+		case touchLook:
+			if !pt.moved && !pt.mining && now-pt.at >= touchLongPress {
+				pt.mining = true
+				g.viewModel.Swing()
+				g.startMining()
+			}
+		}
+	}
+}
+
+// stickOffset returns the knob offset from the joystick center clamped to
+// the joystick radius.
+func stickOffset(pt *touchPoint, stick float32) mgl32.Vec2 {
+	d := pt.last.Sub(pt.start)
+	if n := d.Len(); n > stick {
+		d = d.Mul(stick / n)
+	}
+	return d
+}
+
+// makeCircle makes a unit circle of n segments.
+func makeCircle(shader *glhf.Shader, n int) *render.Lines {
+	var data []float32
+	for i := 0; i < n; i++ {
+		a0 := 2 * math.Pi * float64(i) / float64(n)
+		a1 := 2 * math.Pi * float64(i+1) / float64(n)
+		data = append(data,
+			float32(math.Cos(a0)), float32(math.Sin(a0)), 0,
+			float32(math.Cos(a1)), float32(math.Sin(a1)), 0,
+		)
+	}
+	return render.NewLines(shader, data)
+}
+
+// makeChevron makes an arrow head pointing up.
+func makeChevron(shader *glhf.Shader) *render.Lines {
+	return render.NewLines(shader, []float32{
+		-0.4, 0.2, 0, 0, -0.2, 0,
+		0, -0.2, 0, 0.4, 0.2, 0,
+	})
+}
+
+// drawTouch draws the joystick and the buttons, call between Begin and End
+// of the line shader.
+func (r *LineRender) drawTouch() {
+	w, h := game.win.GetSize()
+	project := mgl32.Ortho2D(0, float32(w), float32(h), 0)
+	jump, fly, button, stick := touchLayout(float32(w), float32(h))
+	circle := func(c mgl32.Vec2, radius float32) {
+		m := mgl32.Translate3D(c.X(), c.Y(), 0).Mul4(mgl32.Scale3D(radius, radius, 0))
+		r.circle.Draw(project.Mul4(m))
+	}
+	chevron := func(c mgl32.Vec2) {
+		m := mgl32.Translate3D(c.X(), c.Y(), 0).Mul4(mgl32.Scale3D(button, button, 0))
+		r.chevron.Draw(project.Mul4(m))
+	}
+
+	// the joystick rests at the bottom left until a finger moves it
+	center := mgl32.Vec2{stick * 1.5, float32(h) - stick*1.5}
+	var knob mgl32.Vec2
+	for _, pt := range game.touch.points {
+		if pt.role == touchStick {
+			center = pt.start
+			knob = stickOffset(pt, stick)
+			break
+		}
+	}
+	circle(center, stick)
+	circle(center.Add(knob), stick/3)
+
+	circle(jump, button)
+	chevron(jump)
+	circle(fly, button)
+	chevron(fly.Sub(mgl32.Vec2{0, button / 4}))
+	chevron(fly.Add(mgl32.Vec2{0, button / 4}))
+}
@@ -0,0 +1,152 @@
+package game
+
+import (
+	"math/rand"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/icexin/gocraft/render"
+	"github.com/icexin/gocraft/world"
+)
+
+const (
+	// mean time between two storms and their length, in seconds
+	stormInterval  = 1200
+	minStormLength = 120
+	maxStormLength = 300
+
+	// lightning strikes every minStrikeDelay to maxStrikeDelay seconds during a storm
+	minStrikeDelay = 4
+	maxStrikeDelay = 15
+	strikeRadius   = 48
+	boltHeight     = 64
+	boltTime       = 0.3 // seconds a bolt stays on screen
+
+	flashBoost = 0.6 // extra sky brightness of a strike
+	flashTime  = 0.4
+
+	stormWind = 2.5 // plants wave that much more during a storm
+)
+
+// Weather holds the thunderstorm state, call on mainthread.
+type Weather struct {
+	storm      bool
+	stormEnd   float64
+	nextStrike float64
+	flash      float32
+	bolts      []*lightningBolt
+}
+
+type lightningBolt struct {
+	lines *render.Lines
+	ttl   float64
+}
+
+func init() {
+	RegisterCommand(&Command{
+		Name:  "weather",
+		Usage: "/weather clear|thunder",
+		Run: func(g *Game, args *Args) (string, error) {
+			weather := args.Choice("weather", "clear", "thunder")
+			if err := args.Err(); err != nil {
+				return "", err
+			}
+			g.weather.SetStorm(weather == "thunder", g.prevtime)
+			return "weather set to " + weather, nil
+		},
+	})
+}
+
+func (w *Weather) SetStorm(storm bool, now float64) {
+	w.storm = storm
+	if storm {
+		w.stormEnd = now + minStormLength + rand.Float64()*(maxStormLength-minStormLength)
+		w.nextStrike = now + minStrikeDelay
+	}
+	gameLog.Infof("thunderstorm:%v", storm)
+}
+
+// Brightness returns the sky brightness factor, raised by lightning flashes.
+func (w *Weather) Brightness() float32 {
+	return 1 + w.flash
+}
+
+// Wind returns the strength of the wind waving the plants and leaves.
+func (w *Weather) Wind() float32 {
+	if w.storm {
+		return stormWind
+	}
+	return 1
+}
+
+func (w *Weather) Update(g *Game, now, dt float64) {
+	w.flash -= float32(dt / flashTime * flashBoost)
+	if w.flash < 0 {
+		w.flash = 0
+	}
+	bolts := w.bolts[:0]
+	for _, b := range w.bolts {
+		b.ttl -= dt
+		if b.ttl > 0 {
+			bolts = append(bolts, b)
+		} else {
+			b.lines.Release()
+		}
+	}
+	w.bolts = bolts
+
+	if !w.storm {
+		if rand.Float64() < dt/stormInterval {
+			w.SetStorm(true, now)
+		}
+		return
+	}
+	if now > w.stormEnd {
+		w.SetStorm(false, now)
+		return
+	}
+	if now < w.nextStrike {
+		return
+	}
+	w.nextStrike = now + minStrikeDelay + rand.Float64()*(maxStrikeDelay-minStrikeDelay)
+	p := world.NearBlock(g.camera.Pos())
+	x := p.X + rand.Intn(2*strikeRadius) - strikeRadius
+	z := p.Z + rand.Intn(2*strikeRadius) - strikeRadius
+	w.strike(g, x, z)
+}
+
+// strike hits the highest block at x, z and sets fire on top of it.
+func (w *Weather) strike(g *Game, x, z int) {
+	if g.world.Block(world.Vec3{X: x, Y: 0, Z: z}) == -1 {
+		// chunk not loaded
+		return
+	}
+	s := g.groundState(x, z)
+	top := world.Vec3{X: x, Y: int(s.Y) - 1, Z: z}
+	gameLog.Debugf("lightning strikes %v", top)
+	g.Ignite(top)
+	w.flash = flashBoost
+	w.bolts = append(w.bolts, &lightningBolt{
+		lines: render.NewLines(g.lineRender.shader, makeBoltData(top)),
+		ttl:   boltTime,
+	})
+}
+
+// makeBoltData makes a jagged line from the sky down to the block top.
+func makeBoltData(top world.Vec3) []float32 {
+	var vertices []float32
+	prev := mgl32.Vec3{float32(top.X), float32(top.Y + boltHeight), float32(top.Z)}
+	for y := top.Y + boltHeight - 4; y > top.Y; y -= 4 {
+		next := mgl32.Vec3{
+			float32(top.X) + rand.Float32()*3 - 1.5,
+			float32(y),
+			float32(top.Z) + rand.Float32()*3 - 1.5,
+		}
+		vertices = append(vertices, prev[:]...)
+		vertices = append(vertices, next[:]...)
+		prev = next
+	}
+	end := mgl32.Vec3{float32(top.X), float32(top.Y) - 0.5, float32(top.Z)}
+	vertices = append(vertices, prev[:]...)
+	vertices = append(vertices, end[:]...)
+	return vertices
+}
@@ -0,0 +1,173 @@
+package game
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+const statsSaveInterval = 30 * time.Second
+
+// Names of the statistics in the stats bucket, the block counts are
+// "placed/<type>" and "broken/<type>".
+const (
+	statPlaced = "placed/"
+	statBroken = "broken/"
+	statWalked = "walked" // blocks
+	statPlayed = "played" // seconds
+	statDeaths = "deaths"
+)
+
+// WorldStats counts what the player did in the world, fed by the event bus
+// and saved in the store every statsSaveInterval.
+type WorldStats struct {
+	// taken across Save, the writes reach the store in order
+	saveMutex sync.Mutex
+
+	mutex    sync.Mutex
+	values   map[string]float64
+	dirty    map[string]bool
+	lastSave time.Time
+}
+
+var worldStats = &WorldStats{
+	values: make(map[string]float64),
+	dirty:  make(map[string]bool),
+}
+
+func init() {
+	events.Subscribe(EventBlockPlaced, func(e Event) {
+		worldStats.Add(statPlaced+strconv.Itoa(e.(BlockPlaced).W), 1)
+	})
+	events.Subscribe(EventBlockBroken, func(e Event) {
+		worldStats.Add(statBroken+strconv.Itoa(e.(BlockBroken).W), 1)
+	})
+	events.Subscribe(EventPlayerMoved, func(e Event) {
+		m := e.(PlayerMoved)
+		if game.camera.flying {
+			return
+		}
+		d := m.To.Sub(m.From)
+		worldStats.Add(statWalked, float64(mgl32.Vec2{d.X(), d.Z()}.Len()))
+	})
+	events.Subscribe(EventDeath, func(e Event) {
+		worldStats.Add(statDeaths, 1)
+	})
+
+	RegisterCommand(&Command{
+		Name:  "stats",
+		Usage: "/stats [placed|broken]",
+		Run: func(g *Game, args *Args) (string, error) {
+			if args.Len() == 0 {
+				return worldStats.Summary(), nil
+			}
+			kind := args.Choice("kind", "placed", "broken")
+			if err := args.Err(); err != nil {
+				return "", err
+			}
+			return worldStats.Blocks(kind + "/"), nil
+		},
+	})
+}
+
+func (s *WorldStats) Add(name string, v float64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.values[name] += v
+	s.dirty[name] = true
+}
+
+func (s *WorldStats) Get(name string) float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.values[name]
+}
+
+// Restore loads the statistics of the world from the store.
+func (s *WorldStats) Restore() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.values = db.GetStats()
+	s.lastSave = time.Now()
+}
+
+// Save adds the time played since the last save and writes the changed
+// statistics to the store.
+func (s *WorldStats) Save() {
+	s.saveMutex.Lock()
+	defer s.saveMutex.Unlock()
+	s.mutex.Lock()
+	now := time.Now()
+	s.values[statPlayed] += now.Sub(s.lastSave).Seconds()
+	s.dirty[statPlayed] = true
+	s.lastSave = now
+	changed := make(map[string]float64, len(s.dirty))
+	for name := range s.dirty {
+		changed[name] = s.values[name]
+	}
+	s.dirty = make(map[string]bool)
+	s.mutex.Unlock()
+	if err := db.UpdateStats(changed); err != nil {
+		storeLog.Errorf("save stats error:%s", err)
+	}
+}
+
+func (s *WorldStats) saveLoop() {
+	defer crashGuard()
+	tick := time.NewTicker(statsSaveInterval)
+	for range tick.C {
+		s.Save()
+	}
+}
+
+// total sums the block counts of prefix.
+func (s *WorldStats) total(prefix string) float64 {
+	var n float64
+	for name, v := range s.values {
+		if strings.HasPrefix(name, prefix) {
+			n += v
+		}
+	}
+	return n
+}
+
+func (s *WorldStats) Summary() string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	played := time.Duration(s.values[statPlayed]) * time.Second
+	played += time.Since(s.lastSave).Round(time.Second)
+	return fmt.Sprintf("played %s, walked %.0f blocks, placed %.0f, broken %.0f, deaths %.0f",
+		played, s.values[statWalked], s.total(statPlaced), s.total(statBroken), s.values[statDeaths])
+}
+
+// Blocks lists the block types of prefix by count, most first.
+func (s *WorldStats) Blocks(prefix string) string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	type count struct {
+		tp string
+		n  float64
+	}
+	var counts []count
+	for name, v := range s.values {
+		if strings.HasPrefix(name, prefix) {
+			counts = append(counts, count{strings.TrimPrefix(name, prefix), v})
+		}
+	}
+	if len(counts) == 0 {
+		return "none"
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		return counts[i].n > counts[j].n
+	})
+	var list []string
+	for _, c := range counts {
+		list = append(list, fmt.Sprintf("#%s:%.0f", c.tp, c.n))
+	}
+	return strings.Join(list, " ")
+}
@@ -9,6 +9,8 @@ require (
 	github.com/go-gl/gl v0.0.0-20190320180904-bf2b1f2f34d7
 	github.com/go-gl/glfw v0.0.0-20200222043503-6f7a984d4dc4
 	github.com/go-gl/mathgl v0.0.0-20190713194549-592312d8590a
+	github.com/golang/snappy v0.0.4
+	github.com/gorilla/websocket v1.4.2
 	github.com/hashicorp/golang-lru v0.5.4
 	github.com/icexin/gocraft-server v0.0.0-20200316021447-c466fe50ae44
 	github.com/ojrac/opensimplex-go v1.0.1
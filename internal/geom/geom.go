@@ -0,0 +1,126 @@
+package geom
+
+import "github.com/go-gl/mathgl/mgl32"
+
+// AABB is an axis aligned box.
+type AABB struct {
+	Min, Max mgl32.Vec3
+}
+
+func (b AABB) Contains(p mgl32.Vec3) bool {
+	return p.X() >= b.Min.X() && p.X() <= b.Max.X() &&
+		p.Y() >= b.Min.Y() && p.Y() <= b.Max.Y() &&
+		p.Z() >= b.Min.Z() && p.Z() <= b.Max.Z()
+}
+
+func (b AABB) Intersects(o AABB) bool {
+	return b.Min.X() <= o.Max.X() && b.Max.X() >= o.Min.X() &&
+		b.Min.Y() <= o.Max.Y() && b.Max.Y() >= o.Min.Y() &&
+		b.Min.Z() <= o.Max.Z() && b.Max.Z() >= o.Min.Z()
+}
+
+// Plane is the set of points p with Normal.Dot(p) + D == 0, points in
+// front of the plane have a positive distance.
+type Plane struct {
+	Normal mgl32.Vec3
+	D      float32
+}
+
+func (p Plane) Distance(v mgl32.Vec3) float32 {
+	return p.Normal.Dot(v) + p.D
+}
+
+func (p Plane) Normalize() Plane {
+	l := p.Normal.Len()
+	if l == 0 {
+		return p
+	}
+	return Plane{p.Normal.Mul(1 / l), p.D / l}
+}
+
+// Frustum is the view volume, its planes face inward.
+type Frustum [6]Plane
+
+// NewFrustum extracts the planes of a projection * view matrix, the near
+// and far planes come from the projection itself.
+func NewFrustum(mat mgl32.Mat4) Frustum {
+	r1, r2, r3, r4 := mat.Rows()
+	planes := [6]mgl32.Vec4{
+		r4.Add(r1), // left
+		r4.Sub(r1), // right
+		r4.Sub(r2), // top
+		r4.Add(r2), // bottom
+		r4.Add(r3), // near
+		r4.Sub(r3), // far
+	}
+	var f Frustum
+	for i, v := range planes {
+		f[i] = Plane{v.Vec3(), v.W()}.Normalize()
+	}
+	return f
+}
+
+func (f *Frustum) ContainsPoint(p mgl32.Vec3) bool {
+	for _, plane := range f {
+		if plane.Distance(p) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// IntersectsAABB reports whether the box may be visible, it's conservative:
+// boxes near the frustum corners can be reported visible.
+func (f *Frustum) IntersectsAABB(b AABB) bool {
+	for _, plane := range f {
+		// the box corner farthest along the plane normal
+		p := b.Min
+		if plane.Normal.X() >= 0 {
+			p[0] = b.Max.X()
+		}
+		if plane.Normal.Y() >= 0 {
+			p[1] = b.Max.Y()
+		}
+		if plane.Normal.Z() >= 0 {
+			p[2] = b.Max.Z()
+		}
+		if plane.Distance(p) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Ray is a half line from Origin along Dir.
+type Ray struct {
+	Origin, Dir mgl32.Vec3
+}
+
+func (r Ray) At(t float32) mgl32.Vec3 {
+	return r.Origin.Add(r.Dir.Mul(t))
+}
+
+// IntersectAABB returns the distance along the ray where it enters the box,
+// 0 if the origin is inside.
+func (r Ray) IntersectAABB(b AABB) (float32, bool) {
+	tmin, tmax := float32(0), float32(3.4e38)
+	for i := 0; i < 3; i++ {
+		if r.Dir[i] == 0 {
+			if r.Origin[i] < b.Min[i] || r.Origin[i] > b.Max[i] {
+				return 0, false
+			}
+			continue
+		}
+		t1 := (b.Min[i] - r.Origin[i]) / r.Dir[i]
+		t2 := (b.Max[i] - r.Origin[i]) / r.Dir[i]
+		if t1 > t2 {
+			t1, t2 = t2, t1
+		}
+		tmin = Max(tmin, t1)
+		tmax = Min(tmax, t2)
+		if tmin > tmax {
+			return 0, false
+		}
+	}
+	return tmin, true
+}
@@ -0,0 +1,174 @@
+package geom
+
+import (
+	"testing"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+func box(x0, y0, z0, x1, y1, z1 float32) AABB {
+	return AABB{mgl32.Vec3{x0, y0, z0}, mgl32.Vec3{x1, y1, z1}}
+}
+
+func TestAABBContains(t *testing.T) {
+	b := box(0, 0, 0, 1, 2, 3)
+	tests := []struct {
+		p    mgl32.Vec3
+		want bool
+	}{
+		{mgl32.Vec3{0.5, 1, 1.5}, true},
+		{mgl32.Vec3{0, 0, 0}, true},
+		{mgl32.Vec3{1, 2, 3}, true},
+		{mgl32.Vec3{-0.1, 1, 1}, false},
+		{mgl32.Vec3{0.5, 2.1, 1}, false},
+		{mgl32.Vec3{0.5, 1, 3.1}, false},
+	}
+	for _, tt := range tests {
+		if got := b.Contains(tt.p); got != tt.want {
+			t.Errorf("Contains(%v) = %v, want %v", tt.p, got, tt.want)
+		}
+	}
+}
+
+func TestAABBIntersects(t *testing.T) {
+	b := box(0, 0, 0, 1, 1, 1)
+	tests := []struct {
+		o    AABB
+		want bool
+	}{
+		{box(0.5, 0.5, 0.5, 2, 2, 2), true},
+		{box(0.2, 0.2, 0.2, 0.8, 0.8, 0.8), true},
+		{box(-1, -1, -1, 2, 2, 2), true},
+		// touching faces
+		{box(1, 0, 0, 2, 1, 1), true},
+		{box(1.1, 0, 0, 2, 1, 1), false},
+		{box(0, -2, 0, 1, -0.1, 1), false},
+		{box(0, 0, 1.5, 1, 1, 2), false},
+	}
+	for _, tt := range tests {
+		if got := b.Intersects(tt.o); got != tt.want {
+			t.Errorf("Intersects(%v) = %v, want %v", tt.o, got, tt.want)
+		}
+		if got := tt.o.Intersects(b); got != tt.want {
+			t.Errorf("%v.Intersects = %v, want %v", tt.o, got, tt.want)
+		}
+	}
+}
+
+func TestPlaneNormalize(t *testing.T) {
+	p := Plane{mgl32.Vec3{0, 3, 4}, 10}.Normalize()
+	if !p.Normal.ApproxEqual(mgl32.Vec3{0, 0.6, 0.8}) || !mgl32.FloatEqual(p.D, 2) {
+		t.Errorf("Normalize = %v, want normal (0, 0.6, 0.8) and D 2", p)
+	}
+	// the distance of a point in front of the plane is in world units
+	if d := p.Distance(mgl32.Vec3{0, 0.6, 0.8}); !mgl32.FloatEqual(d, 3) {
+		t.Errorf("Distance = %v, want 3", d)
+	}
+	zero := Plane{D: 1}
+	if got := zero.Normalize(); got != zero {
+		t.Errorf("Normalize of a zero normal = %v, want %v", got, zero)
+	}
+}
+
+// testFrustum looks down -z from the origin with a 90 degrees field of view.
+func testFrustum() Frustum {
+	proj := mgl32.Perspective(mgl32.DegToRad(90), 1, 0.1, 100)
+	view := mgl32.LookAtV(mgl32.Vec3{}, mgl32.Vec3{0, 0, -1}, mgl32.Vec3{0, 1, 0})
+	return NewFrustum(proj.Mul4(view))
+}
+
+func TestNewFrustum(t *testing.T) {
+	f := testFrustum()
+	s := 1 / Sqrt(2)
+	want := [6]Plane{
+		{mgl32.Vec3{s, 0, -s}, 0},  // left
+		{mgl32.Vec3{-s, 0, -s}, 0}, // right
+		{mgl32.Vec3{0, -s, -s}, 0}, // top
+		{mgl32.Vec3{0, s, -s}, 0},  // bottom
+		{mgl32.Vec3{0, 0, -1}, -0.1},
+		{mgl32.Vec3{0, 0, 1}, 100},
+	}
+	for i, p := range f {
+		if !p.Normal.ApproxEqualThreshold(want[i].Normal, 1e-4) ||
+			!mgl32.FloatEqualThreshold(p.D, want[i].D, 1e-2) {
+			t.Errorf("plane %d = %v, want %v", i, p, want[i])
+		}
+	}
+}
+
+func TestFrustumIntersectsAABB(t *testing.T) {
+	f := testFrustum()
+	tests := []struct {
+		name string
+		b    AABB
+		want bool
+	}{
+		{"inside", box(-1, -1, -11, 1, 1, -9), true},
+		{"behind", box(-1, -1, 5, 1, 1, 7), false},
+		{"left", box(-30, -1, -11, -20, 1, -9), false},
+		{"above", box(-1, 20, -11, 1, 30, -9), false},
+		{"beyond far", box(-1, -1, -120, 1, 1, -110), false},
+		{"straddling left", box(-15, -1, -11, -5, 1, -9), true},
+		{"straddling near", box(-1, -1, -1, 1, 1, 1), true},
+		{"straddling far", box(-1, -1, -105, 1, 1, -95), true},
+		{"around", box(-200, -200, -200, 200, 200, 200), true},
+	}
+	for _, tt := range tests {
+		if got := f.IntersectsAABB(tt.b); got != tt.want {
+			t.Errorf("%s: IntersectsAABB(%v) = %v, want %v", tt.name, tt.b, got, tt.want)
+		}
+	}
+	if !f.ContainsPoint(mgl32.Vec3{0, 0, -10}) || f.ContainsPoint(mgl32.Vec3{0, 0, 10}) {
+		t.Error("ContainsPoint is wrong in front of and behind the eye")
+	}
+}
+
+func TestRayIntersectAABB(t *testing.T) {
+	b := box(2, -1, -1, 4, 1, 1)
+	tests := []struct {
+		name string
+		r    Ray
+		hit  bool
+		t    float32
+	}{
+		{"toward", Ray{mgl32.Vec3{0, 0, 0}, mgl32.Vec3{1, 0, 0}}, true, 2},
+		{"away", Ray{mgl32.Vec3{0, 0, 0}, mgl32.Vec3{-1, 0, 0}}, false, 0},
+		{"inside", Ray{mgl32.Vec3{3, 0, 0}, mgl32.Vec3{0, 1, 0}}, true, 0},
+		{"diagonal", Ray{mgl32.Vec3{0, -2, 0}, mgl32.Vec3{1, 1, 0}}, true, 2},
+		{"miss", Ray{mgl32.Vec3{0, 2, 0}, mgl32.Vec3{1, 0.1, 0}}, false, 0},
+		// parallel to the faces y and z, within and outside the slabs
+		{"parallel within", Ray{mgl32.Vec3{0, 0.5, 0.5}, mgl32.Vec3{1, 0, 0}}, true, 2},
+		{"parallel on face", Ray{mgl32.Vec3{0, 1, 0}, mgl32.Vec3{1, 0, 0}}, true, 2},
+		{"parallel outside", Ray{mgl32.Vec3{0, 1.5, 0}, mgl32.Vec3{1, 0, 0}}, false, 0},
+	}
+	for _, tt := range tests {
+		got, hit := tt.r.IntersectAABB(b)
+		if hit != tt.hit || (hit && !mgl32.FloatEqual(got, tt.t)) {
+			t.Errorf("%s: IntersectAABB = %v, %v, want %v, %v", tt.name, got, hit, tt.t, tt.hit)
+		}
+		if hit && !b.Contains(tt.r.At(got)) {
+			t.Errorf("%s: entry point %v not on the box", tt.name, tt.r.At(got))
+		}
+	}
+}
+
+func TestFloorDiv(t *testing.T) {
+	tests := []struct {
+		a, b, want int64
+	}{
+		{7, 2, 3},
+		{-7, 2, -4},
+		{7, -2, -4},
+		{-7, -2, 3},
+		{-8, 2, -4},
+		{-1, 32, -1},
+		{-32, 32, -1},
+		{-33, 32, -2},
+		{0, 32, 0},
+	}
+	for _, tt := range tests {
+		if got := FloorDiv(tt.a, tt.b); got != tt.want {
+			t.Errorf("FloorDiv(%d, %d) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+// Package geom holds the math and geometry helpers of the game.
+package geom
+
+import (
+	"math"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+func Abs(x float32) float32 {
+	return float32(math.Abs(float64(x)))
+}
+
+func Round(x float32) float32 {
+	return float32(math.Round(float64(x)))
+}
+
+func Floor(x float32) float32 {
+	return float32(math.Floor(float64(x)))
+}
+
+func AbsInt(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func MinInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func MaxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func ClampInt(x, min, max int) int {
+	if x < min {
+		return min
+	}
+	if x > max {
+		return max
+	}
+	return x
+}
+
+// FloorDiv divides a by b rounding toward negative infinity.
+func FloorDiv(a, b int64) int64 {
+	q := a / b
+	if a%b != 0 && (a < 0) != (b < 0) {
+		q--
+	}
+	return q
+}
+
+func Sqrt(x float32) float32 {
+	return float32(math.Sqrt(float64(x)))
+}
+
+func Sin(x float32) float32 {
+	return float32(math.Sin(float64(x)))
+}
+
+func Cos(x float32) float32 {
+	return float32(math.Cos(float64(x)))
+}
+
+func Radian(angle float32) float32 {
+	return mgl32.DegToRad(angle)
+}
+
+func Max(a, b float32) float32 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func Min(a, b float32) float32 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func Mix(a, b, factor float32) float32 {
+	return a*(1-factor) + factor*b
+}
@@ -0,0 +1,140 @@
+// Package logging writes the messages of the subsystems of gocraft, tagged
+// with their name, through the standard log.
+package logging
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+type Level int
+
+const (
+	Error Level = iota
+	Warn
+	Info
+	Debug
+)
+
+var levelNames = [...]string{"ERROR", "WARN", "INFO", "DEBUG"}
+
+// ParseLevel returns the level named name, in any case.
+func ParseLevel(name string) (Level, bool) {
+	for level, s := range levelNames {
+		if strings.EqualFold(s, name) {
+			return Level(level), true
+		}
+	}
+	return 0, false
+}
+
+// the messages above are dropped, set by -v and /log
+var verbosity = int32(Info)
+
+func Verbosity() Level {
+	return Level(atomic.LoadInt32(&verbosity))
+}
+
+func SetVerbosity(level Level) {
+	atomic.StoreInt32(&verbosity, int32(level))
+}
+
+type verbosityFlag struct{}
+
+func (verbosityFlag) String() string {
+	return strconv.Itoa(int(Verbosity()))
+}
+
+func (verbosityFlag) Set(s string) error {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return err
+	}
+	SetVerbosity(Level(n))
+	return nil
+}
+
+// AddFlags adds -v, the verbosity, to fs.
+func AddFlags(fs *flag.FlagSet) {
+	fs.Var(verbosityFlag{}, "v", "log verbosity: 0 errors, 1 warnings, 2 info, 3 debug (chunk meshes, block updates)")
+}
+
+// Logger writes the messages of a subsystem, tagged with its name, through
+// the standard log. The messages above -v are dropped, the last ones are kept
+// for the debug info.
+type Logger struct {
+	tag string
+}
+
+func New(tag string) *Logger {
+	return &Logger{tag}
+}
+
+func (l *Logger) logf(level Level, format string, args ...interface{}) {
+	if level > Verbosity() {
+		return
+	}
+	line := fmt.Sprintf("%s %s: %s", levelNames[level], l.tag, fmt.Sprintf(format, args...))
+	log.Print(line)
+	Tail.add(line)
+}
+
+func (l *Logger) Errorf(format string, args ...interface{}) {
+	l.logf(Error, format, args...)
+}
+
+func (l *Logger) Warnf(format string, args ...interface{}) {
+	l.logf(Warn, format, args...)
+}
+
+func (l *Logger) Infof(format string, args ...interface{}) {
+	l.logf(Info, format, args...)
+}
+
+func (l *Logger) Debugf(format string, args ...interface{}) {
+	l.logf(Debug, format, args...)
+}
+
+// Debugging reports whether the debug messages are logged, to skip the
+// work done only for them.
+func (l *Logger) Debugging() bool {
+	return Verbosity() >= Debug
+}
+
+// LogTail keeps the last line logged, shown after the debug info with
+// /log overlay on.
+type LogTail struct {
+	mutex sync.Mutex
+	last  string
+	show  bool
+}
+
+var Tail = &LogTail{}
+
+func (t *LogTail) add(line string) {
+	t.mutex.Lock()
+	t.last = line
+	t.mutex.Unlock()
+}
+
+// Show shows or hides the last line.
+func (t *LogTail) Show(on bool) {
+	t.mutex.Lock()
+	t.show = on
+	t.mutex.Unlock()
+}
+
+// Title returns the line for the window title, empty unless shown.
+func (t *LogTail) Title() string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if !t.show {
+		return ""
+	}
+	return t.last
+}
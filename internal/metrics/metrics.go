@@ -0,0 +1,87 @@
+// Package metrics counts durations in histograms and writes the counters
+// of gocraft in the Prometheus text format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Histogram counts durations by upper bound in milliseconds, the last count
+// is over the last bound.
+type Histogram struct {
+	buckets []float64
+
+	mutex  sync.Mutex
+	counts []int64
+	sum    float64 // ms
+}
+
+func NewHistogram(buckets []float64) *Histogram {
+	return &Histogram{
+		buckets: buckets,
+		counts:  make([]int64, len(buckets)+1),
+	}
+}
+
+func (h *Histogram) Record(d time.Duration) {
+	ms := d.Seconds() * 1000
+	i := 0
+	for i < len(h.buckets) && ms > h.buckets[i] {
+		i++
+	}
+	h.mutex.Lock()
+	h.counts[i]++
+	h.sum += ms
+	h.mutex.Unlock()
+}
+
+// Buckets returns the counts by upper bound, the last one is "inf".
+func (h *Histogram) Buckets() map[string]int64 {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	m := make(map[string]int64, len(h.counts))
+	for i, n := range h.counts {
+		key := "inf"
+		if i < len(h.buckets) {
+			key = strconv.FormatFloat(h.buckets[i], 'f', -1, 64) + "ms"
+		}
+		m[key] = n
+	}
+	return m
+}
+
+// WriteMetric writes h as the histogram name in seconds.
+func (h *Histogram) WriteMetric(w io.Writer, name, help string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	WriteHistogram(w, name, help, h.buckets, h.counts, h.sum)
+}
+
+// Write writes a counter or a gauge, as kind says.
+func Write(w io.Writer, name, kind, help string, value float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %s\n", name, help, name, kind, name, formatFloat(value))
+}
+
+// WriteHistogram writes counts by upper bound in milliseconds as a
+// histogram in seconds, the last count is over the last bound.
+func WriteHistogram(w io.Writer, name, help string, buckets []float64, counts []int64, sumMs float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+	var total int64
+	for i, n := range counts {
+		total += n
+		le := "+Inf"
+		if i < len(buckets) {
+			le = formatFloat(buckets[i] / 1000)
+		}
+		fmt.Fprintf(w, "%s_bucket{le=\"%s\"} %d\n", name, le, total)
+	}
+	fmt.Fprintf(w, "%s_sum %s\n%s_count %d\n", name, formatFloat(sumMs/1000), name, total)
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
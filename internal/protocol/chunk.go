@@ -0,0 +1,159 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"errors"
+	"sort"
+
+	"github.com/golang/snappy"
+	"github.com/icexin/gocraft/internal/geom"
+	"github.com/icexin/gocraft/world"
+)
+
+// ChunkEncoding is the compact chunk encoding: a palette of block types and
+// runs of consecutive blocks of the same type, compressed by snappy.
+const ChunkEncoding = "palette-rle+snappy"
+
+var errBadChunkData = errors.New("bad chunk data")
+
+// chunkVolume bounds the block indexes of the encoding, the blocks of a
+// chunk are encoded from the height 0 up to world.ChunkHeight.
+const chunkVolume = world.ChunkWidth * world.ChunkWidth * world.ChunkHeight
+
+func localBlockIndex(cid world.Vec3, b [4]int) int64 {
+	dx, dz := b[0]-cid.X*world.ChunkWidth, b[2]-cid.Z*world.ChunkWidth
+	return (int64(b[1])*world.ChunkWidth+int64(dx))*world.ChunkWidth + int64(dz)
+}
+
+// EncodeChunkBlocks encodes the blocks of chunk cid, the blocks out of the
+// heights of the encoding are left out.
+func EncodeChunkBlocks(cid world.Vec3, blocks [][4]int) []byte {
+	sorted := make([][4]int, 0, len(blocks))
+	for _, b := range blocks {
+		if b[1] >= 0 && b[1] < world.ChunkHeight {
+			sorted = append(sorted, b)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return localBlockIndex(cid, sorted[i]) < localBlockIndex(cid, sorted[j])
+	})
+
+	var palette []int
+	paletteIdx := make(map[int]int)
+	for _, b := range sorted {
+		if _, ok := paletteIdx[b[3]]; !ok {
+			paletteIdx[b[3]] = len(palette)
+			palette = append(palette, b[3])
+		}
+	}
+
+	type run struct {
+		start  int64
+		length int
+		w      int
+	}
+	var runs []run
+	for _, b := range sorted {
+		idx := localBlockIndex(cid, b)
+		if n := len(runs); n > 0 {
+			last := &runs[n-1]
+			if last.w == b[3] && last.start+int64(last.length) == idx {
+				last.length++
+				continue
+			}
+		}
+		runs = append(runs, run{start: idx, length: 1, w: b[3]})
+	}
+
+	buf := make([]byte, 0, 16+len(palette)*2+len(runs)*4)
+	tmp := make([]byte, binary.MaxVarintLen64)
+	putUvarint := func(x uint64) {
+		buf = append(buf, tmp[:binary.PutUvarint(tmp, x)]...)
+	}
+	putVarint := func(x int64) {
+		buf = append(buf, tmp[:binary.PutVarint(tmp, x)]...)
+	}
+	putUvarint(uint64(len(palette)))
+	for _, w := range palette {
+		putVarint(int64(w))
+	}
+	putUvarint(uint64(len(runs)))
+	var end int64
+	for _, r := range runs {
+		putVarint(r.start - end)
+		putUvarint(uint64(r.length))
+		putUvarint(uint64(paletteIdx[r.w]))
+		end = r.start + int64(r.length)
+	}
+	return snappy.Encode(nil, buf)
+}
+
+// DecodeChunkBlocks decodes the blocks of chunk cid. The runs must lie in
+// the chunk and hold at most chunkVolume blocks in all, the data comes from
+// the server.
+func DecodeChunkBlocks(cid world.Vec3, data []byte) ([][4]int, error) {
+	buf, err := snappy.Decode(nil, data)
+	if err != nil {
+		return nil, err
+	}
+	readUvarint := func() uint64 {
+		x, n := binary.Uvarint(buf)
+		if n <= 0 {
+			err = errBadChunkData
+			return 0
+		}
+		buf = buf[n:]
+		return x
+	}
+	readVarint := func() int64 {
+		x, n := binary.Varint(buf)
+		if n <= 0 {
+			err = errBadChunkData
+			return 0
+		}
+		buf = buf[n:]
+		return x
+	}
+
+	npalette := readUvarint()
+	if err != nil || npalette > uint64(len(buf)) {
+		return nil, errBadChunkData
+	}
+	palette := make([]int, npalette)
+	for i := range palette {
+		palette[i] = int(readVarint())
+	}
+	nruns := readUvarint()
+	if err != nil || nruns > uint64(len(buf)) {
+		return nil, errBadChunkData
+	}
+
+	var blocks [][4]int
+	var end, total int64
+	for i := uint64(0); i < nruns; i++ {
+		start := end + readVarint()
+		length := readUvarint()
+		pidx := readUvarint()
+		if err != nil || pidx >= npalette || start < 0 || length > chunkVolume ||
+			start+int64(length) > chunkVolume {
+			return nil, errBadChunkData
+		}
+		total += int64(length)
+		if total > chunkVolume {
+			return nil, errBadChunkData
+		}
+		for idx := start; idx < start+int64(length); idx++ {
+			y := geom.FloorDiv(idx, world.ChunkWidth*world.ChunkWidth)
+			rem := idx - y*world.ChunkWidth*world.ChunkWidth
+			dx, dz := rem/world.ChunkWidth, rem%world.ChunkWidth
+			blocks = append(blocks, [...]int{
+				cid.X*world.ChunkWidth + int(dx),
+				int(y),
+				cid.Z*world.ChunkWidth + int(dz),
+				palette[pidx],
+			})
+		}
+		end = start + int64(length)
+	}
+	return blocks, nil
+}
@@ -0,0 +1,84 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/golang/snappy"
+	"github.com/icexin/gocraft/world"
+)
+
+// rawChunkData encodes a palette of one block type and the runs given as
+// start, length pairs, the starts relative to the end of the previous run.
+func rawChunkData(runs ...int64) []byte {
+	var buf []byte
+	tmp := make([]byte, binary.MaxVarintLen64)
+	putUvarint := func(x uint64) {
+		buf = append(buf, tmp[:binary.PutUvarint(tmp, x)]...)
+	}
+	putVarint := func(x int64) {
+		buf = append(buf, tmp[:binary.PutVarint(tmp, x)]...)
+	}
+	putUvarint(1)
+	putVarint(int64(world.Stone))
+	putUvarint(uint64(len(runs) / 2))
+	for i := 0; i < len(runs); i += 2 {
+		putVarint(runs[i])
+		putUvarint(uint64(runs[i+1]))
+		putUvarint(0)
+	}
+	return snappy.Encode(nil, buf)
+}
+
+func TestChunkBlocksRoundTrip(t *testing.T) {
+	cid := world.Vec3{X: -2, Z: 3}
+	blocks := [][4]int{
+		{-64, 0, 96, world.Grass},
+		{-63, 0, 96, world.Grass},
+		{-64, 10, 127, world.Stone},
+		{-33, 255, 96, world.Brick},
+	}
+	got, err := DecodeChunkBlocks(cid, EncodeChunkBlocks(cid, blocks))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Slice(blocks, func(i, j int) bool {
+		return localBlockIndex(cid, blocks[i]) < localBlockIndex(cid, blocks[j])
+	})
+	if !reflect.DeepEqual(got, blocks) {
+		t.Errorf("decoded %v, want %v", got, blocks)
+	}
+
+	// the blocks out of the heights of the encoding are left out
+	out := [][4]int{{-64, -1, 96, world.Stone}, {-64, world.ChunkHeight, 96, world.Stone}}
+	got, err = DecodeChunkBlocks(cid, EncodeChunkBlocks(cid, append(out, blocks[0])))
+	if err != nil || !reflect.DeepEqual(got, blocks[:1]) {
+		t.Errorf("decoded %v, %v, want %v", got, err, blocks[:1])
+	}
+}
+
+func TestDecodeChunkBlocksBounds(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"not snappy", []byte("not snappy")},
+		{"negative start", rawChunkData(-1, 2)},
+		{"start past the chunk", rawChunkData(chunkVolume, 1)},
+		{"run past the chunk", rawChunkData(chunkVolume-1, 2)},
+		{"start overflow", rawChunkData(1<<62, 1, 1<<62, 1)},
+		{"overlapping runs", rawChunkData(0, chunkVolume, -chunkVolume, 1)},
+		{"too many blocks", rawChunkData(0, chunkVolume/2, -chunkVolume/2, chunkVolume/2, -chunkVolume/2, chunkVolume/2)},
+	}
+	for _, tt := range tests {
+		if blocks, err := DecodeChunkBlocks(world.Vec3{}, tt.data); err == nil {
+			t.Errorf("%s: decoded %d blocks, want an error", tt.name, len(blocks))
+		}
+	}
+	blocks, err := DecodeChunkBlocks(world.Vec3{}, rawChunkData(0, chunkVolume))
+	if err != nil || len(blocks) != chunkVolume {
+		t.Errorf("full chunk: %d blocks, %v, want %d", len(blocks), err, chunkVolume)
+	}
+}
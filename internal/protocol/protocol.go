@@ -0,0 +1,91 @@
+// Package protocol holds the rpc messages and capabilities of gocraft
+// added on top of the gocraft-server ones, shared by the game client and
+// the bot. New fields are optional and ignored by the old servers.
+package protocol
+
+import "github.com/icexin/gocraft-server/proto"
+
+const (
+	// Version is bumped on incompatible changes of the messages, new
+	// optional features are announced by capabilities instead.
+	Version          = 1
+	MinServerVersion = 0
+	// LegacyVersion is the version of the servers without Player.Hello.
+	LegacyVersion = 0
+)
+
+// The capabilities announced by Player.Hello.
+const (
+	CapCompression     = "compression"
+	CapDeltaChunks     = "delta-chunks"
+	CapBatchUpdates    = "batch-updates"
+	CapMining          = "mining"
+	CapEntities        = "entities"
+	CapChat            = "chat"
+	CapInterestRadius  = "interest-radius"
+	CapServerClockSync = "clock-sync"
+	CapChunkFlags      = "chunk-flags"
+)
+
+type HelloRequest struct {
+	Id         int32
+	Version    int
+	MinVersion int
+	Caps       []string
+}
+
+type HelloResponse struct {
+	Version    int
+	MinVersion int
+	Caps       []string
+}
+
+type LoginRequest struct {
+	Id    int32
+	Name  string
+	Token string
+}
+
+type LoginResponse struct {
+}
+
+// UpdateStateRequest extends proto.UpdateStateRequest with the radius of the
+// area of interest, servers supporting it only send the players inside.
+type UpdateStateRequest struct {
+	Id     int32
+	State  proto.PlayerState
+	Radius float32
+}
+
+type UpdateStateResponse struct {
+	// set if the server filtered Players by the area of interest
+	Interest bool
+	Players  map[int32]proto.PlayerState
+	// server time of the player states, sent by servers supporting time sync
+	Times map[int32]float64
+	AFK   map[int32]bool
+}
+
+type ChatRequest struct {
+	Id   int32
+	Text string
+}
+
+type ChatResponse struct {
+}
+
+// The server calls the clients with the messages below.
+
+type KickRequest struct {
+	Reason string
+}
+
+type KickResponse struct {
+}
+
+type SetPermissionsRequest struct {
+	Op bool
+}
+
+type SetPermissionsResponse struct {
+}
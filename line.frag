@@ -1,7 +0,0 @@
-#version 330 core
-
-out vec4 color;
-
-void main() {
-    color = vec4(0,0,0,1);
-}
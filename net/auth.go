@@ -0,0 +1,106 @@
+package net
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/rpc"
+	"os"
+	"strings"
+	"time"
+
+	gocraft "github.com/icexin/gocraft-server/client"
+	"github.com/icexin/gocraft/internal/protocol"
+)
+
+var (
+	useTLS     = flags.Bool("tls", false, "use tls for the server connection")
+	tlsCAFile  = flags.String("tlsca", "", "pem file of the CA certificates to verify the server, system CAs by default")
+	playerName = flags.String("name", "", "player name used to login")
+	authToken  = flags.String("token", "", "auth token used to login, defaults to $GOCRAFT_TOKEN")
+)
+
+// PlayerName returns the name of -name, the player logs in with it.
+func PlayerName() string {
+	return *playerName
+}
+
+func dialTLS(addr string) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{
+		ServerName: host,
+	}
+	if *tlsCAFile != "" {
+		pem, err := ioutil.ReadFile(*tlsCAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificate found in " + *tlsCAFile)
+		}
+		config.RootCAs = pool
+	}
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	return tls.DialWithDialer(dialer, "tcp", addr, config)
+}
+
+// LoginError is returned by dialServer when the server refuses the
+// credentials of the player, logging in again won't help.
+type LoginError struct {
+	Reason string
+}
+
+func (e *LoginError) Error() string {
+	return "login failed: " + e.Reason
+}
+
+// encrypted reports whether the connection to addr is encrypted, the token
+// is never sent in clear.
+func encrypted(addr string) bool {
+	if isWebSocketAddr(addr) {
+		return strings.HasPrefix(addr, "wss://")
+	}
+	return *useTLS
+}
+
+func loginToken() string {
+	if *authToken != "" {
+		return *authToken
+	}
+	return strings.TrimSpace(os.Getenv("GOCRAFT_TOKEN"))
+}
+
+// login sends the player credentials, servers without authentication
+// don't know the method and the player stays anonymous.
+func login(c *gocraft.Client) error {
+	token := loginToken()
+	if *playerName == "" && token == "" {
+		return nil
+	}
+	if token != "" && !encrypted(*serverAddr) {
+		return &LoginError{Reason: "the token is only sent with -tls or to a wss:// server"}
+	}
+	req := &protocol.LoginRequest{
+		Id:    c.ClientId,
+		Name:  *playerName,
+		Token: token,
+	}
+	err := c.Call("Player.Login", req, new(protocol.LoginResponse))
+	if isMethodNotFound(err) {
+		netLog.Warnf("server doesn't support login, play as anonymous")
+		return nil
+	}
+	if _, ok := err.(rpc.ServerError); ok {
+		return &LoginError{Reason: err.Error()}
+	}
+	if err != nil {
+		return errors.New("login failed: " + err.Error())
+	}
+	return nil
+}
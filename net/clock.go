@@ -0,0 +1,184 @@
+package net
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/icexin/gocraft/internal/protocol"
+)
+
+type TimeRequest struct {
+	ClientTime float64
+}
+
+type TimeResponse struct {
+	ClientTime float64
+	ServerTime float64
+}
+
+const (
+	clockSamples      = 16
+	clockBurstSamples = 8
+	clockSyncInterval = 10 * time.Second
+)
+
+type clockSample struct {
+	local  float64 // local time when the server time was taken
+	offset float64 // server - local
+	rtt    float64
+}
+
+// Clock estimates the server clock from round trip samples, the offset and
+// drift are fitted over the samples with the lowest round trip time.
+type Clock struct {
+	mutex   sync.Mutex
+	samples []clockSample
+
+	base   float64
+	offset float64
+	drift  float64
+	// set when the current server doesn't know Player.Time, cleared by
+	// Reset on reconnect
+	unsupported bool
+}
+
+var clock = new(Clock)
+
+// the local clock of the samples
+var startTime = time.Now()
+
+func localTime() float64 {
+	return time.Since(startTime).Seconds()
+}
+
+// Now returns the estimated server time of the current server.
+func Now() float64 {
+	return clock.Now()
+}
+
+// Now returns the estimated server time, equals to local time if not synced.
+func (c *Clock) Now() float64 {
+	return c.ServerTime(localTime())
+}
+
+func (c *Clock) ServerTime(local float64) float64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return local + c.offset + c.drift*(local-c.base)
+}
+
+// Reset drops the samples of the previous connection, the server is asked
+// again whether it supports time sync.
+func (c *Clock) Reset() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.samples = nil
+	c.unsupported = false
+}
+
+// useLocal falls back to the local clock until the next Reset.
+func (c *Clock) useLocal() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.samples = nil
+	c.offset, c.drift = 0, 0
+	c.unsupported = true
+}
+
+func (c *Clock) supported() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return !c.unsupported
+}
+
+func (c *Clock) synced() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return len(c.samples) != 0
+}
+
+func (c *Clock) addSample(s clockSample) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.samples = append(c.samples, s)
+	if len(c.samples) > clockSamples {
+		c.samples = c.samples[1:]
+	}
+
+	best := append([]clockSample{}, c.samples...)
+	sort.Slice(best, func(i, j int) bool {
+		return best[i].rtt < best[j].rtt
+	})
+	best = best[:(len(best)+1)/2]
+
+	// least squares fit of offset = a + b*(local-base)
+	var sx, sy float64
+	for _, s := range best {
+		sx += s.local
+		sy += s.offset
+	}
+	n := float64(len(best))
+	mx, my := sx/n, sy/n
+	var sxx, sxy float64
+	for _, s := range best {
+		sxx += (s.local - mx) * (s.local - mx)
+		sxy += (s.local - mx) * (s.offset - my)
+	}
+	c.base = mx
+	c.offset = my
+	c.drift = 0
+	if sxx > 1 {
+		c.drift = sxy / sxx
+	}
+}
+
+// sample returns false if the server doesn't support time sync.
+func (c *Clock) sample() bool {
+	if !c.supported() {
+		return false
+	}
+	if !serverMay(protocol.CapServerClockSync) {
+		c.useLocal()
+		return false
+	}
+	req := &TimeRequest{
+		ClientTime: localTime(),
+	}
+	rep := new(TimeResponse)
+	err := clientCall("Player.Time", req, rep)
+	if isMethodNotFound(err) {
+		netLog.Warnf("server doesn't support time sync, use local clock")
+		c.useLocal()
+		return false
+	}
+	if err != nil {
+		return true
+	}
+	now := localTime()
+	mid := (rep.ClientTime + now) / 2
+	c.addSample(clockSample{
+		local:  mid,
+		offset: rep.ServerTime - mid,
+		rtt:    now - rep.ClientTime,
+	})
+	return true
+}
+
+// SyncLoop samples the server clock until the program exits, a server
+// without time sync is checked again after a reconnect.
+func (c *Clock) SyncLoop() {
+	defer recoverPanic()
+	for {
+		n := 1
+		if !c.synced() {
+			n = clockBurstSamples
+		}
+		for i := 0; i < n; i++ {
+			if !c.sample() {
+				break
+			}
+		}
+		time.Sleep(clockSyncInterval)
+	}
+}
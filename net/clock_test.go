@@ -0,0 +1,39 @@
+package net
+
+import (
+	"math"
+	"testing"
+)
+
+func TestClockFit(t *testing.T) {
+	c := new(Clock)
+	if got := c.ServerTime(10); got != 10 {
+		t.Errorf("server time %v before any sample, want the local 10", got)
+	}
+	// a server 100s ahead running 1% faster, the slow round trips are off
+	for i := 0; i < clockSamples; i++ {
+		local := float64(i * 10)
+		offset := 100 + 0.01*local
+		rtt := 0.01
+		if i%2 == 1 {
+			offset += 0.5
+			rtt = 1
+		}
+		c.addSample(clockSample{local: local, offset: offset, rtt: rtt})
+	}
+	for _, local := range []float64{50, 200} {
+		want := local + 100 + 0.01*local
+		if got := c.ServerTime(local); math.Abs(got-want) > 1e-6 {
+			t.Errorf("server time at %v: %v, want %v", local, got, want)
+		}
+	}
+
+	c.useLocal()
+	if got := c.ServerTime(10); got != 10 || c.supported() {
+		t.Errorf("server time %v, supported %v with the local clock", got, c.supported())
+	}
+	c.Reset()
+	if !c.supported() || c.synced() {
+		t.Errorf("supported %v, synced %v after Reset", c.supported(), c.synced())
+	}
+}
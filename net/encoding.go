@@ -0,0 +1,47 @@
+package net
+
+import (
+	"encoding/json"
+	"sync/atomic"
+
+	"github.com/icexin/gocraft/internal/protocol"
+	"github.com/icexin/gocraft/world"
+)
+
+var acceptEncodings = []string{protocol.ChunkEncoding}
+
+// acceptedEncodings returns the chunk encodings to ask the current server for.
+func acceptedEncodings() []string {
+	if !serverMay(protocol.CapCompression) {
+		return nil
+	}
+	return acceptEncodings
+}
+
+// ChunkNetStat records the chunk bytes received, JSONBytes is the size of
+// the chunks in the plain json encoding, EncodedBytes in the compact one.
+// Recorded with the net debug messages only, both encodings are costly.
+type ChunkNetStat struct {
+	Chunks       int64
+	JSONBytes    int64
+	EncodedBytes int64
+}
+
+var chunkNetStat ChunkNetStat
+
+func recordChunkNetStat(blocks [][4]int, encoded []byte, cid world.Vec3) {
+	if !netLog.Debugging() {
+		return
+	}
+	jsonData, _ := json.Marshal(blocks)
+	if encoded == nil {
+		encoded = protocol.EncodeChunkBlocks(cid, blocks)
+	}
+	chunks := atomic.AddInt64(&chunkNetStat.Chunks, 1)
+	jsonBytes := atomic.AddInt64(&chunkNetStat.JSONBytes, int64(len(jsonData)))
+	encodedBytes := atomic.AddInt64(&chunkNetStat.EncodedBytes, int64(len(encoded)))
+	if len(blocks) != 0 {
+		netLog.Debugf("chunk %v: %d blocks, json %d bytes, encoded %d bytes, avg %d/%d bytes per chunk",
+			cid, len(blocks), len(jsonData), len(encoded), jsonBytes/chunks, encodedBytes/chunks)
+	}
+}
@@ -0,0 +1,15 @@
+package net
+
+import "flag"
+
+// flags are the command line flags of the client, added to the ones of the
+// program by AddFlags.
+var flags = flag.NewFlagSet("net", flag.ContinueOnError)
+
+// AddFlags adds the flags of the client to fs: the server, -tls and the
+// login.
+func AddFlags(fs *flag.FlagSet) {
+	flags.VisitAll(func(f *flag.Flag) {
+		fs.Var(f.Value, f.Name, f.Usage)
+	})
+}
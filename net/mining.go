@@ -0,0 +1,95 @@
+package net
+
+import (
+	"github.com/icexin/gocraft/internal/protocol"
+	"github.com/icexin/gocraft/world"
+)
+
+// The actions of Block.Mine.
+const (
+	MineStart    = "start"
+	MineStop     = "stop"
+	MineProgress = "progress"
+	MineFinish   = "finish"
+)
+
+type MineRequest struct {
+	Id       int32
+	X, Y, Z  int
+	Action   string
+	Progress float32
+}
+
+// MineResponse is the server arbitration of a finish action, Granted is false
+// if another player broke the block first, W is the authoritative block type.
+type MineResponse struct {
+	Granted bool
+	W       int
+}
+
+var mineEvents = make(chan MineRequest, 16)
+
+func mineEventLoop() {
+	defer recoverPanic()
+	for req := range mineEvents {
+		err := clientCall("Block.Mine", &req, new(MineResponse))
+		if err != nil && err != errOffline && !isMethodNotFound(err) {
+			netLog.Errorf("mine event error:%s", err)
+		}
+	}
+}
+
+// SendMineEvent tells the server about the progress of the player breaking
+// block id, dropped when the server doesn't show the mining of the others.
+func SendMineEvent(id world.Vec3, action string, progress float32) {
+	c := currentClient()
+	if c == nil || !serverMay(protocol.CapMining) {
+		return
+	}
+	req := MineRequest{
+		Id:       c.ClientId,
+		X:        id.X,
+		Y:        id.Y,
+		Z:        id.Z,
+		Action:   action,
+		Progress: progress,
+	}
+	select {
+	case mineEvents <- req:
+	default:
+	}
+}
+
+// ClientMineBlock asks the server for block id broken by the player, queued
+// as any other edit when the server doesn't arbitrate the mining. granted
+// is false if another player broke the block first, w is then the block
+// type of the server.
+func ClientMineBlock(id world.Vec3) (granted bool, w int) {
+	c := currentClient()
+	if c == nil || !serverMay(protocol.CapMining) {
+		ClientUpdateBlocks(BlockEdit{id, 0})
+		return true, 0
+	}
+	req := &MineRequest{
+		Id:     c.ClientId,
+		X:      id.X,
+		Y:      id.Y,
+		Z:      id.Z,
+		Action: MineFinish,
+	}
+	rep := new(MineResponse)
+	err := clientCall("Block.Mine", req, rep)
+	if err == errOffline || isMethodNotFound(err) {
+		ClientUpdateBlocks(BlockEdit{id, 0})
+		return true, 0
+	}
+	if err != nil {
+		netLog.Errorf("mine block %v error:%s", id, err)
+		return true, 0
+	}
+	if rep.Granted {
+		return true, 0
+	}
+	netLog.Infof("lost block %v to another player", id)
+	return false, rep.W
+}
@@ -0,0 +1,153 @@
+package net
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/icexin/gocraft/internal/metrics"
+)
+
+// round trip time buckets in milliseconds
+var rttBuckets = []float64{5, 10, 20, 50, 100, 200, 500, 1000}
+
+// NetStat tracks the rpc round trip times and the bytes sent and received.
+type NetStat struct {
+	bytesIn  int64
+	bytesOut int64
+
+	mutex    sync.Mutex
+	calls    int64
+	failures int64
+	ping     float64 // ms, moving average
+	hist     []int64
+	rttSum   float64 // ms
+
+	lastTime        time.Time
+	lastIn, lastOut int64
+	lastCalls       int64
+	lastFailures    int64
+	rateIn, rateOut float64 // bytes per second
+	loss            float64
+}
+
+// Stat counts the traffic with the server.
+var Stat = &NetStat{
+	hist: make([]int64, len(rttBuckets)+1),
+}
+
+func (s *NetStat) RecordCall(rtt time.Duration, failed bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.calls++
+	if failed {
+		s.failures++
+		return
+	}
+	ms := rtt.Seconds() * 1000
+	s.rttSum += ms
+	if s.ping == 0 {
+		s.ping = ms
+	} else {
+		s.ping = s.ping*0.9 + ms*0.1
+	}
+	i := 0
+	for i < len(rttBuckets) && ms > rttBuckets[i] {
+		i++
+	}
+	s.hist[i]++
+}
+
+// update computes the rates since last update, at most once per second.
+func (s *NetStat) update() {
+	now := time.Now()
+	dt := now.Sub(s.lastTime).Seconds()
+	if dt < 1 {
+		return
+	}
+	in, out := atomic.LoadInt64(&s.bytesIn), atomic.LoadInt64(&s.bytesOut)
+	s.rateIn = float64(in-s.lastIn) / dt
+	s.rateOut = float64(out-s.lastOut) / dt
+	calls, failures := s.calls-s.lastCalls, s.failures-s.lastFailures
+	s.loss = 0
+	if calls != 0 {
+		s.loss = float64(failures) / float64(calls)
+	}
+	s.lastTime, s.lastIn, s.lastOut = now, in, out
+	s.lastCalls, s.lastFailures = s.calls, s.failures
+}
+
+// Summary returns a short text for the debug overlay.
+func (s *NetStat) Summary() string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.update()
+	return fmt.Sprintf("ping %.0fms loss %.1f%% in %.1fKB/s out %.1fKB/s",
+		s.ping, s.loss*100, s.rateIn/1024, s.rateOut/1024)
+}
+
+func (s *NetStat) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	fmt.Fprintf(w, "bytes in: %d\n", atomic.LoadInt64(&s.bytesIn))
+	fmt.Fprintf(w, "bytes out: %d\n", atomic.LoadInt64(&s.bytesOut))
+	fmt.Fprintf(w, "calls: %d\n", s.calls)
+	fmt.Fprintf(w, "failures: %d\n", s.failures)
+	fmt.Fprintf(w, "ping: %.1fms\n", s.ping)
+	fmt.Fprintf(w, "rtt histogram:\n")
+	for i, n := range s.hist {
+		if i < len(rttBuckets) {
+			fmt.Fprintf(w, "  <= %4.0fms: %d\n", rttBuckets[i], n)
+		} else {
+			fmt.Fprintf(w, "  >  %4.0fms: %d\n", rttBuckets[i-1], n)
+		}
+	}
+}
+
+// Stats returns the counters of /debug/net for the debug API.
+func (s *NetStat) Stats() map[string]interface{} {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.update()
+	return map[string]interface{}{
+		"bytes_in":  atomic.LoadInt64(&s.bytesIn),
+		"bytes_out": atomic.LoadInt64(&s.bytesOut),
+		"calls":     s.calls,
+		"failures":  s.failures,
+		"ping_ms":   s.ping,
+		"loss":      s.loss,
+	}
+}
+
+// WriteMetrics writes the counters in the Prometheus text format.
+func (s *NetStat) WriteMetrics(w io.Writer) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	metrics.Write(w, "gocraft_net_bytes_in_total", "counter", "Bytes received from the server.", float64(atomic.LoadInt64(&s.bytesIn)))
+	metrics.Write(w, "gocraft_net_bytes_out_total", "counter", "Bytes sent to the server.", float64(atomic.LoadInt64(&s.bytesOut)))
+	metrics.Write(w, "gocraft_rpc_calls_total", "counter", "Rpc calls to the server.", float64(s.calls))
+	metrics.Write(w, "gocraft_rpc_failures_total", "counter", "Failed rpc calls.", float64(s.failures))
+	metrics.WriteHistogram(w, "gocraft_rpc_duration_seconds", "Round trip time of the successful rpc calls.", rttBuckets, s.hist, s.rttSum)
+}
+
+// countConn counts the bytes read and written on a connection.
+type countConn struct {
+	net.Conn
+	stat *NetStat
+}
+
+func (c *countConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	atomic.AddInt64(&c.stat.bytesIn, int64(n))
+	return n, err
+}
+
+func (c *countConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	atomic.AddInt64(&c.stat.bytesOut, int64(n))
+	return n, err
+}
@@ -0,0 +1,52 @@
+package net
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/icexin/gocraft/world"
+)
+
+// Chunk permission flags sent by the server with the chunk blocks, servers
+// without them send 0 and every chunk is editable.
+const (
+	// nobody can edit the chunk
+	chunkReadOnly = 1 << iota
+	// only operators can edit the chunk, like the spawn area
+	chunkProtected
+)
+
+var (
+	// set by the server for operators
+	serverOp int32
+
+	chunkFlagsMutex sync.RWMutex
+	chunkFlags      = make(map[world.Vec3]int)
+)
+
+func setChunkFlags(id world.Vec3, flags int) {
+	chunkFlagsMutex.Lock()
+	defer chunkFlagsMutex.Unlock()
+	if flags == 0 {
+		delete(chunkFlags, id)
+		return
+	}
+	chunkFlags[id] = flags
+}
+
+// chunkLocked reports whether the server refuses the edits of the player in
+// chunk id, checked locally to spare a round trip that would be undone.
+func ChunkLocked(id world.Vec3) bool {
+	chunkFlagsMutex.RLock()
+	flags := chunkFlags[id]
+	chunkFlagsMutex.RUnlock()
+	if flags&chunkReadOnly != 0 {
+		return true
+	}
+	return flags&chunkProtected != 0 && atomic.LoadInt32(&serverOp) == 0
+}
+
+// Op reports whether the server made the player an operator.
+func Op() bool {
+	return atomic.LoadInt32(&serverOp) != 0
+}
@@ -0,0 +1,120 @@
+package net
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	gocraft "github.com/icexin/gocraft-server/client"
+	"github.com/icexin/gocraft/internal/protocol"
+)
+
+// clientCaps are the capabilities implemented by this client.
+var clientCaps = []string{
+	protocol.CapCompression,
+	protocol.CapDeltaChunks,
+	protocol.CapBatchUpdates,
+	protocol.CapMining,
+	protocol.CapInterestRadius,
+	protocol.CapServerClockSync,
+	protocol.CapChunkFlags,
+}
+
+// ProtocolError is returned by the handshake when the client and the server
+// can't talk to each other.
+type ProtocolError struct {
+	Client, Server       int
+	MinClient, MinServer int
+}
+
+func (e *ProtocolError) Error() string {
+	if e.Server < e.MinServer {
+		return fmt.Sprintf("server protocol v%d is too old, need v%d+", e.Server, e.MinServer)
+	}
+	return fmt.Sprintf("client protocol v%d is too old, server needs v%d+", e.Client, e.MinClient)
+}
+
+// ServerInfo is the result of the handshake with the current server.
+type ServerInfo struct {
+	Version int
+	// nil for legacy servers, features are probed then
+	Caps map[string]bool
+}
+
+var (
+	serverInfoMutex sync.RWMutex
+	serverInfo      = ServerInfo{Version: protocol.LegacyVersion}
+)
+
+// serverMay reports whether a feature is worth trying on the current server,
+// legacy servers didn't announce anything and are probed by method.
+func serverMay(capability string) bool {
+	serverInfoMutex.RLock()
+	defer serverInfoMutex.RUnlock()
+	if serverInfo.Caps == nil {
+		return true
+	}
+	return serverInfo.Caps[capability]
+}
+
+func ServerProtocol() ServerInfo {
+	serverInfoMutex.RLock()
+	defer serverInfoMutex.RUnlock()
+	return serverInfo
+}
+
+// hello exchanges the protocol version and capabilities with the server.
+func hello(c *gocraft.Client) error {
+	req := &protocol.HelloRequest{
+		Id:         c.ClientId,
+		Version:    protocol.Version,
+		MinVersion: protocol.MinServerVersion,
+		Caps:       clientCaps,
+	}
+	rep := new(protocol.HelloResponse)
+	err := c.Call("Player.Hello", req, rep)
+	info := ServerInfo{Version: protocol.LegacyVersion}
+	switch {
+	case isMethodNotFound(err):
+		netLog.Warnf("server doesn't support handshake, assume legacy protocol")
+	case err != nil:
+		return err
+	default:
+		info.Version = rep.Version
+		info.Caps = make(map[string]bool)
+		for _, name := range rep.Caps {
+			info.Caps[name] = true
+		}
+		if protocol.Version < rep.MinVersion {
+			return &ProtocolError{
+				Client:    protocol.Version,
+				Server:    rep.Version,
+				MinClient: rep.MinVersion,
+				MinServer: protocol.MinServerVersion,
+			}
+		}
+		netLog.Infof("server protocol v%d, capabilities: %s", rep.Version, capsString(info.Caps))
+	}
+	if info.Version < protocol.MinServerVersion {
+		return &ProtocolError{
+			Client:    protocol.Version,
+			Server:    info.Version,
+			MinServer: protocol.MinServerVersion,
+		}
+	}
+
+	serverInfoMutex.Lock()
+	serverInfo = info
+	serverInfoMutex.Unlock()
+	return nil
+}
+
+func capsString(caps map[string]bool) string {
+	var names []string
+	for name := range caps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
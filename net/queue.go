@@ -0,0 +1,261 @@
+package net
+
+import (
+	"sync"
+	"time"
+
+	"github.com/icexin/gocraft-server/proto"
+	"github.com/icexin/gocraft/internal/protocol"
+	"github.com/icexin/gocraft/world"
+)
+
+type BlockEdit struct {
+	Id world.Vec3
+	W  int
+}
+
+type UpdateBlocksRequest struct {
+	Id     int32
+	Blocks [][4]int
+}
+
+type ChunkVersion struct {
+	P, Q    int
+	Version string
+}
+
+type UpdateBlocksResponse struct {
+	Versions []ChunkVersion
+}
+
+const (
+	maxBatchEdits   = 256
+	maxUpdateRetry  = 5
+	updateFlushTime = 50 * time.Millisecond
+)
+
+// UpdateQueue sends local block edits to the server in order.
+// Edits pushed between two flushes are coalesced and sent as one batch.
+type UpdateQueue struct {
+	mutex   sync.Mutex
+	pending []BlockEdit
+	sigch   chan struct{}
+
+	// serializes senders to keep the edits in order
+	sendMutex sync.Mutex
+
+	// push time of the blocks waiting for the server ack
+	pushed  map[world.Vec3]time.Time
+	latency time.Duration
+
+	batchUnsupported bool
+}
+
+func NewUpdateQueue() *UpdateQueue {
+	return &UpdateQueue{
+		sigch:  make(chan struct{}, 1),
+		pushed: make(map[world.Vec3]time.Time),
+	}
+}
+
+func (q *UpdateQueue) Push(edits ...BlockEdit) {
+	if *serverAddr == "" {
+		return
+	}
+	now := time.Now()
+	q.mutex.Lock()
+	q.pending = append(q.pending, edits...)
+	for _, e := range edits {
+		if _, ok := q.pushed[e.Id]; !ok {
+			q.pushed[e.Id] = now
+		}
+	}
+	q.mutex.Unlock()
+	select {
+	case q.sigch <- struct{}{}:
+	default:
+	}
+}
+
+func (q *UpdateQueue) take() []BlockEdit {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	n := len(q.pending)
+	if n > maxBatchEdits {
+		n = maxBatchEdits
+	}
+	edits := coalesceEdits(q.pending[:n])
+	q.pending = q.pending[n:]
+	if len(q.pending) == 0 {
+		q.pending = nil
+	}
+	return edits
+}
+
+// requeue puts edits failed to send back to the front of the queue.
+func (q *UpdateQueue) requeue(edits []BlockEdit) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.pending = append(edits[:len(edits):len(edits)], q.pending...)
+}
+
+// acked records the latency from the oldest local edit of the blocks to the server ack.
+func (q *UpdateQueue) acked(edits []BlockEdit, ok bool) {
+	now := time.Now()
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	var latency time.Duration
+	for _, e := range edits {
+		if t, exist := q.pushed[e.Id]; exist && now.Sub(t) > latency {
+			latency = now.Sub(t)
+		}
+		delete(q.pushed, e.Id)
+	}
+	if ok && latency > 0 {
+		q.latency = latency
+	}
+}
+
+// Latency returns the last measured time between a local edit and its server ack.
+func (q *UpdateQueue) Latency() time.Duration {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.latency
+}
+
+// coalesceEdits keeps only the last edit of every block,
+// in the order of the last edits.
+func coalesceEdits(edits []BlockEdit) []BlockEdit {
+	last := make(map[world.Vec3]int, len(edits))
+	for i, e := range edits {
+		last[e.Id] = i
+	}
+	ret := make([]BlockEdit, 0, len(last))
+	for i, e := range edits {
+		if last[e.Id] == i {
+			ret = append(ret, e)
+		}
+	}
+	return ret
+}
+
+func (q *UpdateQueue) Loop() {
+	defer recoverPanic()
+	tick := time.NewTicker(updateFlushTime)
+	defer tick.Stop()
+	for {
+		select {
+		case <-q.sigch:
+			// give the following edits of a drag or a tool a chance to join the batch
+			time.Sleep(updateFlushTime)
+		case <-tick.C:
+		}
+		q.Flush()
+	}
+}
+
+// Flush sends all the pending edits, edits are kept in the queue while offline.
+func (q *UpdateQueue) Flush() {
+	q.sendMutex.Lock()
+	defer q.sendMutex.Unlock()
+	for currentClient() != nil {
+		edits := q.take()
+		if len(edits) == 0 {
+			break
+		}
+		if left := q.send(edits); left != nil {
+			q.requeue(left)
+			break
+		}
+	}
+}
+
+// send returns the edits not sent because of the connection lost, nil
+// when they were all sent or dropped. The retries only send the edits
+// left by the last try.
+func (q *UpdateQueue) send(edits []BlockEdit) []BlockEdit {
+	backoff := 100 * time.Millisecond
+	for i := 0; ; i++ {
+		left, err := q.sendOnce(edits)
+		q.acked(edits[:len(edits)-len(left)], true)
+		edits = left
+		if err == nil {
+			return nil
+		}
+		if err == errOffline {
+			return edits
+		}
+		if i+1 >= maxUpdateRetry {
+			netLog.Errorf("drop %d block updates after %d retries:%s", len(edits), i+1, err)
+			q.acked(edits, false)
+			return nil
+		}
+		netLog.Warnf("update blocks error:%s, retry in %s", err, backoff)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// sendOnce returns the edits left to send with the error, the single
+// updates sent before a failure aren't sent again.
+func (q *UpdateQueue) sendOnce(edits []BlockEdit) ([]BlockEdit, error) {
+	if q.batchUnsupported || !serverMay(protocol.CapBatchUpdates) || len(edits) == 1 {
+		for len(edits) > 0 {
+			err := clientUpdateBlock(edits[0].Id, edits[0].W)
+			if err != nil {
+				return edits, err
+			}
+			edits = edits[1:]
+		}
+		return nil, nil
+	}
+
+	c := currentClient()
+	if c == nil {
+		return edits, errOffline
+	}
+	req := &UpdateBlocksRequest{
+		Id: c.ClientId,
+	}
+	for _, e := range edits {
+		req.Blocks = append(req.Blocks, [...]int{e.Id.X, e.Id.Y, e.Id.Z, e.W})
+	}
+	rep := new(UpdateBlocksResponse)
+	err := clientCall("Block.UpdateBlocks", req, rep)
+	if isMethodNotFound(err) {
+		netLog.Warnf("server doesn't support batch block update, fallback to single update")
+		q.batchUnsupported = true
+		return q.sendOnce(edits)
+	}
+	if err != nil {
+		return edits, err
+	}
+	for _, v := range rep.Versions {
+		versions.UpdateChunkVersion(world.Vec3{X: v.P, Y: 0, Z: v.Q}, v.Version)
+	}
+	return nil, nil
+}
+
+func clientUpdateBlock(id world.Vec3, w int) error {
+	c := currentClient()
+	if c == nil {
+		return errOffline
+	}
+	cid := id.Chunkid()
+	req := &proto.UpdateBlockRequest{
+		Id: c.ClientId,
+		P:  cid.X,
+		Q:  cid.Z,
+		X:  id.X,
+		Y:  id.Y,
+		Z:  id.Z,
+		W:  w,
+	}
+	rep := new(proto.UpdateBlockResponse)
+	err := clientCall("Block.UpdateBlock", req, rep)
+	if err != nil {
+		return err
+	}
+	versions.UpdateChunkVersion(cid, rep.Version)
+	return nil
+}
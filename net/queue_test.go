@@ -0,0 +1,53 @@
+package net
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/icexin/gocraft/world"
+)
+
+func TestCoalesceEdits(t *testing.T) {
+	a, b, c := world.Vec3{X: 1}, world.Vec3{X: 2}, world.Vec3{X: 3}
+	edits := []BlockEdit{{a, 1}, {b, 2}, {a, 0}, {c, 3}, {b, 4}}
+	want := []BlockEdit{{a, 0}, {c, 3}, {b, 4}}
+	if got := coalesceEdits(edits); !reflect.DeepEqual(got, want) {
+		t.Errorf("coalesced %v, want %v", got, want)
+	}
+}
+
+func TestUpdateQueueBatches(t *testing.T) {
+	addr := *serverAddr
+	*serverAddr = "test"
+	defer func() { *serverAddr = addr }()
+
+	q := NewUpdateQueue()
+	var edits []BlockEdit
+	for i := 0; i < maxBatchEdits+10; i++ {
+		edits = append(edits, BlockEdit{world.Vec3{X: i}, 1})
+	}
+	q.Push(edits...)
+	batch := q.take()
+	if !reflect.DeepEqual(batch, edits[:maxBatchEdits]) {
+		t.Fatalf("first batch of %d edits, want the %d first", len(batch), maxBatchEdits)
+	}
+	// the edits left unsent go back before the ones pushed since
+	q.Push(BlockEdit{world.Vec3{Z: 1}, 2})
+	q.requeue(batch[len(batch)-2:])
+	want := append(append([]BlockEdit{}, batch[len(batch)-2:]...), edits[maxBatchEdits:]...)
+	want = append(want, BlockEdit{world.Vec3{Z: 1}, 2})
+	if got := q.take(); !reflect.DeepEqual(got, want) {
+		t.Errorf("second batch %v, want %v", got, want)
+	}
+	if got := q.take(); len(got) != 0 {
+		t.Errorf("edits %v left", got)
+	}
+}
+
+func TestUpdateQueueOffline(t *testing.T) {
+	q := NewUpdateQueue()
+	q.Push(BlockEdit{world.Vec3{}, 1})
+	if got := q.take(); len(got) != 0 {
+		t.Errorf("edits %v queued without a server", got)
+	}
+}
@@ -0,0 +1,613 @@
+// Package net is the client of a gocraft server: it fetches the chunks,
+// sends the block edits and the player state in order, reconnects and
+// syncs the server clock. The changes pushed by the server are handed to a
+// Handler.
+package net
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/rpc"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	gocraft "github.com/icexin/gocraft-server/client"
+	"github.com/icexin/gocraft-server/proto"
+	"github.com/icexin/gocraft/internal/logging"
+	"github.com/icexin/gocraft/internal/protocol"
+	"github.com/icexin/gocraft/world"
+)
+
+var (
+	serverAddr = flags.String("s", "", "server address, host[:port] or ws(s)://host[:port]/path")
+
+	clientMutex sync.RWMutex
+	client      *gocraft.Client
+	connState   ConnState
+	closing     bool
+	// why the server dropped us, shown when kicked or incompatible
+	dropReason string
+
+	updateQueue = NewUpdateQueue()
+
+	handler  Handler
+	versions ChunkVersions
+
+	errOffline = errors.New("offline")
+)
+
+// Handler applies the changes pushed by the server to the game, called on
+// the goroutines of the client.
+type Handler interface {
+	// UpdateBlock applies the block edit of another player.
+	UpdateBlock(id world.Vec3, w int)
+	// RemovePlayer drops a player who left.
+	RemovePlayer(id int32)
+	// Reconnected is called once a lost connection is back and the edits
+	// made offline are sent, the chunks are fetched again.
+	Reconnected()
+	// RetryFetches fetches again the chunks which failed to fetch, called
+	// every fetchRetryTime while online.
+	RetryFetches()
+}
+
+// ChunkVersions keeps the versions of the chunks fetched from the server,
+// the next fetches only get the edits made since, *store.Store is one.
+type ChunkVersions interface {
+	GetChunkVersion(id world.Vec3) string
+	UpdateChunkVersion(id world.Vec3, version string) error
+}
+
+var netLog = logging.New("net")
+
+// PanicHandler, if set, is called with the value and the stack of a panic
+// in a goroutine of the client before it goes on.
+var PanicHandler func(v interface{}, stack []byte)
+
+// recoverPanic hands the panic of the goroutine to PanicHandler and panics
+// again.
+func recoverPanic() {
+	if v := recover(); v != nil {
+		if PanicHandler != nil {
+			PanicHandler(v, debug.Stack())
+		}
+		panic(v)
+	}
+}
+
+// ServerAddr returns the server of -s, empty to play offline.
+func ServerAddr() string {
+	return *serverAddr
+}
+
+type ConnState int
+
+const (
+	ConnOffline ConnState = iota
+	ConnReconnecting
+	ConnOnline
+	ConnKicked
+	ConnIncompatible
+	ConnRejected
+)
+
+func (s ConnState) String() string {
+	switch s {
+	case ConnReconnecting:
+		return "reconnecting"
+	case ConnOnline:
+		return "online"
+	case ConnKicked:
+		return "kicked"
+	case ConnIncompatible:
+		return "incompatible"
+	case ConnRejected:
+		return "rejected"
+	default:
+		return "offline"
+	}
+}
+
+const (
+	minReconnectDelay = time.Second
+	maxReconnectDelay = 30 * time.Second
+
+	// the chunks failing to fetch are fetched again every fetchRetryTime,
+	// after maxFetchErrors failures in a row the connection is dropped and
+	// the client reconnects
+	fetchRetryTime = 10 * time.Second
+	maxFetchErrors = 8
+)
+
+func dialConn(addr string) (net.Conn, error) {
+	if isWebSocketAddr(addr) {
+		return dialWebSocket(addr)
+	}
+	if strings.Index(addr, ":") == -1 {
+		addr += ":8421"
+	}
+	if *useTLS {
+		return dialTLS(addr)
+	}
+	return net.DialTimeout("tcp", addr, 5*time.Second)
+}
+
+func dialServer() (*gocraft.Client, error) {
+	conn, err := dialConn(*serverAddr)
+	if err != nil {
+		return nil, err
+	}
+	conn = &countConn{Conn: conn, stat: Stat}
+	c := gocraft.NewClient()
+	c.RegisterService("Block", &BlockService{})
+	c.RegisterService("Player", &PlayerService{})
+	c.Start(conn)
+	err = hello(c)
+	if err == nil {
+		err = login(c)
+	}
+	if err != nil {
+		c.Close()
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// InitClient connects to the server of -s, if any, h gets the changes the
+// server pushes and v keeps the versions of the fetched chunks. The game
+// goes on offline if the server refuses the player.
+func InitClient(h Handler, v ChunkVersions) error {
+	if *serverAddr == "" {
+		return nil
+	}
+	handler, versions = h, v
+	c, err := dialServer()
+	if state, ok := refusal(err); ok {
+		// keep playing offline, the title tells the player why
+		setRefused(state, err)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	setClient(c)
+	go updateQueue.Loop()
+	go clock.SyncLoop()
+	go mineEventLoop()
+	go fetchRetryLoop()
+	return nil
+}
+
+func CloseClient() {
+	clientMutex.Lock()
+	defer clientMutex.Unlock()
+	closing = true
+	if client != nil {
+		client.Close()
+	}
+}
+
+func setClient(c *gocraft.Client) {
+	clientMutex.Lock()
+	client = c
+	connState = ConnOnline
+	clientMutex.Unlock()
+}
+
+func currentClient() *gocraft.Client {
+	clientMutex.RLock()
+	defer clientMutex.RUnlock()
+	return client
+}
+
+func ConnectionState() ConnState {
+	clientMutex.RLock()
+	defer clientMutex.RUnlock()
+	return connState
+}
+
+// DropReason returns why the server dropped the client when kicked or incompatible.
+func DropReason() string {
+	clientMutex.RLock()
+	defer clientMutex.RUnlock()
+	return dropReason
+}
+
+// refusal returns the state of the dialServer errors retrying won't fix.
+func refusal(err error) (ConnState, bool) {
+	switch err.(type) {
+	case *ProtocolError:
+		return ConnIncompatible, true
+	case *LoginError:
+		return ConnRejected, true
+	}
+	return ConnOffline, false
+}
+
+func setRefused(state ConnState, err error) {
+	clientMutex.Lock()
+	connState = state
+	dropReason = err.Error()
+	clientMutex.Unlock()
+	netLog.Errorf("can't talk to server:%s", err)
+}
+
+// kickClient drops the connection without reconnecting, the game keeps running offline.
+func kickClient(reason string) {
+	clientMutex.Lock()
+	c := client
+	client = nil
+	connState = ConnKicked
+	dropReason = reason
+	clientMutex.Unlock()
+
+	netLog.Warnf("kicked by server:%s", reason)
+	if c != nil {
+		go c.Close()
+	}
+}
+
+// clientCall calls the server, connection errors switch the client to offline
+// mode and start reconnecting, errOffline is returned in this case.
+func clientCall(method string, req, rep interface{}) error {
+	c := currentClient()
+	if c == nil {
+		return errOffline
+	}
+	start := time.Now()
+	err := c.Call(method, req, rep)
+	_, serverError := err.(rpc.ServerError)
+	Stat.RecordCall(time.Since(start), err != nil && !serverError)
+	if err == nil || serverError {
+		return err
+	}
+	onConnError(c, err)
+	return errOffline
+}
+
+func onConnError(c *gocraft.Client, err error) {
+	clientMutex.Lock()
+	if client != c || closing {
+		clientMutex.Unlock()
+		return
+	}
+	client = nil
+	connState = ConnReconnecting
+	clientMutex.Unlock()
+
+	netLog.Warnf("lost connection to server:%s", err)
+	c.Close()
+	go reconnectLoop()
+}
+
+func reconnectLoop() {
+	defer recoverPanic()
+	delay := minReconnectDelay
+	for {
+		time.Sleep(delay)
+		c, err := dialServer()
+		if err == nil {
+			setClient(c)
+			break
+		}
+		if state, ok := refusal(err); ok {
+			// the server was replaced by an incompatible one or stopped
+			// taking the player, retrying won't help
+			setRefused(state, err)
+			return
+		}
+		netLog.Warnf("reconnect error:%s, retry in %s", err, delay)
+		delay *= 2
+		if delay > maxReconnectDelay {
+			delay = maxReconnectDelay
+		}
+	}
+	netLog.Infof("reconnected to %s", *serverAddr)
+	clock.Reset()
+	// replay edits made while offline before pulling others' changes
+	updateQueue.Flush()
+	handler.Reconnected()
+}
+
+// FetchChunkDeltaRequest asks the server for the block edits made to a chunk
+// since Version. MaxEdits bounds the size of the delta, the server answers
+// with all the edits of the chunk when the gap is larger. Both are applied
+// over the cached chunk the same way, as the full fetches are.
+type FetchChunkDeltaRequest struct {
+	P, Q     int
+	Version  string
+	MaxEdits int
+	Accept   []string
+}
+
+type FetchChunkDeltaResponse struct {
+	ChunkData
+}
+
+// FetchChunkRequest extends proto.FetchChunkRequest with the chunk encodings
+// the client accepts, old servers ignore the field and send plain blocks.
+type FetchChunkRequest struct {
+	P, Q    int
+	Version string
+	Accept  []string
+}
+
+type FetchChunkResponse struct {
+	ChunkData
+}
+
+// ChunkData holds the chunk blocks either in Blocks or encoded in Data.
+type ChunkData struct {
+	Blocks   [][4]int
+	Encoding string
+	Data     []byte
+	Version  string
+	// chunkReadOnly, chunkProtected
+	Flags int
+}
+
+func (d *ChunkData) decode(cid world.Vec3) ([][4]int, error) {
+	var (
+		blocks [][4]int
+		err    error
+	)
+	switch d.Encoding {
+	case "":
+		blocks = d.Blocks
+		recordChunkNetStat(blocks, nil, cid)
+	case protocol.ChunkEncoding:
+		blocks, err = protocol.DecodeChunkBlocks(cid, d.Data)
+		if err != nil {
+			return nil, err
+		}
+		recordChunkNetStat(blocks, d.Data, cid)
+	default:
+		return nil, fmt.Errorf("unknown chunk encoding %q", d.Encoding)
+	}
+	return blocks, nil
+}
+
+const maxDeltaEdits = 512
+
+var (
+	// set when the server doesn't know Block.FetchChunkDelta
+	deltaUnsupported int32
+	// chunk fetches failed in a row
+	fetchErrors int32
+)
+
+func isMethodNotFound(err error) bool {
+	_, ok := err.(rpc.ServerError)
+	return ok && strings.HasPrefix(err.Error(), "rpc: can't find")
+}
+
+// ClientFetchChunk calls f on the server changes of chunk id. Nothing is
+// fetched offline, the chunks are fetched again once reconnected. Server
+// errors and bad replies are returned, the world retries them later.
+func ClientFetchChunk(id world.Vec3, f func(bid world.Vec3, w int)) error {
+	c := currentClient()
+	if c == nil {
+		return nil
+	}
+	err := clientFetchChunk(id, f)
+	if err == nil {
+		atomic.StoreInt32(&fetchErrors, 0)
+		return nil
+	}
+	if atomic.AddInt32(&fetchErrors, 1) >= maxFetchErrors {
+		// the server keeps failing, start over on a new connection
+		atomic.StoreInt32(&fetchErrors, 0)
+		onConnError(c, err)
+	}
+	return err
+}
+
+func clientFetchChunk(id world.Vec3, f func(bid world.Vec3, w int)) error {
+	version := versions.GetChunkVersion(id)
+	if version != "" && atomic.LoadInt32(&deltaUnsupported) == 0 && serverMay(protocol.CapDeltaChunks) {
+		ok, err := clientFetchChunkDelta(id, version, f)
+		if ok || err != nil {
+			return err
+		}
+	}
+	return clientFetchFullChunk(id, version, f)
+}
+
+// fetchRetryLoop fetches again the chunks which failed to fetch while online.
+func fetchRetryLoop() {
+	defer recoverPanic()
+	tick := time.NewTicker(fetchRetryTime)
+	defer tick.Stop()
+	for range tick.C {
+		if ConnectionState() == ConnOnline {
+			handler.RetryFetches()
+		}
+	}
+}
+
+// clientFetchChunkDelta returns false if the server doesn't support deltas.
+func clientFetchChunkDelta(id world.Vec3, version string, f func(bid world.Vec3, w int)) (bool, error) {
+	req := FetchChunkDeltaRequest{
+		P:        id.X,
+		Q:        id.Z,
+		Version:  version,
+		MaxEdits: maxDeltaEdits,
+		Accept:   acceptedEncodings(),
+	}
+	rep := new(FetchChunkDeltaResponse)
+	err := clientCall("Block.FetchChunkDelta", req, rep)
+	if err == errOffline {
+		return true, nil
+	}
+	if isMethodNotFound(err) {
+		netLog.Warnf("server doesn't support delta chunk sync, fallback to full sync")
+		atomic.StoreInt32(&deltaUnsupported, 1)
+		return false, nil
+	}
+	if err != nil {
+		return true, err
+	}
+	blocks, err := rep.decode(id)
+	if err != nil {
+		return true, err
+	}
+	setChunkFlags(id, rep.Flags)
+	for _, b := range blocks {
+		f(world.Vec3{X: b[0], Y: b[1], Z: b[2]}, b[3])
+	}
+	if req.Version != rep.Version {
+		versions.UpdateChunkVersion(id, rep.Version)
+	}
+	return true, nil
+}
+
+func clientFetchFullChunk(id world.Vec3, version string, f func(bid world.Vec3, w int)) error {
+	req := FetchChunkRequest{
+		P:       id.X,
+		Q:       id.Z,
+		Version: version,
+		Accept:  acceptedEncodings(),
+	}
+	rep := new(FetchChunkResponse)
+	err := clientCall("Block.FetchChunk", req, rep)
+	if err == errOffline {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	blocks, err := rep.decode(id)
+	if err != nil {
+		return err
+	}
+	setChunkFlags(id, rep.Flags)
+	for _, b := range blocks {
+		f(world.Vec3{X: b[0], Y: b[1], Z: b[2]}, b[3])
+	}
+	if req.Version != rep.Version {
+		versions.UpdateChunkVersion(id, rep.Version)
+	}
+	return nil
+}
+
+// UpdateLatency returns the last measured time between a local edit and its
+// server ack.
+func UpdateLatency() time.Duration {
+	return updateQueue.Latency()
+}
+
+// ClientUpdateBlocks queues block edits to be sent to the server in order.
+func ClientUpdateBlocks(edits ...BlockEdit) {
+	updateQueue.Push(edits...)
+}
+
+type SetAFKRequest struct {
+	Id  int32
+	AFK bool
+}
+
+type SetAFKResponse struct {
+}
+
+func ClientSetAFK(afk bool) {
+	c := currentClient()
+	if c == nil {
+		return
+	}
+	req := &SetAFKRequest{
+		Id:  c.ClientId,
+		AFK: afk,
+	}
+	err := clientCall("Player.SetAFK", req, new(SetAFKResponse))
+	if err != nil && err != errOffline && !isMethodNotFound(err) {
+		netLog.Errorf("set afk error:%s", err)
+	}
+}
+
+// RemotePlayer is the state of another player sent by the server.
+type RemotePlayer struct {
+	State proto.PlayerState
+	// the server time of the state
+	Time float64
+	AFK  bool
+}
+
+// ClientUpdatePlayerState sends the state of the player and returns the
+// other players within radius, false if offline or if the call failed.
+func ClientUpdatePlayerState(state proto.PlayerState, radius float32) (map[int32]RemotePlayer, bool) {
+	c := currentClient()
+	if c == nil {
+		return nil, false
+	}
+	req := &protocol.UpdateStateRequest{
+		Id:     c.ClientId,
+		State:  state,
+		Radius: radius,
+	}
+	rep := new(protocol.UpdateStateResponse)
+	err := clientCall("Player.UpdateState", req, rep)
+	if err == errOffline {
+		return nil, false
+	}
+	if err != nil {
+		// the next state is sent in a moment
+		netLog.Warnf("update player state error:%s", err)
+		return nil, false
+	}
+
+	now := clock.Now()
+	players := make(map[int32]RemotePlayer, len(rep.Players))
+	for id, player := range rep.Players {
+		// old servers send all the players, filter them here
+		if !rep.Interest && !inInterest(state, player, radius) {
+			continue
+		}
+		t, ok := rep.Times[id]
+		if !ok {
+			t = now
+		}
+		players[id] = RemotePlayer{State: player, Time: t, AFK: rep.AFK[id]}
+	}
+	return players, true
+}
+
+func inInterest(self, other proto.PlayerState, radius float32) bool {
+	dx, dz := self.X-other.X, self.Z-other.Z
+	return dx*dx+dz*dz <= radius*radius
+}
+
+type BlockService struct {
+}
+
+func (s *BlockService) UpdateBlock(req *proto.UpdateBlockRequest, rep *proto.UpdateBlockResponse) error {
+	netLog.Debugf("rpc::UpdateBlock:%v", *req)
+	handler.UpdateBlock(world.Vec3{X: req.X, Y: req.Y, Z: req.Z}, req.W)
+	return nil
+}
+
+type PlayerService struct {
+}
+
+func (s *PlayerService) SetPermissions(req *protocol.SetPermissionsRequest, rep *protocol.SetPermissionsResponse) error {
+	var op int32
+	if req.Op {
+		op = 1
+	}
+	atomic.StoreInt32(&serverOp, op)
+	return nil
+}
+
+func (s *PlayerService) Kick(req *protocol.KickRequest, rep *protocol.KickResponse) error {
+	kickClient(req.Reason)
+	return nil
+}
+
+func (s *PlayerService) RemovePlayer(req *proto.RemovePlayerRequest, rep *proto.RemovePlayerResponse) error {
+	handler.RemovePlayer(req.Id)
+	return nil
+}
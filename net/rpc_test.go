@@ -0,0 +1,58 @@
+package net
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/icexin/gocraft-server/proto"
+	"github.com/icexin/gocraft/internal/protocol"
+	"github.com/icexin/gocraft/world"
+)
+
+func TestRefusal(t *testing.T) {
+	tests := []struct {
+		err   error
+		state ConnState
+		ok    bool
+	}{
+		{nil, ConnOffline, false},
+		{errors.New("connection refused"), ConnOffline, false},
+		{&ProtocolError{Client: 1, MinClient: 2}, ConnIncompatible, true},
+		{&LoginError{Reason: "bad token"}, ConnRejected, true},
+	}
+	for _, tt := range tests {
+		if state, ok := refusal(tt.err); state != tt.state || ok != tt.ok {
+			t.Errorf("refusal(%v) = %v, %v, want %v, %v", tt.err, state, ok, tt.state, tt.ok)
+		}
+	}
+}
+
+func TestInInterest(t *testing.T) {
+	self := proto.PlayerState{X: 10, Z: 10}
+	if !inInterest(self, proto.PlayerState{X: 13, Y: 100, Z: 14}, 5) {
+		t.Error("player at distance 5 left out")
+	}
+	if inInterest(self, proto.PlayerState{X: 14, Z: 14}, 5) {
+		t.Error("player past the radius kept")
+	}
+}
+
+func TestChunkDataDecode(t *testing.T) {
+	cid := world.Vec3{X: 1, Z: -1}
+	blocks := [][4]int{{32, 1, -32, world.Stone}, {33, 1, -32, world.Grass}}
+	plain := &ChunkData{Blocks: blocks}
+	encoded := &ChunkData{
+		Encoding: protocol.ChunkEncoding,
+		Data:     protocol.EncodeChunkBlocks(cid, blocks),
+	}
+	for _, d := range []*ChunkData{plain, encoded} {
+		got, err := d.decode(cid)
+		if err != nil || !reflect.DeepEqual(got, blocks) {
+			t.Errorf("%q decoded %v, %v, want %v", d.Encoding, got, err, blocks)
+		}
+	}
+	if _, err := (&ChunkData{Encoding: "zip"}).decode(cid); err == nil {
+		t.Error("unknown encoding decoded")
+	}
+}
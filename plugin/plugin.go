@@ -0,0 +1,119 @@
+// Package plugin is the API of the gocraft plugins. A plugin is a Go plugin
+// built against the same gocraft version and registering itself from init:
+//
+//	package main
+//
+//	import (
+//		"github.com/icexin/gocraft/plugin"
+//		"github.com/icexin/gocraft/world"
+//	)
+//
+//	func init() {
+//		plugin.Register(&plugin.Plugin{
+//			Name: "marble",
+//			Blocks: []plugin.Block{
+//				{Type: 100, Tiles: [6]int{5, 5, 5, 5, 5, 5}, Hardness: 2},
+//			},
+//			Handlers: plugin.Handlers{
+//				BlockBroken: func(g plugin.Game, id world.Vec3, w int) {
+//					if w == 100 {
+//						g.Print("marble broken")
+//					}
+//				},
+//			},
+//		})
+//	}
+//
+// go build -buildmode=plugin -o marble.so, then put marble.so in the -plugins
+// directory of the game.
+package plugin
+
+import (
+	"sync"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/icexin/gocraft/world"
+)
+
+// Game is the part of the game reachable by the plugins, call it from the
+// commands and the handlers running on the main thread only.
+type Game interface {
+	// Block returns the block at id, -1 if its chunk isn't loaded.
+	Block(id world.Vec3) int
+	// SetBlocks changes blocks like the player does, the changes are saved
+	// and sent to the server.
+	SetBlocks(edits ...Edit)
+	// Player returns the position of the player.
+	Player() mgl32.Vec3
+	// Print shows a message to the player.
+	Print(msg string)
+}
+
+type Edit struct {
+	Id world.Vec3
+	W  int
+}
+
+// FirstBlock is the first block type free for the plugins, the lower ones
+// belong to the game.
+const FirstBlock = 100
+
+// Block is a new block type, it's added to the items of the player.
+type Block struct {
+	Type int
+	// tiles of the texture atlas: left, right, top, bottom, front, back
+	Tiles [6]int
+	// seconds to break the block by hand, 0 for the default
+	Hardness float32
+	// power an explosion loses crossing the block, 0 for the default
+	Resistance float32
+}
+
+// Command is a console command, args are the words after its name.
+type Command struct {
+	Name  string
+	Usage string
+	Run   func(g Game, args []string) (string, error)
+}
+
+// Handlers are called on the game events, nil ones are skipped.
+type Handlers struct {
+	// the player placed or broke block w at id, on the main thread
+	BlockPlaced func(g Game, id world.Vec3, w int)
+	BlockBroken func(g Game, id world.Vec3, w int)
+	// the player moved, on the main thread every frame it moves
+	PlayerMoved func(g Game, from, to mgl32.Vec3)
+	// chunk was generated and its saved changes applied, called from the
+	// world load pipeline
+	ChunkGenerated func(chunk *world.Chunk)
+	// another player showed up, called from the network goroutines
+	PlayerJoined func(id int32)
+	// the player was hurt, on the main thread
+	Damage func(g Game, amount int, reason string)
+}
+
+type Plugin struct {
+	Name     string
+	Blocks   []Block
+	Commands []Command
+	Handlers
+}
+
+var (
+	mutex   sync.Mutex
+	plugins []*Plugin
+)
+
+// Register adds a plugin, call it from the init of the plugin.
+func Register(p *Plugin) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	plugins = append(plugins, p)
+}
+
+// Plugins returns the registered plugins in load order.
+func Plugins() []*Plugin {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return append([]*Plugin(nil), plugins...)
+}
@@ -0,0 +1,140 @@
+#version 330 core
+
+in vec2 Tex;
+in float diff;
+in float fog_factor;
+in vec3 Pos;
+in vec3 Normal;
+#ifdef BAKED_LIGHT
+in float Light;
+#endif
+uniform sampler2D tex;
+uniform sampler3D lightmap;
+uniform vec3 origin;
+uniform float uselight;
+uniform float dim;
+uniform float time;
+uniform vec3 foliage;
+uniform float snow;
+uniform sampler2DArrayShadow shadowmap;
+uniform float useshadow;
+uniform mat4 shadowmat0;
+uniform mat4 shadowmat1;
+uniform mat4 shadowmat2;
+uniform float translucent;
+// gray out of the chunks the player can't edit
+uniform float locked;
+// the sky behind the far blocks
+uniform vec3 fogcolor;
+
+out vec4 FragColor;
+
+// the chunk and a border of one cell from its neighbors
+const vec3 light_size = vec3(34, 34, 128);
+// the flame texture is 3 frames from tile 55
+const vec2 flame_tile = vec2(7, 3) / 16;
+const float flame_frames = 3;
+const float flame_fps = 8;
+// the see-through magenta texels of the plain glass
+const vec4 glass_color = vec4(0.85, 0.93, 1, 0.2);
+
+float light() {
+#ifdef BAKED_LIGHT
+    return Light;
+#else
+    // sample the air cell in front of the face, the volume is stored as (x, z, y)
+    vec3 p = Pos + Normal * 0.5 - origin + 0.5;
+    return texture(lightmap, p.xzy / light_size).r;
+#endif
+}
+
+// shadow_at returns the lit fraction of p in cascade layer, or -1 if p is
+// outside the cascade.
+float shadow_at(mat4 mat, float layer, vec3 p) {
+    vec3 c = (mat * vec4(p, 1)).xyz * 0.5 + 0.5;
+    if (any(lessThan(c.xy, vec2(0.02))) || any(greaterThan(c.xy, vec2(0.98))) || c.z > 1) {
+        return -1;
+    }
+    return texture(shadowmap, vec4(c.xy, layer, c.z));
+}
+
+float shadow() {
+    if (useshadow == 0) {
+        return 1;
+    }
+    // push the point off its face against shadow acne
+    vec3 p = Pos + Normal * 0.08;
+    float s = shadow_at(shadowmat0, 0, p);
+    if (s < 0) {
+        s = shadow_at(shadowmat1, 1, p);
+    }
+    if (s < 0) {
+        s = shadow_at(shadowmat2, 2, p);
+    }
+    return s < 0 ? 1 : s;
+}
+
+float tile_index() {
+    vec2 t = floor(Tex * 16);
+    return t.y * 16 + t.x;
+}
+
+// leaves, grass top and plants follow the season
+bool is_foliage(float idx) {
+    return idx == 14 || idx == 32 || (idx >= 48 && idx <= 54);
+}
+
+bool is_flame() {
+    vec2 d = Tex - flame_tile;
+    return d.x >= 0 && d.x < 1.0/16 && d.y >= 0 && d.y < 1.0/16;
+}
+
+void main() {
+    vec2 uv = Tex;
+    bool flame = is_flame();
+    if (flame) {
+        uv.x += floor(mod(time * flame_fps, flame_frames)) / 16;
+    }
+    vec4 texel = texture(tex, vec2(uv.x, 1-uv.y));
+    vec3 color = texel.rgb;
+    float alpha = 1;
+    // the see-through texels are only drawn by the translucent pass
+    if (color == vec3(1,0,1) || texel.a < 1) {
+        if (translucent == 0) {
+            discard;
+        }
+        if (texel.a < 1) {
+            alpha = texel.a;
+        } else {
+            color = glass_color.rgb;
+            alpha = glass_color.a;
+        }
+    }
+    if (flame) {
+        FragColor = vec4(mix(color, fogcolor, fog_factor) * dim, 1);
+        return;
+    }
+    float idx = tile_index();
+    if (is_foliage(idx)) {
+        color = clamp(color * foliage, 0, 1);
+    }
+    if (snow > 0 && Normal.y > 0.5 && (idx == 32 || idx == 14)) {
+        color = mix(color, vec3(0.95, 0.97, 1), snow);
+    }
+    float df = diff * shadow();
+    if (color == vec3(1,1,1)) {
+        df = 1- diff * 0.2;
+    }
+    vec3 ambient = 0.5 * vec3(1, 1, 1);
+    vec3 diffcolor = df * 0.5 * vec3(1,1,1);
+    color = (ambient + diffcolor) * color;
+    if (uselight > 0) {
+        color = color * mix(0.35, 1, light());
+    }
+    if (locked > 0) {
+        float gray = dot(color, vec3(0.299, 0.587, 0.114));
+        color = mix(color, vec3(gray * 0.85), locked);
+    }
+    color = mix(color, fogcolor, fog_factor);
+    FragColor = vec4(color * dim, alpha);
+}
@@ -0,0 +1,66 @@
+#version 330 core
+
+layout(location = 0) in vec3 pos;
+layout(location = 1) in vec2 tex;
+layout(location = 2) in vec3 normal;
+#ifdef BAKED_LIGHT
+layout(location = 3) in float light;
+#endif
+
+uniform mat4 matrix;
+uniform vec3 camera;
+uniform float time;
+uniform float wind;
+
+out vec2 Tex;
+out float diff;
+out float fog_factor;
+out vec3 Pos;
+out vec3 Normal;
+#ifdef BAKED_LIGHT
+out float Light;
+#endif
+
+const vec3 lightdir = normalize(vec3(-1, 1, -1));
+// how far in blocks the plant tops and the leaves move in the wind
+const float plant_sway = 0.08;
+const float leaves_sway = 0.03;
+
+// sway returns how far the vertex waves, picked by its tile like is_foliage
+// in block.frag: the top vertices of the plants, the whole leaves.
+float sway() {
+    vec2 t = floor(tex * 16);
+    float idx = t.y * 16 + t.x;
+    // the texture coordinates of the top vertices are at the top of the tile
+    if (idx >= 48 && idx <= 54 && fract(tex.y * 16) > 0.5) {
+        return plant_sway;
+    }
+    if (idx == 14) {
+        return leaves_sway;
+    }
+    return 0;
+}
+
+void main() {
+    vec3 p = pos;
+    float s = sway() * wind;
+    if (s > 0) {
+        // the phase follows the position so the blocks don't move together
+        // and the shared corners of the leaves stay joined
+        float phase = pos.x * 0.7 + pos.z * 0.5;
+        p.x += sin(time * 1.8 + phase) * s;
+        p.z += sin(time * 1.3 + phase * 1.3) * s * 0.6;
+    }
+    gl_Position = matrix *  vec4(p, 1.0);
+
+    float camera_distance = distance(pos, camera);
+    // fog is in fog.glsl, included by the game
+    fog_factor = fog(camera_distance);
+    Tex = tex;
+    diff = max(0, dot(normal, lightdir));
+    Pos = pos;
+    Normal = normal;
+#ifdef BAKED_LIGHT
+    Light = light;
+#endif
+}
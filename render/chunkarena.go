@@ -0,0 +1,193 @@
+package render
+
+import (
+	"sort"
+
+	"github.com/faiface/glhf"
+	"github.com/go-gl/gl/v3.3-core/gl"
+	"github.com/icexin/gocraft/internal/geom"
+)
+
+const arenaInitVertices = 1 << 18
+
+// ChunkArena holds the opaque faces of all the chunk meshes in one vertex
+// buffer behind one vertex array, each mesh at its own base vertex. The
+// visible sections of the chunks are then drawn by a single
+// glMultiDrawElementsIndirect when the GPU has it and no chunk needs state
+// of its own: the light volumes are one 3d texture per chunk, so with
+// -light volume the chunks are still drawn one by one, from the shared
+// vertex array. Call on mainthread.
+type ChunkArena struct {
+	shader   *glhf.Shader
+	vao, vbo uint32
+	stride   int // bytes per vertex
+	capacity int // vertices
+	free     []arenaRange
+
+	// indirect draw commands of the frame
+	indirect uint32
+	cmds     []uint32
+}
+
+// arenaRange is a free range of vertices, the free list is sorted by start
+// and never holds two adjacent ranges.
+type arenaRange struct {
+	start, count int
+}
+
+func NewChunkArena(shader *glhf.Shader) *ChunkArena {
+	a := &ChunkArena{
+		shader:   shader,
+		stride:   shader.VertexFormat().Size(),
+		capacity: arenaInitVertices,
+		free:     []arenaRange{{0, arenaInitVertices}},
+	}
+	gl.GenVertexArrays(1, &a.vao)
+	gl.GenBuffers(1, &a.vbo)
+	gl.BindVertexArray(a.vao)
+	gl.BindBuffer(gl.ARRAY_BUFFER, a.vbo)
+	gl.BufferData(gl.ARRAY_BUFFER, a.capacity*a.stride, nil, gl.STATIC_DRAW)
+	setVertexAttribs(shader)
+	gl.BindVertexArray(0)
+	gl.BindBuffer(gl.ARRAY_BUFFER, 0)
+	return a
+}
+
+// alloc takes n vertices from the first free range large enough, growing
+// the buffer if none is.
+func (a *ChunkArena) alloc(n int) int {
+	for {
+		for i, r := range a.free {
+			if r.count < n {
+				continue
+			}
+			if r.count == n {
+				a.free = append(a.free[:i], a.free[i+1:]...)
+			} else {
+				a.free[i] = arenaRange{r.start + n, r.count - n}
+			}
+			return r.start
+		}
+		a.grow(n)
+	}
+}
+
+// grow doubles the buffer until n more vertices fit, copying the meshes
+// at the same offsets.
+func (a *ChunkArena) grow(n int) {
+	capacity := a.capacity * 2
+	for capacity < a.capacity+n {
+		capacity *= 2
+	}
+	var vbo uint32
+	gl.GenBuffers(1, &vbo)
+	gl.BindBuffer(gl.COPY_WRITE_BUFFER, vbo)
+	gl.BufferData(gl.COPY_WRITE_BUFFER, capacity*a.stride, nil, gl.STATIC_DRAW)
+	gl.BindBuffer(gl.COPY_READ_BUFFER, a.vbo)
+	gl.CopyBufferSubData(gl.COPY_READ_BUFFER, gl.COPY_WRITE_BUFFER, 0, 0, a.capacity*a.stride)
+	gl.BindBuffer(gl.COPY_READ_BUFFER, 0)
+	gl.BindBuffer(gl.COPY_WRITE_BUFFER, 0)
+	gl.DeleteBuffers(1, &a.vbo)
+	a.vbo = vbo
+
+	gl.BindVertexArray(a.vao)
+	gl.BindBuffer(gl.ARRAY_BUFFER, a.vbo)
+	setVertexAttribs(a.shader)
+	gl.BindVertexArray(0)
+	gl.BindBuffer(gl.ARRAY_BUFFER, 0)
+
+	a.Free(int32(a.capacity), capacity-a.capacity)
+	a.capacity = capacity
+}
+
+// SetShader points the vertex attributes to the ones of shader, which must
+// have the same vertex format.
+func (a *ChunkArena) SetShader(shader *glhf.Shader) {
+	a.shader = shader
+	gl.BindVertexArray(a.vao)
+	gl.BindBuffer(gl.ARRAY_BUFFER, a.vbo)
+	setVertexAttribs(shader)
+	gl.BindVertexArray(0)
+	gl.BindBuffer(gl.ARRAY_BUFFER, 0)
+}
+
+// Free gives back the n vertices at start.
+func (a *ChunkArena) Free(start int32, n int) {
+	r := arenaRange{int(start), n}
+	i := sort.Search(len(a.free), func(i int) bool {
+		return a.free[i].start > r.start
+	})
+	a.free = append(a.free, arenaRange{})
+	copy(a.free[i+1:], a.free[i:])
+	a.free[i] = r
+	// merge with the next range, then with the previous one
+	if i+1 < len(a.free) && a.free[i].start+a.free[i].count == a.free[i+1].start {
+		a.free[i].count += a.free[i+1].count
+		a.free = append(a.free[:i+1], a.free[i+2:]...)
+	}
+	if i > 0 && a.free[i-1].start+a.free[i-1].count == a.free[i].start {
+		a.free[i-1].count += a.free[i].count
+		a.free = append(a.free[:i], a.free[i+1:]...)
+	}
+}
+
+// NewMesh uploads the faces of data, built like for NewMesh, into the arena.
+func (a *ChunkArena) NewMesh(data []float32) *Mesh {
+	m := &Mesh{arena: a}
+	stride := a.stride / 4
+	m.faces = len(data) / stride / 6
+	if m.faces == 0 {
+		return m
+	}
+	quads := compactFaces(data, stride)
+	m.base = int32(a.alloc(m.faces * 4))
+	m.vao = a.vao
+	gl.BindVertexArray(a.vao)
+	bindQuadIndices(m.faces)
+	gl.BindVertexArray(0)
+	gl.BindBuffer(gl.ARRAY_BUFFER, a.vbo)
+	gl.BufferSubData(gl.ARRAY_BUFFER, int(m.base)*a.stride, len(quads)*4, gl.Ptr(quads))
+	gl.BindBuffer(gl.ARRAY_BUFFER, 0)
+	return m
+}
+
+// MultiDraw reports whether the chunks of this frame can go through Add.
+func (a *ChunkArena) MultiDraw() bool {
+	return GPU.MultiDrawIndirect && *lightMode != "volume"
+}
+
+// Add queues the visible sections of mesh, drawn by Draw, and returns
+// their faces.
+func (a *ChunkArena) Add(m *Mesh, frustum *geom.Frustum) int {
+	if m.vao == 0 {
+		return 0
+	}
+	// count, instances, first index, base vertex, base instance
+	if m.sections == nil {
+		a.cmds = append(a.cmds, uint32(m.faces*6), 1, 0, uint32(m.base), 0)
+		return m.faces
+	}
+	return m.visibleRanges(frustum, func(first, count int32) {
+		a.cmds = append(a.cmds, uint32(count), 1, uint32(first), uint32(m.base), 0)
+	})
+}
+
+// Draw draws the sections queued by Add in one call, between Begin and
+// End of the block shader. It returns the number of draw calls.
+func (a *ChunkArena) Draw() int {
+	n := len(a.cmds) / 5
+	if n == 0 {
+		return 0
+	}
+	if a.indirect == 0 {
+		gl.GenBuffers(1, &a.indirect)
+	}
+	gl.BindVertexArray(a.vao)
+	gl.BindBuffer(gl.DRAW_INDIRECT_BUFFER, a.indirect)
+	gl.BufferData(gl.DRAW_INDIRECT_BUFFER, len(a.cmds)*4, gl.Ptr(a.cmds), gl.STREAM_DRAW)
+	gl.MultiDrawElementsIndirect(gl.TRIANGLES, gl.UNSIGNED_INT, nil, int32(n), 0)
+	gl.BindBuffer(gl.DRAW_INDIRECT_BUFFER, 0)
+	gl.BindVertexArray(0)
+	a.cmds = a.cmds[:0]
+	return 1
+}
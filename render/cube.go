@@ -0,0 +1,231 @@
+package render
+
+import "github.com/icexin/gocraft/world"
+
+const (
+	sleft = iota
+	sright
+	sup
+	sdown
+	sfront
+	sback
+)
+
+// MakeCubeData appends the faces of the cube at block textured with tex to
+// vertices, show: left, right, up, down, front, back,
+func MakeCubeData(vertices []float32, show [6]bool, block world.Vec3, tex *BlockTexture) []float32 {
+	x, y, z := float32(block.X), float32(block.Y), float32(block.Z)
+	if show[sleft] {
+		vertices = appendFace(vertices, tex.Left, -1, 0, 0,
+			x-0.5, y-0.5, z-0.5,
+			x-0.5, y-0.5, z+0.5,
+			x-0.5, y+0.5, z+0.5,
+			x-0.5, y+0.5, z-0.5)
+	}
+	if show[sright] {
+		vertices = appendFace(vertices, tex.Right, 1, 0, 0,
+			x+0.5, y-0.5, z+0.5,
+			x+0.5, y-0.5, z-0.5,
+			x+0.5, y+0.5, z-0.5,
+			x+0.5, y+0.5, z+0.5)
+	}
+	if show[sup] {
+		vertices = appendFace(vertices, tex.Up, 0, 1, 0,
+			x-0.5, y+0.5, z+0.5,
+			x+0.5, y+0.5, z+0.5,
+			x+0.5, y+0.5, z-0.5,
+			x-0.5, y+0.5, z-0.5)
+	}
+	if show[sdown] {
+		vertices = appendFace(vertices, tex.Down, 0, -1, 0,
+			x-0.5, y-0.5, z-0.5,
+			x+0.5, y-0.5, z-0.5,
+			x+0.5, y-0.5, z+0.5,
+			x-0.5, y-0.5, z+0.5)
+	}
+	if show[sfront] {
+		vertices = appendFace(vertices, tex.Front, 0, 0, 1,
+			x-0.5, y-0.5, z+0.5,
+			x+0.5, y-0.5, z+0.5,
+			x+0.5, y+0.5, z+0.5,
+			x-0.5, y+0.5, z+0.5)
+	}
+	if show[sback] {
+		vertices = appendFace(vertices, tex.Back, 0, 0, -1,
+			x+0.5, y-0.5, z-0.5,
+			x-0.5, y-0.5, z-0.5,
+			x-0.5, y+0.5, z-0.5,
+			x+0.5, y+0.5, z-0.5)
+	}
+	return vertices
+}
+
+// appendFace appends the triangles a b c and c d a of a face with the
+// texture t and the normal nx ny nz, without a temporary slice.
+func appendFace(vertices []float32, t FaceTexture, nx, ny, nz float32,
+	ax, ay, az, bx, by, bz, cx, cy, cz, dx, dy, dz float32) []float32 {
+	return append(vertices,
+		ax, ay, az, t[0][0], t[0][1], nx, ny, nz,
+		bx, by, bz, t[1][0], t[1][1], nx, ny, nz,
+		cx, cy, cz, t[2][0], t[2][1], nx, ny, nz,
+		cx, cy, cz, t[3][0], t[3][1], nx, ny, nz,
+		dx, dy, dz, t[4][0], t[4][1], nx, ny, nz,
+		ax, ay, az, t[5][0], t[5][1], nx, ny, nz,
+	)
+}
+
+// cubeFaces returns the faces MakeCubeData adds for show.
+func cubeFaces(show [6]bool) int {
+	n := 0
+	for _, s := range show {
+		if s {
+			n++
+		}
+	}
+	return n
+}
+
+// reserveFaces grows vertices once to take n more floats.
+func reserveFaces(vertices []float32, n int) []float32 {
+	if cap(vertices)-len(vertices) >= n {
+		return vertices
+	}
+	grown := make([]float32, len(vertices), len(vertices)+n)
+	copy(grown, vertices)
+	return grown
+}
+
+// MakeWireFrameData appends the edges of the faces of a unit cube in show.
+func MakeWireFrameData(vertices []float32, show [6]bool) []float32 {
+	if show[sleft] {
+		vertices = append(vertices, []float32{
+			// left
+			-0.5, -0.5, -0.5,
+			-0.5, -0.5, +0.5,
+
+			-0.5, -0.5, +0.5,
+			-0.5, +0.5, +0.5,
+
+			-0.5, +0.5, +0.5,
+			-0.5, +0.5, -0.5,
+
+			-0.5, +0.5, -0.5,
+			-0.5, -0.5, -0.5,
+		}...)
+	}
+	if show[sright] {
+		vertices = append(vertices, []float32{
+			// right
+			+0.5, -0.5, +0.5,
+			+0.5, -0.5, -0.5,
+
+			+0.5, -0.5, -0.5,
+			+0.5, +0.5, -0.5,
+
+			+0.5, +0.5, -0.5,
+			+0.5, +0.5, +0.5,
+
+			+0.5, +0.5, +0.5,
+			+0.5, -0.5, +0.5,
+		}...)
+	}
+
+	if show[sup] {
+		vertices = append(vertices, []float32{
+			// top
+			-0.5, +0.5, +0.5,
+			+0.5, +0.5, +0.5,
+
+			+0.5, +0.5, +0.5,
+			+0.5, +0.5, -0.5,
+
+			+0.5, +0.5, -0.5,
+			-0.5, +0.5, -0.5,
+
+			-0.5, +0.5, -0.5,
+			-0.5, +0.5, +0.5,
+		}...)
+	}
+
+	if show[sdown] {
+		vertices = append(vertices, []float32{
+			// bottom
+			+0.5, -0.5, +0.5,
+			-0.5, -0.5, +0.5,
+
+			-0.5, -0.5, +0.5,
+			-0.5, -0.5, -0.5,
+
+			-0.5, -0.5, -0.5,
+			+0.5, -0.5, -0.5,
+
+			+0.5, -0.5, -0.5,
+			+0.5, -0.5, +0.5,
+		}...)
+	}
+
+	if show[sfront] {
+		// z front
+		vertices = append(vertices, []float32{
+			-0.5, -0.5, +0.5,
+			+0.5, -0.5, +0.5,
+
+			+0.5, -0.5, +0.5,
+			+0.5, +0.5, +0.5,
+
+			+0.5, +0.5, +0.5,
+			-0.5, +0.5, +0.5,
+
+			-0.5, +0.5, +0.5,
+			-0.5, -0.5, +0.5,
+		}...)
+	}
+
+	if show[sback] {
+		vertices = append(vertices, []float32{
+			// back
+			+0.5, -0.5, -0.5,
+			-0.5, -0.5, -0.5,
+
+			-0.5, -0.5, -0.5,
+			-0.5, +0.5, -0.5,
+
+			-0.5, +0.5, -0.5,
+			+0.5, +0.5, -0.5,
+
+			+0.5, +0.5, -0.5,
+			+0.5, -0.5, -0.5,
+		}...)
+	}
+
+	return vertices
+}
+
+// plantFaces is the number of faces of MakePlantData.
+const plantFaces = 4
+
+// MakePlantData appends the crossed quads of the plant at block.
+func MakePlantData(vertices []float32, show [6]bool, block world.Vec3, tex *BlockTexture) []float32 {
+	x, y, z := float32(block.X), float32(block.Y), float32(block.Z)
+	vertices = appendFace(vertices, tex.Left, -1, 0, 0,
+		x, y-0.5, z-0.5,
+		x, y-0.5, z+0.5,
+		x, y+0.5, z+0.5,
+		x, y+0.5, z-0.5)
+	vertices = appendFace(vertices, tex.Right, 1, 0, 0,
+		x, y-0.5, z+0.5,
+		x, y-0.5, z-0.5,
+		x, y+0.5, z-0.5,
+		x, y+0.5, z+0.5)
+	vertices = appendFace(vertices, tex.Front, 0, 0, 1,
+		x-0.5, y-0.5, z,
+		x+0.5, y-0.5, z,
+		x+0.5, y+0.5, z,
+		x-0.5, y+0.5, z)
+	vertices = appendFace(vertices, tex.Back, 0, 0, -1,
+		x+0.5, y-0.5, z,
+		x-0.5, y-0.5, z,
+		x-0.5, y+0.5, z,
+		x+0.5, y+0.5, z)
+	return vertices
+}
@@ -0,0 +1,73 @@
+package render
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/icexin/gocraft/world"
+)
+
+// emptySource is a Source without any change, the chunks stay generated.
+type emptySource struct{}
+
+func (emptySource) RangeBlocks(id world.Vec3, f func(bid world.Vec3, w int)) error { return nil }
+func (emptySource) UpdateBlock(id world.Vec3, w int) error                         { return nil }
+func (emptySource) FetchChunk(id world.Vec3, f func(bid world.Vec3, w int)) error  { return nil }
+
+// benchTextures maps the block textures without loading the atlas.
+func benchTextures() {
+	for w, f := range ItemDesc {
+		Textures.AddTexture(w, f[0], f[1], f[2], f[3], f[4], f[5])
+	}
+}
+
+// benchRender is a BlockRender building the vertex data only, without gl.
+func benchRender() *BlockRender {
+	return &BlockRender{
+		facePool: &sync.Pool{
+			New: func() interface{} {
+				return make([]float32, 0, 8*6*6)
+			},
+		},
+	}
+}
+
+func BenchmarkMakeCubeData(b *testing.B) {
+	benchTextures()
+	texture := Textures.Texture(world.Grass)
+	show := [...]bool{true, true, true, true, true, true}
+	vertices := make([]float32, 0, 6*6*8)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		vertices = MakeCubeData(vertices[:0], show, world.Vec3{X: i % 32, Y: 10, Z: 3}, texture)
+	}
+}
+
+// BenchmarkMakeChunkMesh builds the vertices of a generated chunk with its
+// neighbors loaded, the part of the mesh jobs running off the main thread.
+func BenchmarkMakeChunkMesh(b *testing.B) {
+	benchTextures()
+	w := world.New(16, emptySource{}, nil)
+	defer w.Close()
+	var ids []world.Vec3
+	for dx := -1; dx <= 1; dx++ {
+		for dz := -1; dz <= 1; dz++ {
+			ids = append(ids, world.Vec3{X: dx, Z: dz})
+		}
+	}
+	w.Chunks(ids)
+	c := w.BorderSnapshot(w.Chunk(world.Vec3{}))
+	r := benchRender()
+	// x y z u v and the normal
+	const stride = 8
+	mode := *lightMode
+	*lightMode = "volume"
+	defer func() { *lightMode = mode }()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r.putChunkData(r.makeChunkData(c, stride))
+	}
+}
@@ -0,0 +1,19 @@
+package render
+
+import "flag"
+
+// flags are the command line flags of the render, added to the ones of the
+// program by AddFlags.
+var flags = flag.NewFlagSet("render", flag.ContinueOnError)
+
+func init() {
+	flags.Var(radiusFlag{}, "r", "render radius")
+}
+
+// AddFlags adds the flags of the render to fs: the texture, the render
+// radius, the lighting and the mesh buffers.
+func AddFlags(fs *flag.FlagSet) {
+	flags.VisitAll(func(f *flag.Flag) {
+		fs.Var(f.Value, f.Name, f.Usage)
+	})
+}
@@ -0,0 +1,21 @@
+uniform float fogdis;
+uniform float fogstart;
+uniform float fogdensity;
+uniform int fogmode;
+
+// fog returns how much the sky color covers a vertex at distance d, the fog
+// starts at fogstart and ends at fogdis, where the exp curves may still let
+// a bit through.
+float fog(float d) {
+    float x = clamp((d - fogstart) / max(fogdis - fogstart, 1), 0, 1);
+    if (fogmode == 1) {
+        return x;
+    }
+    if (fogmode == 2) {
+        return 1 - exp(-fogdensity * x);
+    }
+    if (fogmode == 3) {
+        return 1 - exp(-(fogdensity * x) * (fogdensity * x));
+    }
+    return pow(x, 4);
+}
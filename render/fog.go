@@ -0,0 +1,32 @@
+package render
+
+import (
+	"github.com/faiface/glhf"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// Fog is the fog of the block and lod shaders, the distances in blocks.
+type Fog struct {
+	Start, End float32
+	Density    float32
+	Mode       int32
+	Color      mgl32.Vec3
+}
+
+// Bind sets the fogdis uniform at index dis and fogstart, fogdensity,
+// fogmode and fogcolor from index first.
+func (f Fog) Bind(s *glhf.Shader, dis, first int) {
+	s.SetUniformAttr(dis, f.End)
+	s.SetUniformAttr(first, f.Start)
+	s.SetUniformAttr(first+1, f.Density)
+	s.SetUniformAttr(first+2, f.Mode)
+	s.SetUniformAttr(first+3, f.Color)
+}
+
+// FogUniforms follow the other uniforms of the shaders including fog.glsl.
+var FogUniforms = glhf.AttrFormat{
+	glhf.Attr{Name: "fogstart", Type: glhf.Float},
+	glhf.Attr{Name: "fogdensity", Type: glhf.Float},
+	glhf.Attr{Name: "fogmode", Type: glhf.Int},
+	glhf.Attr{Name: "fogcolor", Type: glhf.Vec3},
+}
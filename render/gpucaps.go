@@ -0,0 +1,93 @@
+package render
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-gl/gl/v3.3-core/gl"
+)
+
+// EXT_texture_filter_anisotropic, not in the 3.3 core headers
+const maxTextureMaxAnisotropyExt = 0x84FF
+
+// GPUCaps are the limits and extensions of the GL context. The render
+// features check them and fall back to a simpler path instead of failing
+// on old or small GPUs.
+type GPUCaps struct {
+	Renderer string
+	Version  string
+
+	MaxTextureSize   int32
+	Max3DTextureSize int32
+	MaxArrayLayers   int32
+	MaxSamples       int32
+	// samples of the window, 0 without multisampling
+	Samples int32
+	// 0 without EXT_texture_filter_anisotropic
+	MaxAnisotropy float32
+	// GL_TIME_ELAPSED queries, core in 3.3 but broken on some drivers
+	TimerQuery bool
+	// glMultiDrawArraysIndirect, GL 4.3 or ARB_multi_draw_indirect
+	MultiDrawIndirect bool
+
+	Extensions map[string]bool
+}
+
+// GPU holds the caps of the context, set by the game at startup.
+var GPU GPUCaps
+
+// DetectGPUCaps queries the current context, call on mainthread after gl.Init.
+func DetectGPUCaps() GPUCaps {
+	c := GPUCaps{
+		Renderer:   gl.GoStr(gl.GetString(gl.RENDERER)),
+		Version:    gl.GoStr(gl.GetString(gl.VERSION)),
+		Extensions: make(map[string]bool),
+	}
+	var n int32
+	gl.GetIntegerv(gl.NUM_EXTENSIONS, &n)
+	for i := int32(0); i < n; i++ {
+		c.Extensions[gl.GoStr(gl.GetStringi(gl.EXTENSIONS, uint32(i)))] = true
+	}
+	gl.GetIntegerv(gl.MAX_TEXTURE_SIZE, &c.MaxTextureSize)
+	gl.GetIntegerv(gl.MAX_3D_TEXTURE_SIZE, &c.Max3DTextureSize)
+	gl.GetIntegerv(gl.MAX_ARRAY_TEXTURE_LAYERS, &c.MaxArrayLayers)
+	gl.GetIntegerv(gl.MAX_SAMPLES, &c.MaxSamples)
+	gl.GetIntegerv(gl.SAMPLES, &c.Samples)
+	if c.Extensions["GL_EXT_texture_filter_anisotropic"] || c.Extensions["GL_ARB_texture_filter_anisotropic"] {
+		gl.GetFloatv(maxTextureMaxAnisotropyExt, &c.MaxAnisotropy)
+	}
+	var bits int32
+	gl.GetQueryiv(gl.TIME_ELAPSED, gl.QUERY_COUNTER_BITS, &bits)
+	c.TimerQuery = bits > 0
+	var major, minor int32
+	gl.GetIntegerv(gl.MAJOR_VERSION, &major)
+	gl.GetIntegerv(gl.MINOR_VERSION, &minor)
+	c.MultiDrawIndirect = major > 4 || major == 4 && minor >= 3 || c.Extensions["GL_ARB_multi_draw_indirect"]
+	// a failed query leaves an error behind, don't let it show up later
+	for gl.GetError() != gl.NO_ERROR {
+	}
+	return c
+}
+
+// LightVolumes reports whether the 3d light textures of the chunks fit.
+func (c *GPUCaps) LightVolumes() bool {
+	return c.Max3DTextureSize >= lightHeight
+}
+
+func (c *GPUCaps) String() string {
+	var features []string
+	add := func(name string, ok bool) {
+		if ok {
+			features = append(features, name)
+		}
+	}
+	add("light-volumes", c.LightVolumes())
+	add("timer-query", c.TimerQuery)
+	add("multidraw-indirect", c.MultiDrawIndirect)
+	if c.MaxAnisotropy > 0 {
+		features = append(features, fmt.Sprintf("anisotropy:%g", c.MaxAnisotropy))
+	}
+	return fmt.Sprintf("%s, GL %s, texture:%d 3d:%d layers:%d samples:%d, %s",
+		c.Renderer, c.Version, c.MaxTextureSize, c.Max3DTextureSize, c.MaxArrayLayers, c.MaxSamples,
+		strings.Join(features, ","))
+}
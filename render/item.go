@@ -1,9 +1,11 @@
-package main
+package render
 
-import "log"
+import (
+	"sync"
+)
 
 var (
-	tex = NewItemHub()
+	Textures = NewItemHub()
 )
 
 type FaceTexture [6][2]float32
@@ -30,8 +32,11 @@ type BlockTexture struct {
 	Front, Back FaceTexture
 }
 
+// ItemHub maps the block types to their texture coordinates, the meshes are
+// built from any goroutine while a resource pack can replace the mapping.
 type ItemHub struct {
-	tex map[int]*BlockTexture
+	mutex sync.RWMutex
+	tex   map[int]*BlockTexture
 }
 
 func NewItemHub() *ItemHub {
@@ -41,6 +46,8 @@ func NewItemHub() *ItemHub {
 }
 
 func (h *ItemHub) AddTexture(w, l, r, u, d, f, b int) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
 	h.tex[w] = &BlockTexture{
 		Left:  MakeFaceTexture(l),
 		Right: MakeFaceTexture(r),
@@ -52,23 +59,28 @@ func (h *ItemHub) AddTexture(w, l, r, u, d, f, b int) {
 }
 
 func (h *ItemHub) Texture(w int) *BlockTexture {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
 	t, ok := h.tex[w]
 	if !ok {
-		log.Printf("%d not found", w)
+		renderLog.Warnf("%d not found", w)
 		return h.tex[0]
 	}
 	return t
 }
 
-func LoadTextureDesc() error {
-	for w, f := range itemDesc {
-		tex.AddTexture(w, f[0], f[1], f[2], f[3], f[4], f[5])
+// UseResourcePack makes pack the current one and maps the block textures,
+// the meshes built before still use the old mapping.
+func UseResourcePack(pack *ResourcePack) {
+	currentPack = pack
+	for w := range ItemDesc {
+		f := pack.Tiles(w)
+		Textures.AddTexture(w, f[0], f[1], f[2], f[3], f[4], f[5])
 	}
-	return nil
 }
 
 // w => left, right, top, bottom, front, back
-var itemDesc = map[int][6]int{
+var ItemDesc = map[int][6]int{
 	0:  {0, 0, 0, 0, 0, 0},
 	1:  {16, 16, 32, 0, 16, 16},
 	2:  {1, 1, 1, 1, 1, 1},
@@ -134,63 +146,18 @@ var itemDesc = map[int][6]int{
 	62: {206, 206, 206, 206, 206, 206},
 	63: {207, 207, 207, 207, 207, 207},
 	64: {226, 224, 241, 209, 227, 225},
-}
-
-var availableItems = []int{
-	1,
-	2,
-	3,
-	4,
-	5,
-	6,
-	7,
-	8,
-	9,
-	10,
-	11,
-	12,
-	13,
-	14,
-	15,
-	16,
-	17,
-	18,
-	19,
-	20,
-	21,
-	22,
-	23,
-	32,
-	33,
-	34,
-	35,
-	36,
-	37,
-	38,
-	39,
-	40,
-	41,
-	42,
-	43,
-	44,
-	45,
-	46,
-	47,
-	48,
-	49,
-	50,
-	51,
-	52,
-	53,
-	54,
-	55,
-	56,
-	57,
-	58,
-	59,
-	60,
-	61,
-	62,
-	63,
-	64,
+	65: {7, 7, 178, 7, 7, 7},
+	66: {55, 55, 0, 0, 55, 55},
+	67: {58, 58, 58, 58, 58, 58},
+	68: {59, 59, 59, 59, 59, 59},
+	69: {60, 60, 60, 60, 60, 60},
+	70: {61, 61, 61, 61, 61, 61},
+	71: {62, 62, 62, 62, 62, 62},
+	72: {63, 63, 63, 63, 63, 63},
+	73: {96, 96, 96, 96, 96, 96},
+	74: {97, 97, 97, 97, 97, 97},
+	75: {98, 98, 98, 98, 98, 98},
+	76: {99, 99, 99, 99, 99, 99},
+	77: {100, 100, 100, 100, 100, 100},
+	78: {101, 101, 101, 101, 101, 101},
 }
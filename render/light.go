@@ -0,0 +1,222 @@
+package render
+
+import (
+	"github.com/go-gl/gl/v3.3-core/gl"
+	"github.com/icexin/gocraft/internal/geom"
+	"github.com/icexin/gocraft/world"
+)
+
+var (
+	lightMode = flags.String("light", "volume", "lighting: volume (3d light textures), baked (per vertex, for old gpus) or off")
+)
+
+// LightMode returns the lighting of -light: volume, baked or off.
+func LightMode() string {
+	return *lightMode
+}
+
+// SetLightMode changes the lighting, before NewBlockRender.
+func SetLightMode(mode string) {
+	*lightMode = mode
+}
+
+const (
+	lightHeight = 128
+	minSkyLight = 90
+	// the volume keeps a border of one cell from the neighbor chunks, so the
+	// light blended around a vertex doesn't stop at the chunk border
+	lightWidth = world.ChunkWidth + 2
+)
+
+// LightVolume holds the light level of every cell of a chunk and its border,
+// indexed by x + lightWidth*(z + lightWidth*y) from origin.
+type LightVolume struct {
+	origin world.Vec3
+	data   []uint8
+}
+
+func lightIndex(x, y, z int) int {
+	return x + lightWidth*(z+lightWidth*y)
+}
+
+// makeLightVolume computes the sky light of the cells of chunk snapshot c,
+// solid cells are dark so that sampling with linear filtering gives
+// a soft occlusion on the air cells around them. block gives the blocks of
+// the border cells.
+func makeLightVolume(c *world.ChunkSnapshot, block func(id world.Vec3) int) *LightVolume {
+	origin := world.Vec3{X: c.Id().X*world.ChunkWidth - 1, Y: 0, Z: c.Id().Z*world.ChunkWidth - 1}
+	solid := make([]bool, lightWidth*lightWidth*lightHeight)
+	var top [lightWidth][lightWidth]int
+	var emitters []world.Vec3
+	set := func(id world.Vec3, w int) {
+		if id.Y < 0 || id.Y >= lightHeight {
+			return
+		}
+		if world.BlockLight(w) > 0 {
+			emitters = append(emitters, id)
+		}
+		if world.IsTransparent(w) {
+			return
+		}
+		x, z := id.X-origin.X, id.Z-origin.Z
+		solid[lightIndex(x, id.Y, z)] = true
+		if id.Y+1 > top[x][z] {
+			top[x][z] = id.Y + 1
+		}
+	}
+	c.RangeBlocks(set)
+	for z := 0; z < lightWidth; z++ {
+		for x := 0; x < lightWidth; x++ {
+			if x != 0 && x != lightWidth-1 && z != 0 && z != lightWidth-1 {
+				continue
+			}
+			for y := 0; y < lightHeight; y++ {
+				id := world.Vec3{X: origin.X + x, Y: y, Z: origin.Z + z}
+				set(id, block(id))
+			}
+		}
+	}
+
+	v := &LightVolume{
+		origin: origin,
+		data:   make([]uint8, len(solid)),
+	}
+	for y := 0; y < lightHeight; y++ {
+		for z := 0; z < lightWidth; z++ {
+			for x := 0; x < lightWidth; x++ {
+				idx := lightIndex(x, y, z)
+				if solid[idx] {
+					continue
+				}
+				light := 255
+				if depth := top[x][z] - y; depth > 0 {
+					light -= depth * 24
+					if light < minSkyLight {
+						light = minSkyLight
+					}
+				}
+				v.data[idx] = uint8(light)
+			}
+		}
+	}
+	for _, id := range emitters {
+		v.addEmitter(world.Vec3{X: id.X - origin.X, Y: id.Y, Z: id.Z - origin.Z}, world.BlockLight(block(id)), solid)
+	}
+	return v
+}
+
+// light lost per block away from an emitter
+const emitterFalloff = 36
+
+// addEmitter lights the air cells around the local cell p, light doesn't
+// leave the volume.
+func (v *LightVolume) addEmitter(p world.Vec3, light int, solid []bool) {
+	r := light / emitterFalloff
+	for y := geom.ClampInt(p.Y-r, 0, lightHeight-1); y <= geom.ClampInt(p.Y+r, 0, lightHeight-1); y++ {
+		for z := geom.ClampInt(p.Z-r, 0, lightWidth-1); z <= geom.ClampInt(p.Z+r, 0, lightWidth-1); z++ {
+			for x := geom.ClampInt(p.X-r, 0, lightWidth-1); x <= geom.ClampInt(p.X+r, 0, lightWidth-1); x++ {
+				idx := lightIndex(x, y, z)
+				if solid[idx] {
+					continue
+				}
+				d := geom.AbsInt(x-p.X) + geom.AbsInt(y-p.Y) + geom.AbsInt(z-p.Z)
+				l := light - d*emitterFalloff
+				if l > int(v.data[idx]) {
+					v.data[idx] = uint8(l)
+				}
+			}
+		}
+	}
+}
+
+func (v *LightVolume) at(x, y, z int) float32 {
+	x, y, z = geom.ClampInt(x, 0, lightWidth-1), geom.ClampInt(y, 0, lightHeight-1), geom.ClampInt(z, 0, lightWidth-1)
+	return float32(v.data[lightIndex(x, y, z)]) / 255
+}
+
+// share of the sky light lost at night by lightLevel
+const nightLightLoss = 0.7
+
+// LightLevel returns the light of the air block id of w the way the light
+// volumes compute it, 0 to 255, with the sky light dimmed by night, 0 at
+// noon and 1 at midnight. The volumes live on the GPU, the game logic asks
+// this one.
+func LightLevel(w *world.World, id world.Vec3, night float32) int {
+	sky := 255
+	if chunk, ok := w.PeekChunk(id.Chunkid()); ok {
+		for y := chunk.Top(); y > id.Y; y-- {
+			if !world.IsTransparent(w.Block(world.Vec3{X: id.X, Y: y, Z: id.Z})) {
+				sky = geom.MaxInt(255-(y+1-id.Y)*24, minSkyLight)
+				break
+			}
+		}
+	}
+	light := int(float32(sky) * (1 - nightLightLoss*night))
+	r := 255 / emitterFalloff
+	for y := id.Y - r; y <= id.Y+r; y++ {
+		for z := id.Z - r; z <= id.Z+r; z++ {
+			for x := id.X - r; x <= id.X+r; x++ {
+				emit := world.BlockLight(w.Block(world.Vec3{X: x, Y: y, Z: z}))
+				if emit == 0 {
+					continue
+				}
+				d := geom.AbsInt(x-id.X) + geom.AbsInt(y-id.Y) + geom.AbsInt(z-id.Z)
+				if l := emit - d*emitterFalloff; l > light {
+					light = l
+				}
+			}
+		}
+	}
+	return light
+}
+
+// Sample does the same trilinear filtering as the GPU does on the light texture,
+// x, y, z are world coordinates.
+func (v *LightVolume) Sample(x, y, z float32) float32 {
+	x, y, z = x-float32(v.origin.X), y-float32(v.origin.Y), z-float32(v.origin.Z)
+	if y >= lightHeight-0.5 {
+		return 1
+	}
+	x0, y0, z0 := int(geom.Floor(x)), int(geom.Floor(y)), int(geom.Floor(z))
+	fx, fy, fz := x-float32(x0), y-float32(y0), z-float32(z0)
+	c00 := geom.Mix(v.at(x0, y0, z0), v.at(x0+1, y0, z0), fx)
+	c01 := geom.Mix(v.at(x0, y0, z0+1), v.at(x0+1, y0, z0+1), fx)
+	c10 := geom.Mix(v.at(x0, y0+1, z0), v.at(x0+1, y0+1, z0), fx)
+	c11 := geom.Mix(v.at(x0, y0+1, z0+1), v.at(x0+1, y0+1, z0+1), fx)
+	return geom.Mix(geom.Mix(c00, c01, fz), geom.Mix(c10, c11, fz), fy)
+}
+
+// bakeLight converts cube vertices (pos, tex, normal) to the baked format
+// with a trailing light value, sampled in front of the face like the shader
+// does. A vertex is on the corner of four cells in front of the face, the
+// filtering blends them so the light is smooth across the faces.
+// All the vertices are fully lit if v is nil.
+func bakeLight(dst, vertices []float32, v *LightVolume) []float32 {
+	const stride = 8
+	for i := 0; i+stride <= len(vertices); i += stride {
+		p := vertices[i : i+stride]
+		light := float32(1)
+		if v != nil {
+			light = v.Sample(p[0]+p[5]*0.5, p[1]+p[6]*0.5, p[2]+p[7]*0.5)
+		}
+		dst = append(dst, p...)
+		dst = append(dst, light)
+	}
+	return dst
+}
+
+// call on mainthread
+func newLightTexture(v *LightVolume) uint32 {
+	var id uint32
+	gl.GenTextures(1, &id)
+	gl.BindTexture(gl.TEXTURE_3D, id)
+	gl.TexParameteri(gl.TEXTURE_3D, gl.TEXTURE_MIN_FILTER, gl.LINEAR)
+	gl.TexParameteri(gl.TEXTURE_3D, gl.TEXTURE_MAG_FILTER, gl.LINEAR)
+	gl.TexParameteri(gl.TEXTURE_3D, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_3D, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_3D, gl.TEXTURE_WRAP_R, gl.CLAMP_TO_EDGE)
+	gl.PixelStorei(gl.UNPACK_ALIGNMENT, 1)
+	gl.TexImage3D(gl.TEXTURE_3D, 0, gl.R8, lightWidth, lightWidth, lightHeight, 0, gl.RED, gl.UNSIGNED_BYTE, gl.Ptr(v.data))
+	gl.BindTexture(gl.TEXTURE_3D, 0)
+	return id
+}
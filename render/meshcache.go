@@ -0,0 +1,69 @@
+package render
+
+import (
+	"sync"
+
+	"github.com/icexin/gocraft/world"
+)
+
+// MeshCache maps chunk ids to their meshes.
+type MeshCache struct {
+	mutex  sync.RWMutex
+	meshes map[world.Vec3]*Mesh
+}
+
+func NewMeshCache() *MeshCache {
+	return &MeshCache{
+		meshes: make(map[world.Vec3]*Mesh),
+	}
+}
+
+func (c *MeshCache) Load(id world.Vec3) (*Mesh, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	mesh, ok := c.meshes[id]
+	return mesh, ok
+}
+
+func (c *MeshCache) Store(id world.Vec3, mesh *Mesh) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.meshes[id] = mesh
+}
+
+// Remove deletes id from the cache and returns its mesh.
+func (c *MeshCache) Remove(id world.Vec3) (*Mesh, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	mesh, ok := c.meshes[id]
+	delete(c.meshes, id)
+	return mesh, ok
+}
+
+func (c *MeshCache) Len() int {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return len(c.meshes)
+}
+
+// AppendMeshes appends all the meshes to dst, used to iterate meshes every
+// frame without holding the lock or allocating.
+func (c *MeshCache) AppendMeshes(dst []*Mesh) []*Mesh {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	for _, mesh := range c.meshes {
+		dst = append(dst, mesh)
+	}
+	return dst
+}
+
+// Ids returns the ids of the cached meshes.
+func (c *MeshCache) Ids() []world.Vec3 {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	ids := make([]world.Vec3, 0, len(c.meshes))
+	for id := range c.meshes {
+		ids = append(ids, id)
+	}
+	return ids
+}
@@ -0,0 +1,31 @@
+package render
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/icexin/gocraft/world"
+)
+
+// BenchmarkMeshCacheRange walks the meshes of the chunks in the render
+// radius the way every frame does, from the low to the high preset and
+// beyond.
+func BenchmarkMeshCacheRange(b *testing.B) {
+	for _, radius := range []int{4, 10, 16} {
+		b.Run(fmt.Sprintf("r%d", radius), func(b *testing.B) {
+			c := NewMeshCache()
+			for x := -radius; x <= radius; x++ {
+				for z := -radius; z <= radius; z++ {
+					id := world.Vec3{X: x, Z: z}
+					c.Store(id, &Mesh{Id: id})
+				}
+			}
+			var meshes []*Mesh
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				meshes = c.AppendMeshes(meshes[:0])
+			}
+		})
+	}
+}
@@ -0,0 +1,197 @@
+package render
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"image"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var texturePath = flags.String("t", "texture.png", "texture file")
+
+// TexturePath returns the atlas of -t, used without a resource pack.
+func TexturePath() string {
+	return *texturePath
+}
+
+// Files of a resource pack, all optional:
+//
+//	texture.png  the atlas of 16x16 tiles replacing -t
+//	blocks.json  {"<block type>": [left, right, top, bottom, front, back]}
+//	             tile indexes replacing the ones of ItemDesc
+//	sounds/      ignored, the game has no sound yet
+const (
+	PackTexture = "texture.png"
+	PackBlocks  = "blocks.json"
+	packSounds  = "sounds/"
+)
+
+// ResourcePack is a loaded resource pack, the default one has no path.
+type ResourcePack struct {
+	Path string
+	// the atlas, decoded as NRGBA
+	Pix  []uint8
+	Rect image.Rectangle
+	// tiles overriding ItemDesc by block type
+	blocks map[int][6]int
+}
+
+var currentPack *ResourcePack
+
+// CurrentPack returns the pack of the last UseResourcePack.
+func CurrentPack() *ResourcePack {
+	return currentPack
+}
+
+// packFS opens the files of a pack directory or zip.
+type packFS interface {
+	Open(name string) (io.ReadCloser, error)
+	Has(prefix string) bool
+	Close() error
+}
+
+type dirPack string
+
+func (d dirPack) Open(name string) (io.ReadCloser, error) {
+	return os.Open(filepath.Join(string(d), filepath.FromSlash(name)))
+}
+
+func (d dirPack) Has(prefix string) bool {
+	_, err := os.Stat(filepath.Join(string(d), filepath.FromSlash(prefix)))
+	return err == nil
+}
+
+func (d dirPack) Close() error {
+	return nil
+}
+
+type zipPack struct {
+	*zip.ReadCloser
+}
+
+func (z zipPack) Open(name string) (io.ReadCloser, error) {
+	for _, f := range z.File {
+		if f.Name == name {
+			return f.Open()
+		}
+	}
+	return nil, os.ErrNotExist
+}
+
+func (z zipPack) Has(prefix string) bool {
+	for _, f := range z.File {
+		if strings.HasPrefix(f.Name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func openPack(path string) (packFS, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return dirPack(path), nil
+	}
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	return zipPack{r}, nil
+}
+
+// LoadResourcePack loads the pack at path, an empty path gives the default
+// textures.
+func LoadResourcePack(path string) (*ResourcePack, error) {
+	pack := &ResourcePack{
+		Path:   path,
+		blocks: make(map[int][6]int),
+	}
+	if path == "" {
+		var err error
+		pack.Pix, pack.Rect, err = loadImage(*texturePath)
+		return pack, err
+	}
+
+	fs, err := openPack(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fs.Close()
+
+	f, err := fs.Open(PackTexture)
+	if os.IsNotExist(err) {
+		pack.Pix, pack.Rect, err = loadImage(*texturePath)
+	} else if err == nil {
+		pack.Pix, pack.Rect, err = decodeImage(f)
+		f.Close()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", PackTexture, err)
+	}
+	if pack.Rect.Dx()%16 != 0 || pack.Rect.Dy()%16 != 0 {
+		return nil, fmt.Errorf("%s: %dx%d is not a grid of 16x16 tiles", PackTexture, pack.Rect.Dx(), pack.Rect.Dy())
+	}
+
+	f, err = fs.Open(PackBlocks)
+	if err == nil {
+		err = pack.readBlocks(f)
+		f.Close()
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("%s: %s", PackBlocks, err)
+	}
+
+	if fs.Has(packSounds) {
+		renderLog.Warnf("resource pack %s: sounds are not supported, ignored", path)
+	}
+	return pack, nil
+}
+
+func (p *ResourcePack) readBlocks(r io.Reader) error {
+	buf, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	var blocks map[string][6]int
+	if err := json.Unmarshal(buf, &blocks); err != nil {
+		return err
+	}
+	for key, tiles := range blocks {
+		w, err := strconv.Atoi(key)
+		if err != nil {
+			return fmt.Errorf("bad block type %q", key)
+		}
+		if _, ok := ItemDesc[w]; !ok {
+			return fmt.Errorf("unknown block type %d", w)
+		}
+		for _, t := range tiles {
+			if t < 0 || t >= 256 {
+				return fmt.Errorf("tile %d of block %d out of the atlas", t, w)
+			}
+		}
+		p.blocks[w] = tiles
+	}
+	return nil
+}
+
+// Tiles returns the tiles of block type w: left, right, top, bottom, front, back.
+func (p *ResourcePack) Tiles(w int) [6]int {
+	if t, ok := p.blocks[w]; ok {
+		return t
+	}
+	return ItemDesc[w]
+}
+
+// TileSize returns the size in pixels of the tiles of the atlas.
+func (p *ResourcePack) TileSize() int {
+	return p.Rect.Dx() / 16
+}
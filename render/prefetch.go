@@ -0,0 +1,84 @@
+package render
+
+import (
+	"sort"
+	"time"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/icexin/gocraft/world"
+)
+
+var prefetchTime = flags.Float64("prefetch", 2, "seconds of movement ahead whose chunks are loaded before they come in range, 0 disables")
+
+const (
+	minPrefetchSpeed = 4   // blocks per second, slower players don't need it
+	maxPrefetchSpeed = 100 // faster is a teleport
+)
+
+// Prefetch follows the camera between the mesh cache updates and picks the
+// chunks out of the render radius the player is heading to, so their terrain
+// is generated and meshed before a fast flight reaches them.
+type Prefetch struct {
+	lastPos  mgl32.Vec3
+	lastTime time.Time
+	velocity mgl32.Vec3 // blocks per second, horizontal and smoothed
+}
+
+// update measures the velocity of the camera since the last call.
+func (p *Prefetch) update(pos mgl32.Vec3, now time.Time) {
+	dt := float32(now.Sub(p.lastTime).Seconds())
+	last := p.lastPos
+	p.lastPos, p.lastTime = pos, now
+	if dt <= 0 || dt > 1 {
+		p.velocity = mgl32.Vec3{}
+		return
+	}
+	d := pos.Sub(last)
+	v := mgl32.Vec3{d.X(), 0, d.Z()}.Mul(1 / dt)
+	if v.Len() > maxPrefetchSpeed {
+		p.velocity = mgl32.Vec3{}
+		return
+	}
+	p.velocity = p.velocity.Add(v.Sub(p.velocity).Mul(0.5))
+}
+
+// Ahead returns the chunks within radius n of where the player will be in
+// -prefetch seconds and out of needed, the ones in front of the camera first.
+// The distance ahead is at most half the radius, so the world cache holds
+// both the view and the prefetched chunks.
+func (p *Prefetch) Ahead(pos, front mgl32.Vec3, n int, needed map[world.Vec3]bool) []world.Vec3 {
+	speed := p.velocity.Len()
+	if *prefetchTime <= 0 || speed < minPrefetchSpeed {
+		return nil
+	}
+	dir := p.velocity.Mul(1 / speed)
+	// a camera moving backward sees less of what comes, prefetch closer
+	dist := speed * float32(*prefetchTime)
+	if front.Dot(dir) < 0 {
+		dist /= 2
+	}
+	if max := float32(n * world.ChunkWidth / 2); dist > max {
+		dist = max
+	}
+	center := world.NearBlock(pos.Add(dir.Mul(dist))).Chunkid()
+
+	var ids []world.Vec3
+	for dx := -n; dx < n; dx++ {
+		for dz := -n; dz < n; dz++ {
+			id := world.Vec3{X: center.X + dx, Y: 0, Z: center.Z + dz}
+			if dx*dx+dz*dz > n*n || needed[id] {
+				continue
+			}
+			ids = append(ids, id)
+		}
+	}
+	origin := world.NearBlock(pos).Chunkid()
+	facing := func(id world.Vec3) float32 {
+		v := mgl32.Vec3{float32(id.X - origin.X), 0, float32(id.Z - origin.Z)}
+		return v.Normalize().Dot(front)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return facing(ids[i]) > facing(ids[j])
+	})
+	return ids
+}
@@ -0,0 +1,1188 @@
+// Package render builds the meshes of the chunks of a world.World and draws
+// them with OpenGL 3.3: the block shader with its light volumes or baked
+// light, the texture atlas of the resource packs and the buffers shared by
+// the meshes. The program owns the window, the camera and the other passes
+// and hands them to the block render as a Scene.
+package render
+
+import (
+	"image"
+	"image/draw"
+	"io"
+	"log"
+	"os"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/faiface/glhf"
+	"github.com/faiface/mainthread"
+	"github.com/go-gl/gl/v3.3-core/gl"
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/icexin/gocraft/internal/geom"
+	"github.com/icexin/gocraft/internal/logging"
+	"github.com/icexin/gocraft/world"
+)
+
+var renderLog = logging.New("render")
+
+// PanicHandler, if set, is called with the value and the stack of a panic
+// in UpdateLoop before it goes on, so programs can report the crash.
+var PanicHandler func(v interface{}, stack []byte)
+
+// recoverPanic hands the panic of the goroutine to PanicHandler and panics
+// again.
+func recoverPanic() {
+	if v := recover(); v != nil {
+		if PanicHandler != nil {
+			PanicHandler(v, debug.Stack())
+		}
+		panic(v)
+	}
+}
+
+// radius is the render radius in chunks, set on mainthread, by -r and by
+// the debug api, the mesh updates read it on their own goroutine.
+var radius int32 = 6
+
+// Radius returns the render radius in chunks.
+func Radius() int {
+	return int(atomic.LoadInt32(&radius))
+}
+
+// SetRadius changes the render radius, the world cache is resized by the
+// caller.
+func SetRadius(n int) {
+	atomic.StoreInt32(&radius, int32(n))
+}
+
+type radiusFlag struct{}
+
+func (radiusFlag) String() string {
+	return strconv.Itoa(Radius())
+}
+
+func (radiusFlag) Set(s string) error {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return err
+	}
+	SetRadius(n)
+	return nil
+}
+
+func loadImage(fname string) ([]uint8, image.Rectangle, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil, image.Rectangle{}, err
+	}
+	defer f.Close()
+	return decodeImage(f)
+}
+
+func decodeImage(r io.Reader) ([]uint8, image.Rectangle, error) {
+	img, _, err := image.Decode(r)
+	if err != nil {
+		return nil, image.Rectangle{}, err
+	}
+	// not premultiplied, the shader blends with the alpha of the texels
+	rgba := image.NewNRGBA(img.Bounds())
+	draw.Draw(rgba, rgba.Bounds(), img, img.Bounds().Min, draw.Src)
+	return rgba.Pix, img.Bounds(), nil
+}
+
+// Camera is the point of view of the frames.
+type Camera interface {
+	Pos() mgl32.Vec3
+	Front() mgl32.Vec3
+	// Fov is the vertical field of view in degrees.
+	Fov() float32
+	// Matrix is the view matrix.
+	Matrix() mgl32.Mat4
+}
+
+// Scene is what the block render draws around the chunk meshes of the world,
+// implemented by the game.
+type Scene interface {
+	// Camera returns the point of view, read from the mesh updates too.
+	Camera() Camera
+	// Size returns the size of the window in screen coordinates.
+	Size() (width, height int)
+	// BindShadows sets the shadow uniforms of the block shader before the
+	// chunks are drawn.
+	BindShadows(shader *glhf.Shader)
+	// ChunkShade returns the shade of the faces of chunk id, 0 draws them
+	// as they are.
+	ChunkShade(id world.Vec3) float32
+	// DrawBlocks draws the blocks out of the chunk meshes with the block
+	// shader bound and mat the matrix of the frame, before the translucent
+	// faces.
+	DrawBlocks(mat mgl32.Mat4)
+	// RecordMeshBuild and RecordChunkLoad record the time spent building a
+	// chunk mesh and waiting for a batch of chunks, from the mesh updates.
+	RecordMeshBuild(d time.Duration)
+	RecordChunkLoad(d time.Duration)
+}
+
+// Frame holds the light and the weather a frame is drawn with.
+type Frame struct {
+	Dim     float32 // brightness
+	Time    float32 // seconds, moves the plants and the water
+	Foliage mgl32.Vec3
+	Snow    float32
+	Wind    float32
+	Fog     Fog
+}
+
+// BlockRender builds the meshes of the chunks around the camera and draws
+// them with the block shader.
+type BlockRender struct {
+	world *world.World
+	scene Scene
+
+	shader  *glhf.Shader
+	texture *glhf.Texture
+
+	facePool *sync.Pool
+
+	sigch     chan struct{}
+	meshcache *MeshCache
+	prefetch  Prefetch
+	// vertices of the chunk meshes
+	arena    *ChunkArena
+	drawList []*Mesh
+	// visible meshes with translucent faces this frame
+	transList []*Mesh
+	// meshes of the passes of DrawMeshes
+	passList []*Mesh
+
+	stat Stat
+
+	// meshes of a single block at the origin by type, used by the falling
+	// blocks and the animations
+	blockMeshes map[int]*Mesh
+	// meshes of a single cube showing a tile on every face, like the crack
+	// overlay, by tile
+	tileMeshes map[int]*Mesh
+}
+
+// NewBlockRender returns a render of the chunks of w with the textures of
+// the current resource pack, drawn in scene. Start UpdateLoop on a goroutine
+// of its own to build the meshes.
+func NewBlockRender(w *world.World, scene Scene) (*BlockRender, error) {
+	var (
+		err error
+	)
+	img, rect := currentPack.Pix, currentPack.Rect
+
+	r := &BlockRender{
+		world:       w,
+		scene:       scene,
+		sigch:       make(chan struct{}, 4),
+		meshcache:   NewMeshCache(),
+		blockMeshes: make(map[int]*Mesh),
+		tileMeshes:  make(map[int]*Mesh),
+	}
+
+	mainthread.Call(func() {
+		r.shader, err = NewBlockShader(blockVertexSource, blockFragmentSource)
+		if err != nil {
+			return
+		}
+		r.texture = glhf.NewTexture(rect.Dx(), rect.Dy(), false, img)
+		r.arena = NewChunkArena(r.shader)
+	})
+	if err != nil {
+		return nil, err
+	}
+	r.facePool = &sync.Pool{
+		New: func() interface{} {
+			atomic.AddInt64(&Counts.FaceMisses, 1)
+			return make([]float32, 0, r.arena.stride/4*6*6)
+		},
+	}
+
+	return r, nil
+}
+
+// index of fogstart in the uniforms of the block shader
+const blockFogUniform = 18
+
+// NewBlockShader compiles the block shader of the light mode from the
+// sources, NewBlockRender compiles the embedded ones. Call on
+// mainthread.
+func NewBlockShader(vertexSource, fragmentSource string) (*glhf.Shader, error) {
+	vertexFormat := glhf.AttrFormat{
+		glhf.Attr{Name: "pos", Type: glhf.Vec3},
+		glhf.Attr{Name: "tex", Type: glhf.Vec2},
+		glhf.Attr{Name: "normal", Type: glhf.Vec3},
+	}
+	if *lightMode == "baked" {
+		vertexFormat = append(vertexFormat, glhf.Attr{Name: "light", Type: glhf.Float})
+		vertexSource = ShaderDefine(vertexSource, "BAKED_LIGHT")
+		fragmentSource = ShaderDefine(fragmentSource, "BAKED_LIGHT")
+	}
+	vertexSource = ShaderInclude(vertexSource, FogSource)
+	shader, err := glhf.NewShader(vertexFormat, append(glhf.AttrFormat{
+		glhf.Attr{Name: "matrix", Type: glhf.Mat4},
+		glhf.Attr{Name: "camera", Type: glhf.Vec3},
+		glhf.Attr{Name: "fogdis", Type: glhf.Float},
+		glhf.Attr{Name: "dim", Type: glhf.Float},
+		glhf.Attr{Name: "origin", Type: glhf.Vec3},
+		glhf.Attr{Name: "uselight", Type: glhf.Float},
+		glhf.Attr{Name: "lightmap", Type: glhf.Int},
+		glhf.Attr{Name: "time", Type: glhf.Float},
+		glhf.Attr{Name: "foliage", Type: glhf.Vec3},
+		glhf.Attr{Name: "snow", Type: glhf.Float},
+		glhf.Attr{Name: "shadowmap", Type: glhf.Int},
+		glhf.Attr{Name: "useshadow", Type: glhf.Float},
+		glhf.Attr{Name: "shadowmat0", Type: glhf.Mat4},
+		glhf.Attr{Name: "shadowmat1", Type: glhf.Mat4},
+		glhf.Attr{Name: "shadowmat2", Type: glhf.Mat4},
+		glhf.Attr{Name: "translucent", Type: glhf.Float},
+		glhf.Attr{Name: "locked", Type: glhf.Float},
+		glhf.Attr{Name: "wind", Type: glhf.Float},
+	}, FogUniforms...), vertexSource, fragmentSource)
+	if err != nil {
+		return nil, err
+	}
+	shader.Begin()
+	shader.SetUniformAttr(6, int32(1))
+	shader.SetUniformAttr(10, int32(2))
+	shader.End()
+	return shader, nil
+}
+
+// SetShader replaces the block shader, the meshes drawn with the old one
+// are built again, call on mainthread.
+func (r *BlockRender) SetShader(shader *glhf.Shader) {
+	r.shader = shader
+	r.arena.SetShader(shader)
+	for tp, mesh := range r.blockMeshes {
+		mesh.Release()
+		delete(r.blockMeshes, tp)
+	}
+	for tile, mesh := range r.tileMeshes {
+		mesh.Release()
+		delete(r.tileMeshes, tile)
+	}
+}
+
+// SetAtlas replaces the texture atlas, the chunk meshes must be rebuilt
+// when the pack maps the blocks to other tiles, call on mainthread.
+func (r *BlockRender) SetAtlas(pack *ResourcePack) {
+	r.texture = glhf.NewTexture(pack.Rect.Dx(), pack.Rect.Dy(), false, pack.Pix)
+	for tp, mesh := range r.blockMeshes {
+		mesh.Release()
+		delete(r.blockMeshes, tp)
+	}
+}
+
+// getFaces takes a vertex buffer from the pool, put it back once the mesh is built.
+func (r *BlockRender) getFaces() []float32 {
+	atomic.AddInt64(&Counts.FaceGets, 1)
+	return r.facePool.Get().([]float32)
+}
+
+// chunkData is the vertex data of a chunk mesh, built off the main thread.
+type chunkData struct {
+	faces    []float32 // sorted by section
+	sections []meshSection
+	trans    []float32
+	light    *LightVolume
+	box      geom.AABB
+	// the buffers taken from the pool
+	pooled [][]float32
+}
+
+func (r *BlockRender) makeChunkMesh(chunk *world.Chunk, onmainthread bool) *Mesh {
+	start := time.Now()
+	// the faces on the chunk sides read the border of the snapshot, the
+	// job doesn't touch the world cache
+	c := r.world.BorderSnapshot(chunk)
+	data := r.makeChunkData(c, r.arena.stride/4)
+	defer r.putChunkData(data)
+	r.scene.RecordMeshBuild(time.Since(start))
+	atomic.AddInt64(&Counts.MeshesBuilt, 1)
+	var mesh *Mesh
+	build := func() {
+		mesh = r.arena.NewMesh(data.faces)
+		mesh.sections = data.sections
+		if len(data.trans) != 0 {
+			mesh.trans = newTranslucentMesh(r.shader, data.trans)
+		}
+		if *lightMode == "volume" && (mesh.faces != 0 || mesh.trans != nil) {
+			mesh.light = newLightTexture(data.light)
+			mesh.origin = data.light.origin
+		}
+	}
+	if onmainthread {
+		build()
+	} else {
+		FrameTasks.Call(build)
+	}
+	mesh.Id = c.Id()
+	mesh.world = r.world
+	mesh.version = c.Version()
+	mesh.missing = c.MissingNeighbors()
+	mesh.box = data.box
+	return mesh
+}
+
+// makeChunkData builds the vertices of the chunk snapshot c, stride floats
+// per vertex. The buffers go back to the pool with putChunkData.
+func (r *BlockRender) makeChunkData(c *world.ChunkSnapshot, stride int) *chunkData {
+	data := new(chunkData)
+	getFaces := func(n int) []float32 {
+		buf := reserveFaces(r.getFaces(), n)
+		data.pooled = append(data.pooled, buf)
+		return buf
+	}
+	minY, maxY := c.YRange()
+	block := c.Block
+	// the faces are counted first, the buffers then take them without
+	// growing
+	type visibleBlock struct {
+		id   world.Vec3
+		w    int
+		show [6]bool
+	}
+	var blocks []visibleBlock
+	var nface, ntrans int
+	c.RangeBlocks(func(id world.Vec3, w int) {
+		if w == 0 {
+			log.Panicf("unexpect 0 item type on %v", id)
+		}
+		// faces between two glass blocks of the same color are hidden
+		visible := func(nb int) bool {
+			return world.IsTransparent(nb) && !(world.IsTranslucent(w) && nb == w)
+		}
+		show := [...]bool{
+			visible(block(id.Left())),
+			visible(block(id.Right())),
+			visible(block(id.Up())),
+			visible(block(id.Down())) && id.Y != 0,
+			visible(block(id.Front())),
+			visible(block(id.Back())),
+		}
+		switch {
+		case world.IsPlant(w):
+			nface += plantFaces
+		case world.IsTranslucent(w):
+			ntrans += cubeFaces(show)
+		default:
+			nface += cubeFaces(show)
+		}
+		blocks = append(blocks, visibleBlock{id, w, show})
+	})
+	// x y z u v and the normal per vertex, 6 vertices per face
+	const faceLen = 6 * 8
+	facedata := getFaces(nface * faceLen)
+	transdata := getFaces(ntrans * faceLen)
+	for _, b := range blocks {
+		switch {
+		case world.IsPlant(b.w):
+			facedata = MakePlantData(facedata, b.show, b.id, Textures.Texture(b.w))
+		case world.IsTranslucent(b.w):
+			transdata = MakeCubeData(transdata, b.show, b.id, Textures.Texture(b.w))
+		default:
+			facedata = MakeCubeData(facedata, b.show, b.id, Textures.Texture(b.w))
+		}
+	}
+	if *lightMode != "off" {
+		data.light = makeLightVolume(c, block)
+	}
+	if *lightMode == "baked" {
+		// one more float per vertex
+		facedata = bakeLight(getFaces(nface*6*9), facedata, data.light)
+		if len(transdata) != 0 {
+			transdata = bakeLight(make([]float32, 0, ntrans*6*9), transdata, data.light)
+		}
+	}
+	renderLog.Debugf("chunk faces:%d", len(facedata)/stride/6)
+	data.faces, data.sections = sortSections(getFaces(len(facedata)), facedata, stride, c.Id())
+	data.trans = transdata
+	data.box = ChunkAABB(c.Id(), minY, maxY)
+	return data
+}
+
+// putChunkData puts the buffers of data back to the pool once the mesh is
+// built.
+func (r *BlockRender) putChunkData(data *chunkData) {
+	for _, buf := range data.pooled {
+		r.facePool.Put(buf[:0])
+	}
+}
+
+// ChunkAABB returns the box of the blocks of chunk id with y in [miny, maxy],
+// blocks are centered on their integer position.
+func ChunkAABB(id world.Vec3, miny, maxy int) geom.AABB {
+	x, z := float32(id.X*world.ChunkWidth), float32(id.Z*world.ChunkWidth)
+	return geom.AABB{
+		Min: mgl32.Vec3{x - 0.5, float32(miny) - 0.5, z - 0.5},
+		Max: mgl32.Vec3{x + world.ChunkWidth - 0.5, float32(maxy) + 0.5, z + world.ChunkWidth - 0.5},
+	}
+}
+
+// isChunkVisiable checks chunks without a mesh yet, up to the top of the
+// chunk once it's loaded or the full height.
+func (r *BlockRender) isChunkVisiable(frustum *geom.Frustum, id world.Vec3) bool {
+	top := world.ChunkHeight - 1
+	if chunk, ok := r.world.PeekChunk(id); ok {
+		top = chunk.Top()
+	}
+	return frustum.IntersectsAABB(ChunkAABB(id, 0, top))
+}
+
+// NearPlane is the distance of the near plane of the projections.
+const NearPlane = 0.01
+
+// Matrix returns the projection and view matrix of the frame.
+func (r *BlockRender) Matrix() mgl32.Mat4 {
+	n := float32(Radius() * world.ChunkWidth)
+	width, height := r.scene.Size()
+	camera := r.scene.Camera()
+	mat := mgl32.Perspective(geom.Radian(camera.Fov()), float32(width)/float32(height), NearPlane, n)
+	mat = mat.Mul4(camera.Matrix())
+	return mat
+}
+
+func (r *BlockRender) get2dmat() mgl32.Mat4 {
+	n := float32(Radius() * world.ChunkWidth)
+	mat := mgl32.Ortho(-n, n, -n, n, -1, n)
+	mat = mat.Mul4(r.scene.Camera().Matrix())
+	return mat
+}
+
+func (r *BlockRender) sortChunks(chunks []world.Vec3) []world.Vec3 {
+	cid := world.NearBlock(r.scene.Camera().Pos()).Chunkid()
+	x, z := cid.X, cid.Z
+	mat := r.Matrix()
+	frustum := geom.NewFrustum(mat)
+
+	sort.Slice(chunks, func(i, j int) bool {
+		v1 := r.isChunkVisiable(&frustum, chunks[i])
+		v2 := r.isChunkVisiable(&frustum, chunks[j])
+		if v1 && !v2 {
+			return true
+		}
+		if v2 && !v1 {
+			return false
+		}
+		d1 := (chunks[i].X-x)*(chunks[i].X-x) + (chunks[i].Z-z)*(chunks[i].Z-z)
+		d2 := (chunks[j].X-x)*(chunks[j].X-x) + (chunks[j].Z-z)*(chunks[j].Z-z)
+		return d1 < d2
+	})
+	return chunks
+}
+
+func (r *BlockRender) updateMeshCache() {
+	camera := r.scene.Camera()
+	pos := camera.Pos()
+	block := world.NearBlock(pos)
+	chunk := block.Chunkid()
+	x, z := chunk.X, chunk.Z
+	n := Radius()
+	needed := make(map[world.Vec3]bool)
+
+	for dx := -n; dx < n; dx++ {
+		for dz := -n; dz < n; dz++ {
+			id := world.Vec3{X: x + dx, Y: 0, Z: z + dz}
+			if dx*dx+dz*dz > n*n {
+				continue
+			}
+			needed[id] = true
+		}
+	}
+	var added, removed []world.Vec3
+	for id := range needed {
+		mesh, ok := r.meshcache.Load(id)
+		// 不在cache里面的需要重新构建
+		if !ok {
+			added = append(added, id)
+		} else {
+			if mesh.Stale() {
+				renderLog.Debugf("update cache %v", id)
+				added = append(added, id)
+				removed = append(removed, id)
+			}
+		}
+	}
+
+	r.prefetch.update(pos, time.Now())
+	var prefetched []world.Vec3
+	for _, id := range r.prefetch.Ahead(pos, camera.Front(), n, needed) {
+		if _, ok := r.meshcache.Load(id); !ok {
+			prefetched = append(prefetched, id)
+		}
+		needed[id] = true
+	}
+	for _, id := range r.meshcache.Ids() {
+		if !needed[id] {
+			removed = append(removed, id)
+			// out of view before it finished loading
+			r.world.Cancel(id)
+		}
+	}
+
+	// 单次并发构造的chunk个数
+	const batchBuildChunk = 4
+	r.sortChunks(added)
+	// the prefetched chunks take the slots left by the view
+	added = append(added, prefetched...)
+	if len(added) > batchBuildChunk {
+		added = added[:batchBuildChunk]
+	}
+
+	var removedMesh []*Mesh
+	for _, id := range removed {
+		renderLog.Debugf("remove cache %v", id)
+		mesh, ok := r.meshcache.Remove(id)
+		if ok {
+			removedMesh = append(removedMesh, mesh)
+		}
+	}
+
+	start := time.Now()
+	newChunks := r.world.Chunks(added)
+	if len(added) != 0 {
+		r.scene.RecordChunkLoad(time.Since(start))
+	}
+	for _, c := range newChunks {
+		renderLog.Debugf("add cache %v", c.Id())
+		r.meshcache.Store(c.Id(), r.makeChunkMesh(c, false))
+	}
+
+	FrameTasks.Post(func() {
+		for _, mesh := range removedMesh {
+			mesh.Release()
+		}
+	})
+
+}
+
+// called on mainthread
+func (r *BlockRender) forceChunks(ids []world.Vec3) {
+	var removedMesh []*Mesh
+	chunks := r.world.Chunks(ids)
+	for _, chunk := range chunks {
+		id := chunk.Id()
+		mesh, ok := r.meshcache.Load(id)
+		if ok && !mesh.Stale() {
+			continue
+		}
+		r.meshcache.Store(id, r.makeChunkMesh(chunk, true))
+		if ok {
+			removedMesh = append(removedMesh, mesh)
+		}
+	}
+	FrameTasks.Post(func() {
+		for _, mesh := range removedMesh {
+			mesh.Release()
+		}
+	})
+}
+
+func (r *BlockRender) forcePlayerChunks() {
+	bid := world.NearBlock(r.scene.Camera().Pos())
+	cid := bid.Chunkid()
+	var ids []world.Vec3
+	for dx := -1; dx <= 1; dx++ {
+		for dz := -1; dz <= 1; dz++ {
+			id := world.Vec3{X: cid.X + dx, Y: 0, Z: cid.Z + dz}
+			ids = append(ids, id)
+		}
+	}
+	r.forceChunks(ids)
+}
+
+// CheckChunks wakes UpdateLoop up to build the meshes coming in view.
+func (r *BlockRender) CheckChunks() {
+	// nonblock signal
+	select {
+	case r.sigch <- struct{}{}:
+	default:
+	}
+}
+
+func (r *BlockRender) DirtyChunk(id world.Vec3) {
+	mesh, ok := r.meshcache.Load(id)
+	if !ok {
+		return
+	}
+	mesh.SetDirty()
+}
+
+// DirtyAll rebuilds the meshes of every chunk.
+func (r *BlockRender) DirtyAll() {
+	for _, id := range r.meshcache.Ids() {
+		r.DirtyChunk(id)
+	}
+	r.CheckChunks()
+}
+
+// NeighborLoaded rebuilds the mesh of chunk id if it was built while its
+// neighbor nb wasn't in the world.
+func (r *BlockRender) NeighborLoaded(id, nb world.Vec3) {
+	mesh, ok := r.meshcache.Load(id)
+	if !ok {
+		return
+	}
+	for _, missing := range mesh.missing {
+		if missing == nb {
+			mesh.SetDirty()
+			return
+		}
+	}
+}
+
+func (r *BlockRender) UpdateLoop() {
+	defer recoverPanic()
+	for {
+		select {
+		case <-r.sigch:
+		}
+		r.updateMeshCache()
+	}
+}
+
+func (r *BlockRender) drawChunks(f *Frame) {
+	r.forcePlayerChunks()
+	r.CheckChunks()
+	mat := r.Matrix()
+
+	r.shader.SetUniformAttr(0, mat)
+	r.shader.SetUniformAttr(1, r.scene.Camera().Pos())
+	f.Fog.Bind(r.shader, 2, blockFogUniform)
+	if *lightMode != "off" {
+		r.shader.SetUniformAttr(5, float32(1))
+	}
+	r.scene.BindShadows(r.shader)
+
+	frustum := geom.NewFrustum(mat)
+	r.stat = Stat{}
+	r.drawList = r.meshcache.AppendMeshes(r.drawList[:0])
+	r.transList = r.transList[:0]
+	multi := r.arena.MultiDraw()
+	for _, mesh := range r.drawList {
+		r.stat.CacheChunks++
+		if frustum.IntersectsAABB(mesh.box) {
+			r.stat.RendingChunks++
+			if shade := r.scene.ChunkShade(mesh.Id); multi && shade == 0 {
+				r.stat.Faces += r.arena.Add(mesh, &frustum)
+			} else {
+				r.bindLight(mesh)
+				r.shader.SetUniformAttr(16, shade)
+				r.stat.Faces += mesh.DrawVisible(&frustum)
+				r.stat.DrawCalls++
+			}
+			if mesh.trans != nil {
+				r.transList = append(r.transList, mesh)
+			}
+		}
+	}
+	r.shader.SetUniformAttr(16, float32(0))
+	r.stat.DrawCalls += r.arena.Draw()
+	atomic.StoreInt64(&Counts.FacesRendered, int64(r.stat.Faces))
+	r.shader.SetUniformAttr(5, float32(0))
+	r.shader.SetUniformAttr(16, float32(0))
+	r.scene.DrawBlocks(mat)
+	r.drawTranslucent()
+}
+
+// bindLight binds the light volume of mesh, call between Begin and End of
+// the block shader.
+func (r *BlockRender) bindLight(mesh *Mesh) {
+	if mesh.light == 0 {
+		return
+	}
+	r.shader.SetUniformAttr(4, mgl32.Vec3{float32(mesh.origin.X), float32(mesh.origin.Y), float32(mesh.origin.Z)})
+	gl.ActiveTexture(gl.TEXTURE1)
+	gl.BindTexture(gl.TEXTURE_3D, mesh.light)
+	gl.ActiveTexture(gl.TEXTURE0)
+}
+
+// Draw draws the chunks in view, call on mainthread.
+func (r *BlockRender) Draw(f *Frame) {
+	r.shader.Begin()
+	r.texture.Begin()
+	r.shader.SetUniformAttr(3, f.Dim)
+	r.shader.SetUniformAttr(7, f.Time)
+	r.shader.SetUniformAttr(8, f.Foliage)
+	r.shader.SetUniformAttr(9, f.Snow)
+	r.shader.SetUniformAttr(17, f.Wind)
+
+	r.drawChunks(f)
+
+	r.shader.End()
+	r.texture.End()
+}
+
+// DrawMeshes draws the chunk meshes in the frustum of mat whole, with the
+// shader and the uniforms set by the caller, for the passes of their own
+// like the shadow maps. Call on mainthread.
+func (r *BlockRender) DrawMeshes(mat mgl32.Mat4) {
+	frustum := geom.NewFrustum(mat)
+	r.passList = r.meshcache.AppendMeshes(r.passList[:0])
+	for _, mesh := range r.passList {
+		if frustum.IntersectsAABB(mesh.box) {
+			mesh.Draw()
+		}
+	}
+}
+
+// Shader returns the block shader, the other draws with it set the
+// uniforms they use.
+func (r *BlockRender) Shader() *glhf.Shader {
+	return r.shader
+}
+
+// Texture returns the texture atlas.
+func (r *BlockRender) Texture() *glhf.Texture {
+	return r.texture
+}
+
+// Meshes returns the cache of the chunk meshes.
+func (r *BlockRender) Meshes() *MeshCache {
+	return r.meshcache
+}
+
+// BlockMesh returns the mesh of a single block of type tp at the origin,
+// call on mainthread.
+func (r *BlockRender) BlockMesh(tp int) *Mesh {
+	mesh, ok := r.blockMeshes[tp]
+	if ok {
+		return mesh
+	}
+	show := [...]bool{true, true, true, true, true, true}
+	var vertices []float32
+	if world.IsPlant(tp) {
+		vertices = MakePlantData(nil, show, world.Vec3{X: 0, Y: 0, Z: 0}, Textures.Texture(tp))
+	} else {
+		vertices = MakeCubeData(nil, show, world.Vec3{X: 0, Y: 0, Z: 0}, Textures.Texture(tp))
+	}
+	if *lightMode == "baked" {
+		vertices = bakeLight(nil, vertices, nil)
+	}
+	mesh = NewMesh(r.shader, vertices)
+	r.blockMeshes[tp] = mesh
+	return mesh
+}
+
+// TileMesh returns the mesh of a cube at the origin showing tile of the
+// atlas on its six faces, call on mainthread.
+func (r *BlockRender) TileMesh(tile int) *Mesh {
+	mesh, ok := r.tileMeshes[tile]
+	if ok {
+		return mesh
+	}
+	face := MakeFaceTexture(tile)
+	texture := &BlockTexture{face, face, face, face, face, face}
+	vertices := MakeCubeData(nil, [...]bool{true, true, true, true, true, true}, world.Vec3{X: 0, Y: 0, Z: 0}, texture)
+	if *lightMode == "baked" {
+		vertices = bakeLight(nil, vertices, nil)
+	}
+	mesh = NewMesh(r.shader, vertices)
+	r.tileMeshes[tile] = mesh
+	return mesh
+}
+
+type Stat struct {
+	Faces         int
+	CacheChunks   int
+	RendingChunks int
+	DrawCalls     int // of the chunks
+}
+
+func (r *BlockRender) Stat() Stat {
+	return r.stat
+}
+
+type Mesh struct {
+	vao, vbo uint32
+	vboSize  int // bytes, from vboPool
+	faces    int
+	Id       world.Vec3
+	dirty    int32 // set by DirtyChunk from any goroutine
+	world    *world.World
+	version  uint64 // version of the chunk snapshot the mesh was built from
+	box      geom.AABB
+
+	// the chunk meshes live in the arena from vertex base, the others in
+	// their own vertex array and buffer
+	arena *ChunkArena
+	base  int32
+
+	// 3d light texture of the chunk and its world origin
+	light  uint32
+	origin world.Vec3
+
+	// translucent faces, nil if the chunk has none
+	trans *TranslucentMesh
+	// faces by height, nil for the meshes drawn whole
+	sections []meshSection
+	// side neighbors not in the world when the chunk was meshed
+	missing []world.Vec3
+}
+
+// SectionHeight is the height in blocks of the mesh sections culled on
+// their own.
+const SectionHeight = 16
+
+// meshSection is the range of the built vertices of a mesh, which is also
+// its range of indices, in SectionHeight blocks of height and the box of its
+// faces.
+type meshSection struct {
+	first, count int32
+	box          geom.AABB
+}
+
+// sortSections appends the faces of data to dst ordered by section, bottom
+// first, and returns the sections holding faces. stride is the number of
+// floats of a vertex, y comes second.
+func sortSections(dst, data []float32, stride int, id world.Vec3) ([]float32, []meshSection) {
+	const nsection = world.ChunkHeight / SectionHeight
+	faceLen := stride * 6
+	nface := len(data) / faceLen
+	// the lowest vertex of a face is at the bottom of its block
+	bottom := func(f int) float32 {
+		face := data[f*faceLen : (f+1)*faceLen]
+		y := face[1]
+		for v := stride + 1; v < faceLen; v += stride {
+			if face[v] < y {
+				y = face[v]
+			}
+		}
+		return y
+	}
+	faces := make([][]int, nsection)
+	for f := 0; f < nface; f++ {
+		s := int(bottom(f)+0.5) / SectionHeight
+		if s < 0 {
+			s = 0
+		}
+		if s >= nsection {
+			s = nsection - 1
+		}
+		faces[s] = append(faces[s], f)
+	}
+	var sections []meshSection
+	for _, list := range faces {
+		if len(list) == 0 {
+			continue
+		}
+		first := len(dst) / stride
+		box := ChunkAABB(id, 0, 0)
+		box.Min[1], box.Max[1] = float32(world.ChunkHeight), 0
+		for _, f := range list {
+			face := data[f*faceLen : (f+1)*faceLen]
+			for v := 1; v < faceLen; v += stride {
+				if face[v] < box.Min[1] {
+					box.Min[1] = face[v]
+				}
+				if face[v] > box.Max[1] {
+					box.Max[1] = face[v]
+				}
+			}
+			dst = append(dst, face...)
+		}
+		sections = append(sections, meshSection{
+			first: int32(first),
+			count: int32(len(dst)/stride - first),
+			box:   box,
+		})
+	}
+	return dst, sections
+}
+
+// The faces are built as two triangles of 6 vertices, the third and fourth
+// and the first and sixth being the same corners. The meshes only upload
+// the 4 corners of each face and draw them through a shared element buffer
+// indexing 0 1 2 2 3 0 of every face, so a range of faces keeps the same
+// offset and count in the indices as in the built vertices.
+var quadIndices struct {
+	ebo   uint32
+	faces int
+}
+
+// bindQuadIndices binds the shared element buffer to the current vertex
+// array, grown to index faces. Growing keeps the buffer name, the vertex
+// arrays bound before see the new data. Call on mainthread.
+func bindQuadIndices(faces int) {
+	if quadIndices.ebo == 0 {
+		gl.GenBuffers(1, &quadIndices.ebo)
+	}
+	gl.BindBuffer(gl.ELEMENT_ARRAY_BUFFER, quadIndices.ebo)
+	if faces <= quadIndices.faces {
+		return
+	}
+	n := 1024
+	for n < faces {
+		n *= 2
+	}
+	indices := make([]uint32, 0, n*6)
+	for i := uint32(0); i < uint32(n); i++ {
+		indices = append(indices, i*4, i*4+1, i*4+2, i*4+2, i*4+3, i*4)
+	}
+	gl.BufferData(gl.ELEMENT_ARRAY_BUFFER, len(indices)*4, gl.Ptr(indices), gl.STATIC_DRAW)
+	quadIndices.faces = n
+}
+
+// compactFaces keeps the 4 corners of the faces of data.
+func compactFaces(data []float32, stride int) []float32 {
+	faceLen := stride * 6
+	quads := make([]float32, 0, len(data)/6*4)
+	for i := 0; i+faceLen <= len(data); i += faceLen {
+		face := data[i : i+faceLen]
+		quads = append(quads, face[:3*stride]...)
+		quads = append(quads, face[4*stride:5*stride]...)
+	}
+	return quads
+}
+
+func NewMesh(shader *glhf.Shader, data []float32) *Mesh {
+	m := new(Mesh)
+	stride := shader.VertexFormat().Size() / 4
+	m.faces = len(data) / stride / 6
+	if m.faces == 0 {
+		return m
+	}
+	quads := compactFaces(data, stride)
+	gl.GenVertexArrays(1, &m.vao)
+	gl.BindVertexArray(m.vao)
+	bindQuadIndices(m.faces)
+	m.vbo, m.vboSize = vboPool.Upload(quads)
+	setVertexAttribs(shader)
+	gl.BindVertexArray(0)
+	gl.BindBuffer(gl.ARRAY_BUFFER, 0)
+	return m
+}
+
+// setVertexAttribs points the attributes of shader to the buffer bound to
+// ARRAY_BUFFER, in the current vertex array.
+func setVertexAttribs(shader *glhf.Shader) {
+	offset := 0
+	for _, attr := range shader.VertexFormat() {
+		loc := gl.GetAttribLocation(shader.ID(), gl.Str(attr.Name+"\x00"))
+		var size int32
+		switch attr.Type {
+		case glhf.Float:
+			size = 1
+		case glhf.Vec2:
+			size = 2
+		case glhf.Vec3:
+			size = 3
+		case glhf.Vec4:
+			size = 4
+		}
+		gl.VertexAttribPointer(
+			uint32(loc),
+			size,
+			gl.FLOAT,
+			false,
+			int32(shader.VertexFormat().Size()),
+			gl.PtrOffset(offset),
+		)
+		gl.EnableVertexAttribArray(uint32(loc))
+		offset += attr.Type.Size()
+	}
+}
+
+func (m *Mesh) SetDirty() {
+	atomic.StoreInt32(&m.dirty, 1)
+}
+
+// Stale reports whether the mesh needs rebuilding, either marked dirty,
+// built from an older version of its chunk or without a neighbor loaded
+// since. The last one catches the neighbors loaded before the mesh reached
+// the cache, NeighborLoaded missed them.
+func (m *Mesh) Stale() bool {
+	if atomic.LoadInt32(&m.dirty) != 0 {
+		return true
+	}
+	for _, id := range m.missing {
+		if chunk, ok := m.world.PeekChunk(id); ok && chunk.Loaded() {
+			return true
+		}
+	}
+	version, ok := m.world.ChunkVersion(m.Id)
+	return ok && version != m.version
+}
+
+func (m *Mesh) Faces() int {
+	return m.faces
+}
+
+// Version returns the version of the chunk the mesh was built from.
+func (m *Mesh) Version() uint64 {
+	return m.version
+}
+
+// Missing returns the side neighbors not in the world when the chunk was
+// meshed.
+func (m *Mesh) Missing() []world.Vec3 {
+	return m.missing
+}
+
+func (m *Mesh) Draw() {
+	if m.vao != 0 {
+		gl.BindVertexArray(m.vao)
+		gl.DrawElementsBaseVertex(gl.TRIANGLES, int32(m.faces)*6, gl.UNSIGNED_INT, nil, m.base)
+		gl.BindVertexArray(0)
+	}
+}
+
+// DrawVisible draws the sections of the mesh in frustum, the whole mesh if
+// it has no sections, and returns the faces drawn. The adjacent sections
+// are drawn at once.
+func (m *Mesh) DrawVisible(frustum *geom.Frustum) int {
+	if m.vao == 0 {
+		return 0
+	}
+	if m.sections == nil {
+		m.Draw()
+		return m.faces
+	}
+	gl.BindVertexArray(m.vao)
+	drawn := m.visibleRanges(frustum, func(first, count int32) {
+		gl.DrawElementsBaseVertex(gl.TRIANGLES, count, gl.UNSIGNED_INT, gl.PtrOffset(int(first)*4), m.base)
+	})
+	gl.BindVertexArray(0)
+	return drawn
+}
+
+// visibleRanges calls f on the index ranges of the sections in frustum,
+// adjacent ones merged, and returns their faces.
+func (m *Mesh) visibleRanges(frustum *geom.Frustum, f func(first, count int32)) int {
+	var first, count, drawn int32
+	flush := func() {
+		if count != 0 {
+			f(first, count)
+			drawn += count
+		}
+		count = 0
+	}
+	for _, s := range m.sections {
+		if !frustum.IntersectsAABB(s.box) {
+			flush()
+			continue
+		}
+		if count == 0 {
+			first = s.first
+		} else if first+count != s.first {
+			flush()
+			first = s.first
+		}
+		count += s.count
+	}
+	flush()
+	return int(drawn / 6)
+}
+
+func (m *Mesh) Release() {
+	if m.arena != nil && m.vao != 0 {
+		m.arena.Free(m.base, m.faces*4)
+		m.vao = 0
+	}
+	if m.vao != 0 {
+		gl.DeleteVertexArrays(1, &m.vao)
+		vboPool.Put(m.vbo, m.vboSize)
+		m.vao = 0
+		m.vbo = 0
+	}
+	if m.light != 0 {
+		gl.DeleteTextures(1, &m.light)
+		m.light = 0
+	}
+	if m.trans != nil {
+		m.trans.Release()
+		m.trans = nil
+	}
+}
+
+type Lines struct {
+	vao, vbo uint32
+	shader   *glhf.Shader
+	nvertex  int
+}
+
+func NewLines(shader *glhf.Shader, data []float32) *Lines {
+	l := new(Lines)
+	l.shader = shader
+	l.nvertex = len(data) / (shader.VertexFormat().Size() / 4)
+	gl.GenVertexArrays(1, &l.vao)
+	gl.GenBuffers(1, &l.vbo)
+	gl.BindVertexArray(l.vao)
+	gl.BindBuffer(gl.ARRAY_BUFFER, l.vbo)
+	gl.BufferData(gl.ARRAY_BUFFER, len(data)*4, gl.Ptr(data), gl.STATIC_DRAW)
+
+	offset := 0
+	for _, attr := range shader.VertexFormat() {
+		loc := gl.GetAttribLocation(shader.ID(), gl.Str(attr.Name+"\x00"))
+		var size int32
+		switch attr.Type {
+		case glhf.Float:
+			size = 1
+		case glhf.Vec2:
+			size = 2
+		case glhf.Vec3:
+			size = 3
+		case glhf.Vec4:
+			size = 4
+		}
+		gl.VertexAttribPointer(
+			uint32(loc),
+			size,
+			gl.FLOAT,
+			false,
+			int32(shader.VertexFormat().Size()),
+			gl.PtrOffset(offset),
+		)
+		gl.EnableVertexAttribArray(uint32(loc))
+		offset += attr.Type.Size()
+	}
+	gl.BindVertexArray(0)
+	gl.BindBuffer(gl.ARRAY_BUFFER, 0)
+	return l
+}
+
+func (l *Lines) Draw(mat mgl32.Mat4) {
+	if l.vao != 0 {
+		l.shader.SetUniformAttr(0, mat)
+		gl.BindVertexArray(l.vao)
+		gl.DrawArrays(gl.LINES, 0, int32(l.nvertex))
+		gl.BindVertexArray(0)
+	}
+}
+
+// Fill draws the vertices as triangles, for the filled shapes of the HUD.
+func (l *Lines) Fill(mat mgl32.Mat4) {
+	if l.vao != 0 {
+		l.shader.SetUniformAttr(0, mat)
+		gl.BindVertexArray(l.vao)
+		gl.DrawArrays(gl.TRIANGLES, 0, int32(l.nvertex))
+		gl.BindVertexArray(0)
+	}
+}
+
+// DrawRange draws count vertices from first.
+func (l *Lines) DrawRange(mat mgl32.Mat4, first, count int) {
+	if l.vao != 0 {
+		l.shader.SetUniformAttr(0, mat)
+		gl.BindVertexArray(l.vao)
+		gl.DrawArrays(gl.LINES, int32(first), int32(count))
+		gl.BindVertexArray(0)
+	}
+}
+
+func (l *Lines) Release() {
+	if l.vao != 0 {
+		gl.DeleteVertexArrays(1, &l.vao)
+		gl.DeleteBuffers(1, &l.vbo)
+		l.vao = 0
+		l.vbo = 0
+	}
+}
@@ -0,0 +1,92 @@
+package render
+
+import (
+	"flag"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/icexin/gocraft/world"
+)
+
+// face returns the 6 vertices of a face of stride 3 with y from y0 to y1.
+func face(y0, y1 float32) []float32 {
+	return []float32{
+		0, y0, 0,
+		1, y0, 0,
+		1, y1, 0,
+		1, y1, 0,
+		0, y1, 0,
+		0, y0, 0,
+	}
+}
+
+func TestSortSections(t *testing.T) {
+	var data []float32
+	data = append(data, face(40.5, 41.5)...)
+	data = append(data, face(-0.5, 0.5)...)
+	data = append(data, face(39.5, 40.5)...)
+	id := world.Vec3{X: 1, Z: -2}
+	dst, sections := sortSections(nil, data, 3, id)
+
+	var want []float32
+	want = append(want, face(-0.5, 0.5)...)
+	want = append(want, face(40.5, 41.5)...)
+	want = append(want, face(39.5, 40.5)...)
+	if !reflect.DeepEqual(dst, want) {
+		t.Fatalf("sorted faces %v, want %v", dst, want)
+	}
+	if len(sections) != 2 {
+		t.Fatalf("%d sections, want 2", len(sections))
+	}
+	if s := sections[0]; s.first != 0 || s.count != 6 {
+		t.Errorf("bottom section at %d, %d vertices", s.first, s.count)
+	}
+	if s := sections[1]; s.first != 6 || s.count != 12 {
+		t.Errorf("top section at %d, %d vertices", s.first, s.count)
+	}
+	box := sections[1].box
+	if box.Min[1] != 39.5 || box.Max[1] != 41.5 {
+		t.Errorf("top section from y %v to %v, want 39.5 to 41.5", box.Min[1], box.Max[1])
+	}
+	if chunk := ChunkAABB(id, 0, 0); box.Min[0] != chunk.Min[0] || box.Max[2] != chunk.Max[2] {
+		t.Errorf("section box %v out of the chunk %v", box, chunk)
+	}
+}
+
+func TestTaskQueue(t *testing.T) {
+	q := &TaskQueue{}
+	var ran []int
+	for i := 0; i < 3; i++ {
+		i := i
+		q.Post(func() {
+			ran = append(ran, i)
+		})
+	}
+	// a spent budget still runs one task
+	if n := q.Run(0); n != 1 || q.Len() != 2 {
+		t.Errorf("ran %d tasks, %d left, want 1 and 2", n, q.Len())
+	}
+	if n := q.Run(time.Hour); n != 2 || q.Len() != 0 {
+		t.Errorf("ran %d tasks, %d left, want 2 and 0", n, q.Len())
+	}
+	if !reflect.DeepEqual(ran, []int{0, 1, 2}) {
+		t.Errorf("tasks ran in order %v", ran)
+	}
+}
+
+func TestAddFlags(t *testing.T) {
+	defer SetRadius(Radius())
+	defer SetLightMode(LightMode())
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	AddFlags(fs)
+	if err := fs.Parse([]string{"-r", "9", "-light", "off"}); err != nil {
+		t.Fatal(err)
+	}
+	if Radius() != 9 {
+		t.Errorf("radius %d, want 9", Radius())
+	}
+	if LightMode() != "off" {
+		t.Errorf("light mode %q, want off", LightMode())
+	}
+}
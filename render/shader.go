@@ -0,0 +1,29 @@
+package render
+
+import (
+	_ "embed"
+	"strings"
+)
+
+var (
+	//go:embed block.vert
+	blockVertexSource string
+
+	//go:embed block.frag
+	blockFragmentSource string
+
+	// the fog function of the block and lod vertex shaders
+	//go:embed fog.glsl
+	FogSource string
+)
+
+// ShaderDefine adds a #define after the #version line of source.
+func ShaderDefine(source, name string) string {
+	return ShaderInclude(source, "#define "+name+"\n")
+}
+
+// ShaderInclude adds code after the #version line of source.
+func ShaderInclude(source, code string) string {
+	idx := strings.Index(source, "\n")
+	return source[:idx+1] + code + source[idx+1:]
+}
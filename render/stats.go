@@ -0,0 +1,48 @@
+package render
+
+import "sync/atomic"
+
+// Counters count the buffers and the meshes of the block renders, the
+// game serves them at /debug/vars.
+type Counters struct {
+	FaceGets   int64
+	FaceMisses int64 // allocated by the pool
+	VBOGets    int64
+	VBOHits    int64 // reused from the pool
+	VBOPooled  int64 // bytes
+
+	MeshesBuilt   int64
+	FacesRendered int64 // in the last frame
+}
+
+var Counts = &Counters{}
+
+// VBOPool returns the counters of the vertex buffer pool for expvar.
+func (s *Counters) VBOPool() map[string]interface{} {
+	gets, hits := atomic.LoadInt64(&s.VBOGets), atomic.LoadInt64(&s.VBOHits)
+	rate := 0.0
+	if gets != 0 {
+		rate = float64(hits) / float64(gets)
+	}
+	return map[string]interface{}{
+		"enabled":  *vboPoolEnabled,
+		"gets":     gets,
+		"hits":     hits,
+		"hit_rate": rate,
+		"bytes":    atomic.LoadInt64(&s.VBOPooled),
+	}
+}
+
+// FacePool returns the counters of the face buffer pool for expvar.
+func (s *Counters) FacePool() map[string]interface{} {
+	gets, misses := atomic.LoadInt64(&s.FaceGets), atomic.LoadInt64(&s.FaceMisses)
+	rate := 0.0
+	if gets != 0 {
+		rate = float64(gets-misses) / float64(gets)
+	}
+	return map[string]interface{}{
+		"gets":     gets,
+		"misses":   misses,
+		"hit_rate": rate,
+	}
+}
@@ -0,0 +1,63 @@
+package render
+
+import (
+	"sync"
+	"time"
+)
+
+// TaskQueue runs the GPU work of the other goroutines on the main thread a
+// bit every frame, a burst of chunk meshes is spread over several frames
+// instead of stalling one.
+type TaskQueue struct {
+	mutex sync.Mutex
+	tasks []func()
+}
+
+// FrameTasks is run by the game every frame.
+var FrameTasks = &TaskQueue{}
+
+// Post queues f without waiting for it.
+func (q *TaskQueue) Post(f func()) {
+	q.mutex.Lock()
+	q.tasks = append(q.tasks, f)
+	q.mutex.Unlock()
+}
+
+// Call queues f and waits until a frame ran it, don't call on mainthread.
+func (q *TaskQueue) Call(f func()) {
+	done := make(chan struct{})
+	q.Post(func() {
+		f()
+		close(done)
+	})
+	<-done
+}
+
+func (q *TaskQueue) Len() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return len(q.tasks)
+}
+
+// Run runs the queued tasks in order until budget is spent, at least one
+// so the queue always drains. Call on mainthread once per frame.
+func (q *TaskQueue) Run(budget time.Duration) int {
+	start := time.Now()
+	n := 0
+	for {
+		q.mutex.Lock()
+		if len(q.tasks) == 0 {
+			q.mutex.Unlock()
+			return n
+		}
+		f := q.tasks[0]
+		q.tasks[0] = nil
+		q.tasks = q.tasks[1:]
+		q.mutex.Unlock()
+		f()
+		n++
+		if time.Since(start) >= budget {
+			return n
+		}
+	}
+}
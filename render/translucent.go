@@ -0,0 +1,100 @@
+package render
+
+import (
+	"sort"
+
+	"github.com/faiface/glhf"
+	"github.com/go-gl/gl/v3.3-core/gl"
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/icexin/gocraft/world"
+)
+
+// TranslucentMesh holds the blended faces of a chunk. They are drawn after
+// the opaque faces without writing depth, so they must go back to front:
+// the faces are kept on the cpu and sorted again when the camera enters
+// another block.
+type TranslucentMesh struct {
+	*Mesh
+	data   []float32
+	stride int // floats per vertex
+
+	eye    world.Vec3 // camera block of the last sort
+	sorted bool
+}
+
+// call on mainthread
+func newTranslucentMesh(shader *glhf.Shader, data []float32) *TranslucentMesh {
+	return &TranslucentMesh{
+		Mesh:   NewMesh(shader, data),
+		data:   append([]float32(nil), data...),
+		stride: shader.VertexFormat().Size() / 4,
+	}
+}
+
+// sortFaces orders the faces from the farthest to the nearest to eye.
+func (t *TranslucentMesh) sortFaces(eye mgl32.Vec3) {
+	block := world.NearBlock(eye)
+	if t.sorted && block == t.eye {
+		return
+	}
+	t.eye, t.sorted = block, true
+
+	faceSize := t.stride * 6
+	n := len(t.data) / faceSize
+	dist := make([]float32, n)
+	order := make([]int, n)
+	for i := range order {
+		// the first and third vertices are opposite corners of the face
+		v0 := t.data[i*faceSize:]
+		v2 := t.data[i*faceSize+2*t.stride:]
+		center := mgl32.Vec3{(v0[0] + v2[0]) / 2, (v0[1] + v2[1]) / 2, (v0[2] + v2[2]) / 2}
+		dist[i] = center.Sub(eye).LenSqr()
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool {
+		return dist[order[i]] > dist[order[j]]
+	})
+	sorted := make([]float32, 0, len(t.data))
+	for _, i := range order {
+		sorted = append(sorted, t.data[i*faceSize:(i+1)*faceSize]...)
+	}
+	t.data = sorted
+	quads := compactFaces(t.data, t.stride)
+	gl.BindBuffer(gl.ARRAY_BUFFER, t.vbo)
+	gl.BufferSubData(gl.ARRAY_BUFFER, 0, len(quads)*4, gl.Ptr(quads))
+	gl.BindBuffer(gl.ARRAY_BUFFER, 0)
+}
+
+// drawTranslucent draws the translucent faces of the visible chunks from the
+// farthest chunk, call last between Begin and End of the block shader.
+func (r *BlockRender) drawTranslucent() {
+	eye := r.scene.Camera().Pos()
+	center := func(m *Mesh) mgl32.Vec3 {
+		return m.box.Min.Add(m.box.Max).Mul(0.5)
+	}
+	sort.Slice(r.transList, func(i, j int) bool {
+		return center(r.transList[i]).Sub(eye).LenSqr() > center(r.transList[j]).Sub(eye).LenSqr()
+	})
+
+	gl.Enable(gl.BLEND)
+	// keep the opaque alpha of the window, screenshots save it
+	gl.BlendFuncSeparate(gl.SRC_ALPHA, gl.ONE_MINUS_SRC_ALPHA, gl.ZERO, gl.ONE)
+	gl.DepthMask(false)
+	r.shader.SetUniformAttr(15, float32(1))
+	if *lightMode != "off" {
+		r.shader.SetUniformAttr(5, float32(1))
+	}
+	for _, mesh := range r.transList {
+		mesh.trans.sortFaces(eye)
+		r.stat.Faces += mesh.trans.Faces()
+		r.stat.DrawCalls++
+		r.bindLight(mesh)
+		r.shader.SetUniformAttr(16, r.scene.ChunkShade(mesh.Id))
+		mesh.trans.Draw()
+	}
+	r.shader.SetUniformAttr(16, float32(0))
+	r.shader.SetUniformAttr(5, float32(0))
+	r.shader.SetUniformAttr(15, float32(0))
+	gl.DepthMask(true)
+	gl.Disable(gl.BLEND)
+}
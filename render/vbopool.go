@@ -0,0 +1,75 @@
+package render
+
+import (
+	"sync/atomic"
+
+	"github.com/go-gl/gl/v3.3-core/gl"
+)
+
+var vboPoolEnabled = flags.Bool("vbopool", true, "reuse the vertex buffers of the released meshes, frame_ms in /debug/vars compares the frame times with it off")
+
+const (
+	minVBOClass    = 4 << 10  // bytes
+	maxPooledBytes = 64 << 20 // released buffers kept for reuse
+)
+
+// VBOPool keeps the vertex buffers of the released meshes by power of two
+// size, a rebuilt chunk takes a buffer of its size class instead of
+// allocating one. The storage of a reused buffer is orphaned before the new
+// vertices are written, the frames still drawing from it keep the old one.
+// Call on mainthread.
+type VBOPool struct {
+	free  map[int][]uint32 // by class
+	bytes int
+}
+
+var vboPool = &VBOPool{
+	free: make(map[int][]uint32),
+}
+
+func vboClass(size int) int {
+	class := minVBOClass
+	for class < size {
+		class *= 2
+	}
+	return class
+}
+
+// Upload returns a buffer bound to ARRAY_BUFFER holding data and its size in
+// bytes, give it back with Put.
+func (p *VBOPool) Upload(data []float32) (uint32, int) {
+	var vbo uint32
+	size := len(data) * 4
+	if !*vboPoolEnabled {
+		gl.GenBuffers(1, &vbo)
+		gl.BindBuffer(gl.ARRAY_BUFFER, vbo)
+		gl.BufferData(gl.ARRAY_BUFFER, size, gl.Ptr(data), gl.STATIC_DRAW)
+		return vbo, size
+	}
+	atomic.AddInt64(&Counts.VBOGets, 1)
+	class := vboClass(size)
+	if list := p.free[class]; len(list) != 0 {
+		vbo = list[len(list)-1]
+		p.free[class] = list[:len(list)-1]
+		p.bytes -= class
+		atomic.AddInt64(&Counts.VBOHits, 1)
+		atomic.StoreInt64(&Counts.VBOPooled, int64(p.bytes))
+	} else {
+		gl.GenBuffers(1, &vbo)
+	}
+	gl.BindBuffer(gl.ARRAY_BUFFER, vbo)
+	gl.BufferData(gl.ARRAY_BUFFER, class, nil, gl.STATIC_DRAW)
+	gl.BufferSubData(gl.ARRAY_BUFFER, 0, size, gl.Ptr(data))
+	return vbo, class
+}
+
+// Put keeps a buffer of Upload for reuse, or deletes it once the pool is full.
+func (p *VBOPool) Put(vbo uint32, size int) {
+	if !*vboPoolEnabled || size != vboClass(size) || p.bytes+size > maxPooledBytes {
+		gl.DeleteBuffers(1, &vbo)
+		return
+	}
+	p.free[size] = append(p.free[size], vbo)
+	p.bytes += size
+	atomic.StoreInt64(&Counts.VBOPooled, int64(p.bytes))
+}
@@ -0,0 +1,577 @@
+// Package store saves the block edits, the chunks, the entities and the
+// player data of the gocraft worlds in a bolt db, the edits written behind
+// in batches.
+package store
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/icexin/gocraft/internal/logging"
+	"github.com/icexin/gocraft/internal/metrics"
+	"github.com/icexin/gocraft/internal/protocol"
+	"github.com/icexin/gocraft/world"
+)
+
+var storeLog = logging.New("store")
+
+// PanicHandler, if set, is called with the value and the stack of a panic
+// in the write loop of a store before it goes on.
+var PanicHandler func(v interface{}, stack []byte)
+
+// recoverPanic hands the panic of the goroutine to PanicHandler and panics
+// again.
+func recoverPanic() {
+	if v := recover(); v != nil {
+		if PanicHandler != nil {
+			PanicHandler(v, debug.Stack())
+		}
+		panic(v)
+	}
+}
+
+// latency buckets in milliseconds of the bolt transactions
+var txBuckets = []float64{0.1, 0.5, 1, 5, 10, 50, 100, 500}
+
+// the durations of the bolt transactions of the stores
+var (
+	UpdateDurations = metrics.NewHistogram(txBuckets)
+	ViewDurations   = metrics.NewHistogram(txBuckets)
+)
+
+var (
+	blockBucket  = []byte("block")
+	chunkBucket  = []byte("chunk")
+	cameraBucket = []byte("camera")
+	// a bucket by world and profile holding playerKey and spawnKey
+	playersBucket = []byte("players")
+	statsBucket   = []byte("stats")
+	// whole chunks pushed out of the world cache, by seed, terrain version
+	// and chunk id
+	terrainBucket = []byte("terrain")
+	// the entities of the chunks by seed and chunk id, an empty list once
+	// the chunk was populated
+	entitiesBucket = []byte("entities")
+	// the versioned player data, the older versions kept it and the spawn
+	// under cameraBucket, the position alone under cameraBucket before that
+	playerKey    = []byte("player")
+	spawnKey     = []byte("spawn")
+	tickSpeedKey = []byte("randomTickSpeed")
+)
+
+// DefaultProfile is the profile of the players without a name.
+const DefaultProfile = "default"
+
+// Store keeps the block edits, the chunks and the players of the worlds in
+// a bolt db.
+type Store struct {
+	db    *bolt.DB
+	edits *writeBehind
+	// the playersBucket key of the player
+	slot []byte
+}
+
+func NewStore(p string) (*Store, error) {
+	db, err := bolt.Open(p, 0666, nil)
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(blockBucket)
+		if err != nil {
+			return err
+		}
+		_, err = tx.CreateBucketIfNotExists(chunkBucket)
+		if err != nil {
+			return err
+		}
+		_, err = tx.CreateBucketIfNotExists(cameraBucket)
+		if err != nil {
+			return err
+		}
+		_, err = tx.CreateBucketIfNotExists(playersBucket)
+		if err != nil {
+			return err
+		}
+		_, err = tx.CreateBucketIfNotExists(statsBucket)
+		if err != nil {
+			return err
+		}
+		_, err = tx.CreateBucketIfNotExists(terrainBucket)
+		if err != nil {
+			return err
+		}
+		_, err = tx.CreateBucketIfNotExists(entitiesBucket)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	db.NoSync = true
+	s := &Store{
+		db:    db,
+		edits: newWriteBehind(),
+		slot:  []byte(fmt.Sprintf("local-%d/%s", world.Seed, DefaultProfile)),
+	}
+	go s.writeLoop()
+	return s, nil
+}
+
+// UpdateBlock queues a block edit, committed with the others of the next
+// batch.
+func (s *Store) UpdateBlock(id world.Vec3, w int) error {
+	s.edits.add(id, w)
+	return nil
+}
+
+// UpdatePlayerData saves the encoded player data of the slot.
+func (s *Store) UpdatePlayerData(value []byte) error {
+	return s.update(func(tx *bolt.Tx) error {
+		bkt, err := s.playerBucket(tx)
+		if err != nil {
+			return err
+		}
+		return bkt.Put(playerKey, value)
+	})
+}
+
+// SetPlayerSlot selects the player state read and saved, by world and
+// profile. The player state saved under cameraBucket by the older versions
+// moves to the first slot selected.
+func (s *Store) SetPlayerSlot(slot string) {
+	s.slot = []byte(slot)
+	if err := s.migratePlayer(); err != nil {
+		storeLog.Errorf("migrate player data:%s", err)
+	}
+}
+
+// the keys of the player state under cameraBucket in the older versions
+var legacyPlayerKeys = [][]byte{playerKey, spawnKey, cameraBucket}
+
+// migratePlayer moves the legacy player state into the player slot, unless
+// the slot already has one.
+func (s *Store) migratePlayer() error {
+	return s.update(func(tx *bolt.Tx) error {
+		legacy := tx.Bucket(cameraBucket)
+		found := false
+		for _, key := range legacyPlayerKeys {
+			if legacy.Get(key) != nil {
+				found = true
+			}
+		}
+		if !found {
+			return nil
+		}
+		bkt, err := s.playerBucket(tx)
+		if err != nil {
+			return err
+		}
+		keep := bkt.Get(playerKey) == nil && bkt.Get(spawnKey) == nil
+		for _, key := range legacyPlayerKeys {
+			value := legacy.Get(key)
+			if value == nil {
+				continue
+			}
+			if keep {
+				// the value is only valid in the transaction
+				if err := bkt.Put(key, append([]byte(nil), value...)); err != nil {
+					return err
+				}
+			}
+			if err := legacy.Delete(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// PlayerSlots returns the slots having a saved player state.
+func (s *Store) PlayerSlots() []string {
+	var slots []string
+	s.view(func(tx *bolt.Tx) error {
+		return tx.Bucket(playersBucket).ForEach(func(k, v []byte) error {
+			slots = append(slots, string(k))
+			return nil
+		})
+	})
+	return slots
+}
+
+func (s *Store) playerBucket(tx *bolt.Tx) (*bolt.Bucket, error) {
+	return tx.Bucket(playersBucket).CreateBucketIfNotExists(s.slot)
+}
+
+// playerValue returns the key of the player slot.
+func (s *Store) playerValue(tx *bolt.Tx, key []byte) []byte {
+	if bkt := tx.Bucket(playersBucket).Bucket(s.slot); bkt != nil {
+		return bkt.Get(key)
+	}
+	return nil
+}
+
+// GetPlayerData returns the encoded player data of the slot, nil if there
+// is none. legacy is then the position saved alone by the older versions,
+// nil if there is none either.
+func (s *Store) GetPlayerData() (data, legacy []byte) {
+	s.view(func(tx *bolt.Tx) error {
+		if value := s.playerValue(tx, playerKey); value != nil {
+			data = append([]byte{}, value...)
+		} else if value := s.playerValue(tx, cameraBucket); value != nil {
+			legacy = append([]byte{}, value...)
+		}
+		return nil
+	})
+	return data, legacy
+}
+
+// UpdateSpawn saves the encoded spawn of the slot.
+func (s *Store) UpdateSpawn(value []byte) error {
+	return s.update(func(tx *bolt.Tx) error {
+		bkt, err := s.playerBucket(tx)
+		if err != nil {
+			return err
+		}
+		return bkt.Put(spawnKey, value)
+	})
+}
+
+// GetSpawn returns the encoded spawn of the slot, nil if there is none.
+func (s *Store) GetSpawn() []byte {
+	var spawn []byte
+	s.view(func(tx *bolt.Tx) error {
+		if value := s.playerValue(tx, spawnKey); value != nil {
+			spawn = append([]byte{}, value...)
+		}
+		return nil
+	})
+	return spawn
+}
+
+// UpdateRandomTickSpeed saves the random tick speed of the world.
+func (s *Store) UpdateRandomTickSpeed(speed int) error {
+	return s.update(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket(cameraBucket)
+		buf := new(bytes.Buffer)
+		binary.Write(buf, binary.LittleEndian, int32(speed))
+		return bkt.Put(tickSpeedKey, buf.Bytes())
+	})
+}
+
+func (s *Store) GetRandomTickSpeed() (int, bool) {
+	var (
+		speed int32
+		ok    bool
+	)
+	s.view(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket(cameraBucket)
+		value := bkt.Get(tickSpeedKey)
+		if value == nil {
+			return nil
+		}
+		buf := bytes.NewBuffer(value)
+		ok = binary.Read(buf, binary.LittleEndian, &speed) == nil
+		return nil
+	})
+	return int(speed), ok
+}
+
+// UpdateStats saves the world statistics by name.
+func (s *Store) UpdateStats(stats map[string]float64) error {
+	return s.update(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket(statsBucket)
+		for name, v := range stats {
+			buf := new(bytes.Buffer)
+			binary.Write(buf, binary.LittleEndian, v)
+			if err := bkt.Put([]byte(name), buf.Bytes()); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *Store) GetStats() map[string]float64 {
+	stats := make(map[string]float64)
+	s.view(func(tx *bolt.Tx) error {
+		return tx.Bucket(statsBucket).ForEach(func(k, v []byte) error {
+			var f float64
+			if binary.Read(bytes.NewBuffer(v), binary.LittleEndian, &f) == nil {
+				stats[string(k)] = f
+			}
+			return nil
+		})
+	})
+	return stats
+}
+
+// UpdateTerrain saves the blocks of chunk id with its queued edits, a chunk
+// of another seed is never loaded back.
+func (s *Store) UpdateTerrain(id world.Vec3, blocks map[world.Vec3]int) error {
+	list := make([][4]int, 0, len(blocks))
+	for bid, w := range blocks {
+		list = append(list, [4]int{bid.X, bid.Y, bid.Z, w})
+	}
+	data := protocol.EncodeChunkBlocks(id, list)
+	return s.flush([]world.Vec3{id}, func(tx *bolt.Tx) error {
+		return tx.Bucket(terrainBucket).Put(encodeTerrainKey(id, world.TerrainVersion), data)
+	})
+}
+
+// ImportTerrain saves the blocks of chunk id as its terrain and drops the
+// edits of the chunk, the imported terrain outlives the generator changes.
+func (s *Store) ImportTerrain(id world.Vec3, blocks map[world.Vec3]int) error {
+	list := make([][4]int, 0, len(blocks))
+	for bid, w := range blocks {
+		list = append(list, [4]int{bid.X, bid.Y, bid.Z, w})
+	}
+	data := protocol.EncodeChunkBlocks(id, list)
+	return s.flush([]world.Vec3{id}, func(tx *bolt.Tx) error {
+		bkt := tx.Bucket(blockBucket)
+		start := encodeBlockDbKey(id, world.Vec3{})
+		prefix := start[:8]
+		c := bkt.Cursor()
+		for k, _ := c.Seek(start); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Seek(start) {
+			if err := c.Delete(); err != nil {
+				return err
+			}
+		}
+		bkt = tx.Bucket(terrainBucket)
+		// the chunk saved since by the generator would hide the import
+		if err := bkt.Delete(encodeTerrainKey(id, world.TerrainVersion)); err != nil {
+			return err
+		}
+		return bkt.Put(encodeTerrainKey(id, importedTerrain), data)
+	})
+}
+
+// GetTerrain returns the saved blocks of chunk id, nil if there are none.
+// The chunks saved by another terrain version are left out, the imported
+// ones are kept.
+func (s *Store) GetTerrain(id world.Vec3) (map[world.Vec3]int, error) {
+	var data []byte
+	s.view(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket(terrainBucket)
+		v := bkt.Get(encodeTerrainKey(id, world.TerrainVersion))
+		if v == nil {
+			v = bkt.Get(encodeTerrainKey(id, importedTerrain))
+		}
+		if v != nil {
+			data = append([]byte{}, v...)
+		}
+		return nil
+	})
+	if data == nil {
+		return nil, nil
+	}
+	list, err := protocol.DecodeChunkBlocks(id, data)
+	if err != nil {
+		return nil, err
+	}
+	blocks := make(map[world.Vec3]int, len(list))
+	for _, b := range list {
+		blocks[world.Vec3{X: b[0], Y: b[1], Z: b[2]}] = b[3]
+	}
+	return blocks, nil
+}
+
+// UpdateEntities queues the encoded entities of the chunks, committed with
+// the block edits of the next batch.
+func (s *Store) UpdateEntities(chunks map[world.Vec3][]byte) error {
+	s.edits.addEntities(chunks)
+	return nil
+}
+
+// GetEntities returns the encoded entities of chunk id, the queued ones
+// included, false if the chunk was never populated.
+func (s *Store) GetEntities(id world.Vec3) ([]byte, bool) {
+	if data, ok := s.edits.chunkEntities(id); ok {
+		return data, true
+	}
+	var data []byte
+	s.view(func(tx *bolt.Tx) error {
+		if v := tx.Bucket(entitiesBucket).Get(encodeChunkKey(id)); v != nil {
+			data = append([]byte{}, v...)
+		}
+		return nil
+	})
+	return data, data != nil
+}
+
+// RangeBlocks calls f on the saved changes of chunk id, the queued ones
+// included.
+func (s *Store) RangeBlocks(id world.Vec3, f func(bid world.Vec3, w int)) error {
+	queued := s.edits.chunkEdits(id)
+	err := s.view(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket(blockBucket)
+		startkey := encodeBlockDbKey(id, world.Vec3{X: 0, Y: 0, Z: 0})
+		iter := bkt.Cursor()
+		for k, v := iter.Seek(startkey); k != nil; k, v = iter.Next() {
+			cid, bid := decodeBlockDbKey(k)
+			if cid != id {
+				break
+			}
+			if _, ok := queued[bid]; ok {
+				continue
+			}
+			w := decodeBlockDbValue(v)
+			f(bid, w)
+		}
+		return nil
+	})
+	for bid, w := range queued {
+		f(bid, w)
+	}
+	return err
+}
+
+// RangeEdits calls f on all the saved changes, the queued ones included.
+func (s *Store) RangeEdits(f func(bid world.Vec3, w int)) error {
+	queued := s.edits.allEdits()
+	err := s.view(func(tx *bolt.Tx) error {
+		return tx.Bucket(blockBucket).ForEach(func(k, v []byte) error {
+			_, bid := decodeBlockDbKey(k)
+			if _, ok := queued[bid]; !ok {
+				f(bid, decodeBlockDbValue(v))
+			}
+			return nil
+		})
+	})
+	for bid, w := range queued {
+		f(bid, w)
+	}
+	return err
+}
+
+// RangeSyncedChunks calls f on the chunks fetched from a server.
+func (s *Store) RangeSyncedChunks(f func(id world.Vec3)) error {
+	return s.view(func(tx *bolt.Tx) error {
+		return tx.Bucket(chunkBucket).ForEach(func(k, v []byte) error {
+			f(decodeVec3(k))
+			return nil
+		})
+	})
+}
+
+func (s *Store) UpdateChunkVersion(id world.Vec3, version string) error {
+	return s.update(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket(chunkBucket)
+		key := encodeVec3(id)
+		return bkt.Put(key, []byte(version))
+	})
+}
+
+func (s *Store) GetChunkVersion(id world.Vec3) string {
+	var version string
+	s.view(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket(chunkBucket)
+		key := encodeVec3(id)
+		v := bkt.Get(key)
+		if v != nil {
+			version = string(v)
+		}
+		return nil
+	})
+	return version
+}
+
+func (s *Store) update(f func(tx *bolt.Tx) error) error {
+	start := time.Now()
+	defer func() { UpdateDurations.Record(time.Since(start)) }()
+	return s.db.Update(f)
+}
+
+func (s *Store) view(f func(tx *bolt.Tx) error) error {
+	start := time.Now()
+	defer func() { ViewDurations.Record(time.Since(start)) }()
+	return s.db.View(f)
+}
+
+// Close commits the queued edits and closes the db.
+func (s *Store) Close() {
+	close(s.edits.done)
+	if err := s.Flush(); err != nil {
+		storeLog.Errorf("commit block edits error:%s", err)
+	}
+	s.edits.flushMutex.Lock()
+	defer s.edits.flushMutex.Unlock()
+	s.edits.closed = true
+	s.db.Sync()
+	s.db.Close()
+}
+
+func encodeVec3(v world.Vec3) []byte {
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.LittleEndian, [...]int32{int32(v.X), int32(v.Y), int32(v.Z)})
+	return buf.Bytes()
+}
+
+func decodeVec3(b []byte) world.Vec3 {
+	var arr [3]int32
+	binary.Read(bytes.NewBuffer(b), binary.LittleEndian, &arr)
+	return world.Vec3{X: int(arr[0]), Y: int(arr[1]), Z: int(arr[2])}
+}
+
+// the terrain version of the chunks imported from another game, they are
+// kept whatever the generator
+const importedTerrain = 0
+
+// encodeTerrainKey returns the terrainBucket key of chunk id saved by the
+// terrain version, the keys without a version of the older versions are
+// never read.
+func encodeTerrainKey(id world.Vec3, version uint32) []byte {
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.LittleEndian, int64(world.Seed))
+	binary.Write(buf, binary.LittleEndian, version)
+	buf.Write(encodeVec3(id))
+	return buf.Bytes()
+}
+
+// encodeChunkKey returns the key of chunk id in the world of the seed.
+func encodeChunkKey(id world.Vec3) []byte {
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.LittleEndian, int64(world.Seed))
+	buf.Write(encodeVec3(id))
+	return buf.Bytes()
+}
+
+func encodeBlockDbKey(cid, bid world.Vec3) []byte {
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.LittleEndian, [...]int32{int32(cid.X), int32(cid.Z)})
+	binary.Write(buf, binary.LittleEndian, [...]int32{int32(bid.X), int32(bid.Y), int32(bid.Z)})
+	return buf.Bytes()
+}
+
+func decodeBlockDbKey(b []byte) (world.Vec3, world.Vec3) {
+	if len(b) != 4*5 {
+		log.Panicf("bad db key length:%d", len(b))
+	}
+	buf := bytes.NewBuffer(b)
+	var arr [5]int32
+	binary.Read(buf, binary.LittleEndian, &arr)
+
+	cid := world.Vec3{X: int(arr[0]), Y: 0, Z: int(arr[1])}
+	bid := world.Vec3{X: int(arr[2]), Y: int(arr[3]), Z: int(arr[4])}
+	if bid.Chunkid() != cid {
+		log.Panicf("bad db key: cid:%v, bid:%v", cid, bid)
+	}
+	return cid, bid
+}
+
+func encodeBlockDbValue(w int) []byte {
+	value := make([]byte, 4)
+	binary.LittleEndian.PutUint32(value, uint32(w))
+	return value
+}
+
+func decodeBlockDbValue(b []byte) int {
+	if len(b) != 4 {
+		log.Panicf("bad db value length:%d", len(b))
+	}
+	return int(binary.LittleEndian.Uint32(b))
+}
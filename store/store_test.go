@@ -0,0 +1,143 @@
+package store
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/icexin/gocraft/world"
+)
+
+func openTestStore(t *testing.T) (*Store, string) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	s, err := NewStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, path
+}
+
+func chunkBlocks(s *Store, id world.Vec3) map[world.Vec3]int {
+	blocks := make(map[world.Vec3]int)
+	s.RangeBlocks(id, func(bid world.Vec3, w int) {
+		blocks[bid] = w
+	})
+	return blocks
+}
+
+func TestBlockEdits(t *testing.T) {
+	s, path := openTestStore(t)
+	a := world.Vec3{X: 1, Y: 2, Z: 3}
+	b := world.Vec3{X: -40, Y: 10, Z: 5}
+	s.UpdateBlock(a, world.Stone)
+	s.UpdateBlock(b, world.Grass)
+	// the queued edits are read back before and after the commit
+	want := map[world.Vec3]int{a: world.Stone}
+	if got := chunkBlocks(s, a.Chunkid()); !reflect.DeepEqual(got, want) {
+		t.Errorf("queued edits %v, want %v", got, want)
+	}
+	if err := s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	s.UpdateBlock(a, 0)
+	want = map[world.Vec3]int{a: 0}
+	if got := chunkBlocks(s, a.Chunkid()); !reflect.DeepEqual(got, want) {
+		t.Errorf("edits %v, want %v", got, want)
+	}
+	if s.Pending() != 1 {
+		t.Errorf("%d pending edits, want 1", s.Pending())
+	}
+	s.Close()
+
+	s, err := NewStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	all := make(map[world.Vec3]int)
+	s.RangeEdits(func(bid world.Vec3, w int) {
+		all[bid] = w
+	})
+	want = map[world.Vec3]int{a: 0, b: world.Grass}
+	if !reflect.DeepEqual(all, want) {
+		t.Errorf("reopened edits %v, want %v", all, want)
+	}
+}
+
+func TestTerrain(t *testing.T) {
+	s, _ := openTestStore(t)
+	defer s.Close()
+	id := world.Vec3{X: 2, Z: -1}
+	if blocks, err := s.GetTerrain(id); blocks != nil || err != nil {
+		t.Fatalf("terrain %v, %v of a chunk never saved", blocks, err)
+	}
+	blocks := map[world.Vec3]int{
+		{X: 64, Y: 0, Z: -32}: world.Stone,
+		{X: 70, Y: 20, Z: -1}: world.Grass,
+	}
+	if err := s.UpdateTerrain(id, blocks); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.GetTerrain(id)
+	if err != nil || !reflect.DeepEqual(got, blocks) {
+		t.Errorf("terrain %v, %v, want %v", got, err, blocks)
+	}
+
+	// an import drops the edits of the chunk
+	s.UpdateBlock(world.Vec3{X: 64, Y: 1, Z: -32}, world.Brick)
+	imported := map[world.Vec3]int{{X: 65, Y: 3, Z: -30}: world.Brick}
+	if err := s.ImportTerrain(id, imported); err != nil {
+		t.Fatal(err)
+	}
+	if got := chunkBlocks(s, id); len(got) != 0 {
+		t.Errorf("edits %v left by the import", got)
+	}
+	got, err = s.GetTerrain(id)
+	if err != nil || !reflect.DeepEqual(got, imported) {
+		t.Errorf("imported terrain %v, %v, want %v", got, err, imported)
+	}
+}
+
+func TestPlayerSlots(t *testing.T) {
+	s, _ := openTestStore(t)
+	defer s.Close()
+	// the position saved alone by the older versions
+	legacy := []byte{1, 2, 3, 4}
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(cameraBucket).Put(cameraBucket, legacy)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetPlayerSlot("local-1/alice")
+	if data, got := s.GetPlayerData(); data != nil || !bytes.Equal(got, legacy) {
+		t.Errorf("player data %v, legacy %v, want the legacy %v", data, got, legacy)
+	}
+	if err := s.UpdatePlayerData([]byte("alice")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.UpdateSpawn([]byte("bed")); err != nil {
+		t.Fatal(err)
+	}
+
+	// the legacy state went to the first slot only
+	s.SetPlayerSlot("local-1/bob")
+	if data, legacy := s.GetPlayerData(); data != nil || legacy != nil {
+		t.Errorf("new slot has player data %v, legacy %v", data, legacy)
+	}
+	if spawn := s.GetSpawn(); spawn != nil {
+		t.Errorf("new slot has spawn %q", spawn)
+	}
+	s.SetPlayerSlot("local-1/alice")
+	if data, _ := s.GetPlayerData(); string(data) != "alice" {
+		t.Errorf("player data %q, want alice", data)
+	}
+	if spawn := s.GetSpawn(); string(spawn) != "bed" {
+		t.Errorf("spawn %q, want bed", spawn)
+	}
+	if slots := s.PlayerSlots(); !reflect.DeepEqual(slots, []string{"local-1/alice"}) {
+		t.Errorf("slots %v", slots)
+	}
+}
@@ -0,0 +1,273 @@
+package store
+
+import (
+	"sync"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/icexin/gocraft/world"
+)
+
+const (
+	// the block edits are committed every writeBehindTime, or as soon as
+	// maxPendingEdits are waiting
+	writeBehindTime = time.Second
+	maxPendingEdits = 4096
+)
+
+// writeBehind queues the block edits of the store by chunk, only the last
+// edit of a block is kept. The edits are committed in one transaction by
+// the write loop, when their chunk is unloaded and on Close. The queued
+// edits are read back by RangeBlocks and RangeEdits. The encoded entities
+// of the chunks are queued the same way, the last ones of a chunk kept,
+// and read back by GetEntities.
+type writeBehind struct {
+	mutex    sync.Mutex
+	pending  map[world.Vec3]map[world.Vec3]int
+	npending int
+	// the edits being committed, still read back until they are
+	flushing map[world.Vec3]map[world.Vec3]int
+	// the entities by chunk, pending and being committed
+	entities         map[world.Vec3][]byte
+	flushingEntities map[world.Vec3][]byte
+
+	// one commit at a time, an older batch never lands over a newer one
+	flushMutex sync.Mutex
+	closed     bool // under flushMutex, the db is closed
+	flushc     chan struct{}
+	done       chan struct{}
+}
+
+func newWriteBehind() *writeBehind {
+	return &writeBehind{
+		pending:  make(map[world.Vec3]map[world.Vec3]int),
+		flushing: make(map[world.Vec3]map[world.Vec3]int),
+		entities: make(map[world.Vec3][]byte),
+		flushc:   make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+}
+
+func (q *writeBehind) add(id world.Vec3, w int) {
+	cid := id.Chunkid()
+	q.mutex.Lock()
+	edits, ok := q.pending[cid]
+	if !ok {
+		edits = make(map[world.Vec3]int)
+		q.pending[cid] = edits
+	}
+	if _, ok := edits[id]; !ok {
+		q.npending++
+	}
+	edits[id] = w
+	full := q.npending >= maxPendingEdits
+	q.mutex.Unlock()
+	if full {
+		select {
+		case q.flushc <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// take moves the pending edits of the chunks ids, or all of them if ids is
+// nil, to the flushing ones and returns them.
+func (q *writeBehind) take(ids []world.Vec3) map[world.Vec3]map[world.Vec3]int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if ids == nil {
+		for cid := range q.pending {
+			ids = append(ids, cid)
+		}
+	}
+	batch := make(map[world.Vec3]map[world.Vec3]int, len(ids))
+	for _, cid := range ids {
+		edits, ok := q.pending[cid]
+		if !ok {
+			continue
+		}
+		batch[cid] = edits
+		q.flushing[cid] = edits
+		q.npending -= len(edits)
+		delete(q.pending, cid)
+	}
+	return batch
+}
+
+// finish drops the flushing edits of batch, they are put back in the pending
+// ones unless overwritten if the commit failed.
+func (q *writeBehind) finish(batch map[world.Vec3]map[world.Vec3]int, err error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	for cid, edits := range batch {
+		delete(q.flushing, cid)
+		if err == nil {
+			continue
+		}
+		pending, ok := q.pending[cid]
+		if !ok {
+			pending = make(map[world.Vec3]int)
+			q.pending[cid] = pending
+		}
+		for id, w := range edits {
+			if _, ok := pending[id]; !ok {
+				pending[id] = w
+				q.npending++
+			}
+		}
+	}
+}
+
+// addEntities queues the encoded entities of the chunks.
+func (q *writeBehind) addEntities(chunks map[world.Vec3][]byte) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	for cid, data := range chunks {
+		q.entities[cid] = data
+	}
+}
+
+// takeEntities moves the pending entities to the flushing ones and returns
+// them.
+func (q *writeBehind) takeEntities() map[world.Vec3][]byte {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	batch := q.entities
+	q.flushingEntities = batch
+	q.entities = make(map[world.Vec3][]byte)
+	return batch
+}
+
+// finishEntities drops the flushing entities, they are put back in the
+// pending ones unless replaced if the commit failed.
+func (q *writeBehind) finishEntities(batch map[world.Vec3][]byte, err error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.flushingEntities = nil
+	if err == nil {
+		return
+	}
+	for cid, data := range batch {
+		if _, ok := q.entities[cid]; !ok {
+			q.entities[cid] = data
+		}
+	}
+}
+
+// chunkEntities returns the queued entities of chunk cid, false if there
+// are none.
+func (q *writeBehind) chunkEntities(cid world.Vec3) ([]byte, bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if data, ok := q.entities[cid]; ok {
+		return data, true
+	}
+	data, ok := q.flushingEntities[cid]
+	return data, ok
+}
+
+// chunkEdits returns a copy of the queued edits of chunk cid.
+func (q *writeBehind) chunkEdits(cid world.Vec3) map[world.Vec3]int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	var edits map[world.Vec3]int
+	for _, m := range [...]map[world.Vec3]map[world.Vec3]int{q.flushing, q.pending} {
+		for id, w := range m[cid] {
+			if edits == nil {
+				edits = make(map[world.Vec3]int)
+			}
+			edits[id] = w
+		}
+	}
+	return edits
+}
+
+// allEdits returns a copy of all the queued edits.
+func (q *writeBehind) allEdits() map[world.Vec3]int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	edits := make(map[world.Vec3]int)
+	for _, m := range [...]map[world.Vec3]map[world.Vec3]int{q.flushing, q.pending} {
+		for _, chunk := range m {
+			for id, w := range chunk {
+				edits[id] = w
+			}
+		}
+	}
+	return edits
+}
+
+// Pending returns the number of block edits waiting to be committed.
+func (s *Store) Pending() int {
+	s.edits.mutex.Lock()
+	defer s.edits.mutex.Unlock()
+	return s.edits.npending
+}
+
+// Flush commits all the queued block edits and entities.
+func (s *Store) Flush() error {
+	return s.flush(nil, nil)
+}
+
+// flush commits the queued edits of the chunks ids, all of them if ids is
+// nil, and the queued entities, and calls more, if not nil, in the same
+// transaction.
+func (s *Store) flush(ids []world.Vec3, more func(tx *bolt.Tx) error) error {
+	q := s.edits
+	q.flushMutex.Lock()
+	defer q.flushMutex.Unlock()
+	if q.closed {
+		return nil
+	}
+	batch := q.take(ids)
+	entities := q.takeEntities()
+	if len(batch) == 0 && len(entities) == 0 && more == nil {
+		q.finishEntities(entities, nil)
+		return nil
+	}
+	n := 0
+	err := s.update(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket(blockBucket)
+		for cid, edits := range batch {
+			for id, w := range edits {
+				if err := bkt.Put(encodeBlockDbKey(cid, id), encodeBlockDbValue(w)); err != nil {
+					return err
+				}
+				n++
+			}
+		}
+		bkt = tx.Bucket(entitiesBucket)
+		for cid, data := range entities {
+			if err := bkt.Put(encodeChunkKey(cid), data); err != nil {
+				return err
+			}
+		}
+		if more != nil {
+			return more(tx)
+		}
+		return nil
+	})
+	q.finish(batch, err)
+	q.finishEntities(entities, err)
+	if err == nil && n > 0 {
+		storeLog.Debugf("committed %d edits of %d chunks", n, len(batch))
+	}
+	return err
+}
+
+func (s *Store) writeLoop() {
+	defer recoverPanic()
+	tick := time.NewTicker(writeBehindTime)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+		case <-s.edits.flushc:
+		case <-s.edits.done:
+			return
+		}
+		if err := s.Flush(); err != nil {
+			storeLog.Errorf("commit block edits error:%s", err)
+		}
+	}
+}
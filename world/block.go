@@ -0,0 +1,208 @@
+package world
+
+// Block types, the same as https://github.com/fogleman/Craft
+const (
+	Air = iota
+	Grass
+	Sand
+	Stone
+	Brick
+	Wood
+	Cement
+	Dirt
+	Plank
+	Snow
+	Glass
+	Cobble
+	LightStone
+	DarkStone
+	Chest
+	Leaves
+	Cloud
+	TallGrass
+	YellowFlower
+	RedFlower
+	PurpleFlower
+	SunFlower
+	WhiteFlower
+	BlueFlower
+)
+
+const (
+	Player = 64
+	Bed    = 65
+	Fire   = 66
+
+	Bedrock    = 67
+	CoalOre    = 68
+	IronOre    = 69
+	GoldOre    = 70
+	DiamondOre = 71
+	Gravel     = 72
+
+	RedGlass    = 73
+	YellowGlass = 74
+	GreenGlass  = 75
+	CyanGlass   = 76
+	BlueGlass   = 77
+	PurpleGlass = 78
+)
+
+const defaultHardness = 0.4
+
+// seconds to break a block by hand
+var blockHardness = map[int]float32{
+	Grass:      0.35,
+	Sand:       0.3,
+	Stone:      1.2,
+	Brick:      1.2,
+	Wood:       0.8,
+	Cement:     1,
+	Dirt:       0.3,
+	Plank:      0.6,
+	Snow:       0.15,
+	Glass:      0.2,
+	Cobble:     1.2,
+	LightStone: 1,
+	DarkStone:  1,
+	Chest:      0.8,
+	Leaves:     0.15,
+	Cloud:      0.1,
+	Bed:        0.3,
+	Bedrock:    -1,
+	CoalOre:    1.5,
+	IronOre:    1.8,
+	GoldOre:    2,
+	DiamondOre: 2.5,
+	Gravel:     0.4,
+
+	RedGlass:    0.2,
+	YellowGlass: 0.2,
+	GreenGlass:  0.2,
+	CyanGlass:   0.2,
+	BlueGlass:   0.2,
+	PurpleGlass: 0.2,
+}
+
+// BlockHardness returns the seconds to break block tp, negative if it can't be broken.
+func BlockHardness(tp int) float32 {
+	if IsPlant(tp) {
+		return 0
+	}
+	h, ok := blockHardness[tp]
+	if !ok {
+		return defaultHardness
+	}
+	return h
+}
+
+// RegisterBlock sets the properties of a block type added by a plugin, 0
+// keeps the default. Call it before the worlds are created.
+func RegisterBlock(tp int, hardness, resistance float32) {
+	if hardness != 0 {
+		blockHardness[tp] = hardness
+	}
+	if resistance != 0 {
+		blockResistance[tp] = resistance
+	}
+}
+
+// light emitted by a block, 0-255 like the light volume
+var blockLight = map[int]int{
+	Fire: 255,
+}
+
+// BlockLight returns the light emitted by block tp.
+func BlockLight(tp int) int {
+	return blockLight[tp]
+}
+
+const defaultResistance = 1
+
+// explosion resistance, an explosion loses that much power crossing the block
+var blockResistance = map[int]float32{
+	Grass:      0.6,
+	Sand:       0.5,
+	Stone:      6,
+	Brick:      6,
+	Wood:       2,
+	Cement:     5,
+	Dirt:       0.5,
+	Plank:      2,
+	Snow:       0.1,
+	Glass:      0.3,
+	Cobble:     6,
+	LightStone: 5,
+	DarkStone:  5,
+	Chest:      2.5,
+	Leaves:     0.2,
+	Cloud:      0,
+	Bed:        0.2,
+	Bedrock:    1000,
+	CoalOre:    6,
+	IronOre:    6,
+	GoldOre:    6,
+	DiamondOre: 6,
+	Gravel:     0.6,
+
+	RedGlass:    0.3,
+	YellowGlass: 0.3,
+	GreenGlass:  0.3,
+	CyanGlass:   0.3,
+	BlueGlass:   0.3,
+	PurpleGlass: 0.3,
+}
+
+func BlockResistance(tp int) float32 {
+	if IsPlant(tp) {
+		return 0
+	}
+	r, ok := blockResistance[tp]
+	if !ok {
+		return defaultResistance
+	}
+	return r
+}
+
+// IsPlant reports whether tp is drawn as crossed quads, fire is drawn like a plant.
+func IsPlant(tp int) bool {
+	if tp >= 17 && tp <= 31 || tp == Fire {
+		return true
+	}
+	return false
+}
+
+func IsTransparent(tp int) bool {
+	if IsPlant(tp) {
+		return true
+	}
+	if IsTranslucent(tp) {
+		return true
+	}
+	switch tp {
+	case -1, 0, 15:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsTranslucent reports whether tp is seen through and drawn blended after
+// the opaque blocks, the cutout blocks like leaves are opaque.
+func IsTranslucent(tp int) bool {
+	return tp == Glass || tp >= RedGlass && tp <= PurpleGlass
+}
+
+func IsObstacle(tp int) bool {
+	if IsPlant(tp) {
+		return false
+	}
+	switch tp {
+	case -1:
+		return true
+	case 0:
+		return false
+	default:
+		return true
+	}
+}
@@ -0,0 +1,309 @@
+package world
+
+import (
+	"log"
+	"math"
+	"sync"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/icexin/gocraft/internal/geom"
+)
+
+const (
+	ChunkWidth = 32
+	// ChunkHeight bounds the y of the blocks a chunk may hold, used when
+	// the real extent of a chunk isn't known yet.
+	ChunkHeight = 256
+)
+
+type Vec3 struct {
+	X, Y, Z int
+}
+
+func (v Vec3) Left() Vec3 {
+	return Vec3{v.X - 1, v.Y, v.Z}
+}
+func (v Vec3) Right() Vec3 {
+	return Vec3{v.X + 1, v.Y, v.Z}
+}
+func (v Vec3) Up() Vec3 {
+	return Vec3{v.X, v.Y + 1, v.Z}
+}
+func (v Vec3) Down() Vec3 {
+	return Vec3{v.X, v.Y - 1, v.Z}
+}
+func (v Vec3) Front() Vec3 {
+	return Vec3{v.X, v.Y, v.Z + 1}
+}
+func (v Vec3) Back() Vec3 {
+	return Vec3{v.X, v.Y, v.Z - 1}
+}
+func (v Vec3) Chunkid() Vec3 {
+	return Vec3{
+		int(math.Floor(float64(v.X) / ChunkWidth)),
+		0,
+		int(math.Floor(float64(v.Z) / ChunkWidth)),
+	}
+}
+
+func NearBlock(pos mgl32.Vec3) Vec3 {
+	return Vec3{
+		int(geom.Round(pos.X())),
+		int(geom.Round(pos.Y())),
+		int(geom.Round(pos.Z())),
+	}
+}
+
+// Chunk is safe for concurrent use, blocks are guarded by mutex.
+// Readers that walk the whole chunk (meshing, lighting) should work on a
+// Snapshot so they see one consistent state and never hold the lock
+// while calling back into the world.
+type Chunk struct {
+	id Vec3
+
+	mutex   sync.RWMutex
+	blocks  map[Vec3]int
+	version uint64 // bumped on every change
+	top     int    // highest y ever held by the chunk
+
+	// blocks edited while the store and server changes are loading,
+	// the loaded changes don't overwrite them. nil once loaded.
+	edited map[Vec3]bool
+	// closed once the load ends, finished or canceled
+	done     chan struct{}
+	doneOnce sync.Once
+
+	heightmap *Heightmap
+}
+
+func NewChunk(id Vec3) *Chunk {
+	c := &Chunk{
+		id:     id,
+		blocks: make(map[Vec3]int),
+		edited: make(map[Vec3]bool),
+		done:   make(chan struct{}),
+	}
+	return c
+}
+
+func (c *Chunk) Id() Vec3 {
+	return c.id
+}
+
+func (c *Chunk) Block(id Vec3) int {
+	if id.Chunkid() != c.id {
+		log.Panicf("id %v chunk %v", id, c.id)
+	}
+	c.mutex.RLock()
+	w := c.blocks[id]
+	c.mutex.RUnlock()
+	return w
+}
+
+// Version returns the number of changes made to the chunk.
+func (c *Chunk) Version() uint64 {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.version
+}
+
+// Top returns the highest y a block of the chunk ever had.
+func (c *Chunk) Top() int {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.top
+}
+
+// Loaded reports whether the store and server changes are applied.
+func (c *Chunk) Loaded() bool {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.edited == nil
+}
+
+// Done returns a channel closed once the load of the chunk ends, Loaded
+// tells whether it finished or was canceled. A canceled chunk is dropped by
+// World, asking for it again loads a new one.
+func (c *Chunk) Done() <-chan struct{} {
+	return c.done
+}
+
+// endLoad closes the done channel.
+func (c *Chunk) endLoad() {
+	c.doneOnce.Do(func() { close(c.done) })
+}
+
+func (c *Chunk) add(id Vec3, w int) {
+	c.set(id, w, false)
+}
+
+// edit changes a block for the player or the server, it wins over the
+// changes still loading.
+func (c *Chunk) edit(id Vec3, w int) {
+	c.set(id, w, true)
+}
+
+// load applies a change loaded from the store or the server, it returns
+// false if the block was edited meanwhile.
+func (c *Chunk) load(id Vec3, w int) bool {
+	return c.set(id, w, false)
+}
+
+func (c *Chunk) finishLoad() {
+	c.mutex.Lock()
+	c.edited = nil
+	c.mutex.Unlock()
+	c.endLoad()
+}
+
+func (c *Chunk) set(id Vec3, w int, edit bool) bool {
+	if id.Chunkid() != c.id {
+		log.Panicf("id %v chunk %v", id, c.id)
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.edited != nil {
+		if !edit && c.edited[id] {
+			return false
+		}
+		if edit {
+			c.edited[id] = true
+		}
+	}
+	if w == 0 {
+		delete(c.blocks, id)
+	} else {
+		c.blocks[id] = w
+	}
+	c.version++
+	if id.Y > c.top {
+		c.top = id.Y
+	}
+	return true
+}
+
+// RangeBlocks calls f on the blocks under the read lock, f must not change
+// the chunk. Walks calling back into the world, like the mesh jobs, go
+// through a Snapshot.
+func (c *Chunk) RangeBlocks(f func(id Vec3, w int)) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	for id, w := range c.blocks {
+		f(id, w)
+	}
+}
+
+// Snapshot returns a copy of the chunk blocks at the current version.
+func (c *Chunk) Snapshot() *ChunkSnapshot {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	s := &ChunkSnapshot{
+		id:      c.id,
+		blocks:  make(map[Vec3]int, len(c.blocks)),
+		version: c.version,
+	}
+	first := true
+	for id, w := range c.blocks {
+		s.blocks[id] = w
+		if first || id.Y < s.minY {
+			s.minY = id.Y
+		}
+		if first || id.Y > s.maxY {
+			s.maxY = id.Y
+		}
+		first = false
+	}
+	return s
+}
+
+// copyRect copies the blocks with x in [minX, maxX] and z in [minZ, maxZ]
+// into dst.
+func (c *Chunk) copyRect(dst map[Vec3]int, minX, minZ, maxX, maxZ int) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	for x := minX; x <= maxX; x++ {
+		for z := minZ; z <= maxZ; z++ {
+			for y := 0; y <= c.top; y++ {
+				id := Vec3{x, y, z}
+				if w, ok := c.blocks[id]; ok {
+					dst[id] = w
+				}
+			}
+		}
+	}
+}
+
+// ChunkSnapshot is an immutable copy of a chunk.
+type ChunkSnapshot struct {
+	id         Vec3
+	blocks     map[Vec3]int
+	version    uint64
+	minY, maxY int
+
+	// blocks of the neighbors one block around the chunk, set by
+	// World.BorderSnapshot. loaded tells the neighbors found by chunk
+	// offset, (dx+1)*3 + dz+1.
+	border map[Vec3]int
+	loaded [9]bool
+}
+
+func (s *ChunkSnapshot) Id() Vec3 {
+	return s.id
+}
+
+func (s *ChunkSnapshot) Version() uint64 {
+	return s.version
+}
+
+// YRange returns the lowest and highest block y in the snapshot.
+func (s *ChunkSnapshot) YRange() (int, int) {
+	return s.minY, s.maxY
+}
+
+// Block returns block id of the chunk, or of its border if the snapshot
+// was taken by World.BorderSnapshot: -1 if the neighbor wasn't loaded, like
+// World.Block.
+func (s *ChunkSnapshot) Block(id Vec3) int {
+	if s.border == nil {
+		return s.blocks[id]
+	}
+	dx, dz := chunkOffset(id.X, s.id.X), chunkOffset(id.Z, s.id.Z)
+	if dx == 0 && dz == 0 {
+		return s.blocks[id]
+	}
+	if dx < -1 || dx > 1 || dz < -1 || dz > 1 || !s.loaded[(dx+1)*3+dz+1] {
+		return -1
+	}
+	return s.border[id]
+}
+
+// MissingNeighbors returns the chunks on the four sides of the snapshot
+// that weren't in the world when its border was taken, the faces on those
+// sides were built against nothing.
+func (s *ChunkSnapshot) MissingNeighbors() []Vec3 {
+	if s.border == nil {
+		return nil
+	}
+	var ids []Vec3
+	for _, d := range [...]Vec3{{-1, 0, 0}, {1, 0, 0}, {0, 0, -1}, {0, 0, 1}} {
+		if !s.loaded[(d.X+1)*3+d.Z+1] {
+			ids = append(ids, Vec3{s.id.X + d.X, 0, s.id.Z + d.Z})
+		}
+	}
+	return ids
+}
+
+// chunkOffset returns the chunk of coordinate x relative to chunk c.
+func chunkOffset(x, c int) int {
+	x -= c * ChunkWidth
+	if x < 0 {
+		return (x+1)/ChunkWidth - 1
+	}
+	return x / ChunkWidth
+}
+
+func (s *ChunkSnapshot) RangeBlocks(f func(id Vec3, w int)) {
+	for id, w := range s.blocks {
+		f(id, w)
+	}
+}
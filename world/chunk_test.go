@@ -0,0 +1,102 @@
+package world
+
+import (
+	"sync"
+	"testing"
+)
+
+// editRow places n bricks one by one on a row of chunk c, above the terrain.
+func editRow(c *Chunk, n int) {
+	for i := 0; i < n; i++ {
+		c.edit(Vec3{i % ChunkWidth, 200 + i/ChunkWidth, 0}, Brick)
+	}
+}
+
+func countBricks(f func(func(id Vec3, w int))) int {
+	n := 0
+	f(func(id Vec3, w int) {
+		if w == Brick && id.Y >= 200 {
+			n++
+		}
+	})
+	return n
+}
+
+// TestSnapshotDuringEdit takes snapshots while the chunk is edited, as the
+// mesh jobs do, each snapshot must hold exactly the edits of its version.
+func TestSnapshotDuringEdit(t *testing.T) {
+	c := NewChunk(Vec3{})
+	c.add(Vec3{1, 1, 1}, Grass)
+	base := c.Version()
+	const edits = 4 * ChunkWidth
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		editRow(c, edits)
+	}()
+	for {
+		s := c.Snapshot()
+		if n := countBricks(s.RangeBlocks); uint64(n) != s.Version()-base {
+			t.Fatalf("snapshot at version %d holds %d edits", s.Version()-base, n)
+		}
+		select {
+		case <-done:
+			if n := countBricks(c.Snapshot().RangeBlocks); n != edits {
+				t.Fatalf("%d edits in the last snapshot, want %d", n, edits)
+			}
+			return
+		default:
+		}
+	}
+}
+
+// TestRangeBlocksDuringEdit walks the chunk from several goroutines while
+// it's edited, run with -race.
+func TestRangeBlocksDuringEdit(t *testing.T) {
+	c := NewChunk(Vec3{})
+	const edits = 4 * ChunkWidth
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if n := countBricks(c.RangeBlocks); n > edits {
+					t.Errorf("%d bricks, want at most %d", n, edits)
+					return
+				}
+			}
+		}()
+	}
+	editRow(c, edits)
+	close(stop)
+	wg.Wait()
+	if n := countBricks(c.RangeBlocks); n != edits {
+		t.Errorf("%d bricks, want %d", n, edits)
+	}
+}
+
+// TestSnapshotIsolated checks a snapshot doesn't see the edits made after
+// it was taken.
+func TestSnapshotIsolated(t *testing.T) {
+	c := NewChunk(Vec3{})
+	editRow(c, 3)
+	s := c.Snapshot()
+	editRow(c, 10)
+	c.edit(Vec3{0, 200, 0}, 0)
+	if n := countBricks(s.RangeBlocks); n != 3 {
+		t.Errorf("snapshot holds %d bricks, want 3", n)
+	}
+	if s.Block(Vec3{0, 200, 0}) != Brick {
+		t.Error("the removed block is gone from the snapshot")
+	}
+	if s.Version() == c.Version() {
+		t.Error("snapshot version follows the chunk")
+	}
+}
@@ -0,0 +1,47 @@
+package world
+
+// Heightmap is the ground surface of a chunk: the highest block of each
+// column leaving out plants and clouds, indexed by the x and z offsets from
+// the chunk origin.
+type Heightmap struct {
+	Height [ChunkWidth][ChunkWidth]int // -1 for an empty column
+	Block  [ChunkWidth][ChunkWidth]int
+
+	version uint64
+}
+
+// Heightmap returns the heightmap of the chunk, it's cached until the chunk
+// changes.
+func (c *Chunk) Heightmap() *Heightmap {
+	c.mutex.RLock()
+	h := c.heightmap
+	if h != nil && h.version == c.version {
+		c.mutex.RUnlock()
+		return h
+	}
+	h = &Heightmap{version: c.version}
+	for x := range h.Height {
+		for z := range h.Height[x] {
+			h.Height[x][z] = -1
+		}
+	}
+	x0, z0 := c.id.X*ChunkWidth, c.id.Z*ChunkWidth
+	for id, w := range c.blocks {
+		if IsPlant(w) || w == Cloud {
+			continue
+		}
+		dx, dz := id.X-x0, id.Z-z0
+		if id.Y > h.Height[dx][dz] {
+			h.Height[dx][dz] = id.Y
+			h.Block[dx][dz] = w
+		}
+	}
+	c.mutex.RUnlock()
+
+	c.mutex.Lock()
+	if c.heightmap == nil || c.heightmap.version < h.version {
+		c.heightmap = h
+	}
+	c.mutex.Unlock()
+	return h
+}
@@ -1,9 +1,6 @@
-package main
+package world
 
 import (
-	"math"
-
-	"github.com/go-gl/mathgl/mgl32"
 	opensimplex "github.com/ojrac/opensimplex-go"
 )
 
@@ -11,44 +8,6 @@ var (
 	sim = opensimplex.New(0)
 )
 
-func abs(x float32) float32 {
-	return float32(math.Abs(float64(x)))
-}
-
-func round(x float32) float32 {
-	return float32(math.Round(float64(x)))
-}
-
-func sin(x float32) float32 {
-	return float32(math.Sin(float64(x)))
-}
-
-func cos(x float32) float32 {
-	return float32(math.Cos(float64(x)))
-}
-
-func radian(angle float32) float32 {
-	return mgl32.DegToRad(angle)
-}
-
-func max(a, b float32) float32 {
-	if a > b {
-		return a
-	}
-	return b
-}
-
-func min(a, b float32) float32 {
-	if a < b {
-		return a
-	}
-	return b
-}
-
-func mix(a, b, factor float32) float32 {
-	return a*(1-factor) + factor*b
-}
-
 func noise2(x, y float32, octaves int, persistence, lacunarity float32) float32 {
 	var (
 		freq  float32 = 1
@@ -0,0 +1,47 @@
+package world
+
+const (
+	// depth of the dirt under grass and of the sand on beaches
+	dirtDepth = 4
+	sandDepth = 3
+)
+
+// ore veins, an ore appears below MaxY where its noise is above Threshold
+var ores = []struct {
+	Block     int
+	MaxY      int
+	Threshold float32
+	Offset    float32
+}{
+	{DiamondOre, 12, 0.85, 300},
+	{GoldOre, 24, 0.8, 200},
+	{IronOre, 40, 0.78, 100},
+	{CoalOre, 64, 0.76, 0},
+	{Gravel, 64, 0.8, 400},
+}
+
+// groundBlock returns the block at height y of a column of height h with
+// surface block w: the surface, a few blocks of dirt or sand, stone with ore
+// veins and bedrock at the bottom.
+func groundBlock(x, y, z, h, w int) int {
+	switch {
+	case y == 0:
+		return Bedrock
+	case y == h-1:
+		return w
+	case w == Grass && y >= h-dirtDepth:
+		return Dirt
+	case w == Sand && y >= h-sandDepth:
+		return Sand
+	}
+	for _, ore := range ores {
+		if y >= ore.MaxY {
+			continue
+		}
+		fx, fy, fz := float32(x)*0.15+ore.Offset, float32(y)*0.15, float32(z)*0.15
+		if noise3(fx, fy, fz, 1, 0.5, 2) > ore.Threshold {
+			return ore.Block
+		}
+	}
+	return Stone
+}
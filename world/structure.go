@@ -0,0 +1,140 @@
+package world
+
+import "github.com/icexin/gocraft/internal/geom"
+
+// Structures are stamped into the chunks after the terrain. The world is cut
+// into regions, each region may hold a village and a dungeon at positions
+// hashed from the region, so every client generates the same structures and
+// a structure crossing a chunk border is stamped piece by piece by each chunk.
+// Structures stay inside their region.
+
+const (
+	// Seed of the structures and of the random block ticks
+	Seed = 0
+
+	structureRegion = 4 * ChunkWidth
+
+	villageChance = 0.35
+	dungeonChance = 0.3
+	maxVillageHut = 3
+	dungeonY      = 2
+)
+
+// Template is a prefab structure, Layers go from the bottom up, each layer
+// is a list of rows along z of blocks along x. A space keeps the generated
+// block and a dot carves air.
+type Template struct {
+	Layers [][]string
+}
+
+var templateBlocks = map[byte]int{
+	'.': 0,
+	'C': Cobble,
+	'P': Plank,
+	'W': Wood,
+	'G': Glass,
+	'H': Chest,
+	'B': Bed,
+}
+
+var hutTemplate = Template{Layers: [][]string{
+	{"CCCCC", "CCCCC", "CCCCC", "CCCCC", "CCCCC"},
+	{"PP.PP", "P...P", "P...P", "PB..P", "PPPPP"},
+	{"PP.PP", "G...G", "P...P", "P...P", "PPGPP"},
+	{"PPPPP", "P...P", "P...P", "P...P", "PPPPP"},
+	{"WWWWW", "WWWWW", "WWWWW", "WWWWW", "WWWWW"},
+}}
+
+var dungeonTemplate = Template{Layers: [][]string{
+	{"CCCCCCC", "CCCCCCC", "CCCCCCC", "CCCCCCC", "CCCCCCC", "CCCCCCC", "CCCCCCC"},
+	{"CCCCCCC", "C.....C", "C.....C", "C..H..C", "C.....C", "C.....C", "CCCCCCC"},
+	{"CCCCCCC", "C.....C", "C.....C", "C.....C", "C.....C", "C.....C", "CCCCCCC"},
+	{"CCCCCCC", "C.....C", "C.....C", "C.....C", "C.....C", "C.....C", "CCCCCCC"},
+	{"CCCCCCC", "CCCCCCC", "CCCCCCC", "CCCCCCC", "CCCCCCC", "CCCCCCC", "CCCCCCC"},
+}}
+
+// structure is a template placed at origin, its lowest corner.
+type structure struct {
+	template *Template
+	origin   Vec3
+}
+
+// hash mixes the region and salt into a random number, splitmix64.
+func hash(x, z, salt int) uint64 {
+	h := uint64(Seed) ^ uint64(x)*0x9E3779B97F4A7C15 ^ uint64(z)*0xC2B2AE3D27D4EB4F ^ uint64(salt)*0x165667B19E3779F9
+	h += 0x9E3779B97F4A7C15
+	h = (h ^ (h >> 30)) * 0xBF58476D1CE4E5B9
+	h = (h ^ (h >> 27)) * 0x94D049BB133111EB
+	return h ^ (h >> 31)
+}
+
+// hashFloat returns a number in [0, 1).
+func hashFloat(x, z, salt int) float32 {
+	return float32(hash(x, z, salt)>>40) / (1 << 24)
+}
+
+// regionStructures returns the structures of region rx, rz.
+func regionStructures(rx, rz int) []structure {
+	var ret []structure
+	x0, z0 := rx*structureRegion, rz*structureRegion
+	if hashFloat(rx, rz, 1) < villageChance {
+		cx := x0 + 16 + int(hash(rx, rz, 2)%uint64(structureRegion-48))
+		cz := z0 + 16 + int(hash(rx, rz, 3)%uint64(structureRegion-48))
+		n := 1 + int(hash(rx, rz, 4)%maxVillageHut)
+		for i := 0; i < n; i++ {
+			x := cx + i*9
+			z := cz + int(hash(rx, rz, 10+i)%8)
+			h, w := terrainHeight(x+2, z+2)
+			if w != Grass {
+				continue
+			}
+			ret = append(ret, structure{&hutTemplate, Vec3{x, h - 1, z}})
+		}
+	}
+	if hashFloat(rx, rz, 5) < dungeonChance {
+		x := x0 + int(hash(rx, rz, 6)%uint64(structureRegion-8))
+		z := z0 + int(hash(rx, rz, 7)%uint64(structureRegion-8))
+		ret = append(ret, structure{&dungeonTemplate, Vec3{x, dungeonY, z}})
+	}
+	return ret
+}
+
+// stampStructures writes the parts of the structures falling into chunk cid.
+func stampStructures(cid Vec3, m map[Vec3]int) {
+	x0, z0 := cid.X*ChunkWidth, cid.Z*ChunkWidth
+	x1, z1 := x0+ChunkWidth-1, z0+ChunkWidth-1
+	region := func(x int) int {
+		return int(geom.FloorDiv(int64(x), structureRegion))
+	}
+	rx0, rz0 := region(x0), region(z0)
+	rx1, rz1 := region(x1), region(z1)
+	for rx := rx0; rx <= rx1; rx++ {
+		for rz := rz0; rz <= rz1; rz++ {
+			for _, s := range regionStructures(rx, rz) {
+				s.stamp(cid, m)
+			}
+		}
+	}
+}
+
+func (s structure) stamp(cid Vec3, m map[Vec3]int) {
+	for dy, layer := range s.template.Layers {
+		for dz, row := range layer {
+			for dx := 0; dx < len(row); dx++ {
+				tp, ok := templateBlocks[row[dx]]
+				if !ok {
+					continue
+				}
+				id := Vec3{s.origin.X + dx, s.origin.Y + dy, s.origin.Z + dz}
+				if id.Chunkid() != cid {
+					continue
+				}
+				if tp == 0 {
+					delete(m, id)
+				} else {
+					m[id] = tp
+				}
+			}
+		}
+	}
+}
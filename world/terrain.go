@@ -0,0 +1,90 @@
+package world
+
+// TerrainVersion is bumped whenever the generated terrain changes, the
+// chunks saved whole by another version are generated again. 2: no more
+// cloud blocks.
+const TerrainVersion = 2
+
+// terrainHeight returns the ground height at x, z and the surface block.
+func terrainHeight(x, z int) (int, int) {
+	f := noise2(float32(x)*0.01, float32(z)*0.01, 4, 0.5, 2)
+	g := noise2(float32(-x)*0.01, float32(-z)*0.01, 2, 0.9, 2)
+	mh := int(g*32 + 16)
+	h := int(f * float32(mh))
+	w := Grass
+	if h <= 12 {
+		h = 12
+		w = Sand
+	}
+	return h, w
+}
+
+// TerrainHeight returns the generated ground height at x, z and its surface
+// block, without the plants, trees, structures and changes.
+func TerrainHeight(x, z int) (int, int) {
+	return terrainHeight(x, z)
+}
+
+func makeChunkMap(cid Vec3) map[Vec3]int {
+	const (
+		grassBlock = 1
+		sandBlock  = 2
+		grass      = 17
+		leaves     = 15
+		wood       = 5
+	)
+	m := make(map[Vec3]int)
+	p, q := cid.X, cid.Z
+	for dx := 0; dx < ChunkWidth; dx++ {
+		for dz := 0; dz < ChunkWidth; dz++ {
+			x, z := p*ChunkWidth+dx, q*ChunkWidth+dz
+			h, w := terrainHeight(x, z)
+			for y := 0; y < h; y++ {
+				m[Vec3{x, y, z}] = groundBlock(x, y, z, h, w)
+			}
+
+			// flowers
+			if w == grassBlock {
+				if noise2(-float32(x)*0.1, float32(z)*0.1, 4, 0.8, 2) > 0.6 {
+					m[Vec3{x, h, z}] = grass
+				}
+				if noise2(float32(x)*0.05, float32(-z)*0.05, 4, 0.8, 2) > 0.7 {
+					w := 18 + int(noise2(float32(x)*0.1, float32(z)*0.1, 4, 0.8, 2)*7)
+					m[Vec3{x, h, z}] = w
+				}
+			}
+
+			// tree
+			if w == 1 {
+				ok := true
+				if dx-4 < 0 || dz-4 < 0 ||
+					dx+4 > ChunkWidth || dz+4 > ChunkWidth {
+					ok = false
+				}
+				if ok && noise2(float32(x), float32(z), 6, 0.5, 2) > 0.79 {
+					for y := h + 3; y < h+8; y++ {
+						for ox := -3; ox <= 3; ox++ {
+							for oz := -3; oz <= 3; oz++ {
+								d := ox*ox + oz*oz + (y-h-4)*(y-h-4)
+								if d < 11 {
+									m[Vec3{x + ox, y, z + oz}] = leaves
+								}
+							}
+						}
+					}
+					for y := h; y < h+7; y++ {
+						m[Vec3{x, y, z}] = wood
+					}
+				}
+			}
+		}
+	}
+	stampStructures(cid, m)
+	return m
+}
+
+// GenerateChunk returns the blocks of chunk id made by the generator, before
+// the changes of the store and the server.
+func GenerateChunk(id Vec3) map[Vec3]int {
+	return makeChunkMap(id)
+}
@@ -0,0 +1,669 @@
+// Package world holds the blocks of a gocraft world: the chunks, the terrain
+// generator and the World cache loading the chunks from a Source. It doesn't
+// depend on the renderer, the store or the network and can be embedded by
+// other programs.
+package world
+
+import (
+	"context"
+	"log"
+	"runtime"
+	"runtime/debug"
+	"sync"
+
+	"github.com/go-gl/mathgl/mgl32"
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/icexin/gocraft/internal/geom"
+)
+
+// World is safe for concurrent use: the chunk cache is a locked LRU and each
+// chunk guards its own blocks. Mesh workers build from chunk snapshots while
+// the main thread and the rpc handlers edit the chunks, meshes remember the
+// chunk version they were built from and are rebuilt when it changes.
+type World struct {
+	chunks *lru.Cache // map[Vec3]*Chunk
+	source Source
+
+	// chunks being generated, a chunk is generated once however many
+	// goroutines ask for it
+	mutex      sync.Mutex
+	generating map[Vec3]*chunkCall
+	// chunks whose server changes failed to fetch, under mutex
+	unsynced map[Vec3]bool
+	// cancels the chunks in the load pipeline, loadMutex is taken last:
+	// the LRU eviction callback takes it under the LRU lock
+	loadMutex sync.Mutex
+	loading   map[Vec3]loadCall
+	// bounds the chunks generated at the same time
+	genSem chan struct{}
+
+	// load pipeline of the generated chunks: store changes, then server changes
+	storeq   chan loadJob
+	syncq    chan loadJob
+	onLoaded func(chunk *Chunk, changed bool)
+	// evicted chunks waiting to be saved by a ChunkStore source
+	saveq chan *Chunk
+
+	// closed by Close, stops the goroutines of the world
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+type chunkCall struct {
+	done  chan struct{}
+	chunk *Chunk
+}
+
+type loadCall struct {
+	chunk  *Chunk
+	cancel context.CancelFunc
+}
+
+type loadJob struct {
+	ctx     context.Context
+	chunk   *Chunk
+	version uint64 // version of the generated chunk
+}
+
+const (
+	loadQueueSize = 64
+	syncWorkers   = 4 // chunks fetched from the server at the same time
+)
+
+// Source keeps the changes made to the generated terrain, usually a local
+// store and a server.
+type Source interface {
+	// RangeBlocks calls f on the saved changes of chunk id.
+	RangeBlocks(id Vec3, f func(bid Vec3, w int)) error
+	// UpdateBlock saves a change.
+	UpdateBlock(id Vec3, w int) error
+	// FetchChunk calls f on the changes of chunk id made elsewhere, the
+	// changes are saved by World. A chunk failing to fetch keeps its saved
+	// changes and is fetched again by RetryFetches.
+	FetchChunk(id Vec3, f func(bid Vec3, w int)) error
+}
+
+// ChunkStore is implemented by the sources keeping whole chunks: the loaded
+// chunks pushed out of the cache are saved and loaded back instead of being
+// generated and fetched again.
+type ChunkStore interface {
+	// SaveChunk saves the blocks of chunk id.
+	SaveChunk(id Vec3, blocks map[Vec3]int) error
+	// LoadChunk returns the saved blocks of chunk id, nil if there are none.
+	LoadChunk(id Vec3) (map[Vec3]int, error)
+}
+
+// PanicHandler, if set before New, is called with the value and the stack of
+// a panic in a goroutine of the world before it goes on, so programs can
+// report the crash.
+var PanicHandler func(v interface{}, stack []byte)
+
+// recoverPanic hands the panic of the goroutine to PanicHandler and panics
+// again, deferred by the goroutines of the world.
+func recoverPanic() {
+	if v := recover(); v != nil {
+		if PanicHandler != nil {
+			PanicHandler(v, debug.Stack())
+		}
+		panic(v)
+	}
+}
+
+// New returns a world caching size chunks and starts the load pipeline,
+// onLoaded is called from the pipeline once the saved and fetched changes of
+// a chunk are applied, changed is false if the chunk is still the generated one.
+func New(size int, source Source, onLoaded func(chunk *Chunk, changed bool)) *World {
+	w := &World{
+		source:     source,
+		generating: make(map[Vec3]*chunkCall),
+		unsynced:   make(map[Vec3]bool),
+		loading:    make(map[Vec3]loadCall),
+		genSem:     make(chan struct{}, runtime.NumCPU()),
+		storeq:     make(chan loadJob, loadQueueSize),
+		syncq:      make(chan loadJob, loadQueueSize),
+		onLoaded:   onLoaded,
+		saveq:      make(chan *Chunk, loadQueueSize),
+		done:       make(chan struct{}),
+	}
+	w.chunks, _ = lru.NewWithEvict(size, w.onEvict)
+	go w.storeLoop()
+	if _, ok := source.(ChunkStore); ok {
+		go w.saveLoop()
+	}
+	for i := 0; i < syncWorkers; i++ {
+		go w.syncLoop()
+	}
+	return w
+}
+
+// Close stops the load pipeline and the saves, the chunks still loading
+// never finish. The cached chunks can still be read.
+func (w *World) Close() {
+	w.closeOnce.Do(func() { close(w.done) })
+}
+
+// Resize changes the number of chunks cached.
+func (w *World) Resize(size int) {
+	w.chunks.Resize(size)
+}
+
+func (w *World) loadChunk(id Vec3) (*Chunk, bool) {
+	chunk, ok := w.chunks.Get(id)
+	if !ok {
+		return nil, false
+	}
+	return chunk.(*Chunk), true
+}
+
+// storeChunk caches chunk unless id is already cached, it returns the
+// cached one. World never holds two instances of a chunk.
+func (w *World) storeChunk(id Vec3, chunk *Chunk) *Chunk {
+	if prev, ok, _ := w.chunks.PeekOrAdd(id, chunk); ok {
+		return prev.(*Chunk)
+	}
+	return chunk
+}
+
+// onEvict cancels the load of a chunk pushed out of the cache, else a
+// second instance could be generated and loaded while the first still is.
+// A loaded chunk is saved if the source is a ChunkStore.
+func (w *World) onEvict(key, value interface{}) {
+	chunk := value.(*Chunk)
+	w.loadMutex.Lock()
+	call, ok := w.loading[key.(Vec3)]
+	w.loadMutex.Unlock()
+	if ok && call.chunk == chunk {
+		call.cancel()
+		return
+	}
+	if _, ok := w.source.(ChunkStore); !ok || !chunk.Loaded() {
+		return
+	}
+	// called under the LRU lock, a chunk that doesn't fit in the queue is
+	// generated again next time
+	select {
+	case w.saveq <- chunk:
+	default:
+	}
+}
+
+// saveLoop saves the evicted chunks.
+func (w *World) saveLoop() {
+	defer recoverPanic()
+	cs := w.source.(ChunkStore)
+	for {
+		var chunk *Chunk
+		select {
+		case chunk = <-w.saveq:
+		case <-w.done:
+			return
+		}
+		snapshot := chunk.Snapshot()
+		if err := cs.SaveChunk(snapshot.Id(), snapshot.blocks); err != nil {
+			log.Printf("save chunk(%v) error:%s", snapshot.Id(), err)
+		}
+	}
+}
+
+// generate returns the blocks of chunk id saved by a ChunkStore source, or
+// generates them.
+func (w *World) generate(id Vec3) map[Vec3]int {
+	if cs, ok := w.source.(ChunkStore); ok {
+		blocks, err := cs.LoadChunk(id)
+		if err != nil {
+			log.Printf("load chunk(%v) error:%s", id, err)
+		} else if blocks != nil {
+			return blocks
+		}
+	}
+	return makeChunkMap(id)
+}
+
+// PeekChunk returns a loaded chunk without touching the LRU order.
+func (w *World) PeekChunk(id Vec3) (*Chunk, bool) {
+	chunk, ok := w.chunks.Peek(id)
+	if !ok {
+		return nil, false
+	}
+	return chunk.(*Chunk), true
+}
+
+// ChunkVersion returns the version of a loaded chunk without touching the LRU order.
+func (w *World) ChunkVersion(id Vec3) (uint64, bool) {
+	chunk, ok := w.chunks.Peek(id)
+	if !ok {
+		return 0, false
+	}
+	return chunk.(*Chunk).Version(), true
+}
+
+// BorderSnapshot returns a snapshot of chunk holding also the blocks of its
+// eight neighbors one block around it, so a mesh job reads the faces on the
+// chunk sides without going back to the world. The neighbors not loaded
+// read -1, they aren't loaded by the snapshot.
+func (w *World) BorderSnapshot(chunk *Chunk) *ChunkSnapshot {
+	s := chunk.Snapshot()
+	s.border = make(map[Vec3]int)
+	x0, z0 := s.id.X*ChunkWidth, s.id.Z*ChunkWidth
+	// first and last column of the chunk overlapping the border, by offset
+	span := func(d, c0 int) (int, int) {
+		switch d {
+		case -1:
+			return c0 - 1, c0 - 1
+		case 1:
+			return c0 + ChunkWidth, c0 + ChunkWidth
+		}
+		return c0, c0 + ChunkWidth - 1
+	}
+	for dx := -1; dx <= 1; dx++ {
+		for dz := -1; dz <= 1; dz++ {
+			if dx == 0 && dz == 0 {
+				continue
+			}
+			nb, ok := w.PeekChunk(Vec3{s.id.X + dx, 0, s.id.Z + dz})
+			if !ok {
+				continue
+			}
+			s.loaded[(dx+1)*3+dz+1] = true
+			minX, maxX := span(dx, x0)
+			minZ, maxZ := span(dz, z0)
+			nb.copyRect(s.border, minX, minZ, maxX, maxZ)
+		}
+	}
+	return s
+}
+
+// collidePad is the distance Collide keeps the camera from the obstacles
+// around the head and foot blocks.
+const collidePad = 0.25
+
+// PlayerBox returns the box Collide keeps out of the obstacles for a camera
+// at pos, from the foot block to above the head.
+func PlayerBox(pos mgl32.Vec3) geom.AABB {
+	return geom.AABB{
+		Min: pos.Sub(mgl32.Vec3{collidePad, 1 + collidePad, collidePad}),
+		Max: pos.Add(mgl32.Vec3{collidePad, collidePad, collidePad}),
+	}
+}
+
+func (w *World) Collide(pos mgl32.Vec3) (mgl32.Vec3, bool) {
+	x, y, z := pos.X(), pos.Y(), pos.Z()
+	nx, ny, nz := geom.Round(pos.X()), geom.Round(pos.Y()), geom.Round(pos.Z())
+	const pad = collidePad
+
+	head := Vec3{int(nx), int(ny), int(nz)}
+	foot := head.Down()
+
+	stop := false
+	for _, b := range []Vec3{foot, head} {
+		if IsObstacle(w.Block(b.Left())) && x < nx && nx-x > pad {
+			x = nx - pad
+		}
+		if IsObstacle(w.Block(b.Right())) && x > nx && x-nx > pad {
+			x = nx + pad
+		}
+		if IsObstacle(w.Block(b.Down())) && y < ny && ny-y > pad {
+			y = ny - pad
+			stop = true
+		}
+		if IsObstacle(w.Block(b.Up())) && y > ny && y-ny > pad {
+			y = ny + pad
+			stop = true
+		}
+		if IsObstacle(w.Block(b.Back())) && z < nz && nz-z > pad {
+			z = nz - pad
+		}
+		if IsObstacle(w.Block(b.Front())) && z > nz && z-nz > pad {
+			z = nz + pad
+		}
+	}
+	return mgl32.Vec3{x, y, z}, stop
+}
+
+// reach and step of the rays of HitTest
+const (
+	rayLength = float32(8.0)
+	rayStep   = float32(0.125)
+)
+
+func (w *World) HitTest(pos mgl32.Vec3, vec mgl32.Vec3) (*Vec3, *Vec3) {
+	var (
+		maxLen = rayLength
+		step   = rayStep
+
+		block, prev Vec3
+		pprev       *Vec3
+	)
+
+	for len := float32(0); len < maxLen; len += step {
+		block = NearBlock(pos.Add(vec.Mul(len)))
+		if prev != block && w.HasBlock(block) {
+			return &block, pprev
+		}
+		prev = block
+		pprev = &prev
+	}
+	return nil, nil
+}
+
+// RayPath returns the blocks HitTest steps through from pos along vec, the
+// last one is the block hit if any.
+func (w *World) RayPath(pos mgl32.Vec3, vec mgl32.Vec3) []Vec3 {
+	var path []Vec3
+	for d := float32(0); d < rayLength; d += rayStep {
+		block := NearBlock(pos.Add(vec.Mul(d)))
+		if len(path) != 0 && path[len(path)-1] == block {
+			continue
+		}
+		path = append(path, block)
+		if w.HasBlock(block) {
+			break
+		}
+	}
+	return path
+}
+
+func (w *World) Block(id Vec3) int {
+	chunk := w.BlockChunk(id)
+	if chunk == nil {
+		return -1
+	}
+	return chunk.Block(id)
+}
+
+func (w *World) BlockChunk(block Vec3) *Chunk {
+	cid := block.Chunkid()
+	chunk, ok := w.loadChunk(cid)
+	if !ok {
+		return nil
+	}
+	return chunk
+}
+
+func (w *World) UpdateBlock(id Vec3, tp int) {
+	chunk := w.BlockChunk(id)
+	if chunk != nil {
+		chunk.edit(id, tp)
+	}
+	w.source.UpdateBlock(id, tp)
+}
+
+func (w *World) HasBlock(id Vec3) bool {
+	tp := w.Block(id)
+	return tp != -1 && tp != 0
+}
+
+// Chunk returns the chunk id, a chunk not loaded yet is generated and
+// returned at once, the store and server changes are applied later by the
+// load pipeline. The pipeline queues are bounded, Chunk blocks while they
+// are full instead of piling up chunks.
+func (w *World) Chunk(id Vec3) *Chunk {
+	p, ok := w.loadChunk(id)
+	if ok {
+		return p
+	}
+	w.mutex.Lock()
+	if p, ok := w.loadChunk(id); ok {
+		w.mutex.Unlock()
+		return p
+	}
+	if call, ok := w.generating[id]; ok {
+		w.mutex.Unlock()
+		<-call.done
+		return call.chunk
+	}
+	call := &chunkCall{done: make(chan struct{})}
+	w.generating[id] = call
+	w.mutex.Unlock()
+
+	w.genSem <- struct{}{}
+	chunk := NewChunk(id)
+	blocks := w.generate(id)
+	for block, tp := range blocks {
+		chunk.add(block, tp)
+	}
+	<-w.genSem
+	ctx, cancel := context.WithCancel(context.Background())
+	w.loadMutex.Lock()
+	prev, loading := w.loading[id]
+	w.loading[id] = loadCall{chunk, cancel}
+	w.loadMutex.Unlock()
+	// the chunk is in the cache before leaving the generating map, so
+	// callers find it in one or the other
+	cached := w.storeChunk(id, chunk)
+	if cached != chunk {
+		// not expected, the callers get the cached one
+		log.Printf("chunk %v generated twice, keeping the cached one", id)
+		cancel()
+		w.loadMutex.Lock()
+		if call, ok := w.loading[id]; ok && call.chunk == chunk {
+			delete(w.loading, id)
+			if loading {
+				w.loading[id] = prev
+			}
+		}
+		w.loadMutex.Unlock()
+	}
+	w.mutex.Lock()
+	delete(w.generating, id)
+	w.mutex.Unlock()
+	call.chunk = cached
+	close(call.done)
+	if cached != chunk {
+		return cached
+	}
+
+	select {
+	case w.storeq <- loadJob{ctx, chunk, chunk.Version()}:
+	case <-w.done:
+	}
+	return chunk
+}
+
+// Cancel stops loading chunk id if it's still in the load pipeline, the
+// chunk is dropped from the cache and loaded again from scratch by the next
+// Chunk call. Used for the chunks that left the view before they loaded.
+func (w *World) Cancel(id Vec3) {
+	w.loadMutex.Lock()
+	call, ok := w.loading[id]
+	w.loadMutex.Unlock()
+	if ok {
+		call.cancel()
+	}
+}
+
+// loadDone leaves the pipeline, it reports false and drops the chunk if the
+// load was canceled, waking up its Done waiters.
+func (w *World) loadDone(job loadJob) bool {
+	id := job.chunk.Id()
+	w.loadMutex.Lock()
+	if call, ok := w.loading[id]; ok && call.chunk == job.chunk {
+		delete(w.loading, id)
+	}
+	w.loadMutex.Unlock()
+	if job.ctx.Err() == nil {
+		return true
+	}
+	if chunk, ok := w.PeekChunk(id); ok && chunk == job.chunk {
+		w.chunks.Remove(id)
+	}
+	job.chunk.endLoad()
+	return false
+}
+
+// storeLoop applies the changes saved in the store to the generated chunks.
+func (w *World) storeLoop() {
+	defer recoverPanic()
+	for {
+		var job loadJob
+		select {
+		case job = <-w.storeq:
+		case <-w.done:
+			return
+		}
+		if job.ctx.Err() != nil {
+			w.loadDone(job)
+			continue
+		}
+		err := w.source.RangeBlocks(job.chunk.Id(), func(bid Vec3, w int) {
+			job.chunk.load(bid, w)
+		})
+		if err != nil {
+			log.Printf("fetch chunk(%v) from db error:%s", job.chunk.Id(), err)
+		}
+		select {
+		case w.syncq <- job:
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// syncLoop applies the server changes to the chunks loaded from the store.
+func (w *World) syncLoop() {
+	defer recoverPanic()
+	for {
+		var job loadJob
+		select {
+		case job = <-w.syncq:
+		case <-w.done:
+			return
+		}
+		if job.ctx.Err() == nil {
+			w.fetchChunk(job.chunk)
+		}
+		if !w.loadDone(job) {
+			continue
+		}
+		job.chunk.finishLoad()
+		if w.onLoaded != nil {
+			w.onLoaded(job.chunk, job.chunk.Version() != job.version)
+		}
+	}
+}
+
+// fetchChunk applies the blocks changed on the server to chunk, a chunk
+// failing to fetch is remembered for RetryFetches.
+func (w *World) fetchChunk(chunk *Chunk) error {
+	id := chunk.Id()
+	err := w.source.FetchChunk(id, func(bid Vec3, tp int) {
+		if chunk.load(bid, tp) {
+			w.source.UpdateBlock(bid, tp)
+		}
+	})
+	w.mutex.Lock()
+	if err != nil {
+		w.unsynced[id] = true
+	} else {
+		delete(w.unsynced, id)
+	}
+	w.mutex.Unlock()
+	if err != nil {
+		log.Printf("fetch chunk(%v) error:%s", id, err)
+	}
+	return err
+}
+
+// Resync fetches the server changes of all loaded chunks, used after reconnecting.
+func (w *World) Resync() []Vec3 {
+	var ids []Vec3
+	for _, key := range w.chunks.Keys() {
+		chunk, ok := w.loadChunk(key.(Vec3))
+		if !ok {
+			continue
+		}
+		w.fetchChunk(chunk)
+		ids = append(ids, chunk.Id())
+	}
+	return ids
+}
+
+// RetryFetches fetches again the cached chunks that failed to fetch and
+// returns the ones fetched, the others are kept for the next retry.
+func (w *World) RetryFetches() []Vec3 {
+	w.mutex.Lock()
+	var ids []Vec3
+	for id := range w.unsynced {
+		ids = append(ids, id)
+	}
+	w.mutex.Unlock()
+
+	var fetched []Vec3
+	for _, id := range ids {
+		chunk, ok := w.PeekChunk(id)
+		if !ok {
+			w.mutex.Lock()
+			delete(w.unsynced, id)
+			w.mutex.Unlock()
+			continue
+		}
+		if !chunk.Loaded() {
+			// fetched by the load pipeline
+			continue
+		}
+		if w.fetchChunk(chunk) == nil {
+			fetched = append(fetched, id)
+		}
+	}
+	return fetched
+}
+
+// LoadedChunks returns the chunks in the cache without touching the LRU order.
+func (w *World) LoadedChunks() []*Chunk {
+	var chunks []*Chunk
+	for _, key := range w.chunks.Keys() {
+		if chunk, ok := w.chunks.Peek(key); ok {
+			chunks = append(chunks, chunk.(*Chunk))
+		}
+	}
+	return chunks
+}
+
+// Stats are the sizes of the chunk cache and of the load pipeline.
+type Stats struct {
+	Chunks     int // cached
+	Generating int
+	Loading    int // in the load pipeline
+	StoreQueue int // waiting for the saved changes
+	SyncQueue  int // waiting for the server changes
+	SaveQueue  int // evicted, waiting to be saved
+	Unsynced   int // failed to fetch the server changes
+}
+
+func (w *World) Stats() Stats {
+	w.mutex.Lock()
+	generating := len(w.generating)
+	unsynced := len(w.unsynced)
+	w.mutex.Unlock()
+	w.loadMutex.Lock()
+	loading := len(w.loading)
+	w.loadMutex.Unlock()
+	return Stats{
+		Chunks:     w.chunks.Len(),
+		Generating: generating,
+		Loading:    loading,
+		StoreQueue: len(w.storeq),
+		SyncQueue:  len(w.syncq),
+		SaveQueue:  len(w.saveq),
+		Unsynced:   unsynced,
+	}
+}
+
+func (w *World) Chunks(ids []Vec3) []*Chunk {
+	ch := make(chan *Chunk)
+	var chunks []*Chunk
+	for _, id := range ids {
+		id := id
+		go func() {
+			defer recoverPanic()
+			ch <- w.Chunk(id)
+		}()
+	}
+	for range ids {
+		chunk := <-ch
+		if chunk != nil {
+			chunks = append(chunks, chunk)
+		}
+	}
+	return chunks
+}
@@ -0,0 +1,254 @@
+package world
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// testSource is an in memory Source and ChunkStore counting the chunks
+// generated, each generation asks LoadChunk first.
+type testSource struct {
+	mutex   sync.Mutex
+	blocks  map[Vec3]int
+	fetched map[Vec3]int // the server changes
+	saved   map[Vec3]map[Vec3]int
+	loads   map[Vec3]int
+	// RangeBlocks waits for gate when not nil
+	gate chan struct{}
+}
+
+func newTestSource() *testSource {
+	return &testSource{
+		blocks:  make(map[Vec3]int),
+		fetched: make(map[Vec3]int),
+		saved:   make(map[Vec3]map[Vec3]int),
+		loads:   make(map[Vec3]int),
+	}
+}
+
+func (s *testSource) RangeBlocks(id Vec3, f func(bid Vec3, w int)) error {
+	if s.gate != nil {
+		<-s.gate
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for bid, w := range s.blocks {
+		if bid.Chunkid() == id {
+			f(bid, w)
+		}
+	}
+	return nil
+}
+
+func (s *testSource) UpdateBlock(id Vec3, w int) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.blocks[id] = w
+	return nil
+}
+
+func (s *testSource) FetchChunk(id Vec3, f func(bid Vec3, w int)) error {
+	s.mutex.Lock()
+	changes := make(map[Vec3]int)
+	for bid, w := range s.fetched {
+		if bid.Chunkid() == id {
+			changes[bid] = w
+		}
+	}
+	s.mutex.Unlock()
+	// f saves the changes with UpdateBlock
+	for bid, w := range changes {
+		f(bid, w)
+	}
+	return nil
+}
+
+func (s *testSource) SaveChunk(id Vec3, blocks map[Vec3]int) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.saved[id] = blocks
+	return nil
+}
+
+func (s *testSource) LoadChunk(id Vec3) (map[Vec3]int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.loads[id]++
+	return s.saved[id], nil
+}
+
+func (s *testSource) generated(id Vec3) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.loads[id]
+}
+
+func TestChunkConcurrent(t *testing.T) {
+	src := newTestSource()
+	w := New(16, src, nil)
+	defer w.Close()
+
+	const callers = 32
+	id := Vec3{3, 0, -2}
+	var (
+		wg     sync.WaitGroup
+		start  = make(chan struct{})
+		chunks = make([]*Chunk, callers)
+	)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			chunks[i] = w.Chunk(id)
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	if n := src.generated(id); n != 1 {
+		t.Errorf("chunk generated %d times, want 1", n)
+	}
+	for i, c := range chunks {
+		if c != chunks[0] {
+			t.Fatalf("caller %d got another chunk instance", i)
+		}
+	}
+	if c, ok := w.PeekChunk(id); !ok || c != chunks[0] {
+		t.Errorf("the cached chunk isn't the one returned")
+	}
+}
+
+func TestNewLoadsSourceChanges(t *testing.T) {
+	src := newTestSource()
+	id := Vec3{1, 0, 1}
+	saved := Vec3{ChunkWidth + 1, 100, ChunkWidth + 2}
+	fetched := Vec3{ChunkWidth + 3, 101, ChunkWidth + 4}
+	src.blocks[saved] = Brick
+	src.fetched[fetched] = Glass
+	type load struct {
+		chunk   *Chunk
+		changed bool
+	}
+	loaded := make(chan load, 1)
+	w := New(16, src, func(chunk *Chunk, changed bool) {
+		loaded <- load{chunk, changed}
+	})
+	defer w.Close()
+
+	chunk := w.Chunk(id)
+	l := <-loaded
+	if l.chunk != chunk || !l.changed {
+		t.Errorf("onLoaded(%v, %v), want the chunk changed", l.chunk.Id(), l.changed)
+	}
+	select {
+	case <-chunk.Done():
+	default:
+		t.Error("Done not closed after onLoaded")
+	}
+	if !chunk.Loaded() {
+		t.Error("chunk not loaded after onLoaded")
+	}
+	if got := w.Block(saved); got != Brick {
+		t.Errorf("saved block = %d, want %d", got, Brick)
+	}
+	if got := w.Block(fetched); got != Glass {
+		t.Errorf("fetched block = %d, want %d", got, Glass)
+	}
+	// the server changes are saved by the world
+	src.mutex.Lock()
+	got := src.blocks[fetched]
+	src.mutex.Unlock()
+	if got != Glass {
+		t.Errorf("fetched block saved as %d, want %d", got, Glass)
+	}
+
+	w.UpdateBlock(saved, 0)
+	if w.HasBlock(saved) {
+		t.Error("block still there after UpdateBlock")
+	}
+	src.mutex.Lock()
+	got, ok := src.blocks[saved]
+	src.mutex.Unlock()
+	if !ok || got != 0 {
+		t.Errorf("removed block saved as %d, %v, want 0", got, ok)
+	}
+}
+
+func TestChunkStoreSavesEvicted(t *testing.T) {
+	src := newTestSource()
+	loaded := make(chan *Chunk, 2)
+	w := New(1, src, func(chunk *Chunk, changed bool) {
+		loaded <- chunk
+	})
+	defer w.Close()
+
+	a, b := Vec3{0, 0, 0}, Vec3{5, 0, 5}
+	w.Chunk(a)
+	<-loaded
+	w.UpdateBlock(Vec3{1, 120, 1}, Brick)
+	// a is pushed out of the cache holding one chunk
+	w.Chunk(b)
+	<-loaded
+	if _, ok := w.PeekChunk(a); ok {
+		t.Fatal("chunk not evicted")
+	}
+	for i := 0; ; i++ {
+		src.mutex.Lock()
+		blocks := src.saved[a]
+		src.mutex.Unlock()
+		if blocks != nil {
+			if blocks[Vec3{1, 120, 1}] != Brick {
+				t.Error("the edit isn't in the saved chunk")
+			}
+			break
+		}
+		if i == 1000 {
+			t.Fatal("evicted chunk not saved")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// loaded back from the store instead of generated
+	chunk := w.Chunk(a)
+	if got := chunk.Block(Vec3{1, 120, 1}); got != Brick {
+		t.Errorf("block of the chunk loaded back = %d, want %d", got, Brick)
+	}
+}
+
+func TestCancelWakesWaiters(t *testing.T) {
+	src := newTestSource()
+	src.gate = make(chan struct{})
+	w := New(16, src, nil)
+	defer w.Close()
+
+	id := Vec3{2, 0, 2}
+	chunk := w.Chunk(id)
+	w.Cancel(id)
+	close(src.gate)
+	select {
+	case <-chunk.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Done not closed after Cancel")
+	}
+	if chunk.Loaded() {
+		t.Error("canceled chunk reported loaded")
+	}
+	if _, ok := w.PeekChunk(id); ok {
+		t.Error("canceled chunk still cached")
+	}
+	// asked again, a new chunk is loaded
+	again := w.Chunk(id)
+	if again == chunk {
+		t.Fatal("got the canceled chunk back")
+	}
+	select {
+	case <-again.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("chunk asked again never loaded")
+	}
+	if !again.Loaded() {
+		t.Error("chunk asked again not loaded")
+	}
+}